@@ -10,9 +10,10 @@ import (
 	"github.com/Zhiruosama/ai_nexus/configs"
 	app "github.com/Zhiruosama/ai_nexus/internal"
 	_ "github.com/Zhiruosama/ai_nexus/internal/grpc"
-	_ "github.com/Zhiruosama/ai_nexus/internal/pkg/db"
+	"github.com/Zhiruosama/ai_nexus/internal/middleware"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/db"
 	rabbitmq "github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
-	_ "github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
 	websocket "github.com/Zhiruosama/ai_nexus/internal/pkg/ws"
 )
 
@@ -21,6 +22,11 @@ func main() {
 	port := flag.Int("p", 0, "服务端口号，不指定则使用配置文件中的端口")
 	flag.Parse()
 
+	// 依赖的外部服务在启动时检查, 任一不可用直接退出
+	db.Init()
+	rdb.Init()
+	middleware.InitJWT()
+
 	// 如果指定了端口，覆盖配置文件中的端口
 	if *port > 0 {
 		configs.GlobalConfig.Server.Port = *port
@@ -36,8 +42,16 @@ func main() {
 		log.Fatalf("[Main] Failed to wait for RabbitMQ connection: %v\n", err)
 	}
 
+	app.BootstrapAdmins()
+	app.StartOutboxRelay()
+	app.StartRetentionJanitor()
+	app.StartModelHealthMonitor()
+	app.StartPoller()
 	app.StartWorker(3, app.StartText2ImgWorker)
 	app.StartWorker(2, app.StartImg2ImgWorker)
+	app.StartWorker(1, app.StartInpaintWorker)
+	app.StartWorker(1, app.StartOutpaintWorker)
+	app.StartWorker(1, app.StartPostProcessWorker)
 	app.StartWorker(2, app.StartDeadLetterWorker)
 
 	app.Run()
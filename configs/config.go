@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/goccy/go-yaml"
@@ -21,9 +22,16 @@ type Config struct {
 	RateLimit     RateLimitConfig     `yaml:"ratelimit"`
 	Idempotency   IdempotencyConfig   `yaml:"idempotency"`
 	Deduplication DeduplicationConfig `yaml:"deduplication"`
+	Session       SessionConfig       `yaml:"session"`
 	GRPCClient    GRPCClientConfig    `yaml:"grpcclient"`
 	RabbitMQ      RabbitMQConfig      `yaml:"rabbitmq"`
 	Chat          ChatConfig          `yaml:"chat"`
+	Admin         AdminConfig         `yaml:"admin"`
+	ImageGen      ImageGenConfig      `yaml:"imagegen"`
+	Storage       StorageConfig       `yaml:"storage"`
+	Retention     RetentionConfig     `yaml:"retention"`
+	Health        HealthConfig        `yaml:"health"`
+	OAuth         OAuthConfig         `yaml:"oauth"`
 }
 
 // ServerConfig 定义主服务配置
@@ -57,7 +65,8 @@ type RateLimitConfig struct {
 
 // IdempotencyConfig 定义幂等性参数
 type IdempotencyConfig struct {
-	LockDuration time.Duration `yaml:"lockduration"`
+	LockDuration time.Duration `yaml:"lockduration"` // 首个请求处理中的锁定时长, 需覆盖流式响应耗时
+	TTL          time.Duration `yaml:"ttl"`          // 首次响应的保存时长
 }
 
 // DeduplicationConfig 重复请求判断参数
@@ -65,6 +74,14 @@ type DeduplicationConfig struct {
 	LockDuration time.Duration `yaml:"lockduration"`
 }
 
+// SessionConfig 登录会话参数
+type SessionConfig struct {
+	AccessTTL   time.Duration `yaml:"accessttl"`   // 访问令牌有效期
+	RefreshTTL  time.Duration `yaml:"refreshttl"`  // 刷新令牌有效期, 每次刷新后重新计算
+	MaxSessions int           `yaml:"maxsessions"` // 单个用户同时在线的设备数, 超出时挤掉最早登录的会话
+	TOTPIssuer  string        `yaml:"totpissuer"`  // 两步验证在验证器 App 中显示的发行方名称
+}
+
 // GRPCClientConfig 结构体用于配置gRPC连接
 type GRPCClientConfig struct {
 	ServerAddress  string        `yaml:"serveraddress"`
@@ -78,6 +95,8 @@ type RabbitMQConfig struct {
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 	VHost    string `yaml:"vhost"`
+
+	RecreateQueues bool `yaml:"recreatequeues"` // 已存在的队列参数与代码不一致时, 删除空队列后按新参数重建
 }
 
 // SerialString 返回服务信息的序列化字符串
@@ -106,7 +125,93 @@ type ChatConfig struct {
 	MaxMessagesPerConv int    `yaml:"maxmessagesperconv"`
 }
 
+// AdminConfig 定义管理员相关配置
+type AdminConfig struct {
+	BootstrapEmails []string `yaml:"bootstrapemails"` // 启动时提升为 admin 角色的用户邮箱, 用于创建第一个管理员
+}
+
+// ImageGenConfig 定义生图任务调度相关配置
+type ImageGenConfig struct {
+	MaxInFlightPerUser int      `yaml:"maxinflightperuser"` // 每个用户同时未完成的任务上限
+	HighPriorityTiers  []string `yaml:"highprioritytiers"`  // 可以提交 high 优先级任务的用户等级, admin 角色不受限制
+	RetryBaseDelay     int      `yaml:"retrybasedelay"`     // 首次重试前的等待秒数, 之后指数增长
+	RetryMaxDelay      int      `yaml:"retrymaxdelay"`      // 重试等待秒数上限
+
+	WatermarkPath    string  `yaml:"watermarkpath"`    // 后处理水印图片路径, 为空时不接受水印请求
+	WatermarkOpacity float64 `yaml:"watermarkopacity"` // 水印不透明度 0 ~ 1
+	MaxProcessedSize int     `yaml:"maxprocessedsize"` // 后处理输出的最大边长
+}
+
+// StorageConfig 定义文件存储配置
+type StorageConfig struct {
+	Driver       string        `yaml:"driver"`       // local 或 s3, 为空时使用本地 static 目录
+	SigningKey   string        `yaml:"signingkey"`   // 私有图片签名地址的 HMAC 密钥, 多实例部署需保持一致; 为空时由 chat.encryptionkey 派生, 两者都为空时拒绝启动
+	SignedURLTTL time.Duration `yaml:"signedurlttl"` // 接口返回的签名地址有效期
+	S3           S3Config      `yaml:"s3"`
+}
+
+// S3Config 定义 S3 兼容对象存储配置
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`  // 服务地址, 如 http://127.0.0.1:9000
+	Region    string `yaml:"region"`    // 签名使用的区域
+	Bucket    string `yaml:"bucket"`    // 存储桶
+	AccessKey string `yaml:"accesskey"` // 访问密钥 ID
+	SecretKey string `yaml:"secretkey"` // 访问密钥
+	PathStyle bool   `yaml:"pathstyle"` // 使用路径风格访问, MinIO 需开启
+	PublicURL string `yaml:"publicurl"` // 对外访问的基础地址, 为空时使用 endpoint 拼接的对象地址
+}
+
+// RetentionConfig 定义图片保留策略与存储清理配置
+type RetentionConfig struct {
+	Enabled        bool                     `yaml:"enabled"`
+	DryRun         bool                     `yaml:"dryrun"`         // 只记录将要删除的文件, 不删除也不修改数据库
+	Interval       time.Duration            `yaml:"interval"`       // 清理周期
+	BatchSize      int                      `yaml:"batchsize"`      // 每轮每类最多处理的任务或文件数
+	Default        time.Duration            `yaml:"default"`        // 未单独配置等级的保留时长, 0 表示永久保留
+	Tiers          map[string]time.Duration `yaml:"tiers"`          // 按用户等级配置的保留时长, 0 表示永久保留
+	InputRetention time.Duration            `yaml:"inputretention"` // 任务结束后上传原图与蒙版的保留时长
+	OrphanGrace    time.Duration            `yaml:"orphangrace"`    // 无任务引用的文件超过该时长才会删除, 避免误删刚上传的文件
+}
+
+// HealthConfig 定义模型健康检查配置, 成功率或 p95 耗时不达标的模型自动停用并定期探测恢复
+type HealthConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Interval       time.Duration `yaml:"interval"`       // 健康评估周期
+	Window         time.Duration `yaml:"window"`         // 统计窗口
+	MinSamples     int           `yaml:"minsamples"`     // 窗口内样本数达到该值才会评估, 避免少量失败误判
+	MinSuccessRate float64       `yaml:"minsuccessrate"` // 成功率低于该百分比时停用
+	MaxP95         time.Duration `yaml:"maxp95"`         // p95 生成耗时超过该值时停用, 0 表示不检查
+	ProbeInterval  time.Duration `yaml:"probeinterval"`  // 自动停用的模型探测间隔
+	ProbeTimeout   time.Duration `yaml:"probetimeout"`   // 单次探测的超时时间
+	ProbePrompt    string        `yaml:"probeprompt"`    // 探测使用的提示词
+	ProbeImageURL  string        `yaml:"probeimageurl"`  // 图生图模型探测使用的原图地址, 为空时不探测图生图模型
+	EventRetention time.Duration `yaml:"eventretention"` // 调用记录的保留时长
+	NotifyUsers    []string      `yaml:"notifyusers"`    // 除 admin 角色外, 模型停用与恢复时额外通过 WebSocket 通知的用户 UUID
+}
+
+// OAuthConfig 定义第三方登录配置
+type OAuthConfig struct {
+	StateTTL  time.Duration                  `yaml:"statettl"`  // 发起授权到回调完成的时限
+	Providers map[string]OAuthProviderConfig `yaml:"providers"` // 键为 provider 名称, 未配置 clientid 的 provider 不启用
+}
+
+// OAuthProviderConfig 定义单个第三方登录提供方, 均使用授权码模式 + PKCE
+type OAuthProviderConfig struct {
+	Type         string   `yaml:"type"`         // github 或 oidc, Google 与公司账号均按 oidc 接入
+	ClientID     string   `yaml:"clientid"`     // 在提供方后台登记的应用 ID
+	ClientSecret string   `yaml:"clientsecret"` // 应用密钥
+	RedirectURL  string   `yaml:"redirecturl"`  // 授权后回跳的前端地址, 需与提供方后台登记的一致
+	Scopes       []string `yaml:"scopes"`       // 为空时 github 使用 read:user user:email, oidc 使用 openid email profile
+	Issuer       string   `yaml:"issuer"`       // oidc 签发方, 通过 {issuer}/.well-known/openid-configuration 发现端点
+	BaseURL      string   `yaml:"baseurl"`      // github 授权地址, 为空时使用 https://github.com
+	APIURL       string   `yaml:"apiurl"`       // github API 地址, 为空时使用 https://api.github.com
+}
+
 func init() {
+	if err := chdirProjectRoot(); err != nil {
+		panic(fmt.Sprintf("[ERROR] Failed to locate project root: %s\n", err.Error()))
+	}
+
 	var err error
 	GlobalConfig, err = loadConfig("configs/config.yaml")
 
@@ -116,6 +221,28 @@ func init() {
 	log.Println("[Config] Config loaded successfully")
 }
 
+// chdirProjectRoot 工作目录下没有配置文件时逐级向上查找项目根目录并切换过去
+// go test 在包目录下运行, 切换后配置文件、lua 脚本与违禁词表等相对路径同样可用
+func chdirProjectRoot() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	for {
+		if _, err = os.Stat(filepath.Join(dir, "configs", "config.yaml")); err == nil {
+			return os.Chdir(dir)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			// 找不到时保持原工作目录, 由 loadConfig 报告具体错误
+			return nil
+		}
+		dir = parent
+	}
+}
+
 func loadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
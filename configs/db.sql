@@ -14,16 +14,71 @@ CREATE TABLE IF NOT EXISTS `users` (
   `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
   `uuid` CHAR(36) NOT NULL UNIQUE COMMENT '每个用户自带的唯一id',
   `nickname` VARCHAR(64) NOT NULL UNIQUE COMMENT '用户昵称',
-  `avatar` VARCHAR(64) NOT NULL COMMENT '用户头像',
+  `avatar` VARCHAR(512) NOT NULL COMMENT '用户头像地址, 使用 S3 存储时为完整 URL',
   `email` VARCHAR(255) NOT NULL UNIQUE COMMENT '用户邮箱',
   `password_hash` VARCHAR(255) NOT NULL COMMENT 'Argon2id加密密码',
+  `tier` VARCHAR(16) NOT NULL DEFAULT 'free' COMMENT '用户等级, 决定生成图片的保留时长',
+  `role` VARCHAR(32) NOT NULL DEFAULT 'user' COMMENT '用户角色, 关联 roles.name',
   `last_login` DATETIME DEFAULT NULL COMMENT '上次登录的时间',
   `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '账号创建时间',
   `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '信息更新时间, 如修改密码等',
 
-  PRIMARY KEY (`id`)
+  PRIMARY KEY (`id`),
+  KEY `idx_role` (`role`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 
+CREATE TABLE IF NOT EXISTS `roles` (
+  `name` VARCHAR(32) NOT NULL COMMENT '角色名',
+  `description` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '角色描述',
+  `permissions` JSON COMMENT '授予的权限: ["model:manage", "dead_letter:manage"], 内置角色不使用',
+  `is_builtin` BOOLEAN NOT NULL DEFAULT FALSE COMMENT '是否为内置角色, 内置角色不可修改与删除',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+  PRIMARY KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户角色, admin 可访问全部管理接口, 自定义角色按权限访问';
+
+INSERT IGNORE INTO `roles` (`name`, `description`, `permissions`, `is_builtin`) VALUES
+  ('user', '普通用户', JSON_ARRAY(), TRUE),
+  ('admin', '管理员', JSON_ARRAY(), TRUE);
+
+CREATE TABLE IF NOT EXISTS `user_totp` (
+  `user_uuid` CHAR(36) NOT NULL COMMENT '用户UUID, 关联 users.uuid',
+  `secret_enc` VARBINARY(512) NOT NULL COMMENT 'AES-GCM 加密后的 TOTP 密钥',
+  `enabled` BOOLEAN NOT NULL DEFAULT FALSE COMMENT '是否已通过验证码确认启用',
+  `last_used_step` BIGINT NOT NULL DEFAULT 0 COMMENT '最近一次使用的时间步, 同一验证码不能重复使用',
+  `enabled_at` DATETIME DEFAULT NULL COMMENT '启用时间',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+  PRIMARY KEY (`user_uuid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户 TOTP 两步验证';
+
+CREATE TABLE IF NOT EXISTS `user_recovery_codes` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `user_uuid` CHAR(36) NOT NULL COMMENT '用户UUID, 关联 users.uuid',
+  `code_hash` CHAR(64) NOT NULL COMMENT '恢复码 SHA-256 摘要',
+  `used_at` DATETIME DEFAULT NULL COMMENT '使用时间, 为空表示未使用',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '生成时间',
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_user_code` (`user_uuid`, `code_hash`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='两步验证恢复码, 每个只能使用一次';
+
+CREATE TABLE IF NOT EXISTS `user_identities` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
+  `user_uuid` CHAR(36) NOT NULL COMMENT '用户UUID, 关联 users.uuid',
+  `provider` VARCHAR(32) NOT NULL COMMENT '第三方登录提供方, 对应 oauth.providers 中的名称',
+  `subject` VARCHAR(255) NOT NULL COMMENT '提供方内唯一且不变的账号 ID',
+  `email` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '最近一次登录时提供方返回的邮箱',
+  `last_login_at` DATETIME DEFAULT NULL COMMENT '最近一次通过该账号登录的时间',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '绑定时间',
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_provider_subject` (`provider`, `subject`),
+  UNIQUE KEY `uk_user_provider` (`user_uuid`, `provider`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='用户绑定的第三方账号, 每个提供方最多绑定一个';
+
 CREATE TABLE IF NOT EXISTS `user_verification_codes` (
   `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增主键',
   `email` VARCHAR(255) NOT NULL COMMENT '用户邮箱',
@@ -41,11 +96,13 @@ CREATE TABLE IF NOT EXISTS `image_generation_tasks` (
   `user_uuid` CHAR(36) NOT NULL COMMENT '用户UUID, 关联 users.uuid',
 
   -- 任务基本信息
-  `task_type` TINYINT UNSIGNED NOT NULL COMMENT '任务类型: 1-文生图, 2-图生图',
+  `task_type` TINYINT UNSIGNED NOT NULL COMMENT '任务类型: 1-文生图, 2-图生图, 3-局部重绘, 4-扩图',
   `status` TINYINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '任务状态: 0-待处理, 1-队列中, 2-处理中, 3-已完成, 4-失败, 5-已取消',
+  `priority` TINYINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '队列优先级 0-9, 越大越先处理',
 
   -- 输入参数
   `prompt` TEXT NOT NULL COMMENT '正向提示词',
+  `original_prompt` TEXT COMMENT '开启提示词扩写时用户输入的原始提示词, prompt 为扩写后实际提交的提示词',
   `negative_prompt` TEXT COMMENT '负向提示词',
   `model_id` VARCHAR(64) NOT NULL COMMENT '模型ID,关联 generation_models.model_id',
   `width` INT UNSIGNED DEFAULT 512 COMMENT '图片宽度(像素)',
@@ -53,19 +110,43 @@ CREATE TABLE IF NOT EXISTS `image_generation_tasks` (
   `num_inference_steps` INT UNSIGNED DEFAULT 20 COMMENT '推理步数(20-50)',
   `guidance_scale` DECIMAL(4,2) DEFAULT 7.5 COMMENT 'CFG Scale(1.0-20.0)',
   `seed` BIGINT COMMENT '随机种子 (用户指定或自动生成)',
+  `num_images` TINYINT UNSIGNED DEFAULT 1 COMMENT '单次生成图片数量',
+  `credential_id` BIGINT UNSIGNED DEFAULT NULL COMMENT '用户自带的生图凭证ID, 为空时使用模型凭证',
+  `sampler` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '采样器, 为空时使用上游默认',
 
   -- 图生图专用参数
-  `input_image_url` VARCHAR(512) COMMENT '输入图片URL (仅图生图)',
-  `strength` DECIMAL(3,2) DEFAULT 0.75 COMMENT '强度 0.00-1.00 (仅图生图)',
+  `input_image_url` VARCHAR(512) COMMENT '输入图片URL (图生图/局部重绘/扩图, 扩图为已扩展的画布)',
+  `strength` DECIMAL(3,2) DEFAULT 0.75 COMMENT '强度 0.00-1.00 (图生图/局部重绘)',
+
+  -- 局部重绘/扩图专用参数
+  `mask_image_url` VARCHAR(512) NOT NULL DEFAULT '' COMMENT '蒙版图片URL, 白色区域重绘',
+  `extend_left` SMALLINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '扩图时画布向左扩展的像素',
+  `extend_right` SMALLINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '扩图时画布向右扩展的像素',
+  `extend_top` SMALLINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '扩图时画布向上扩展的像素',
+  `extend_bottom` SMALLINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '扩图时画布向下扩展的像素',
+
+  -- 上游任务
+  `upstream_task_id` VARCHAR(128) NOT NULL DEFAULT '' COMMENT '上游平台任务ID, 用于异步轮询与重启恢复',
+  `poller_instance` VARCHAR(128) NOT NULL DEFAULT '' COMMENT '跟踪该上游任务的 Poller 实例',
+  `poller_lease_until` DATETIME(3) COMMENT 'Poller 租约到期时间, 过期后其他实例可接管',
+
+  -- 后处理
+  `post_process` VARCHAR(512) NOT NULL DEFAULT '' COMMENT '后处理配置 JSON, 为空表示不做后处理',
+  `post_status` TINYINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '后处理状态: 0-无, 1-队列中, 2-处理中, 3-已完成, 4-失败',
+  `post_error` VARCHAR(512) NOT NULL DEFAULT '' COMMENT '后处理失败原因',
+
+  -- 访问控制
+  `is_public` BOOLEAN NOT NULL DEFAULT FALSE COMMENT '是否公开, 公开后输出图片无需签名即可访问',
 
   -- 输出结果
-  `output_image_url` VARCHAR(512) COMMENT '生成的图片URL',
+  `output_image_url` VARCHAR(512) COMMENT '生成的首张图片URL, 全部结果见 image_generation_outputs',
   `actual_seed` BIGINT COMMENT '实际使用的种子值',
 
   -- 错误处理
   `error_message` TEXT COMMENT '错误详情',
   `retry_count` TINYINT UNSIGNED DEFAULT 0 COMMENT '已重试次数',
   `max_retry` TINYINT UNSIGNED DEFAULT 3 COMMENT '最大重试次数',
+  `next_retry_at` DATETIME COMMENT '下次重试时间, 指数退避计算',
 
   -- 性能指标
   `generation_time_ms` INT UNSIGNED COMMENT '生成耗时(毫秒)',
@@ -75,6 +156,7 @@ CREATE TABLE IF NOT EXISTS `image_generation_tasks` (
   `queued_at` DATETIME COMMENT '进入队列时间',
   `started_at` DATETIME COMMENT '开始处理时间',
   `completed_at` DATETIME COMMENT '完成时间',
+  `purged_at` DATETIME COMMENT '图片超过保留期限被清理的时间',
   `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
 
   PRIMARY KEY (`id`),
@@ -91,8 +173,8 @@ CREATE TABLE IF NOT EXISTS `image_generation_models` (
 
   -- 基本信息
   `model_name` VARCHAR(128) NOT NULL COMMENT '模型显示名称',
-  `model_type` VARCHAR(32) NOT NULL COMMENT '类型: text2img/img2img',
-  `provider` VARCHAR(32) DEFAULT 'modelscope' COMMENT '提供商: modelscope',
+  `model_type` VARCHAR(32) NOT NULL COMMENT '类型: text2img/img2img/inpaint/outpaint',
+  `provider` VARCHAR(32) DEFAULT 'modelscope' COMMENT '提供商: modelscope / openai / sdwebui / fake',
 
   -- 显示与排序
   `description` TEXT COMMENT '模型描述',
@@ -108,9 +190,16 @@ CREATE TABLE IF NOT EXISTS `image_generation_models` (
   `is_active` BOOLEAN DEFAULT TRUE COMMENT '是否启用',
   `is_recommended` BOOLEAN DEFAULT FALSE COMMENT '是否推荐',
 
+  -- 健康检查
+  `auto_disabled_at` DATETIME DEFAULT NULL COMMENT '健康检查自动停用的时间, 为空表示未被自动停用',
+  `disabled_reason` VARCHAR(255) NOT NULL DEFAULT '' COMMENT '自动停用原因',
+  `last_probe_at` DATETIME DEFAULT NULL COMMENT '最近一次探测时间',
+  `health_reset_at` DATETIME DEFAULT NULL COMMENT '重新启用的时间, 健康统计只计算此后的调用',
+
   -- 第三方平台相关
   `third_party_model_id` VARCHAR(128) NOT NULL COMMENT '第三方平台模型ID',
   `base_url` VARCHAR(512) COMMENT 'API调用地址',
+  `credential_id` BIGINT UNSIGNED DEFAULT NULL COMMENT '平台生图凭证ID, 为空时回退到 <PROVIDER>_API_KEY 环境变量',
 
   -- 能力参数
   `default_width` INT UNSIGNED DEFAULT 512 COMMENT '默认宽度',
@@ -119,6 +208,8 @@ CREATE TABLE IF NOT EXISTS `image_generation_models` (
   `max_height` INT UNSIGNED DEFAULT 1024 COMMENT '最大高度',
   `min_steps` INT UNSIGNED DEFAULT 10 COMMENT '最小推理步数',
   `max_steps` INT UNSIGNED DEFAULT 100 COMMENT '最大推理步数',
+  `max_num_images` TINYINT UNSIGNED DEFAULT 1 COMMENT '单次请求最多生成图片数',
+  `capabilities` JSON COMMENT '模型能力: {"aspect_ratios": ["1:1", "16:9"], "samplers": ["Euler a"]}, 列表为空表示不限制',
 
   -- 时间戳
   `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
@@ -132,11 +223,69 @@ CREATE TABLE IF NOT EXISTS `image_generation_models` (
   KEY `idx_is_active` (`is_active`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='生图模型配置表';
 
+CREATE TABLE IF NOT EXISTS `image_generation_outputs` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `task_id` CHAR(36) NOT NULL COMMENT '任务UUID, 关联 image_generation_tasks.task_id',
+  `image_index` TINYINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '同一任务内的图片序号',
+  `image_url` VARCHAR(512) NOT NULL COMMENT '生成的图片URL',
+  `processed_url` VARCHAR(512) NOT NULL DEFAULT '' COMMENT '后处理后的图片URL, 为空表示未处理',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_task_index` (`task_id`, `image_index`),
+  KEY `idx_image_url` (`image_url`(191)),
+  KEY `idx_processed_url` (`processed_url`(191))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='生图任务输出图片表';
+
+CREATE TABLE IF NOT EXISTS `model_health_events` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `model_id` VARCHAR(64) NOT NULL COMMENT '模型ID, 关联 image_generation_models.model_id',
+  `success` BOOLEAN NOT NULL COMMENT '上游调用是否成功',
+  `generation_time_ms` INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '生成耗时(毫秒), 失败或未知时为 0',
+  `error_class` VARCHAR(32) NOT NULL DEFAULT '' COMMENT '失败分类: timeout / rate_limited / auth / bad_request / server_error / network / permanent / upstream_failed',
+  `is_probe` BOOLEAN NOT NULL DEFAULT FALSE COMMENT '是否为健康探测',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录时间',
+
+  PRIMARY KEY (`id`),
+  KEY `idx_model_created` (`model_id`, `created_at`),
+  KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='模型上游调用记录, 用于滚动窗口健康统计, 每次尝试(含重试)记录一条';
+
+CREATE TABLE IF NOT EXISTS `image_provider_credentials` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `user_uuid` CHAR(36) NOT NULL DEFAULT '' COMMENT '所属用户UUID, 为空表示平台凭证',
+  `provider` VARCHAR(32) NOT NULL COMMENT 'modelscope / openai / sdwebui / fake',
+  `name` VARCHAR(64) NOT NULL COMMENT '凭证名称',
+  `is_active` BOOLEAN DEFAULT TRUE COMMENT '是否启用',
+  `api_key_enc` VARBINARY(512) NOT NULL COMMENT 'AES-GCM 加密后的 API Key',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+  `updated_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP COMMENT '更新时间',
+
+  PRIMARY KEY (`id`),
+  KEY `idx_user_provider` (`user_uuid`, `provider`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='生图提供商凭证表';
+
+CREATE TABLE IF NOT EXISTS `task_outbox` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '自增ID',
+  `task_id` VARCHAR(64) NOT NULL COMMENT '任务ID',
+  `task_type` TINYINT UNSIGNED NOT NULL COMMENT '任务类型, 决定路由键',
+  `message` MEDIUMTEXT NOT NULL COMMENT '待投递的队列消息 JSON',
+  `attempts` INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '投递失败次数',
+  `last_error` TEXT COMMENT '最近一次投递失败原因',
+  `claim_token` VARCHAR(64) NOT NULL DEFAULT '' COMMENT '当前领取该记录的 relay 批次',
+  `available_at` DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) COMMENT '可被领取的时间, 领取后顺延作为租约',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '创建时间',
+
+  PRIMARY KEY (`id`),
+  KEY `idx_available_at` (`available_at`),
+  KEY `idx_claim_token` (`claim_token`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='任务投递 outbox, 与任务在同一事务中写入, 投递成功后删除';
+
 CREATE TABLE dead_letter_tasks (
   id BIGINT PRIMARY KEY AUTO_INCREMENT,
   user_id VARCHAR(64) NOT NULL COMMENT '用户UUID',
   task_id VARCHAR(64) NOT NULL UNIQUE COMMENT '任务ID',
-  task_type TINYINT NOT NULL COMMENT '任务类型 1:text2img 2:img2img',
+  task_type TINYINT NOT NULL COMMENT '任务类型 1:text2img 2:img2img 3:inpaint 4:outpaint',
   dead_reason TEXT COMMENT '死信原因',
   original_status TINYINT COMMENT '进入死信时的原始状态',
   created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP COMMENT '死信记录时间',
@@ -195,3 +344,41 @@ CREATE TABLE IF NOT EXISTS `chat_presets` (
 
   INDEX `idx_user_uuid` (`user_uuid`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='对话预设模板表';
+
+CREATE TABLE IF NOT EXISTS `gallery_posts` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `task_id` CHAR(36) NOT NULL COMMENT '发布的任务UUID, 关联 image_generation_tasks.task_id',
+  `user_uuid` CHAR(36) NOT NULL COMMENT '发布者UUID',
+  `title` VARCHAR(128) NOT NULL DEFAULT '' COMMENT '作品标题',
+  `like_count` INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '点赞数',
+  `favorite_count` INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '收藏数',
+  `remix_count` INT UNSIGNED NOT NULL DEFAULT 0 COMMENT '被 remix 的次数',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '发布时间',
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_task_id` (`task_id`),
+  KEY `idx_user_uuid` (`user_uuid`),
+  KEY `idx_created_at` (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='画廊作品表, 只展示仍公开的任务';
+
+CREATE TABLE IF NOT EXISTS `gallery_likes` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `post_id` BIGINT UNSIGNED NOT NULL COMMENT '作品ID',
+  `user_uuid` CHAR(36) NOT NULL COMMENT '点赞用户UUID',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '点赞时间, 用于统计时间窗口内的热度',
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_post_user` (`post_id`, `user_uuid`),
+  KEY `idx_created_post` (`created_at`, `post_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='画廊点赞表';
+
+CREATE TABLE IF NOT EXISTS `gallery_favorites` (
+  `id` BIGINT UNSIGNED NOT NULL AUTO_INCREMENT COMMENT '主键ID',
+  `post_id` BIGINT UNSIGNED NOT NULL COMMENT '作品ID',
+  `user_uuid` CHAR(36) NOT NULL COMMENT '收藏用户UUID',
+  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '收藏时间',
+
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uk_post_user` (`post_id`, `user_uuid`),
+  KEY `idx_user_created` (`user_uuid`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci COMMENT='画廊收藏表';
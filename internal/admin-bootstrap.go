@@ -0,0 +1,32 @@
+package internal
+
+import (
+	"log"
+	"strings"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	user_dao "github.com/Zhiruosama/ai_nexus/internal/dao/user"
+	"github.com/Zhiruosama/ai_nexus/internal/middleware"
+)
+
+// BootstrapAdmins 启动时把 admin.bootstrapemails 中已注册的用户提升为 admin, 用于创建第一个管理员
+// 每次启动都会执行, 被降级的用户只要仍在列表中就会重新成为 admin, 第一个管理员创建后应清空该配置
+func BootstrapAdmins() {
+	emails := make([]string, 0, len(configs.GlobalConfig.Admin.BootstrapEmails))
+	for _, email := range configs.GlobalConfig.Admin.BootstrapEmails {
+		if email = strings.TrimSpace(email); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	if len(emails) == 0 {
+		return
+	}
+
+	// 失败不影响启动, 管理接口在有 admin 之前只是不可用
+	promoted, err := (&user_dao.DAO{}).PromoteUsersByEmail(emails, middleware.RoleAdmin)
+	if err != nil {
+		log.Printf("[Admin] Bootstrap admins error: %v, check that users.role exists\n", err)
+		return
+	}
+	log.Printf("[Admin] Bootstrap admins: %d user(s) promoted, unregistered emails are promoted on the next start\n", promoted)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/Zhiruosama/ai_nexus/internal/middleware"
 	routes_chat "github.com/Zhiruosama/ai_nexus/internal/routes/chat"
 	routes_demo "github.com/Zhiruosama/ai_nexus/internal/routes/demo"
+	routes_gallery "github.com/Zhiruosama/ai_nexus/internal/routes/gallery"
 	routes_image_generation "github.com/Zhiruosama/ai_nexus/internal/routes/image-generation"
 	routes_user "github.com/Zhiruosama/ai_nexus/internal/routes/user"
 	"github.com/gin-gonic/gin"
@@ -26,14 +27,15 @@ func Run() {
 	route.Use(middleware.SecurityHeaders())
 	route.Use(middleware.CORS(middleware.DefaultCORSConfig()))
 
-	// 静态目录
-	route.Static("/static", "./static")
+	// 静态目录只公开头像, 生成图片与上传原图经 /image-generation/file 校验后访问
+	route.Static("/static/avatar", "./static/avatar")
 
 	// 注册路由
 	routes_demo.InitDemoRoutes(route)
 	routes_user.InitUserRoutes(route)
 	routes_image_generation.InitImageGenerationRoutes(route)
 	routes_chat.InitChatRoutes(route)
+	routes_gallery.InitGalleryRoutes(route)
 
 	// 启动 app
 	log.Printf("[Server] Server start on: %s:%d\n", configs.GlobalConfig.Server.Host, configs.GlobalConfig.Server.Port)
@@ -0,0 +1,239 @@
+// Package gallery 画廊控制器
+package gallery
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	gallery_dto "github.com/Zhiruosama/ai_nexus/internal/domain/dto/gallery"
+	gallery_query "github.com/Zhiruosama/ai_nexus/internal/domain/query/gallery"
+	gallery_vo "github.com/Zhiruosama/ai_nexus/internal/domain/vo/gallery"
+	gallery_service "github.com/Zhiruosama/ai_nexus/internal/service/gallery"
+	"github.com/gin-gonic/gin"
+)
+
+// Controller 画廊控制器
+type Controller struct {
+	GalleryService *gallery_service.Service
+}
+
+// NewController 创建 Controller 实例
+func NewController(s *gallery_service.Service) *Controller {
+	return &Controller{
+		GalleryService: s,
+	}
+}
+
+// Publish 发布已完成的任务到画廊
+func (c *Controller) Publish(ctx *gin.Context) {
+	var dto gallery_dto.PublishDTO
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if dto.TaskID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "task_id is required",
+		})
+		return
+	}
+
+	postID, err := c.GalleryService.Publish(ctx, &dto)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "publish success",
+		"data": gin.H{
+			"post_id": postID,
+		},
+	})
+}
+
+// Unpublish 取消发布
+func (c *Controller) Unpublish(ctx *gin.Context) {
+	c.postAction(ctx, c.GalleryService.Unpublish, "unpublish success")
+}
+
+// Like 点赞
+func (c *Controller) Like(ctx *gin.Context) {
+	c.postAction(ctx, c.GalleryService.Like, "like success")
+}
+
+// Unlike 取消点赞
+func (c *Controller) Unlike(ctx *gin.Context) {
+	c.postAction(ctx, c.GalleryService.Unlike, "unlike success")
+}
+
+// Favorite 收藏
+func (c *Controller) Favorite(ctx *gin.Context) {
+	c.postAction(ctx, c.GalleryService.Favorite, "favorite success")
+}
+
+// Unfavorite 取消收藏
+func (c *Controller) Unfavorite(ctx *gin.Context) {
+	c.postAction(ctx, c.GalleryService.Unfavorite, "unfavorite success")
+}
+
+// Remix 获取以作品参数预填的文生图请求
+func (c *Controller) Remix(ctx *gin.Context) {
+	var dto gallery_dto.PostActionDTO
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil || dto.PostID == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "post_id is required",
+		})
+		return
+	}
+
+	params, err := c.GalleryService.Remix(ctx, dto.PostID)
+	if err != nil {
+		replyPostError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "remix success",
+		"data":    params,
+	})
+}
+
+// GetPost 获取作品详情
+func (c *Controller) GetPost(ctx *gin.Context) {
+	postID, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid post id",
+		})
+		return
+	}
+
+	post, err := c.GalleryService.GetPost(ctx, postID)
+	if err != nil {
+		replyPostError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "get post success",
+		"data":    post,
+	})
+}
+
+// QueryLatest 最新作品
+func (c *Controller) QueryLatest(ctx *gin.Context) {
+	c.queryPosts(ctx, c.GalleryService.QueryLatest)
+}
+
+// QueryTrending 时间窗口内的热门作品
+func (c *Controller) QueryTrending(ctx *gin.Context) {
+	c.queryPosts(ctx, c.GalleryService.QueryTrending)
+}
+
+// QueryFavorites 我的收藏
+func (c *Controller) QueryFavorites(ctx *gin.Context) {
+	c.queryPosts(ctx, c.GalleryService.QueryFavorites)
+}
+
+// postAction 处理以 post_id 为参数的作品操作
+func (c *Controller) postAction(ctx *gin.Context, action func(*gin.Context, uint64) error, message string) {
+	var dto gallery_dto.PostActionDTO
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil || dto.PostID == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "post_id is required",
+		})
+		return
+	}
+
+	if err := action(ctx, dto.PostID); err != nil {
+		replyPostError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": message,
+		"data": gin.H{
+			"post_id": dto.PostID,
+		},
+	})
+}
+
+// queryPosts 校验分页参数并输出作品列表
+func (c *Controller) queryPosts(ctx *gin.Context, query func(*gin.Context, *gallery_query.FeedQuery) ([]*gallery_vo.PostVO, int64, error)) {
+	var q gallery_query.FeedQuery
+	vo := gallery_vo.QueryPostsVO{}
+
+	if err := ctx.ShouldBindQuery(&q); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid query parameters: " + err.Error(),
+		})
+		return
+	}
+
+	if q.PageSize <= 0 || q.PageSize > 100 {
+		q.PageSize = 20
+	}
+	if q.PageIndex < 0 {
+		q.PageIndex = 0
+	}
+	if q.Window == "" {
+		q.Window = gallery_service.DefaultTrendingWindow
+	}
+	if !gallery_service.ValidTrendingWindow(q.Window) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "window must be one of 24h, 7d, 30d",
+		})
+		return
+	}
+
+	posts, total, err := query(ctx, &q)
+	if err != nil {
+		vo.Code = http.StatusInternalServerError
+		vo.Message = "failed to query posts"
+		ctx.JSON(http.StatusInternalServerError, vo)
+		return
+	}
+
+	vo.Code = http.StatusOK
+	vo.Message = "query posts success"
+	vo.Data.PageIndex = q.PageIndex
+	vo.Data.PageSize = q.PageSize
+	vo.Data.Total = int(total)
+	vo.Data.Posts = posts
+	ctx.JSON(http.StatusOK, vo)
+}
+
+// replyPostError 作品不存在返回 404, 其余错误返回 400
+func replyPostError(ctx *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, gallery_service.ErrPostNotFound) {
+		status = http.StatusNotFound
+	}
+
+	ctx.JSON(status, gin.H{
+		"code":    status,
+		"message": err.Error(),
+	})
+}
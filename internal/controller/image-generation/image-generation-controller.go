@@ -2,15 +2,21 @@
 package imagegeneration
 
 import (
+	"errors"
 	"fmt"
 	"math/rand/v2"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	image_generation_dto "github.com/Zhiruosama/ai_nexus/internal/domain/dto/image-generation"
 	image_generation_query "github.com/Zhiruosama/ai_nexus/internal/domain/query/image-generation"
 	image_generation_vo "github.com/Zhiruosama/ai_nexus/internal/domain/vo/image-generation"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/storage"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/third"
 	image_generation_service "github.com/Zhiruosama/ai_nexus/internal/service/image-generation"
 	"github.com/gin-gonic/gin"
 )
@@ -190,6 +196,24 @@ func (c *Controller) GetModelInfo(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, vo)
 }
 
+// GetModelHealth 获取模型在统计窗口内的成功率、生成耗时与错误分类, 不传 model_id 时返回全部模型
+func (c *Controller) GetModelHealth(ctx *gin.Context) {
+	vo := image_generation_vo.GetModelHealthVO{}
+
+	models, err := c.ImageGenerationService.GetModelHealth(ctx, ctx.Query("model_id"))
+	if err != nil {
+		vo.Code = http.StatusBadRequest
+		vo.Message = err.Error()
+		ctx.JSON(http.StatusBadRequest, vo)
+		return
+	}
+
+	vo.Code = http.StatusOK
+	vo.Message = "get model health success"
+	vo.Models = models
+	ctx.JSON(http.StatusOK, vo)
+}
+
 // QueryModels 根据具体信息查询模型列表
 func (c *Controller) QueryModels(ctx *gin.Context) {
 	var query image_generation_query.ModelsQuery
@@ -268,18 +292,7 @@ func (c *Controller) Text2Img(ctx *gin.Context) {
 		return
 	}
 
-	if dto.Width == 0 {
-		dto.Width = 760
-	}
-
-	if dto.Height == 0 {
-		dto.Height = 1280
-	}
-
-	if dto.NumInferenceSteps == 0 {
-		dto.NumInferenceSteps = 20
-	}
-
+	// 宽高、推理步数与采样器由 service 按模型配置补全并校验
 	if dto.GuidanceScale == 0 {
 		dto.GuidanceScale = 7.5
 	}
@@ -288,7 +301,55 @@ func (c *Controller) Text2Img(ctx *gin.Context) {
 		dto.Seed = rand.Int64N(2147483649) - 1
 	}
 
+	if dto.NumImages == 0 {
+		dto.NumImages = 1
+	}
+
+	if dto.Priority != "" && !slices.Contains([]string{"low", "normal", "high"}, dto.Priority) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "priority must be one of low, normal, high",
+		})
+		return
+	}
+
 	taskID, err := c.ImageGenerationService.Text2Img(ctx, dto)
+	if errors.Is(err, image_generation_service.ErrTooManyInFlight) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{
+			"code":    http.StatusTooManyRequests,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrPriorityNotAllowed) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"code":    http.StatusForbidden,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrModelUnavailable) {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    http.StatusServiceUnavailable,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrInvalidPostProcess) || errors.Is(err, image_generation_service.ErrInvalidEnhance) ||
+		errors.Is(err, image_generation_service.ErrInvalidParams) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrEnhanceFailed) {
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"code":    http.StatusBadGateway,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
@@ -345,18 +406,7 @@ func (c *Controller) Img2Img(ctx *gin.Context) {
 		return
 	}
 
-	if dto.Width == 0 {
-		dto.Width = 760
-	}
-
-	if dto.Height == 0 {
-		dto.Height = 1280
-	}
-
-	if dto.NumInferenceSteps == 0 {
-		dto.NumInferenceSteps = 20
-	}
-
+	// 宽高、推理步数与采样器由 service 按模型配置补全并校验
 	if dto.GuidanceScale == 0 {
 		dto.GuidanceScale = 7.5
 	}
@@ -365,6 +415,18 @@ func (c *Controller) Img2Img(ctx *gin.Context) {
 		dto.Seed = rand.Int64N(2147483649) - 1
 	}
 
+	if dto.NumImages == 0 {
+		dto.NumImages = 1
+	}
+
+	if dto.Priority != "" && !slices.Contains([]string{"low", "normal", "high"}, dto.Priority) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "priority must be one of low, normal, high",
+		})
+		return
+	}
+
 	if dto.InputImage == nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"code":    http.StatusBadRequest,
@@ -386,6 +448,42 @@ func (c *Controller) Img2Img(ctx *gin.Context) {
 	}
 
 	taskID, err := c.ImageGenerationService.Img2Img(ctx, &dto)
+	if errors.Is(err, image_generation_service.ErrTooManyInFlight) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{
+			"code":    http.StatusTooManyRequests,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrPriorityNotAllowed) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"code":    http.StatusForbidden,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrModelUnavailable) {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    http.StatusServiceUnavailable,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrInvalidPostProcess) || errors.Is(err, image_generation_service.ErrInvalidEnhance) ||
+		errors.Is(err, image_generation_service.ErrInvalidParams) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrEnhanceFailed) {
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"code":    http.StatusBadGateway,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{
 			"code":    http.StatusInternalServerError,
@@ -404,19 +502,26 @@ func (c *Controller) Img2Img(ctx *gin.Context) {
 	})
 }
 
-// CancelTask 取消任务
-func (c *Controller) CancelTask(ctx *gin.Context) {
-	taskID := ctx.Query("task_id")
+// Inpaint 局部重绘, 输出尺寸与原图一致
+func (c *Controller) Inpaint(ctx *gin.Context) {
+	dto := image_generation_dto.InpaintDTO{}
 
-	if taskID == "" {
+	if err := ctx.ShouldBind(&dto); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"code":    http.StatusBadRequest,
-			"message": "task_id is required",
+			"message": "The input data does not meet the requirements.",
 		})
 		return
 	}
 
-	if err := c.ImageGenerationService.CancelTask(ctx, taskID); err != nil {
+	if dto.Prompt == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "prompt is required",
+		})
+		return
+	}
+	if err := pkg.ValidatePrompt(dto.Prompt); err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"code":    http.StatusBadRequest,
 			"message": err.Error(),
@@ -424,113 +529,988 @@ func (c *Controller) CancelTask(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{
-		"code":    http.StatusOK,
-		"message": "cancel task success",
-		"data": gin.H{
-			"task_id": taskID,
-			"status":  "cancelled",
-		},
-	})
-}
-
-// validateModelCreateRequest 校验创建模型请求参数
-func validateModelCreateRequest(req *image_generation_dto.ModelCreateDTO) error {
-	// 参数校验
-	if req.ModelID == "" {
-		return fmt.Errorf("model_id is required")
-	}
-	if len(req.ModelID) > 64 {
-		return fmt.Errorf("model_id must not exceed 64 characters")
+	if dto.NegativePrompt == "" {
+		dto.NegativePrompt = "lowres, bad anatomy, bad hands, text, error, missing fingers, extra digit, fewer digits, cropped, worst quality, low quality, normal quality, jpeg artifacts, signature, watermark, username, blurry"
 	}
 
-	if req.ModelName == "" {
-		return fmt.Errorf("model_name is required")
-	}
-	if len(req.ModelName) > 128 {
-		return fmt.Errorf("model_name must not exceed 128 characters")
+	if dto.ModelID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "model_id is required",
+		})
+		return
 	}
 
-	if req.ModelType == "" {
-		return fmt.Errorf("model_type is required")
-	}
-	if req.ModelType != "text2img" && req.ModelType != "img2img" {
-		return fmt.Errorf("model_type must be either 'text2img' or 'img2img'")
+	if dto.NumInferenceSteps == 0 {
+		dto.NumInferenceSteps = 20
 	}
 
-	if req.Provider == "" {
-		return fmt.Errorf("provider is required")
-	}
-	if len(req.Provider) > 32 {
-		return fmt.Errorf("provider must not exceed 32 characters")
+	if dto.GuidanceScale == 0 {
+		dto.GuidanceScale = 7.5
 	}
 
-	if req.Description == "" {
-		return fmt.Errorf("description is required")
-	}
-	if len(req.Description) > 500 {
-		return fmt.Errorf("description must not exceed 500 characters")
+	if dto.Seed == 0 {
+		dto.Seed = rand.Int64N(2147483649) - 1
 	}
 
-	if req.Tags == "" {
-		return fmt.Errorf("tags is required")
-	}
-	if len(req.Tags) > 128 {
-		return fmt.Errorf("tags must not exceed 128 characters")
+	if dto.NumImages == 0 {
+		dto.NumImages = 1
 	}
 
-	if req.SortOrder != 0 && (req.SortOrder < 0 || req.SortOrder > 100) {
-		return fmt.Errorf("sort_order must be between 0 and 100")
+	if dto.Priority != "" && !slices.Contains([]string{"low", "normal", "high"}, dto.Priority) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "priority must be one of low, normal, high",
+		})
+		return
 	}
 
-	// is_active 默认为 true, is_recommended 默认为 false
-
-	if req.ThirdPartyModelID == "" {
-		return fmt.Errorf("third_party_model_id is required")
+	if dto.InputImage == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "input_image is required",
+		})
+		return
 	}
-	if len(req.ThirdPartyModelID) > 128 {
-		return fmt.Errorf("third_party_model_id must not exceed 128 characters")
+
+	if dto.Sha256 == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "sha256 is required",
+		})
+		return
 	}
 
-	if req.BaseURL == "" {
-		return fmt.Errorf("base_url is required")
+	if dto.MaskImage == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "mask_image is required",
+		})
+		return
 	}
-	if len(req.BaseURL) > 512 {
-		return fmt.Errorf("base_url must not exceed 512 characters")
+
+	if dto.MaskSha256 == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "mask_sha256 is required",
+		})
+		return
 	}
 
-	// 校验尺寸参数
-	if req.DefaultWidth != 0 && (req.DefaultWidth < 512 || req.DefaultWidth > 2048) {
-		return fmt.Errorf("default_width must be between 512 and 2048")
+	if dto.Strength == 0 {
+		dto.Strength = 0.75
 	}
-	if req.DefaultHeight != 0 && (req.DefaultHeight < 512 || req.DefaultHeight > 2048) {
-		return fmt.Errorf("default_height must be between 512 and 2048")
+
+	taskID, err := c.ImageGenerationService.Inpaint(ctx, &dto)
+	if errors.Is(err, image_generation_service.ErrTooManyInFlight) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{
+			"code":    http.StatusTooManyRequests,
+			"message": err.Error(),
+		})
+		return
 	}
-	if req.MaxWidth != 0 && (req.MaxWidth < 512 || req.MaxWidth > 2048) {
-		return fmt.Errorf("max_width must be between 512 and 2048")
+	if errors.Is(err, image_generation_service.ErrPriorityNotAllowed) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"code":    http.StatusForbidden,
+			"message": err.Error(),
+		})
+		return
 	}
-	if req.MaxHeight != 0 && (req.MaxHeight < 512 || req.MaxHeight > 2048) {
-		return fmt.Errorf("max_height must be between 512 and 2048")
+	if errors.Is(err, image_generation_service.ErrModelUnavailable) {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    http.StatusServiceUnavailable,
+			"message": err.Error(),
+		})
+		return
 	}
-
-	// 校验步数参数
-	if req.MinSteps != 0 && (req.MinSteps < 1 || req.MinSteps > 100) {
-		return fmt.Errorf("min_steps must be between 1 and 100")
+	if errors.Is(err, image_generation_service.ErrInvalidPostProcess) || errors.Is(err, image_generation_service.ErrInvalidParams) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
 	}
-	if req.MaxSteps != 0 && (req.MaxSteps < 1 || req.MaxSteps > 100) {
-		return fmt.Errorf("max_steps must be between 1 and 100")
+	if errors.Is(err, image_generation_service.ErrInvalidImage) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
 	}
-	if req.MinSteps != 0 && req.MaxSteps != 0 && req.MinSteps > req.MaxSteps {
-		return fmt.Errorf("min_steps must not be greater than max_steps")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": err.Error(),
+		})
+		return
 	}
 
-	// 校验逻辑关系
-	if req.DefaultWidth != 0 && req.MaxWidth != 0 && req.DefaultWidth > req.MaxWidth {
-		return fmt.Errorf("default_width must not be greater than max_width")
-	}
-	if req.DefaultHeight != 0 && req.MaxHeight != 0 && req.DefaultHeight > req.MaxHeight {
-		return fmt.Errorf("default_height must not be greater than max_height")
-	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "inpaint create task success",
+		"data": gin.H{
+			"task_id": taskID,
+			"status":  "queued",
+		},
+	})
+}
+
+// Outpaint 扩图, 输出尺寸为原图加上四个方向的扩展像素
+func (c *Controller) Outpaint(ctx *gin.Context) {
+	dto := image_generation_dto.OutpaintDTO{}
+
+	if err := ctx.ShouldBind(&dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "The input data does not meet the requirements.",
+		})
+		return
+	}
+
+	if dto.Prompt == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "prompt is required",
+		})
+		return
+	}
+	if err := pkg.ValidatePrompt(dto.Prompt); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if dto.NegativePrompt == "" {
+		dto.NegativePrompt = "lowres, bad anatomy, bad hands, text, error, missing fingers, extra digit, fewer digits, cropped, worst quality, low quality, normal quality, jpeg artifacts, signature, watermark, username, blurry"
+	}
+
+	if dto.ModelID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "model_id is required",
+		})
+		return
+	}
+
+	if dto.NumInferenceSteps == 0 {
+		dto.NumInferenceSteps = 20
+	}
+
+	if dto.GuidanceScale == 0 {
+		dto.GuidanceScale = 7.5
+	}
+
+	if dto.Seed == 0 {
+		dto.Seed = rand.Int64N(2147483649) - 1
+	}
+
+	if dto.NumImages == 0 {
+		dto.NumImages = 1
+	}
+
+	if dto.Priority != "" && !slices.Contains([]string{"low", "normal", "high"}, dto.Priority) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "priority must be one of low, normal, high",
+		})
+		return
+	}
+
+	if dto.InputImage == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "input_image is required",
+		})
+		return
+	}
+
+	if dto.Sha256 == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "sha256 is required",
+		})
+		return
+	}
+
+	if dto.ExtendLeft < 0 || dto.ExtendRight < 0 || dto.ExtendTop < 0 || dto.ExtendBottom < 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "extend values must not be negative",
+		})
+		return
+	}
+
+	if dto.ExtendLeft+dto.ExtendRight+dto.ExtendTop+dto.ExtendBottom == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "at least one extend value is required",
+		})
+		return
+	}
+
+	taskID, err := c.ImageGenerationService.Outpaint(ctx, &dto)
+	if errors.Is(err, image_generation_service.ErrTooManyInFlight) {
+		ctx.JSON(http.StatusTooManyRequests, gin.H{
+			"code":    http.StatusTooManyRequests,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrPriorityNotAllowed) {
+		ctx.JSON(http.StatusForbidden, gin.H{
+			"code":    http.StatusForbidden,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrModelUnavailable) {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    http.StatusServiceUnavailable,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrInvalidPostProcess) || errors.Is(err, image_generation_service.ErrInvalidParams) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrInvalidImage) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "outpaint create task success",
+		"data": gin.H{
+			"task_id": taskID,
+			"status":  "queued",
+		},
+	})
+}
+
+// ReadImageMetadata 读取上传图片中嵌入的生成参数
+func (c *Controller) ReadImageMetadata(ctx *gin.Context) {
+	fileHeader, err := ctx.FormFile("image")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "image is required",
+		})
+		return
+	}
+
+	meta, err := c.ImageGenerationService.ReadImageMetadata(fileHeader)
+	if errors.Is(err, pkg.ErrNoMetadata) {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "read image metadata success",
+		"data":    meta,
+	})
+}
+
+// CancelTask 取消任务
+func (c *Controller) CancelTask(ctx *gin.Context) {
+	taskID := ctx.Query("task_id")
+
+	if taskID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "task_id is required",
+		})
+		return
+	}
+
+	if err := c.ImageGenerationService.CancelTask(ctx, taskID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "cancel task success",
+		"data": gin.H{
+			"task_id": taskID,
+			"status":  "cancelled",
+		},
+	})
+}
+
+// PreviewEnhancePrompt 预览提示词扩写结果
+func (c *Controller) PreviewEnhancePrompt(ctx *gin.Context) {
+	var dto image_generation_dto.EnhancePromptPreviewDTO
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if dto.Prompt == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "prompt is required",
+		})
+		return
+	}
+	if err := pkg.ValidatePrompt(dto.Prompt); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	enhanced, err := c.ImageGenerationService.PreviewEnhancePrompt(ctx, &dto)
+	if errors.Is(err, image_generation_service.ErrInvalidEnhance) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, image_generation_service.ErrEnhanceFailed) {
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"code":    http.StatusBadGateway,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "enhance prompt success",
+		"data": gin.H{
+			"original_prompt": dto.Prompt,
+			"enhanced_prompt": enhanced,
+		},
+	})
+}
+
+// SetTaskVisibility 公开或取消公开任务的输出图片
+func (c *Controller) SetTaskVisibility(ctx *gin.Context) {
+	var dto image_generation_dto.TaskVisibilityDTO
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if dto.TaskID == "" || dto.IsPublic == nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "task_id and is_public are required",
+		})
+		return
+	}
+
+	if err := c.ImageGenerationService.SetTaskVisibility(ctx, &dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "update task visibility success",
+		"data": gin.H{
+			"task_id":   dto.TaskID,
+			"is_public": *dto.IsPublic,
+		},
+	})
+}
+
+// ServeImage 输出存储中的图片, 需携带有效签名, 或图片已公开, 或以归属用户身份登录
+func (c *Controller) ServeImage(ctx *gin.Context) {
+	key := ctx.Param("key")
+
+	body, public, err := c.ImageGenerationService.OpenImage(ctx, key, ctx.Query("expires"), ctx.Query("signature"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, image_generation_service.ErrImageNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, image_generation_service.ErrImageForbidden):
+			status = http.StatusForbidden
+		}
+		ctx.JSON(status, gin.H{
+			"code":    status,
+			"message": err.Error(),
+		})
+		return
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	// 签名地址有效期有限, 私有图片不允许共享缓存
+	cacheControl := "private, max-age=300"
+	if public {
+		cacheControl = "public, max-age=86400"
+	}
+
+	ctx.DataFromReader(http.StatusOK, -1, storage.ContentType(key), body, map[string]string{
+		"Cache-Control": cacheControl,
+	})
+}
+
+// GetTaskInfo 获取任务详情
+func (c *Controller) GetTaskInfo(ctx *gin.Context) {
+	vo := image_generation_vo.GetTaskInfoVO{}
+
+	taskID := ctx.Param("id")
+	if taskID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "task id is required",
+		})
+		return
+	}
+
+	task, err := c.ImageGenerationService.GetTaskInfo(ctx, taskID)
+	if err != nil {
+		vo.Code = http.StatusBadRequest
+		vo.Message = err.Error()
+		ctx.JSON(http.StatusBadRequest, vo)
+		return
+	}
+
+	vo.Code = http.StatusOK
+	vo.Message = "get taskinfo success"
+	vo.Task = task
+	ctx.JSON(http.StatusOK, vo)
+}
+
+// QueryTasks 分页查询任务历史
+func (c *Controller) QueryTasks(ctx *gin.Context) {
+	var query image_generation_query.TasksQuery
+	vo := image_generation_vo.QueryTasksVO{}
+
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid query parameters: " + err.Error(),
+		})
+		return
+	}
+
+	if query.PageSize <= 0 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+	if query.PageIndex < 0 {
+		query.PageIndex = 0
+	}
+
+	if query.StartDate != nil && *query.StartDate != "" {
+		if _, err := time.Parse(time.DateOnly, *query.StartDate); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "start_date must be in format YYYY-MM-DD",
+			})
+			return
+		}
+	}
+	if query.EndDate != nil && *query.EndDate != "" {
+		if _, err := time.Parse(time.DateOnly, *query.EndDate); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "end_date must be in format YYYY-MM-DD",
+			})
+			return
+		}
+	}
+
+	vo.Data.PageIndex = query.PageIndex
+	vo.Data.PageSize = query.PageSize
+
+	tasks, total, err := c.ImageGenerationService.QueryTasks(ctx, &query)
+	if err != nil {
+		vo.Code = http.StatusInternalServerError
+		vo.Message = "failed to query tasks"
+		ctx.JSON(http.StatusInternalServerError, vo)
+		return
+	}
+
+	vo.Code = http.StatusOK
+	vo.Message = "query tasks success"
+	vo.Data.Total = int(total)
+	vo.Data.Tasks = tasks
+	ctx.JSON(http.StatusOK, vo)
+}
+
+// CreateCredential 创建平台生图凭证
+func (c *Controller) CreateCredential(ctx *gin.Context) {
+	c.createCredential(ctx, "")
+}
+
+// UpdateCredential 更新或轮换平台生图凭证
+func (c *Controller) UpdateCredential(ctx *gin.Context) {
+	c.updateCredential(ctx, "")
+}
+
+// DeleteCredential 删除平台生图凭证
+func (c *Controller) DeleteCredential(ctx *gin.Context) {
+	c.deleteCredential(ctx, "")
+}
+
+// QueryCredentials 查询平台生图凭证
+func (c *Controller) QueryCredentials(ctx *gin.Context) {
+	c.queryCredentials(ctx, "")
+}
+
+// CreateUserCredential 创建当前用户自带的生图凭证
+func (c *Controller) CreateUserCredential(ctx *gin.Context) {
+	c.createCredential(ctx, ctx.GetString("user_id"))
+}
+
+// UpdateUserCredential 更新当前用户的生图凭证
+func (c *Controller) UpdateUserCredential(ctx *gin.Context) {
+	c.updateCredential(ctx, ctx.GetString("user_id"))
+}
+
+// DeleteUserCredential 删除当前用户的生图凭证
+func (c *Controller) DeleteUserCredential(ctx *gin.Context) {
+	c.deleteCredential(ctx, ctx.GetString("user_id"))
+}
+
+// QueryUserCredentials 查询当前用户的生图凭证
+func (c *Controller) QueryUserCredentials(ctx *gin.Context) {
+	c.queryCredentials(ctx, ctx.GetString("user_id"))
+}
+
+func (c *Controller) createCredential(ctx *gin.Context, ownerUUID string) {
+	var req image_generation_dto.CredentialCreateDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "The input data does not meet the requirements.",
+		})
+		return
+	}
+
+	if err := validateCredentialCreateRequest(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := c.ImageGenerationService.CreateCredential(ctx, ownerUUID, &req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "create credential success",
+	})
+}
+
+func (c *Controller) updateCredential(ctx *gin.Context, ownerUUID string) {
+	var req image_generation_dto.CredentialUpdateDTO
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "The input data does not meet the requirements.",
+		})
+		return
+	}
+
+	if req.ID == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "id is required",
+		})
+		return
+	}
+	if req.Name != nil && (*req.Name == "" || len(*req.Name) > 64) {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "name must be between 1 and 64 characters",
+		})
+		return
+	}
+	if req.APIKey != nil && *req.APIKey == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "api_key must not be empty",
+		})
+		return
+	}
+
+	if err := c.ImageGenerationService.UpdateCredential(ctx, ownerUUID, &req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "update credential success",
+	})
+}
+
+func (c *Controller) deleteCredential(ctx *gin.Context, ownerUUID string) {
+	id, err := strconv.ParseUint(ctx.Query("id"), 10, 64)
+	if err != nil || id == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "id is required",
+		})
+		return
+	}
+
+	if err := c.ImageGenerationService.DeleteCredential(ctx, ownerUUID, id); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "delete credential success",
+	})
+}
+
+func (c *Controller) queryCredentials(ctx *gin.Context, ownerUUID string) {
+	vo := image_generation_vo.QueryCredentialsVO{}
+
+	credentials, err := c.ImageGenerationService.QueryCredentials(ctx, ownerUUID)
+	if err != nil {
+		vo.Code = http.StatusBadRequest
+		vo.Message = err.Error()
+		ctx.JSON(http.StatusBadRequest, vo)
+		return
+	}
+
+	vo.Code = http.StatusOK
+	vo.Message = "query credentials success"
+	vo.Credentials = credentials
+	ctx.JSON(http.StatusOK, vo)
+}
+
+// validateCredentialCreateRequest 校验创建凭证请求参数
+func validateCredentialCreateRequest(req *image_generation_dto.CredentialCreateDTO) error {
+	if !slices.Contains(third.SupportedProviders(), req.Provider) {
+		return fmt.Errorf("provider must be one of %s", strings.Join(third.SupportedProviders(), ", "))
+	}
+	if req.Name == "" || len(req.Name) > 64 {
+		return fmt.Errorf("name must be between 1 and 64 characters")
+	}
+	if req.APIKey == "" {
+		return fmt.Errorf("api_key is required")
+	}
+	return nil
+}
+
+// validateModelCreateRequest 校验创建模型请求参数
+func validateModelCreateRequest(req *image_generation_dto.ModelCreateDTO) error {
+	// 参数校验
+	if req.ModelID == "" {
+		return fmt.Errorf("model_id is required")
+	}
+	if len(req.ModelID) > 64 {
+		return fmt.Errorf("model_id must not exceed 64 characters")
+	}
+
+	if req.ModelName == "" {
+		return fmt.Errorf("model_name is required")
+	}
+	if len(req.ModelName) > 128 {
+		return fmt.Errorf("model_name must not exceed 128 characters")
+	}
+
+	if req.ModelType == "" {
+		return fmt.Errorf("model_type is required")
+	}
+	if !slices.Contains(image_generation_service.SupportedModelTypes(), req.ModelType) {
+		return fmt.Errorf("model_type must be one of %s", strings.Join(image_generation_service.SupportedModelTypes(), ", "))
+	}
+
+	if req.Provider == "" {
+		return fmt.Errorf("provider is required")
+	}
+	if len(req.Provider) > 32 {
+		return fmt.Errorf("provider must not exceed 32 characters")
+	}
+	if !slices.Contains(third.SupportedProviders(), req.Provider) {
+		return fmt.Errorf("provider must be one of %s", strings.Join(third.SupportedProviders(), ", "))
+	}
+
+	if req.Description == "" {
+		return fmt.Errorf("description is required")
+	}
+	if len(req.Description) > 500 {
+		return fmt.Errorf("description must not exceed 500 characters")
+	}
+
+	if req.Tags == "" {
+		return fmt.Errorf("tags is required")
+	}
+	if len(req.Tags) > 128 {
+		return fmt.Errorf("tags must not exceed 128 characters")
+	}
+
+	if req.SortOrder != 0 && (req.SortOrder < 0 || req.SortOrder > 100) {
+		return fmt.Errorf("sort_order must be between 0 and 100")
+	}
+
+	// is_active 默认为 true, is_recommended 默认为 false
+
+	if req.ThirdPartyModelID == "" {
+		return fmt.Errorf("third_party_model_id is required")
+	}
+	if len(req.ThirdPartyModelID) > 128 {
+		return fmt.Errorf("third_party_model_id must not exceed 128 characters")
+	}
+
+	if req.BaseURL == "" {
+		return fmt.Errorf("base_url is required")
+	}
+	if len(req.BaseURL) > 512 {
+		return fmt.Errorf("base_url must not exceed 512 characters")
+	}
+
+	// 校验尺寸参数
+	if req.DefaultWidth != 0 && (req.DefaultWidth < 512 || req.DefaultWidth > 2048) {
+		return fmt.Errorf("default_width must be between 512 and 2048")
+	}
+	if req.DefaultHeight != 0 && (req.DefaultHeight < 512 || req.DefaultHeight > 2048) {
+		return fmt.Errorf("default_height must be between 512 and 2048")
+	}
+	if req.MaxWidth != 0 && (req.MaxWidth < 512 || req.MaxWidth > 2048) {
+		return fmt.Errorf("max_width must be between 512 and 2048")
+	}
+	if req.MaxHeight != 0 && (req.MaxHeight < 512 || req.MaxHeight > 2048) {
+		return fmt.Errorf("max_height must be between 512 and 2048")
+	}
+
+	// 校验步数参数
+	if req.MinSteps != 0 && (req.MinSteps < 1 || req.MinSteps > 100) {
+		return fmt.Errorf("min_steps must be between 1 and 100")
+	}
+	if req.MaxSteps != 0 && (req.MaxSteps < 1 || req.MaxSteps > 100) {
+		return fmt.Errorf("max_steps must be between 1 and 100")
+	}
+	if req.MinSteps != 0 && req.MaxSteps != 0 && req.MinSteps > req.MaxSteps {
+		return fmt.Errorf("min_steps must not be greater than max_steps")
+	}
+
+	// 校验单次生成数量
+	if req.MaxNumImages != 0 && (req.MaxNumImages < 1 || req.MaxNumImages > 10) {
+		return fmt.Errorf("max_num_images must be between 1 and 10")
+	}
+
+	// 校验逻辑关系
+	if req.DefaultWidth != 0 && req.MaxWidth != 0 && req.DefaultWidth > req.MaxWidth {
+		return fmt.Errorf("default_width must not be greater than max_width")
+	}
+	if req.DefaultHeight != 0 && req.MaxHeight != 0 && req.DefaultHeight > req.MaxHeight {
+		return fmt.Errorf("default_height must not be greater than max_height")
+	}
 
 	return nil
 }
+
+// QueryDeadLetters 分页查询死信任务
+func (c *Controller) QueryDeadLetters(ctx *gin.Context) {
+	var query image_generation_query.DeadLettersQuery
+	vo := image_generation_vo.QueryDeadLettersVO{}
+
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid query parameters: " + err.Error(),
+		})
+		return
+	}
+
+	if query.PageSize <= 0 || query.PageSize > 100 {
+		query.PageSize = 20
+	}
+	if query.PageIndex < 0 {
+		query.PageIndex = 0
+	}
+
+	if query.StartDate != nil && *query.StartDate != "" {
+		if _, err := time.Parse(time.DateOnly, *query.StartDate); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "start_date must be in format YYYY-MM-DD",
+			})
+			return
+		}
+	}
+	if query.EndDate != nil && *query.EndDate != "" {
+		if _, err := time.Parse(time.DateOnly, *query.EndDate); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "end_date must be in format YYYY-MM-DD",
+			})
+			return
+		}
+	}
+
+	vo.Data.PageIndex = query.PageIndex
+	vo.Data.PageSize = query.PageSize
+
+	deadLetters, total, err := c.ImageGenerationService.QueryDeadLetters(ctx, &query)
+	if err != nil {
+		vo.Code = http.StatusInternalServerError
+		vo.Message = "failed to query dead letters"
+		ctx.JSON(http.StatusInternalServerError, vo)
+		return
+	}
+
+	vo.Code = http.StatusOK
+	vo.Message = "query dead letters success"
+	vo.Data.Total = int(total)
+	vo.Data.DeadLetters = deadLetters
+	ctx.JSON(http.StatusOK, vo)
+}
+
+// GetDeadLetter 查看死信记录及其原始任务
+func (c *Controller) GetDeadLetter(ctx *gin.Context) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid dead letter id",
+		})
+		return
+	}
+
+	detail, err := c.ImageGenerationService.GetDeadLetter(ctx, id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "get dead letter success",
+		"data":    detail,
+	})
+}
+
+// ReplayDeadLetters 重置重试次数后重新投递一条或多条死信任务
+func (c *Controller) ReplayDeadLetters(ctx *gin.Context) {
+	var dto image_generation_dto.DeadLetterReplayDTO
+
+	if err := ctx.ShouldBindJSON(&dto); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if len(dto.IDs) == 0 || len(dto.IDs) > 100 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "ids must contain between 1 and 100 items",
+		})
+		return
+	}
+
+	results := c.ImageGenerationService.ReplayDeadLetters(ctx, dto.IDs)
+
+	replayed := 0
+	for _, result := range results {
+		if result.Replayed {
+			replayed++
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": fmt.Sprintf("replayed %d of %d dead letters", replayed, len(results)),
+		"data":    results,
+	})
+}
+
+// PurgeDeadLetters 清理指定日期之前的死信记录
+func (c *Controller) PurgeDeadLetters(ctx *gin.Context) {
+	before := ctx.Query("before")
+	if _, err := time.Parse(time.DateOnly, before); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "before must be in format YYYY-MM-DD",
+		})
+		return
+	}
+
+	deleted, err := c.ImageGenerationService.PurgeDeadLetters(ctx, before)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "failed to purge dead letters",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "purge dead letters success",
+		"data": gin.H{
+			"deleted": deleted,
+		},
+	})
+}
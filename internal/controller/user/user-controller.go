@@ -2,6 +2,7 @@
 package user
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -14,7 +15,9 @@ import (
 	user_query "github.com/Zhiruosama/ai_nexus/internal/domain/query/user"
 	user_vo "github.com/Zhiruosama/ai_nexus/internal/domain/vo/user"
 	"github.com/Zhiruosama/ai_nexus/internal/middleware"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/oauth"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/session"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/ws"
 	user_service "github.com/Zhiruosama/ai_nexus/internal/service/user"
 	"github.com/gin-gonic/gin"
@@ -39,6 +42,10 @@ const (
 	charset        = "abcdefghijklmnopqrstuvwxyz" + "ABCDEFGHIJKLMNOPQRSTUVWXYZ" + "0123456789"
 	nickNamePrefix = "用户_"
 	codePrefix     = "code_"
+
+	// oauthBindingCookie 保存登录流程 binding 的 HttpOnly Cookie, 只在 /user/oauth 下发送
+	oauthBindingCookie = "oauth_binding"
+	oauthCookiePath    = "/user/oauth"
 )
 
 var (
@@ -249,32 +256,62 @@ func (uc *Controller) Login(ctx *gin.Context) {
 		loginvo.Code = int32(middleware.LoginFailed)
 		loginvo.Message = err.Error()
 		loginvo.JWTToken = ""
+		loginvo.RefreshToken = ""
+		loginvo.ExpiresIn = 0
 		ctx.JSON(http.StatusBadRequest, loginvo)
 		return
 	}
 
 	loginvo.Code = int32(http.StatusOK)
 	loginvo.Message = "login successful"
+	if loginvo.TwoFactorRequired {
+		loginvo.Message = "two-factor authentication required"
+	}
 
 	ctx.JSON(http.StatusOK, loginvo)
 }
 
-// Logout 登出
-func (uc *Controller) Logout(ctx *gin.Context) {
-	UserID, _ := ctx.Get("user_id")
-	rdbClient := rdb.Rdb
-	rCtx := rdb.Ctx
+// LoginTwoFactor 登录第二步, 提交挑战令牌与验证码或恢复码换取访问令牌
+func (uc *Controller) LoginTwoFactor(ctx *gin.Context) {
+	var req user_dto.TwoFactorLoginRequest
+	var loginvo = &user_vo.LoginVO{}
+
+	if err := ctx.ShouldBind(&req); err != nil || req.ChallengeToken == "" || (req.Code == "" && req.RecoveryCode == "") {
+		loginvo.Code = http.StatusBadRequest
+		loginvo.Message = "challenge_token and code or recovery_code are required"
+		ctx.JSON(http.StatusBadRequest, loginvo)
+		return
+	}
 
-	_, err := rdbClient.Get(rCtx, UserID.(string)).Result()
+	err := uc.UserService.VerifyTwoFactorLogin(ctx, &req, loginvo)
+	if errors.Is(err, user_service.ErrInvalidTwoFactorCode) || errors.Is(err, user_service.ErrChallengeExpired) {
+		loginvo.Code = http.StatusUnauthorized
+		loginvo.Message = err.Error()
+		ctx.JSON(http.StatusUnauthorized, loginvo)
+		return
+	}
 	if err != nil {
+		loginvo.Code = http.StatusInternalServerError
+		loginvo.Message = "failed to verify two-factor code"
+		ctx.JSON(http.StatusInternalServerError, loginvo)
+		return
+	}
+
+	loginvo.Code = http.StatusOK
+	loginvo.Message = "login successful"
+	ctx.JSON(http.StatusOK, loginvo)
+}
+
+// Logout 登出, 只注销当前设备的会话
+func (uc *Controller) Logout(ctx *gin.Context) {
+	err := uc.UserService.RevokeSession(ctx, ctx.GetString(middleware.SessionIDKey))
+	if errors.Is(err, user_service.ErrSessionNotFound) {
 		ctx.JSON(http.StatusOK, gin.H{
 			"code":    http.StatusOK,
 			"message": "user already logged out",
 		})
 		return
 	}
-
-	_, err = rdbClient.Del(rCtx, UserID.(string)).Result()
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{
 			"code":    middleware.LogoutFailed,
@@ -289,6 +326,112 @@ func (uc *Controller) Logout(ctx *gin.Context) {
 	})
 }
 
+// RefreshToken 使用刷新令牌换取新的访问令牌与刷新令牌
+func (uc *Controller) RefreshToken(ctx *gin.Context) {
+	var req user_dto.RefreshTokenRequest
+	var loginvo = &user_vo.LoginVO{}
+
+	if err := ctx.ShouldBind(&req); err != nil || req.RefreshToken == "" {
+		loginvo.Code = http.StatusBadRequest
+		loginvo.Message = "refresh_token is required"
+		ctx.JSON(http.StatusBadRequest, loginvo)
+		return
+	}
+
+	err := uc.UserService.RefreshToken(ctx, req.RefreshToken, loginvo)
+	if errors.Is(err, session.ErrInvalidRefreshToken) {
+		loginvo.Code = http.StatusUnauthorized
+		loginvo.Message = err.Error()
+		ctx.JSON(http.StatusUnauthorized, loginvo)
+		return
+	}
+	if err != nil {
+		loginvo.Code = http.StatusInternalServerError
+		loginvo.Message = "failed to refresh token"
+		ctx.JSON(http.StatusInternalServerError, loginvo)
+		return
+	}
+
+	loginvo.Code = http.StatusOK
+	loginvo.Message = "refresh token successful"
+	ctx.JSON(http.StatusOK, loginvo)
+}
+
+// QuerySessions 查询当前用户在各设备上的登录会话
+func (uc *Controller) QuerySessions(ctx *gin.Context) {
+	sessions, err := uc.UserService.ListSessions(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "failed to query sessions",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "query sessions success",
+		"data": gin.H{
+			"sessions": sessions,
+		},
+	})
+}
+
+// RevokeSession 注销指定设备的会话
+func (uc *Controller) RevokeSession(ctx *gin.Context) {
+	sessionID := ctx.Query("session_id")
+	if sessionID == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "session_id is required",
+		})
+		return
+	}
+
+	err := uc.UserService.RevokeSession(ctx, sessionID)
+	if errors.Is(err, user_service.ErrSessionNotFound) {
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"code":    http.StatusNotFound,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "failed to revoke session",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "revoke session success",
+	})
+}
+
+// RevokeAllSessions 注销全部设备的会话, keep_current=true 时保留当前设备
+func (uc *Controller) RevokeAllSessions(ctx *gin.Context) {
+	keepCurrent := ctx.Query("keep_current") == "true"
+
+	revoked, err := uc.UserService.RevokeAllSessions(ctx, keepCurrent)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "failed to revoke sessions",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "revoke all sessions success",
+		"data": gin.H{
+			"revoked": revoked,
+		},
+	})
+}
+
 // GetUserInfo 获取当前已登录用户信息
 func (uc *Controller) GetUserInfo(ctx *gin.Context) {
 	UserID, _ := ctx.Get("user_id")
@@ -451,6 +594,440 @@ func (uc *Controller) DestroyUser(ctx *gin.Context) {
 	})
 }
 
+// GetTwoFactorStatus 查询当前用户的两步验证状态
+func (uc *Controller) GetTwoFactorStatus(ctx *gin.Context) {
+	status, err := uc.UserService.GetTwoFactorStatus(ctx)
+	if err != nil {
+		replyTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "query two-factor status success",
+		"data":    status,
+	})
+}
+
+// SetupTwoFactor 生成两步验证密钥与绑定二维码地址
+func (uc *Controller) SetupTwoFactor(ctx *gin.Context) {
+	setup, err := uc.UserService.SetupTwoFactor(ctx)
+	if err != nil {
+		replyTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "scan the provisioning uri and submit a code to enable two-factor authentication",
+		"data":    setup,
+	})
+}
+
+// EnableTwoFactor 提交验证码启用两步验证, 恢复码只在此时返回一次
+func (uc *Controller) EnableTwoFactor(ctx *gin.Context) {
+	var req user_dto.TwoFactorCodeRequest
+
+	if err := ctx.ShouldBind(&req); err != nil || req.Code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "code is required",
+		})
+		return
+	}
+
+	codes, err := uc.UserService.EnableTwoFactor(ctx, req.Code)
+	if err != nil {
+		replyTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "two-factor authentication enabled",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// DisableTwoFactor 提交验证码或恢复码关闭两步验证
+func (uc *Controller) DisableTwoFactor(ctx *gin.Context) {
+	var req user_dto.TwoFactorCodeRequest
+
+	if err := ctx.ShouldBind(&req); err != nil || (req.Code == "" && req.RecoveryCode == "") {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "code or recovery_code is required",
+		})
+		return
+	}
+
+	if err := uc.UserService.DisableTwoFactor(ctx, &req); err != nil {
+		replyTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes 提交验证码重新生成恢复码
+func (uc *Controller) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var req user_dto.TwoFactorCodeRequest
+
+	if err := ctx.ShouldBind(&req); err != nil || req.Code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "code is required",
+		})
+		return
+	}
+
+	codes, err := uc.UserService.RegenerateRecoveryCodes(ctx, req.Code)
+	if err != nil {
+		replyTwoFactorError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "recovery codes regenerated",
+		"data": gin.H{
+			"recovery_codes": codes,
+		},
+	})
+}
+
+// replyTwoFactorError 状态冲突返回 409, 验证码错误或未绑定返回 400, 其余错误返回 500
+func replyTwoFactorError(ctx *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	message := "two-factor operation failed"
+
+	switch {
+	case errors.Is(err, user_service.ErrTwoFactorEnabled):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, user_service.ErrTwoFactorNotEnabled),
+		errors.Is(err, user_service.ErrTwoFactorNotSetup),
+		errors.Is(err, user_service.ErrInvalidTwoFactorCode):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, user_service.ErrUserNotFound):
+		status, message = http.StatusNotFound, err.Error()
+	}
+
+	ctx.JSON(status, gin.H{
+		"code":    status,
+		"message": message,
+	})
+}
+
+// QueryOAuthProviders 查询已启用的第三方登录提供方
+func (uc *Controller) QueryOAuthProviders(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "query oauth providers success",
+		"data": gin.H{
+			"providers": uc.UserService.ListOAuthProviders(),
+		},
+	})
+}
+
+// OAuthAuthorize 发起第三方登录, 前端保存 state 后跳转到 auth_url
+func (uc *Controller) OAuthAuthorize(ctx *gin.Context) {
+	uc.oauthAuthorize(ctx, "")
+}
+
+// OAuthLink 为当前用户发起第三方账号绑定, 回调需要提交到需要登录的 /user/oauth/link/callback
+func (uc *Controller) OAuthLink(ctx *gin.Context) {
+	uc.oauthAuthorize(ctx, ctx.GetString(middleware.UserIDKey))
+}
+
+func (uc *Controller) oauthAuthorize(ctx *gin.Context, linkUserID string) {
+	provider := ctx.Query("provider")
+	if provider == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "provider is required",
+		})
+		return
+	}
+
+	device := ctx.Query("device_name")
+	if device == "" {
+		device = ctx.Request.UserAgent()
+	}
+
+	// 登录流程把 state 绑定到发起授权的浏览器, 防止攻击者诱导受害者用攻击者的授权码登录
+	binding := ""
+	if linkUserID == "" {
+		var err error
+		if binding, err = oauth.RandomToken(); err != nil {
+			replyOAuthError(ctx, err)
+			return
+		}
+	}
+
+	authURL, state, err := uc.UserService.OAuthAuthorize(ctx, provider, device, linkUserID, binding)
+	if err != nil {
+		replyOAuthError(ctx, err)
+		return
+	}
+
+	if binding != "" {
+		ctx.SetSameSite(http.SameSiteLaxMode)
+		ctx.SetCookie(oauthBindingCookie, binding, 0, oauthCookiePath, "", ctx.Request.TLS != nil, true)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "redirect to auth_url to continue",
+		"data": gin.H{
+			"auth_url": authURL,
+			"state":    state,
+		},
+	})
+}
+
+// OAuthCallback 提交回跳地址中的 state 与 code, 完成第三方登录或绑定
+// 登录回调挂载在公开路由上并校验 Cookie 中的 binding, 绑定回调挂载在需要登录的路由上
+func (uc *Controller) OAuthCallback(ctx *gin.Context) {
+	var req user_dto.OAuthCallbackRequest
+	var loginvo = &user_vo.LoginVO{}
+
+	if err := ctx.ShouldBind(&req); err != nil || req.State == "" || req.Code == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "state and code are required",
+		})
+		return
+	}
+
+	// state 只能使用一次, 无论成功与否都清除 binding
+	binding, _ := ctx.Cookie(oauthBindingCookie)
+	if binding != "" {
+		ctx.SetSameSite(http.SameSiteLaxMode)
+		ctx.SetCookie(oauthBindingCookie, "", -1, oauthCookiePath, "", ctx.Request.TLS != nil, true)
+	}
+
+	linked, err := uc.UserService.OAuthCallback(ctx, &req, binding, loginvo)
+	if err != nil {
+		replyOAuthError(ctx, err)
+		return
+	}
+
+	if linked {
+		ctx.JSON(http.StatusOK, gin.H{
+			"code":    http.StatusOK,
+			"message": "link account successful",
+		})
+		return
+	}
+
+	loginvo.Code = http.StatusOK
+	loginvo.Message = "login successful"
+	if loginvo.TwoFactorRequired {
+		loginvo.Message = "two-factor authentication required"
+	}
+	ctx.JSON(http.StatusOK, loginvo)
+}
+
+// QueryIdentities 查询当前用户绑定的第三方账号
+func (uc *Controller) QueryIdentities(ctx *gin.Context) {
+	identities, err := uc.UserService.ListIdentities(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "failed to query identities",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "query identities success",
+		"data": gin.H{
+			"identities": identities,
+		},
+	})
+}
+
+// UnlinkIdentity 解绑当前用户在指定提供方的账号
+func (uc *Controller) UnlinkIdentity(ctx *gin.Context) {
+	provider := ctx.Query("provider")
+	if provider == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "provider is required",
+		})
+		return
+	}
+
+	if err := uc.UserService.UnlinkIdentity(ctx, provider); err != nil {
+		replyOAuthError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "unlink account successful",
+	})
+}
+
+// replyOAuthError 按错误类型返回 400/401/403/404/409/502, 其余错误返回 500
+func replyOAuthError(ctx *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	message := "oauth operation failed"
+
+	switch {
+	case errors.Is(err, user_service.ErrOAuthProviderNotFound),
+		errors.Is(err, user_service.ErrIdentityNotFound):
+		status, message = http.StatusNotFound, err.Error()
+	case errors.Is(err, user_service.ErrOAuthStateInvalid):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, user_service.ErrOAuthProviderFailed):
+		// 授权码错误或过期同样来自提供方, 前端应重新发起授权
+		status, message = http.StatusBadGateway, err.Error()
+	case errors.Is(err, user_service.ErrOAuthEmailUnverified),
+		errors.Is(err, user_service.ErrOAuthLinkMismatch):
+		status, message = http.StatusForbidden, err.Error()
+	case errors.Is(err, user_service.ErrIdentityLinked),
+		errors.Is(err, user_service.ErrProviderLinked):
+		status, message = http.StatusConflict, err.Error()
+	}
+
+	ctx.JSON(status, gin.H{
+		"code":    status,
+		"message": message,
+	})
+}
+
+// QueryRoles 查询全部角色及其权限
+func (uc *Controller) QueryRoles(ctx *gin.Context) {
+	roles, err := uc.UserService.ListRoles(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "failed to query roles",
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "query roles success",
+		"data": gin.H{
+			"roles":       roles,
+			"permissions": middleware.Permissions(),
+		},
+	})
+}
+
+// CreateRole 创建自定义角色
+func (uc *Controller) CreateRole(ctx *gin.Context) {
+	var req user_dto.RoleCreateRequest
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "invalid request body: " + err.Error(),
+		})
+		return
+	}
+
+	if err := uc.UserService.CreateRole(ctx, &req); err != nil {
+		replyRoleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "create role success",
+	})
+}
+
+// UpdateRole 更新自定义角色的描述与权限
+func (uc *Controller) UpdateRole(ctx *gin.Context) {
+	var req user_dto.RoleUpdateRequest
+
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.Name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "name is required",
+		})
+		return
+	}
+
+	if err := uc.UserService.UpdateRole(ctx, &req); err != nil {
+		replyRoleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "update role success",
+	})
+}
+
+// DeleteRole 删除自定义角色
+func (uc *Controller) DeleteRole(ctx *gin.Context) {
+	name := ctx.Query("name")
+	if name == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "name is required",
+		})
+		return
+	}
+
+	if err := uc.UserService.DeleteRole(ctx, name); err != nil {
+		replyRoleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "delete role success",
+	})
+}
+
+// AssignRole 为用户分配角色
+func (uc *Controller) AssignRole(ctx *gin.Context) {
+	var req user_dto.AssignRoleRequest
+
+	if err := ctx.ShouldBindJSON(&req); err != nil || req.UUID == "" || req.Role == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"code":    http.StatusBadRequest,
+			"message": "uuid and role are required",
+		})
+		return
+	}
+
+	if err := uc.UserService.AssignRole(ctx, &req); err != nil {
+		replyRoleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":    http.StatusOK,
+		"message": "assign role success",
+	})
+}
+
+// replyRoleError 角色或用户不存在返回 404, 其余错误返回 400
+func replyRoleError(ctx *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, user_service.ErrRoleNotFound) || errors.Is(err, user_service.ErrUserNotFound) {
+		status = http.StatusNotFound
+	}
+
+	ctx.JSON(status, gin.H{
+		"code":    status,
+		"message": err.Error(),
+	})
+}
+
 // generateRandomString 生成指定长度的随机字符串
 func generateRandomString(n int) string {
 	b := make([]byte, n)
@@ -479,10 +1056,15 @@ func (uc *Controller) HandleWebSocket(ctx *gin.Context) {
 
 	userUUID := claims.UserID
 
-	rdbClient := rdb.Rdb
-	rCtx := rdb.Ctx
-
-	exists, err := rdbClient.Exists(rCtx, userUUID).Result()
+	err = middleware.ValidateSession(claims, ctx.ClientIP())
+	if errors.Is(err, session.ErrRevoked) {
+		log.Printf("[WebSocket] Session of user %s revoked\n", userUUID)
+		ctx.JSON(http.StatusUnauthorized, gin.H{
+			"code":    middleware.UserNotExists,
+			"message": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		log.Printf("[WebSocket] Redis error: %v\n", err)
 		ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -492,15 +1074,6 @@ func (uc *Controller) HandleWebSocket(ctx *gin.Context) {
 		return
 	}
 
-	if exists == 0 {
-		log.Printf("[WebSocket] User %s not exists\n", userUUID)
-		ctx.JSON(http.StatusUnauthorized, gin.H{
-			"code":    middleware.UserNotExists,
-			"message": "user not exists",
-		})
-		return
-	}
-
 	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
 		log.Printf("[WebSocket] Upgrade failed: %v\n", err)
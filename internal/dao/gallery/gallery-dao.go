@@ -0,0 +1,307 @@
+// Package gallery 画廊 dao
+package gallery
+
+import (
+	"time"
+
+	gallery_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/gallery"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/db"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// DAO 作为 gallery 模块的 dao 结构体
+type DAO struct {
+}
+
+// postColumns 作品列表与详情共用的查询列
+const postColumns = `SELECT p.id, p.task_id, p.user_uuid, p.title, p.like_count, p.favorite_count, p.remix_count, p.created_at,
+	u.nickname, u.avatar,
+	t.task_type, t.prompt, t.negative_prompt, t.model_id, t.width, t.height, t.num_inference_steps, t.guidance_scale,
+	t.seed, t.actual_seed, t.num_images, t.sampler, t.strength, t.output_image_url`
+
+// postFrom 只展示仍公开且已完成的任务, 作者把任务改为私有后作品自动从画廊隐藏
+const postFrom = ` FROM gallery_posts p
+	JOIN image_generation_tasks t ON t.task_id = p.task_id
+	LEFT JOIN users u ON u.uuid = p.user_uuid`
+
+const postVisible = ` WHERE t.is_public = TRUE AND t.status = 3`
+
+// reaction 点赞与收藏共用同一套读写逻辑
+type reaction struct {
+	table   string
+	counter string
+}
+
+var (
+	likeReaction     = reaction{table: "gallery_likes", counter: "like_count"}
+	favoriteReaction = reaction{table: "gallery_favorites", counter: "favorite_count"}
+)
+
+// GetPostByTaskID 根据任务 ID 获取作品, 不存在时返回 nil
+func (d *DAO) GetPostByTaskID(ctx *gin.Context, taskID string) (*gallery_do.TableGalleryPostDO, error) {
+	var posts []*gallery_do.TableGalleryPostDO
+	sql := `SELECT * FROM gallery_posts WHERE task_id = ? LIMIT 1`
+
+	result := db.GlobalDB.Raw(sql, taskID).Scan(&posts)
+	if result.Error != nil {
+		logger.Error(ctx, "GetPostByTaskID error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	if len(posts) == 0 {
+		return nil, nil
+	}
+	return posts[0], nil
+}
+
+// CreatePost 发布作品并把任务设为公开, 返回作品 ID
+func (d *DAO) CreatePost(ctx *gin.Context, do *gallery_do.TableGalleryPostDO) (uint64, error) {
+	tx := db.GlobalDB.Begin()
+
+	sql := `INSERT INTO gallery_posts (task_id, user_uuid, title) VALUES (?, ?, ?)`
+	if result := tx.Exec(sql, do.TaskID, do.UserUUID, do.Title); result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "CreatePost insert error: %s", result.Error.Error())
+		return 0, result.Error
+	}
+
+	var id uint64
+	if result := tx.Raw("SELECT id FROM gallery_posts WHERE task_id = ?", do.TaskID).Scan(&id); result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "CreatePost select id error: %s", result.Error.Error())
+		return 0, result.Error
+	}
+
+	sql = `UPDATE image_generation_tasks SET is_public = TRUE WHERE task_id = ?`
+	if result := tx.Exec(sql, do.TaskID); result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "CreatePost update task error: %s", result.Error.Error())
+		return 0, result.Error
+	}
+
+	return id, tx.Commit().Error
+}
+
+// DeletePost 取消发布, 同时删除点赞与收藏, 任务的公开状态保持不变; 作品不存在或不属于该用户时返回 false
+func (d *DAO) DeletePost(ctx *gin.Context, postID uint64, userUUID string) (bool, error) {
+	tx := db.GlobalDB.Begin()
+
+	result := tx.Exec("DELETE FROM gallery_posts WHERE id = ? AND user_uuid = ?", postID, userUUID)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "DeletePost error: %s", result.Error.Error())
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	for _, r := range []reaction{likeReaction, favoriteReaction} {
+		if result = tx.Exec("DELETE FROM "+r.table+" WHERE post_id = ?", postID); result.Error != nil {
+			tx.Rollback()
+			logger.Error(ctx, "DeletePost delete %s error: %s", r.table, result.Error.Error())
+			return false, result.Error
+		}
+	}
+
+	return true, tx.Commit().Error
+}
+
+// GetPost 获取单个可见作品, 不存在或已隐藏时返回 nil
+func (d *DAO) GetPost(ctx *gin.Context, postID uint64) (*gallery_do.GalleryPostDetailDO, error) {
+	var posts []*gallery_do.GalleryPostDetailDO
+	sql := postColumns + postFrom + postVisible + " AND p.id = ? LIMIT 1"
+
+	result := db.GlobalDB.Raw(sql, postID).Scan(&posts)
+	if result.Error != nil {
+		logger.Error(ctx, "GetPost error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	if len(posts) == 0 {
+		return nil, nil
+	}
+	return posts[0], nil
+}
+
+// QueryLatestPosts 按发布时间倒序分页查询作品
+func (d *DAO) QueryLatestPosts(ctx *gin.Context, offset, limit int) ([]*gallery_do.GalleryPostDetailDO, int64, error) {
+	total, err := countVisiblePosts(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var posts []*gallery_do.GalleryPostDetailDO
+	sql := postColumns + postFrom + postVisible + " ORDER BY p.created_at DESC, p.id DESC LIMIT ? OFFSET ?"
+
+	result := db.GlobalDB.Raw(sql, limit, offset).Scan(&posts)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryLatestPosts error: %s", result.Error.Error())
+		return nil, 0, result.Error
+	}
+	return posts, total, nil
+}
+
+// QueryTrendingPosts 按 since 之后的点赞数倒序分页查询作品, 点赞数相同时按总点赞数与发布时间排序
+func (d *DAO) QueryTrendingPosts(ctx *gin.Context, since time.Time, offset, limit int) ([]*gallery_do.GalleryPostDetailDO, int64, error) {
+	total, err := countVisiblePosts(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var posts []*gallery_do.GalleryPostDetailDO
+	sql := postColumns + `, COALESCE(r.recent_likes, 0) AS recent_likes` + postFrom + `
+		LEFT JOIN (SELECT post_id, COUNT(*) AS recent_likes FROM gallery_likes WHERE created_at >= ? GROUP BY post_id) r ON r.post_id = p.id` +
+		postVisible + " ORDER BY recent_likes DESC, p.like_count DESC, p.id DESC LIMIT ? OFFSET ?"
+
+	result := db.GlobalDB.Raw(sql, since, limit, offset).Scan(&posts)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryTrendingPosts error: %s", result.Error.Error())
+		return nil, 0, result.Error
+	}
+	return posts, total, nil
+}
+
+// QueryFavoritePosts 按收藏时间倒序分页查询用户收藏的作品
+func (d *DAO) QueryFavoritePosts(ctx *gin.Context, userUUID string, offset, limit int) ([]*gallery_do.GalleryPostDetailDO, int64, error) {
+	var total int64
+	countSQL := `SELECT COUNT(*) FROM gallery_favorites f JOIN gallery_posts p ON p.id = f.post_id
+		JOIN image_generation_tasks t ON t.task_id = p.task_id` + postVisible + " AND f.user_uuid = ?"
+
+	result := db.GlobalDB.Raw(countSQL, userUUID).Scan(&total)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryFavoritePosts count error: %s", result.Error.Error())
+		return nil, 0, result.Error
+	}
+
+	var posts []*gallery_do.GalleryPostDetailDO
+	sql := postColumns + postFrom + `
+		JOIN gallery_favorites f ON f.post_id = p.id` +
+		postVisible + " AND f.user_uuid = ? ORDER BY f.created_at DESC, f.id DESC LIMIT ? OFFSET ?"
+
+	result = db.GlobalDB.Raw(sql, userUUID, limit, offset).Scan(&posts)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryFavoritePosts error: %s", result.Error.Error())
+		return nil, 0, result.Error
+	}
+	return posts, total, nil
+}
+
+// LikePost 点赞, 重复点赞时返回 false
+func (d *DAO) LikePost(ctx *gin.Context, postID uint64, userUUID string) (bool, error) {
+	return addReaction(ctx, likeReaction, postID, userUUID)
+}
+
+// UnlikePost 取消点赞, 未点赞时返回 false
+func (d *DAO) UnlikePost(ctx *gin.Context, postID uint64, userUUID string) (bool, error) {
+	return removeReaction(ctx, likeReaction, postID, userUUID)
+}
+
+// FavoritePost 收藏, 重复收藏时返回 false
+func (d *DAO) FavoritePost(ctx *gin.Context, postID uint64, userUUID string) (bool, error) {
+	return addReaction(ctx, favoriteReaction, postID, userUUID)
+}
+
+// UnfavoritePost 取消收藏, 未收藏时返回 false
+func (d *DAO) UnfavoritePost(ctx *gin.Context, postID uint64, userUUID string) (bool, error) {
+	return removeReaction(ctx, favoriteReaction, postID, userUUID)
+}
+
+// GetUserReactions 查询用户对一批作品的点赞与收藏状态
+func (d *DAO) GetUserReactions(ctx *gin.Context, userUUID string, postIDs []uint64) (map[uint64]bool, map[uint64]bool, error) {
+	liked := make(map[uint64]bool, len(postIDs))
+	favorited := make(map[uint64]bool, len(postIDs))
+	if userUUID == "" || len(postIDs) == 0 {
+		return liked, favorited, nil
+	}
+
+	for _, item := range []struct {
+		r   reaction
+		set map[uint64]bool
+	}{{likeReaction, liked}, {favoriteReaction, favorited}} {
+		var ids []uint64
+		sql := "SELECT post_id FROM " + item.r.table + " WHERE user_uuid = ? AND post_id IN ?"
+
+		result := db.GlobalDB.Raw(sql, userUUID, postIDs).Scan(&ids)
+		if result.Error != nil {
+			logger.Error(ctx, "GetUserReactions %s error: %s", item.r.table, result.Error.Error())
+			return nil, nil, result.Error
+		}
+		for _, id := range ids {
+			item.set[id] = true
+		}
+	}
+	return liked, favorited, nil
+}
+
+// IncrementRemixCount 作品被 remix 时计数加一
+func (d *DAO) IncrementRemixCount(ctx *gin.Context, postID uint64) error {
+	sql := `UPDATE gallery_posts SET remix_count = remix_count + 1 WHERE id = ?`
+
+	if result := db.GlobalDB.Exec(sql, postID); result.Error != nil {
+		logger.Error(ctx, "IncrementRemixCount error: %s", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+func countVisiblePosts(ctx *gin.Context) (int64, error) {
+	var total int64
+	sql := `SELECT COUNT(*) FROM gallery_posts p JOIN image_generation_tasks t ON t.task_id = p.task_id` + postVisible
+
+	result := db.GlobalDB.Raw(sql).Scan(&total)
+	if result.Error != nil {
+		logger.Error(ctx, "countVisiblePosts error: %s", result.Error.Error())
+		return 0, result.Error
+	}
+	return total, nil
+}
+
+// addReaction 写入点赞或收藏记录, 成功写入时同步累加作品计数
+func addReaction(ctx *gin.Context, r reaction, postID uint64, userUUID string) (bool, error) {
+	tx := db.GlobalDB.Begin()
+
+	result := tx.Exec("INSERT IGNORE INTO "+r.table+" (post_id, user_uuid) VALUES (?, ?)", postID, userUUID)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "addReaction %s error: %s", r.table, result.Error.Error())
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if result = tx.Exec("UPDATE gallery_posts SET "+r.counter+" = "+r.counter+" + 1 WHERE id = ?", postID); result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "addReaction update %s error: %s", r.counter, result.Error.Error())
+		return false, result.Error
+	}
+
+	return true, tx.Commit().Error
+}
+
+// removeReaction 删除点赞或收藏记录, 删除成功时同步扣减作品计数
+func removeReaction(ctx *gin.Context, r reaction, postID uint64, userUUID string) (bool, error) {
+	tx := db.GlobalDB.Begin()
+
+	result := tx.Exec("DELETE FROM "+r.table+" WHERE post_id = ? AND user_uuid = ?", postID, userUUID)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "removeReaction %s error: %s", r.table, result.Error.Error())
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	sql := "UPDATE gallery_posts SET " + r.counter + " = " + r.counter + " - 1 WHERE id = ? AND " + r.counter + " > 0"
+	if result = tx.Exec(sql, postID); result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "removeReaction update %s error: %s", r.counter, result.Error.Error())
+		return false, result.Error
+	}
+
+	return true, tx.Commit().Error
+}
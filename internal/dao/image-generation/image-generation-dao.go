@@ -2,14 +2,17 @@
 package imagegeneration
 
 import (
+	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
 	image_generation_query "github.com/Zhiruosama/ai_nexus/internal/domain/query/image-generation"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/db"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/logger"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // DAO 作为 imagegeneration 模块的 dao 结构体
@@ -31,8 +34,8 @@ func (d *DAO) CheckModelExists(ctx *gin.Context, modelID string) (bool, error) {
 
 // CreateModel 创建新模型
 func (d *DAO) CreateModel(ctx *gin.Context, model *image_generation_do.TableImageGenerationModelsDO) error {
-	sql := `INSERT INTO image_generation_models (model_id, model_name, model_type, provider, description, tags, sort_order, is_active, is_recommended, third_party_model_id, base_url, default_width, default_height, max_width, max_height, min_steps, max_steps) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	result := db.GlobalDB.Exec(sql, model.ModelID, model.ModelName, model.ModelType, model.Provider, model.Description, model.Tags, model.SortOrder, model.IsActive, model.IsRecommended, model.ThirdPartyModelID, model.BaseURL, model.DefaultWidth, model.DefaultHeight, model.MaxWidth, model.MaxHeight, model.MinSteps, model.MaxSteps)
+	sql := `INSERT INTO image_generation_models (model_id, model_name, model_type, provider, description, tags, sort_order, is_active, is_recommended, third_party_model_id, base_url, default_width, default_height, max_width, max_height, min_steps, max_steps, max_num_images, credential_id, capabilities) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result := db.GlobalDB.Exec(sql, model.ModelID, model.ModelName, model.ModelType, model.Provider, model.Description, model.Tags, model.SortOrder, model.IsActive, model.IsRecommended, model.ThirdPartyModelID, model.BaseURL, model.DefaultWidth, model.DefaultHeight, model.MaxWidth, model.MaxHeight, model.MinSteps, model.MaxSteps, model.MaxNumImages, NullableID(model.CredentialID), NullableJSON(model.Capabilities))
 
 	if result.Error != nil {
 		logger.Error(ctx, "CreateModel error: %s", result.Error.Error())
@@ -155,30 +158,109 @@ func (d *DAO) UpdateModelUsage(success bool, modelID string) error {
 	return nil
 }
 
-// CreateText2ImgTask 创建文生图任务
-func (d *DAO) CreateText2ImgTask(ctx *gin.Context, do *image_generation_do.TableImageGenerationTaskDO) error {
-	sql := `INSERT INTO image_generation_tasks (task_id, user_uuid, task_type, status, prompt, negative_prompt, model_id, width, height, num_inference_steps, guidance_scale, seed) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	result := db.GlobalDB.Exec(sql, do.TaskID, do.UserUUID, do.TaskType, do.Status, do.Prompt, do.NegativePrompt, do.ModelID, do.Width, do.Height, do.NumInferenceSteps, do.GuidanceScale, do.Seed)
+// CreateText2ImgTask 创建文生图任务, 队列消息在同一事务中写入 outbox, 由 relay 负责投递; 用户未结束的任务数达到 maxInFlight 时返回 false
+func (d *DAO) CreateText2ImgTask(ctx *gin.Context, do *image_generation_do.TableImageGenerationTaskDO, message []byte, maxInFlight int64) (bool, error) {
+	tx := db.GlobalDB.Begin()
 
+	reserved, err := reserveInFlightSlot(tx, do.UserUUID, maxInFlight)
+	if err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "Reserve in-flight slot error: %s", err.Error())
+		return false, err
+	}
+	if !reserved {
+		tx.Rollback()
+		return false, nil
+	}
+
+	sql := `INSERT INTO image_generation_tasks (task_id, user_uuid, task_type, status, priority, prompt, original_prompt, negative_prompt, model_id, width, height, num_inference_steps, guidance_scale, seed, num_images, sampler, credential_id, post_process, queued_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())`
+	result := tx.Exec(sql, do.TaskID, do.UserUUID, do.TaskType, do.Status, do.Priority, do.Prompt, do.OriginalPrompt, do.NegativePrompt, do.ModelID, do.Width, do.Height, do.NumInferenceSteps, do.GuidanceScale, do.Seed, do.NumImages, do.Sampler, NullableID(do.CredentialID), do.PostProcess)
 	if result.Error != nil {
+		tx.Rollback()
 		logger.Error(ctx, "Create text2img task error: %s", result.Error.Error())
-		return result.Error
+		return false, result.Error
 	}
 
-	return nil
+	if err := insertOutbox(tx, do.TaskID, do.TaskType, message); err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "Create text2img outbox error: %s", err.Error())
+		return false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
-// CreateImg2ImgTask 创建图生图任务
-func (d *DAO) CreateImg2ImgTask(ctx *gin.Context, do *image_generation_do.TableImageGenerationTaskDO) error {
-	sql := `INSERT INTO image_generation_tasks (task_id, user_uuid, task_type, status, prompt, negative_prompt, model_id, width, height, num_inference_steps, guidance_scale, seed, input_image_url, strength) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
-	result := db.GlobalDB.Exec(sql, do.TaskID, do.UserUUID, do.TaskType, do.Status, do.Prompt, do.NegativePrompt, do.ModelID, do.Width, do.Height, do.NumInferenceSteps, do.GuidanceScale, do.Seed, do.InputImageURL, do.Strength)
+// CreateImg2ImgTask 创建图生图任务, 队列消息在同一事务中写入 outbox, 由 relay 负责投递; 用户未结束的任务数达到 maxInFlight 时返回 false
+func (d *DAO) CreateImg2ImgTask(ctx *gin.Context, do *image_generation_do.TableImageGenerationTaskDO, message []byte, maxInFlight int64) (bool, error) {
+	tx := db.GlobalDB.Begin()
 
+	reserved, err := reserveInFlightSlot(tx, do.UserUUID, maxInFlight)
+	if err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "Reserve in-flight slot error: %s", err.Error())
+		return false, err
+	}
+	if !reserved {
+		tx.Rollback()
+		return false, nil
+	}
+
+	sql := `INSERT INTO image_generation_tasks (task_id, user_uuid, task_type, status, priority, prompt, original_prompt, negative_prompt, model_id, width, height, num_inference_steps, guidance_scale, seed, input_image_url, strength, num_images, sampler, credential_id, post_process, queued_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())`
+	result := tx.Exec(sql, do.TaskID, do.UserUUID, do.TaskType, do.Status, do.Priority, do.Prompt, do.OriginalPrompt, do.NegativePrompt, do.ModelID, do.Width, do.Height, do.NumInferenceSteps, do.GuidanceScale, do.Seed, do.InputImageURL, do.Strength, do.NumImages, do.Sampler, NullableID(do.CredentialID), do.PostProcess)
 	if result.Error != nil {
+		tx.Rollback()
 		logger.Error(ctx, "Create img2img task error: %s", result.Error.Error())
-		return result.Error
+		return false, result.Error
 	}
 
-	return nil
+	if err := insertOutbox(tx, do.TaskID, do.TaskType, message); err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "Create img2img outbox error: %s", err.Error())
+		return false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CreateMaskedTask 创建局部重绘或扩图任务, 队列消息在同一事务中写入 outbox, 由 relay 负责投递; 用户未结束的任务数达到 maxInFlight 时返回 false
+func (d *DAO) CreateMaskedTask(ctx *gin.Context, do *image_generation_do.TableImageGenerationTaskDO, message []byte, maxInFlight int64) (bool, error) {
+	tx := db.GlobalDB.Begin()
+
+	reserved, err := reserveInFlightSlot(tx, do.UserUUID, maxInFlight)
+	if err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "Reserve in-flight slot error: %s", err.Error())
+		return false, err
+	}
+	if !reserved {
+		tx.Rollback()
+		return false, nil
+	}
+
+	sql := `INSERT INTO image_generation_tasks (task_id, user_uuid, task_type, status, priority, prompt, negative_prompt, model_id, width, height, num_inference_steps, guidance_scale, seed, input_image_url, strength, mask_image_url, extend_left, extend_right, extend_top, extend_bottom, num_images, credential_id, post_process, queued_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOW())`
+	result := tx.Exec(sql, do.TaskID, do.UserUUID, do.TaskType, do.Status, do.Priority, do.Prompt, do.NegativePrompt, do.ModelID, do.Width, do.Height, do.NumInferenceSteps, do.GuidanceScale, do.Seed, do.InputImageURL, do.Strength, do.MaskImageURL, do.ExtendLeft, do.ExtendRight, do.ExtendTop, do.ExtendBottom, do.NumImages, NullableID(do.CredentialID), do.PostProcess)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "Create masked task error: %s", result.Error.Error())
+		return false, result.Error
+	}
+
+	if err := insertOutbox(tx, do.TaskID, do.TaskType, message); err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "Create masked task outbox error: %s", err.Error())
+		return false, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 // DeleteTask 删除任务
@@ -223,6 +305,235 @@ func GetTaskInfo[T any](_ *DAO, key, taskID string) (T, error) {
 	return val, nil
 }
 
+// CompleteTask 仅在任务仍处于处理中时标记为已完成, 并在同一事务中写入全部输出图片, 重试时覆盖上一次的结果
+// 任务已被取消或已由其他实例结束时不做任何修改, 返回 false
+func (d *DAO) CompleteTask(taskID string, imageURLs []string, actualSeed, generationTimeMs int64) (bool, error) {
+	tx := db.GlobalDB.Begin()
+
+	sql := `UPDATE image_generation_tasks
+		SET status = 3, output_image_url = ?, actual_seed = ?, generation_time_ms = ?, completed_at = NOW()
+		WHERE task_id = ? AND status = 2`
+	result := tx.Exec(sql, imageURLs[0], actualSeed, generationTimeMs, taskID)
+	if result.Error != nil {
+		tx.Rollback()
+		log.Printf("CompleteTask error: %s\n", result.Error.Error())
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if result = tx.Exec("DELETE FROM image_generation_outputs WHERE task_id = ?", taskID); result.Error != nil {
+		tx.Rollback()
+		log.Printf("CompleteTask delete outputs error: %s\n", result.Error.Error())
+		return false, result.Error
+	}
+
+	sql = `INSERT INTO image_generation_outputs (task_id, image_index, image_url) VALUES (?, ?, ?)`
+	for i, imageURL := range imageURLs {
+		if result = tx.Exec(sql, taskID, i, imageURL); result.Error != nil {
+			tx.Rollback()
+			log.Printf("CompleteTask insert output error: %s\n", result.Error.Error())
+			return false, result.Error
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Printf("CompleteTask commit error: %s\n", err.Error())
+		return false, err
+	}
+	return true, nil
+}
+
+// GetOutputsByTaskIDs 批量获取任务的输出图片, 按 task_id 分组并保持序号顺序
+func (d *DAO) GetOutputsByTaskIDs(ctx *gin.Context, taskIDs []string) (map[string][]*image_generation_do.TableImageGenerationOutputDO, error) {
+	outputs := make(map[string][]*image_generation_do.TableImageGenerationOutputDO, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return outputs, nil
+	}
+
+	var rows []*image_generation_do.TableImageGenerationOutputDO
+	sql := `SELECT * FROM image_generation_outputs WHERE task_id IN ? ORDER BY task_id, image_index`
+
+	result := db.GlobalDB.Raw(sql, taskIDs).Scan(&rows)
+	if result.Error != nil {
+		logger.Error(ctx, "GetOutputsByTaskIDs error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+
+	for _, row := range rows {
+		outputs[row.TaskID] = append(outputs[row.TaskID], row)
+	}
+	return outputs, nil
+}
+
+// GetImageAccess 根据存储地址查询图片所属用户与公开状态, 输出图片继承任务的公开状态, 上传原图与蒙版始终私有
+func (d *DAO) GetImageAccess(ctx *gin.Context, imageURL string) (*image_generation_do.ImageAccessDO, error) {
+	var rows []*image_generation_do.ImageAccessDO
+	sql := `SELECT t.user_uuid, t.is_public FROM image_generation_outputs o
+		JOIN image_generation_tasks t ON t.task_id = o.task_id
+		WHERE o.image_url = ? OR o.processed_url = ? LIMIT 1`
+
+	result := db.GlobalDB.Raw(sql, imageURL, imageURL).Scan(&rows)
+	if result.Error != nil {
+		logger.Error(ctx, "GetImageAccess error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	if len(rows) > 0 {
+		return rows[0], nil
+	}
+
+	// 早期任务没有 outputs 记录, 以及上传的原图与蒙版
+	sql = `SELECT user_uuid, COALESCE(is_public AND output_image_url = ?, FALSE) AS is_public FROM image_generation_tasks
+		WHERE output_image_url = ? OR input_image_url = ? OR mask_image_url = ? LIMIT 1`
+
+	result = db.GlobalDB.Raw(sql, imageURL, imageURL, imageURL, imageURL).Scan(&rows)
+	if result.Error != nil {
+		logger.Error(ctx, "GetImageAccess error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[0], nil
+}
+
+// GetTaskOutputs 获取单个任务的全部输出图片, 供后处理读取原图
+func (d *DAO) GetTaskOutputs(taskID string) ([]*image_generation_do.TableImageGenerationOutputDO, error) {
+	var rows []*image_generation_do.TableImageGenerationOutputDO
+	sql := `SELECT * FROM image_generation_outputs WHERE task_id = ? ORDER BY image_index`
+
+	result := db.GlobalDB.Raw(sql, taskID).Scan(&rows)
+	if result.Error != nil {
+		log.Printf("GetTaskOutputs error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	return rows, nil
+}
+
+// UpdateProcessedOutputs 写入后处理结果, 下标与原图一一对应, 原图保持不变
+func (d *DAO) UpdateProcessedOutputs(taskID string, processedURLs []string) error {
+	tx := db.GlobalDB.Begin()
+
+	sql := `UPDATE image_generation_outputs SET processed_url = ? WHERE task_id = ? AND image_index = ?`
+	for i, processedURL := range processedURLs {
+		if result := tx.Exec(sql, processedURL, taskID, i); result.Error != nil {
+			tx.Rollback()
+			log.Printf("UpdateProcessedOutputs error: %s\n", result.Error.Error())
+			return result.Error
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// ListExpiredTasks 获取超过保留期限、尚未清理的已结束任务
+// include 为 true 时只查询 tiers 等级的用户, 否则查询其余等级及已注销的用户; 公开任务与死信任务不清理
+func (d *DAO) ListExpiredTasks(tiers []string, include bool, before time.Time, limit int) ([]*image_generation_do.TableImageGenerationTaskDO, error) {
+	sql := `SELECT t.* FROM image_generation_tasks t LEFT JOIN users u ON u.uuid = t.user_uuid
+		WHERE t.status IN (3, 4, 5) AND t.is_public = FALSE AND t.purged_at IS NULL
+		AND COALESCE(t.completed_at, t.updated_at) < ?
+		AND NOT EXISTS (SELECT 1 FROM dead_letter_tasks dl WHERE dl.task_id = t.task_id)`
+	args := []any{before}
+
+	switch {
+	case include:
+		sql += " AND u.tier IN ?"
+		args = append(args, tiers)
+	case len(tiers) > 0:
+		sql += " AND (u.tier IS NULL OR u.tier NOT IN ?)"
+		args = append(args, tiers)
+	}
+
+	sql += " ORDER BY t.id LIMIT ?"
+	args = append(args, limit)
+
+	var tasks []*image_generation_do.TableImageGenerationTaskDO
+	result := db.GlobalDB.Raw(sql, args...).Scan(&tasks)
+	if result.Error != nil {
+		log.Printf("ListExpiredTasks error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	return tasks, nil
+}
+
+// PurgeTaskImages 删除任务的输出记录并清空图片地址, 任务记录本身保留
+func (d *DAO) PurgeTaskImages(taskID string) error {
+	tx := db.GlobalDB.Begin()
+
+	if result := tx.Exec("DELETE FROM image_generation_outputs WHERE task_id = ?", taskID); result.Error != nil {
+		tx.Rollback()
+		log.Printf("PurgeTaskImages delete error: %s\n", result.Error.Error())
+		return result.Error
+	}
+
+	sql := `UPDATE image_generation_tasks SET output_image_url = NULL, input_image_url = NULL, mask_image_url = '', purged_at = NOW()
+		WHERE task_id = ?`
+	if result := tx.Exec(sql, taskID); result.Error != nil {
+		tx.Rollback()
+		log.Printf("PurgeTaskImages update error: %s\n", result.Error.Error())
+		return result.Error
+	}
+
+	return tx.Commit().Error
+}
+
+// ListFinishedTasksWithInputs 获取结束时间早于 before 且仍保留上传原图或蒙版的任务, 死信任务重放需要原图因此跳过
+func (d *DAO) ListFinishedTasksWithInputs(before time.Time, limit int) ([]*image_generation_do.TableImageGenerationTaskDO, error) {
+	sql := `SELECT t.* FROM image_generation_tasks t
+		WHERE t.status IN (3, 4, 5) AND t.purged_at IS NULL
+		AND (COALESCE(t.input_image_url, '') <> '' OR t.mask_image_url <> '')
+		AND COALESCE(t.completed_at, t.updated_at) < ?
+		AND NOT EXISTS (SELECT 1 FROM dead_letter_tasks dl WHERE dl.task_id = t.task_id)
+		ORDER BY t.id LIMIT ?`
+
+	var tasks []*image_generation_do.TableImageGenerationTaskDO
+	result := db.GlobalDB.Raw(sql, before, limit).Scan(&tasks)
+	if result.Error != nil {
+		log.Printf("ListFinishedTasksWithInputs error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	return tasks, nil
+}
+
+// ClearTaskInputs 清空任务的上传原图与蒙版地址
+func (d *DAO) ClearTaskInputs(taskID string) error {
+	sql := `UPDATE image_generation_tasks SET input_image_url = NULL, mask_image_url = '' WHERE task_id = ?`
+
+	if result := db.GlobalDB.Exec(sql, taskID); result.Error != nil {
+		log.Printf("ClearTaskInputs error: %s\n", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// GetReferencedImageURLs 返回 imageURLs 中仍被输出记录或任务引用的地址
+func (d *DAO) GetReferencedImageURLs(imageURLs []string) (map[string]bool, error) {
+	referenced := make(map[string]bool, len(imageURLs))
+	if len(imageURLs) == 0 {
+		return referenced, nil
+	}
+
+	sql := `SELECT image_url AS url FROM image_generation_outputs WHERE image_url IN ?
+		UNION SELECT processed_url FROM image_generation_outputs WHERE processed_url IN ?
+		UNION SELECT output_image_url FROM image_generation_tasks WHERE output_image_url IN ?
+		UNION SELECT input_image_url FROM image_generation_tasks WHERE input_image_url IN ?
+		UNION SELECT mask_image_url FROM image_generation_tasks WHERE mask_image_url IN ?`
+
+	var urls []string
+	result := db.GlobalDB.Raw(sql, imageURLs, imageURLs, imageURLs, imageURLs, imageURLs).Scan(&urls)
+	if result.Error != nil {
+		log.Printf("GetReferencedImageURLs error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+
+	for _, u := range urls {
+		referenced[u] = true
+	}
+	return referenced, nil
+}
+
 // CheckDeadLetterExists 判断是否存在死信任务
 func (d *DAO) CheckDeadLetterExists(taskID string) (bool, error) {
 	var count int64
@@ -248,6 +559,175 @@ func (d *DAO) InsertDeadLetterTask(do *image_generation_do.TableDeadLetterTasksD
 	return nil
 }
 
+// QueryDeadLetters 分页查询死信记录
+func (d *DAO) QueryDeadLetters(ctx *gin.Context, query *image_generation_query.DeadLettersQuery) ([]*image_generation_do.TableDeadLetterTasksDO, int64, error) {
+	base := `SELECT * FROM dead_letter_tasks WHERE 1=1`
+	countBase := `SELECT COUNT(*) FROM dead_letter_tasks WHERE 1=1`
+
+	whereClause, args := buildDeadLetterQueryCondition(query)
+
+	var total int64
+	result := db.GlobalDB.Raw(countBase+whereClause, args...).Scan(&total)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryDeadLetters count error: %s", result.Error.Error())
+		return nil, 0, result.Error
+	}
+
+	offset := query.PageIndex * query.PageSize
+	sql := base + whereClause + " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+	queryArgs := append(args, query.PageSize, offset)
+
+	var deadLetters []*image_generation_do.TableDeadLetterTasksDO
+	result = db.GlobalDB.Raw(sql, queryArgs...).Scan(&deadLetters)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryDeadLetters error: %s", result.Error.Error())
+		return nil, 0, result.Error
+	}
+
+	return deadLetters, total, nil
+}
+
+// GetDeadLetter 获取死信记录, 不存在时返回 nil
+func (d *DAO) GetDeadLetter(ctx *gin.Context, id int64) (*image_generation_do.TableDeadLetterTasksDO, error) {
+	var deadLetters []*image_generation_do.TableDeadLetterTasksDO
+	sql := `SELECT * FROM dead_letter_tasks WHERE id = ?`
+
+	result := db.GlobalDB.Raw(sql, id).Scan(&deadLetters)
+	if result.Error != nil {
+		logger.Error(ctx, "GetDeadLetter error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+
+	if len(deadLetters) == 0 {
+		return nil, nil
+	}
+	return deadLetters[0], nil
+}
+
+// DeleteDeadLetter 删除死信记录
+func (d *DAO) DeleteDeadLetter(ctx *gin.Context, id int64) error {
+	sql := `DELETE FROM dead_letter_tasks WHERE id = ?`
+	result := db.GlobalDB.Exec(sql, id)
+
+	if result.Error != nil {
+		logger.Error(ctx, "DeleteDeadLetter error: %s", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// PurgeDeadLetters 删除指定日期之前进入死信的记录, 返回删除条数
+func (d *DAO) PurgeDeadLetters(ctx *gin.Context, before string) (int64, error) {
+	sql := `DELETE FROM dead_letter_tasks WHERE created_at < ?`
+	result := db.GlobalDB.Exec(sql, before)
+
+	if result.Error != nil {
+		logger.Error(ctx, "PurgeDeadLetters error: %s", result.Error.Error())
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// ResetTaskForReplay 清空任务的重试次数与上次执行结果, 重新置为队列中, 并在同一事务中写入 outbox
+func (d *DAO) ResetTaskForReplay(ctx *gin.Context, taskID string, taskType int8, message []byte) error {
+	tx := db.GlobalDB.Begin()
+
+	sql := `UPDATE image_generation_tasks
+		SET status = 1, retry_count = 0, error_message = NULL, upstream_task_id = '', next_retry_at = NULL,
+		    started_at = NULL, completed_at = NULL, queued_at = NOW()
+		WHERE task_id = ?`
+	if result := tx.Exec(sql, taskID); result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "ResetTaskForReplay error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	if err := insertOutbox(tx, taskID, taskType, message); err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "ResetTaskForReplay outbox error: %s", err.Error())
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// ClaimOutbox 领取一批到期的 outbox 记录, 领取后 available_at 顺延 lease 作为租约
+// 多个实例并发领取时依靠单条 UPDATE 的行锁互斥, 实例崩溃后租约到期会被重新领取
+func (d *DAO) ClaimOutbox(token string, limit int, lease time.Duration) ([]*image_generation_do.TableTaskOutboxDO, error) {
+	sql := `UPDATE task_outbox SET claim_token = ?, available_at = DATE_ADD(NOW(3), INTERVAL ? MICROSECOND)
+		WHERE available_at <= NOW(3) ORDER BY id LIMIT ?`
+	result := db.GlobalDB.Exec(sql, token, lease.Microseconds(), limit)
+	if result.Error != nil {
+		log.Printf("ClaimOutbox error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+
+	var rows []*image_generation_do.TableTaskOutboxDO
+	result = db.GlobalDB.Raw(`SELECT * FROM task_outbox WHERE claim_token = ? ORDER BY id`, token).Scan(&rows)
+	if result.Error != nil {
+		log.Printf("ClaimOutbox select error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+
+	return rows, nil
+}
+
+// DeleteOutbox 投递确认后删除 outbox 记录
+func (d *DAO) DeleteOutbox(id uint64) error {
+	result := db.GlobalDB.Exec(`DELETE FROM task_outbox WHERE id = ?`, id)
+	if result.Error != nil {
+		log.Printf("DeleteOutbox error: %s\n", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// DeadLetterOutbox 投递多次失败的 outbox 记录转入死信: 记录死信、将仍在队列中的任务标记为失败并删除记录, 三步在同一事务中完成
+// 管理员可通过死信重放重新写入 outbox
+func (d *DAO) DeadLetterOutbox(id uint64, taskID, reason string) error {
+	tx := db.GlobalDB.Begin()
+
+	sql := `INSERT INTO dead_letter_tasks (user_id, task_id, task_type, dead_reason, original_status)
+		SELECT user_uuid, task_id, task_type, ?, status FROM image_generation_tasks WHERE task_id = ?
+		ON DUPLICATE KEY UPDATE dead_reason = VALUES(dead_reason), original_status = VALUES(original_status)`
+	if result := tx.Exec(sql, reason, taskID); result.Error != nil {
+		tx.Rollback()
+		log.Printf("DeadLetterOutbox insert error: %s\n", result.Error.Error())
+		return result.Error
+	}
+
+	sql = `UPDATE image_generation_tasks SET status = 4, error_message = ?, completed_at = NOW()
+		WHERE task_id = ? AND status IN (0, 1)`
+	if result := tx.Exec(sql, reason, taskID); result.Error != nil {
+		tx.Rollback()
+		log.Printf("DeadLetterOutbox update task error: %s\n", result.Error.Error())
+		return result.Error
+	}
+
+	if result := tx.Exec(`DELETE FROM task_outbox WHERE id = ?`, id); result.Error != nil {
+		tx.Rollback()
+		log.Printf("DeadLetterOutbox delete error: %s\n", result.Error.Error())
+		return result.Error
+	}
+
+	return tx.Commit().Error
+}
+
+// RescheduleOutbox 投递失败后记录原因, delay 之后再次领取
+func (d *DAO) RescheduleOutbox(id uint64, cause string, delay time.Duration) error {
+	sql := `UPDATE task_outbox SET attempts = attempts + 1, last_error = ?, claim_token = '',
+		available_at = DATE_ADD(NOW(3), INTERVAL ? MICROSECOND) WHERE id = ?`
+	result := db.GlobalDB.Exec(sql, cause, delay.Microseconds(), id)
+	if result.Error != nil {
+		log.Printf("RescheduleOutbox error: %s\n", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
 // CheckTaskExists 检查任务是否存在
 func (d *DAO) CheckTaskExists(ctx *gin.Context, taskID string) (bool, error) {
 	var count int64
@@ -261,6 +741,511 @@ func (d *DAO) CheckTaskExists(ctx *gin.Context, taskID string) (bool, error) {
 	return count > 0, nil
 }
 
+// GetTaskByID 获取指定用户的任务详情
+func (d *DAO) GetTaskByID(ctx *gin.Context, taskID, userUUID string) (*image_generation_do.TableImageGenerationTaskDO, error) {
+	var tasks []*image_generation_do.TableImageGenerationTaskDO
+	sql := `SELECT * FROM image_generation_tasks WHERE task_id = ? AND user_uuid = ?`
+
+	result := db.GlobalDB.Raw(sql, taskID, userUUID).Scan(&tasks)
+	if result.Error != nil {
+		logger.Error(ctx, "GetTaskByID error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+	return tasks[0], nil
+}
+
+// CancelTask 仅在任务尚未结束(待处理/队列中/处理中)时标记为已取消, 返回是否取消成功
+// 条件更新保证与 Worker/Poller 的完成、失败互斥, 已结束的任务不会被覆盖
+func (d *DAO) CancelTask(ctx *gin.Context, taskID, userUUID string) (bool, error) {
+	sql := `UPDATE image_generation_tasks SET status = 5, completed_at = NOW()
+		WHERE task_id = ? AND user_uuid = ? AND status IN (0, 1, 2)`
+
+	result := db.GlobalDB.Exec(sql, taskID, userUUID)
+	if result.Error != nil {
+		logger.Error(ctx, "CancelTask error: %s", result.Error.Error())
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetTask 按任务 ID 读取完整任务, 不依赖请求上下文, 供 Worker 与 Poller 使用
+func (d *DAO) GetTask(taskID string) (*image_generation_do.TableImageGenerationTaskDO, error) {
+	var tasks []*image_generation_do.TableImageGenerationTaskDO
+	sql := `SELECT * FROM image_generation_tasks WHERE task_id = ?`
+
+	result := db.GlobalDB.Raw(sql, taskID).Scan(&tasks)
+	if result.Error != nil {
+		log.Printf("GetTask error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+
+	if len(tasks) == 0 {
+		return nil, nil
+	}
+	return tasks[0], nil
+}
+
+// QueryTasks 分页查询指定用户的任务历史
+func (d *DAO) QueryTasks(ctx *gin.Context, userUUID string, query *image_generation_query.TasksQuery) ([]*image_generation_do.TableImageGenerationTaskDO, int64, error) {
+	base := `SELECT * FROM image_generation_tasks WHERE user_uuid = ?`
+	countBase := `SELECT COUNT(*) FROM image_generation_tasks WHERE user_uuid = ?`
+
+	whereClause, args := buildTaskQueryCondition(query)
+	args = append([]any{userUUID}, args...)
+
+	var total int64
+	result := db.GlobalDB.Raw(countBase+whereClause, args...).Scan(&total)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryTasks count error: %s", result.Error.Error())
+		return nil, 0, result.Error
+	}
+
+	offset := query.PageIndex * query.PageSize
+	sql := base + whereClause + " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+	queryArgs := append(args, query.PageSize, offset)
+
+	var tasks []*image_generation_do.TableImageGenerationTaskDO
+	result = db.GlobalDB.Raw(sql, queryArgs...).Scan(&tasks)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryTasks error: %s", result.Error.Error())
+		return nil, 0, result.Error
+	}
+
+	return tasks, total, nil
+}
+
+// SetUpstreamTask 记录上游任务 ID, 同时登记跟踪该任务的 Poller 实例与租约到期时间
+func (d *DAO) SetUpstreamTask(taskID, upstreamTaskID, instance string, lease time.Duration) error {
+	sql := `UPDATE image_generation_tasks
+		SET upstream_task_id = ?, poller_instance = ?, poller_lease_until = DATE_ADD(NOW(3), INTERVAL ? MICROSECOND)
+		WHERE task_id = ?`
+	result := db.GlobalDB.Exec(sql, upstreamTaskID, instance, lease.Microseconds(), taskID)
+	if result.Error != nil {
+		log.Printf("SetUpstreamTask error: %s\n", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// RenewTrackingLeases 为本实例仍在跟踪的任务续租
+func (d *DAO) RenewTrackingLeases(instance string, taskIDs []string, lease time.Duration) error {
+	if len(taskIDs) == 0 {
+		return nil
+	}
+
+	sql := `UPDATE image_generation_tasks SET poller_lease_until = DATE_ADD(NOW(3), INTERVAL ? MICROSECOND)
+		WHERE poller_instance = ? AND task_id IN ? AND status = 2`
+	result := db.GlobalDB.Exec(sql, lease.Microseconds(), instance, taskIDs)
+	if result.Error != nil {
+		log.Printf("RenewTrackingLeases error: %s\n", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// ListTrackingTasks 获取已提交上游、仍在处理中且可由该实例接管的任务: 属于该实例或租约已过期
+// instance 为空时只返回租约已过期的任务
+func (d *DAO) ListTrackingTasks(instance string) ([]*image_generation_do.TableImageGenerationTaskDO, error) {
+	sql := `SELECT * FROM image_generation_tasks
+		WHERE status = 2 AND upstream_task_id <> ''
+		  AND (poller_instance = ? OR poller_lease_until IS NULL OR poller_lease_until < NOW(3))`
+
+	var tasks []*image_generation_do.TableImageGenerationTaskDO
+	result := db.GlobalDB.Raw(sql, instance).Scan(&tasks)
+	if result.Error != nil {
+		log.Printf("ListTrackingTasks error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	return tasks, nil
+}
+
+// ClaimTrackingTask 接管一个已提交上游的任务, 条件与 ListTrackingTasks 相同
+// 多个实例同时恢复时依靠单条 UPDATE 的行锁互斥, 只有一个实例返回 true
+func (d *DAO) ClaimTrackingTask(taskID, instance string, lease time.Duration) (bool, error) {
+	sql := `UPDATE image_generation_tasks
+		SET poller_instance = ?, poller_lease_until = DATE_ADD(NOW(3), INTERVAL ? MICROSECOND)
+		WHERE task_id = ? AND status = 2
+		  AND (poller_instance = ? OR poller_lease_until IS NULL OR poller_lease_until < NOW(3))`
+	result := db.GlobalDB.Exec(sql, instance, lease.Microseconds(), taskID, instance)
+	if result.Error != nil {
+		log.Printf("ClaimTrackingTask error: %s\n", result.Error.Error())
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CountUserInFlightTasks 统计用户尚未结束(待处理/队列中/处理中)的任务数
+func (d *DAO) CountUserInFlightTasks(ctx *gin.Context, userUUID string) (int64, error) {
+	var count int64
+	sql := `SELECT COUNT(*) FROM image_generation_tasks WHERE user_uuid = ? AND status IN (0, 1, 2)`
+
+	result := db.GlobalDB.Raw(sql, userUUID).Scan(&count)
+	if result.Error != nil {
+		logger.Error(ctx, "CountUserInFlightTasks error: %s", result.Error.Error())
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+// GetQueuePosition 估算任务在同类型队列中的位置, 与 RabbitMQ 一致按优先级降序、入队时间升序排列
+func (d *DAO) GetQueuePosition(ctx *gin.Context, taskID string) (int64, error) {
+	var position int64
+	sql := `SELECT COUNT(*) FROM image_generation_tasks t
+		JOIN image_generation_tasks self ON self.task_id = ?
+		WHERE t.status = 1 AND t.task_type = self.task_type
+		  AND (t.priority > self.priority OR (t.priority = self.priority AND t.queued_at <= self.queued_at))`
+
+	result := db.GlobalDB.Raw(sql, taskID).Scan(&position)
+	if result.Error != nil {
+		logger.Error(ctx, "GetQueuePosition error: %s", result.Error.Error())
+		return 0, result.Error
+	}
+	return position, nil
+}
+
+// CreateCredential 创建生图凭证
+func (d *DAO) CreateCredential(ctx *gin.Context, do *image_generation_do.TableImageProviderCredentialDO) error {
+	sql := `INSERT INTO image_provider_credentials (user_uuid, provider, name, is_active, api_key_enc) VALUES (?, ?, ?, ?, ?)`
+	result := db.GlobalDB.Exec(sql, do.UserUUID, do.Provider, do.Name, do.IsActive, do.APIKeyEnc)
+
+	if result.Error != nil {
+		logger.Error(ctx, "CreateCredential error: %s", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// UpdateCredential 更新生图凭证, userUUID 为空表示平台凭证
+func (d *DAO) UpdateCredential(ctx *gin.Context, id uint64, userUUID string, updates map[string]any) error {
+	set := make([]string, 0, len(updates))
+	args := make([]any, 0, len(updates)+2)
+
+	for k, v := range updates {
+		set = append(set, k+" = ?")
+		args = append(args, v)
+	}
+
+	sql := "UPDATE image_provider_credentials SET " + strings.Join(set, ", ") + " WHERE id = ? AND user_uuid = ?"
+	args = append(args, id, userUUID)
+
+	result := db.GlobalDB.Exec(sql, args...)
+	if result.Error != nil {
+		logger.Error(ctx, "UpdateCredential error: %s", result.Error.Error())
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("credential does not exist")
+	}
+	return nil
+}
+
+// DeleteCredential 删除生图凭证
+func (d *DAO) DeleteCredential(ctx *gin.Context, id uint64, userUUID string) error {
+	sql := "DELETE FROM image_provider_credentials WHERE id = ? AND user_uuid = ?"
+	result := db.GlobalDB.Exec(sql, id, userUUID)
+
+	if result.Error != nil {
+		logger.Error(ctx, "DeleteCredential error: %s", result.Error.Error())
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("credential does not exist")
+	}
+	return nil
+}
+
+// QueryCredentials 查询某个归属下的全部生图凭证
+func (d *DAO) QueryCredentials(ctx *gin.Context, userUUID string) ([]*image_generation_do.TableImageProviderCredentialDO, error) {
+	sql := "SELECT * FROM image_provider_credentials WHERE user_uuid = ? ORDER BY created_at DESC"
+
+	var credentials []*image_generation_do.TableImageProviderCredentialDO
+	result := db.GlobalDB.Raw(sql, userUUID).Scan(&credentials)
+	if result.Error != nil {
+		logger.Error(ctx, "QueryCredentials error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	return credentials, nil
+}
+
+// GetCredential 获取启用中的生图凭证, 不存在时返回 nil
+func (d *DAO) GetCredential(id uint64, userUUID string) (*image_generation_do.TableImageProviderCredentialDO, error) {
+	sql := "SELECT * FROM image_provider_credentials WHERE id = ? AND user_uuid = ? AND is_active = TRUE"
+
+	var credential image_generation_do.TableImageProviderCredentialDO
+	result := db.GlobalDB.Raw(sql, id, userUUID).Scan(&credential)
+	if result.Error != nil {
+		log.Printf("GetCredential error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &credential, nil
+}
+
+// GetModelCredentialID 获取模型绑定的平台凭证 ID, 未绑定时返回 0
+func (d *DAO) GetModelCredentialID(modelID string) (uint64, error) {
+	sql := "SELECT credential_id FROM image_generation_models WHERE model_id = ?"
+
+	var model image_generation_do.TableImageGenerationModelsDO
+	result := db.GlobalDB.Raw(sql, modelID).Scan(&model)
+	if result.Error != nil {
+		log.Printf("GetModelCredentialID error: %s\n", result.Error.Error())
+		return 0, result.Error
+	}
+	return model.CredentialID, nil
+}
+
+// reserveInFlightSlot 在创建任务的事务中锁定用户行后再统计未结束的任务, 同一用户的并发提交在此串行, 不会突破上限
+// 统计语句在取得行锁之后才建立一致性读视图, 能看到先提交的并发事务写入的任务
+func reserveInFlightSlot(tx *gorm.DB, userUUID string, maxInFlight int64) (bool, error) {
+	var locked []string
+	if err := tx.Raw(`SELECT uuid FROM users WHERE uuid = ? FOR UPDATE`, userUUID).Scan(&locked).Error; err != nil {
+		return false, err
+	}
+
+	var count int64
+	sql := `SELECT COUNT(*) FROM image_generation_tasks WHERE user_uuid = ? AND status IN (0, 1, 2)`
+	if err := tx.Raw(sql, userUUID).Scan(&count).Error; err != nil {
+		return false, err
+	}
+	return count < maxInFlight, nil
+}
+
+// GetUserTier 获取用户等级, 用户不存在时返回空串
+func (d *DAO) GetUserTier(ctx *gin.Context, userUUID string) (string, error) {
+	var tier string
+	sql := `SELECT tier FROM users WHERE uuid = ?`
+
+	result := db.GlobalDB.Raw(sql, userUUID).Scan(&tier)
+	if result.Error != nil {
+		logger.Error(ctx, "GetUserTier error: %s", result.Error.Error())
+		return "", result.Error
+	}
+	return tier, nil
+}
+
+// insertOutbox 在事务中写入一条待投递的队列消息
+func insertOutbox(tx *gorm.DB, taskID string, taskType int8, message []byte) error {
+	sql := `INSERT INTO task_outbox (task_id, task_type, message) VALUES (?, ?, ?)`
+	return tx.Exec(sql, taskID, taskType, string(message)).Error
+}
+
+// RecordModelHealthEvent 记录一次模型上游调用结果
+func (d *DAO) RecordModelHealthEvent(event *image_generation_do.TableModelHealthEventDO) error {
+	sql := `INSERT INTO model_health_events (model_id, success, generation_time_ms, error_class, is_probe) VALUES (?, ?, ?, ?, ?)`
+
+	result := db.GlobalDB.Exec(sql, event.ModelID, event.Success, event.GenerationTimeMs, event.ErrorClass, event.IsProbe)
+	if result.Error != nil {
+		log.Printf("RecordModelHealthEvent error: %s\n", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// ListModelHealthEvents 获取模型在 since 之后且在重新启用之后的调用记录, 不含探测记录
+func (d *DAO) ListModelHealthEvents(modelID string, since time.Time) ([]*image_generation_do.TableModelHealthEventDO, error) {
+	sql := `SELECT e.* FROM model_health_events e JOIN image_generation_models m ON m.model_id = e.model_id
+		WHERE e.model_id = ? AND e.is_probe = FALSE AND e.created_at >= ?
+		AND (m.health_reset_at IS NULL OR e.created_at >= m.health_reset_at)
+		ORDER BY e.id`
+
+	var events []*image_generation_do.TableModelHealthEventDO
+	result := db.GlobalDB.Raw(sql, modelID, since).Scan(&events)
+	if result.Error != nil {
+		log.Printf("ListModelHealthEvents error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	return events, nil
+}
+
+// ListModels 获取全部模型, 按排序权重降序
+func (d *DAO) ListModels(ctx *gin.Context) ([]*image_generation_do.TableImageGenerationModelsDO, error) {
+	sql := `SELECT * FROM image_generation_models ORDER BY sort_order DESC, created_at DESC`
+
+	var models []*image_generation_do.TableImageGenerationModelsDO
+	result := db.GlobalDB.Raw(sql).Scan(&models)
+	if result.Error != nil {
+		logger.Error(ctx, "ListModels error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	return models, nil
+}
+
+// ListActiveModelIDs 获取全部启用中的模型ID
+func (d *DAO) ListActiveModelIDs() ([]string, error) {
+	sql := `SELECT model_id FROM image_generation_models WHERE is_active = TRUE`
+
+	var modelIDs []string
+	result := db.GlobalDB.Raw(sql).Scan(&modelIDs)
+	if result.Error != nil {
+		log.Printf("ListActiveModelIDs error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	return modelIDs, nil
+}
+
+// ListModelsDueForProbe 获取被自动停用且距上次探测超过 interval 的模型
+func (d *DAO) ListModelsDueForProbe(interval time.Duration) ([]*image_generation_do.TableImageGenerationModelsDO, error) {
+	sql := `SELECT * FROM image_generation_models
+		WHERE is_active = FALSE AND auto_disabled_at IS NOT NULL
+		AND (last_probe_at IS NULL OR last_probe_at < ?)`
+
+	var models []*image_generation_do.TableImageGenerationModelsDO
+	result := db.GlobalDB.Raw(sql, time.Now().Add(-interval)).Scan(&models)
+	if result.Error != nil {
+		log.Printf("ListModelsDueForProbe error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	return models, nil
+}
+
+// DisableUnhealthyModel 健康检查自动停用模型, 模型已停用时返回 false
+func (d *DAO) DisableUnhealthyModel(modelID, reason string) (bool, error) {
+	sql := `UPDATE image_generation_models SET is_active = FALSE, auto_disabled_at = NOW(), disabled_reason = ?, last_probe_at = NOW()
+		WHERE model_id = ? AND is_active = TRUE`
+
+	result := db.GlobalDB.Exec(sql, reason, modelID)
+	if result.Error != nil {
+		log.Printf("DisableUnhealthyModel error: %s\n", result.Error.Error())
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReactivateModel 探测成功后重新启用自动停用的模型, 管理员已手动处理时返回 false
+func (d *DAO) ReactivateModel(modelID string) (bool, error) {
+	sql := `UPDATE image_generation_models SET is_active = TRUE, auto_disabled_at = NULL, disabled_reason = '', health_reset_at = NOW()
+		WHERE model_id = ? AND auto_disabled_at IS NOT NULL`
+
+	result := db.GlobalDB.Exec(sql, modelID)
+	if result.Error != nil {
+		log.Printf("ReactivateModel error: %s\n", result.Error.Error())
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UpdateModelProbeTime 记录模型的探测时间
+func (d *DAO) UpdateModelProbeTime(modelID string) error {
+	sql := `UPDATE image_generation_models SET last_probe_at = NOW() WHERE model_id = ?`
+
+	result := db.GlobalDB.Exec(sql, modelID)
+	if result.Error != nil {
+		log.Printf("UpdateModelProbeTime error: %s\n", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// PurgeModelHealthEvents 删除 before 之前的调用记录, 返回删除的条数
+func (d *DAO) PurgeModelHealthEvents(before time.Time) (int64, error) {
+	sql := `DELETE FROM model_health_events WHERE created_at < ?`
+
+	result := db.GlobalDB.Exec(sql, before)
+	if result.Error != nil {
+		log.Printf("PurgeModelHealthEvents error: %s\n", result.Error.Error())
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// NullableID 将 0 转换为 NULL 写入可空外键列
+func NullableID(id uint64) any {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+// NullableJSON 将空串转换为 NULL 写入 JSON 列, MySQL 不接受空串作为 JSON 值
+func NullableJSON(data string) any {
+	if data == "" {
+		return nil
+	}
+	return data
+}
+
+// buildTaskQueryCondition 构建任务历史查询条件
+func buildTaskQueryCondition(query *image_generation_query.TasksQuery) (string, []any) {
+	where := make([]string, 0)
+	args := make([]any, 0)
+
+	if query.Status != nil {
+		where = append(where, "status = ?")
+		args = append(args, *query.Status)
+	}
+
+	if query.ModelID != nil && *query.ModelID != "" {
+		where = append(where, "model_id = ?")
+		args = append(args, *query.ModelID)
+	}
+
+	if query.TaskType != nil {
+		where = append(where, "task_type = ?")
+		args = append(args, *query.TaskType)
+	}
+
+	if query.StartDate != nil && *query.StartDate != "" {
+		where = append(where, "created_at >= ?")
+		args = append(args, *query.StartDate)
+	}
+
+	if query.EndDate != nil && *query.EndDate != "" {
+		where = append(where, "created_at < DATE_ADD(?, INTERVAL 1 DAY)")
+		args = append(args, *query.EndDate)
+	}
+
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = " AND " + strings.Join(where, " AND ")
+	}
+
+	return whereClause, args
+}
+
+// buildDeadLetterQueryCondition 构建死信记录查询条件
+func buildDeadLetterQueryCondition(query *image_generation_query.DeadLettersQuery) (string, []any) {
+	where := make([]string, 0)
+	args := make([]any, 0)
+
+	if query.Reason != nil && *query.Reason != "" {
+		where = append(where, "dead_reason LIKE ?")
+		args = append(args, "%"+*query.Reason+"%")
+	}
+
+	if query.UserID != nil && *query.UserID != "" {
+		where = append(where, "user_id = ?")
+		args = append(args, *query.UserID)
+	}
+
+	if query.TaskType != nil {
+		where = append(where, "task_type = ?")
+		args = append(args, *query.TaskType)
+	}
+
+	if query.StartDate != nil && *query.StartDate != "" {
+		where = append(where, "created_at >= ?")
+		args = append(args, *query.StartDate)
+	}
+
+	if query.EndDate != nil && *query.EndDate != "" {
+		where = append(where, "created_at < DATE_ADD(?, INTERVAL 1 DAY)")
+		args = append(args, *query.EndDate)
+	}
+
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = " AND " + strings.Join(where, " AND ")
+	}
+
+	return whereClause, args
+}
+
 // buildQueryCondition 构建查询条件
 func buildQueryCondition(query *image_generation_query.ModelsQuery) (string, []any) {
 	where := make([]string, 0)
@@ -2,6 +2,8 @@
 package user
 
 import (
+	"log"
+	"strings"
 	"time"
 
 	user_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/user"
@@ -92,7 +94,7 @@ func (d *DAO) GetPasswordByEmail(ctx *gin.Context, email string) (uuid string, p
 // GetUserByID 根据UUID获取用户
 func (d *DAO) GetUserByID(ctx *gin.Context, userid string) (userDO *user_do.TableUserDO, err error) {
 	userDO = &user_do.TableUserDO{}
-	sql := `SELECT uuid,nickname,email,avatar from users WHERE uuid = ?`
+	sql := `SELECT uuid,nickname,email,avatar,role from users WHERE uuid = ?`
 
 	result := db.GlobalDB.Raw(sql, userid).Scan(userDO)
 	if result.Error != nil {
@@ -118,7 +120,7 @@ func (d *DAO) UpdateLoginTime(ctx *gin.Context, userid string) error {
 // GetAllUsers 查询所有用户信息
 func (d *DAO) GetAllUsers(ctx *gin.Context) ([]*user_do.TableUserDO, int, error) {
 	var users = make([]*user_do.TableUserDO, 0)
-	sql := `SELECT id, uuid, nickname, avatar, email, last_login, created_at, updated_at FROM users`
+	sql := `SELECT id, uuid, nickname, avatar, email, role, last_login, created_at, updated_at FROM users`
 
 	result := db.GlobalDB.Raw(sql).Scan(&users)
 	if result.Error != nil {
@@ -140,7 +142,7 @@ func (d *DAO) GetAllUsersByPage(ctx *gin.Context, query *user_query.GetAllUsersQ
 	}
 
 	var users = make([]*user_do.TableUserDO, 0)
-	sql := `SELECT id, uuid, nickname, avatar, email, last_login, created_at, updated_at FROM users LIMIT ? OFFSET ?`
+	sql := `SELECT id, uuid, nickname, avatar, email, role, last_login, created_at, updated_at FROM users LIMIT ? OFFSET ?`
 	result = db.GlobalDB.Raw(sql, query.PageSize, query.PageIndex*query.PageSize).Scan(&users)
 	if result.Error != nil {
 		logger.Error(ctx, "GetAllUsersByPage query error: %s", result.Error.Error())
@@ -212,6 +214,30 @@ func (d *DAO) DestroyUser(ctx *gin.Context, uuid string) error {
 		return result.Error
 	}
 
+	sql = `DELETE FROM user_recovery_codes WHERE user_uuid = ?`
+
+	result = db.GlobalDB.Exec(sql, uuid)
+	if result.Error != nil {
+		logger.Error(ctx, "destroy recovery codes error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	sql = `DELETE FROM user_totp WHERE user_uuid = ?`
+
+	result = db.GlobalDB.Exec(sql, uuid)
+	if result.Error != nil {
+		logger.Error(ctx, "destroy totp error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	sql = `DELETE FROM user_identities WHERE user_uuid = ?`
+
+	result = db.GlobalDB.Exec(sql, uuid)
+	if result.Error != nil {
+		logger.Error(ctx, "destroy identities error: %s", result.Error.Error())
+		return result.Error
+	}
+
 	sql = `DELETE FROM users WHERE uuid = ?`
 
 	result = db.GlobalDB.Exec(sql, uuid)
@@ -237,6 +263,370 @@ func (d *DAO) GetUserIDByEmail(ctx *gin.Context, email string) (string, error) {
 	return uuid, nil
 }
 
+// ListRoles 查询全部角色, 内置角色在前
+func (d *DAO) ListRoles(ctx *gin.Context) ([]*user_do.TableRoleDO, error) {
+	var roles = make([]*user_do.TableRoleDO, 0)
+	sql := `SELECT name, description, COALESCE(permissions, '[]') AS permissions, is_builtin, created_at, updated_at
+		FROM roles ORDER BY is_builtin DESC, name`
+
+	result := db.GlobalDB.Raw(sql).Scan(&roles)
+	if result.Error != nil {
+		logger.Error(ctx, "ListRoles query error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	return roles, nil
+}
+
+// GetRole 根据角色名查询角色, 不存在时返回 nil
+func (d *DAO) GetRole(ctx *gin.Context, name string) (*user_do.TableRoleDO, error) {
+	var roles []*user_do.TableRoleDO
+	sql := `SELECT name, description, COALESCE(permissions, '[]') AS permissions, is_builtin, created_at, updated_at
+		FROM roles WHERE name = ?`
+
+	result := db.GlobalDB.Raw(sql, name).Scan(&roles)
+	if result.Error != nil {
+		logger.Error(ctx, "GetRole query error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	if len(roles) == 0 {
+		return nil, nil
+	}
+	return roles[0], nil
+}
+
+// CreateRole 创建自定义角色
+func (d *DAO) CreateRole(ctx *gin.Context, role *user_do.TableRoleDO) error {
+	sql := `INSERT INTO roles (name, description, permissions, is_builtin) VALUES (?, ?, ?, FALSE)`
+
+	result := db.GlobalDB.Exec(sql, role.Name, role.Description, role.Permissions)
+	if result.Error != nil {
+		logger.Error(ctx, "CreateRole insert error: %s", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// UpdateRole 更新自定义角色的描述与权限, 内置角色不会被修改
+func (d *DAO) UpdateRole(ctx *gin.Context, role *user_do.TableRoleDO) error {
+	sql := `UPDATE roles SET description = ?, permissions = ? WHERE name = ? AND is_builtin = FALSE`
+
+	result := db.GlobalDB.Exec(sql, role.Description, role.Permissions, role.Name)
+	if result.Error != nil {
+		logger.Error(ctx, "UpdateRole update error: %s", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// DeleteRole 删除自定义角色, 持有该角色的用户在同一事务中降为普通用户
+func (d *DAO) DeleteRole(ctx *gin.Context, name, fallback string) error {
+	tx := db.GlobalDB.Begin()
+
+	sql := `UPDATE users SET role = ? WHERE role = ?`
+	result := tx.Exec(sql, fallback, name)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "DeleteRole reset users error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	sql = `DELETE FROM roles WHERE name = ? AND is_builtin = FALSE`
+	result = tx.Exec(sql, name)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "DeleteRole delete error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	return tx.Commit().Error
+}
+
+// AssignRole 修改用户角色, 返回用户是否存在
+func (d *DAO) AssignRole(ctx *gin.Context, uuid, role string) (bool, error) {
+	var count int64
+	sql := `SELECT COUNT(*) FROM users WHERE uuid = ?`
+	result := db.GlobalDB.Raw(sql, uuid).Scan(&count)
+	if result.Error != nil {
+		logger.Error(ctx, "AssignRole count error: %s", result.Error.Error())
+		return false, result.Error
+	}
+	if count == 0 {
+		return false, nil
+	}
+
+	sql = `UPDATE users SET role = ? WHERE uuid = ?`
+	result = db.GlobalDB.Exec(sql, role, uuid)
+	if result.Error != nil {
+		logger.Error(ctx, "AssignRole update error: %s", result.Error.Error())
+		return false, result.Error
+	}
+	return true, nil
+}
+
+// PromoteUsersByEmail 把指定邮箱的用户设置为 role, 返回实际修改的用户数, 已是该角色的用户不计入
+func (d *DAO) PromoteUsersByEmail(emails []string, role string) (int64, error) {
+	sql := `UPDATE users SET role = ? WHERE email IN ? AND role <> ?`
+
+	result := db.GlobalDB.Exec(sql, role, emails, role)
+	if result.Error != nil {
+		log.Printf("PromoteUsersByEmail update error: %s\n", result.Error.Error())
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// ListUserUUIDsByRole 查询持有指定角色的全部用户 UUID
+func (d *DAO) ListUserUUIDsByRole(role string) ([]string, error) {
+	var uuids []string
+	sql := `SELECT uuid FROM users WHERE role = ?`
+
+	result := db.GlobalDB.Raw(sql, role).Scan(&uuids)
+	if result.Error != nil {
+		log.Printf("ListUserUUIDsByRole query error: %s\n", result.Error.Error())
+		return nil, result.Error
+	}
+	return uuids, nil
+}
+
+// GetTOTP 查询用户的两步验证配置, 未绑定时返回 nil
+func (d *DAO) GetTOTP(ctx *gin.Context, uuid string) (*user_do.TableUserTOTPDO, error) {
+	var rows []*user_do.TableUserTOTPDO
+	sql := `SELECT user_uuid, secret_enc, enabled, last_used_step, enabled_at, created_at FROM user_totp WHERE user_uuid = ?`
+
+	result := db.GlobalDB.Raw(sql, uuid).Scan(&rows)
+	if result.Error != nil {
+		logger.Error(ctx, "GetTOTP query error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return rows[0], nil
+}
+
+// SaveTOTPSecret 保存待确认的 TOTP 密钥, 已启用的配置不会被覆盖, 返回是否保存成功
+func (d *DAO) SaveTOTPSecret(ctx *gin.Context, uuid string, secretEnc []byte) (bool, error) {
+	sql := `INSERT INTO user_totp (user_uuid, secret_enc, enabled, last_used_step) VALUES (?, ?, FALSE, 0)
+		ON DUPLICATE KEY UPDATE
+			secret_enc = IF(enabled, secret_enc, VALUES(secret_enc)),
+			last_used_step = IF(enabled, last_used_step, 0)`
+
+	result := db.GlobalDB.Exec(sql, uuid, secretEnc)
+	if result.Error != nil {
+		logger.Error(ctx, "SaveTOTPSecret upsert error: %s", result.Error.Error())
+		return false, result.Error
+	}
+
+	// 已启用时 ON DUPLICATE KEY UPDATE 不改变任何列, 影响行数为 0
+	return result.RowsAffected > 0, nil
+}
+
+// EnableTOTP 启用两步验证并写入恢复码, 返回是否启用成功
+func (d *DAO) EnableTOTP(ctx *gin.Context, uuid string, step int64, codeHashes []string) (bool, error) {
+	tx := db.GlobalDB.Begin()
+
+	sql := `UPDATE user_totp SET enabled = TRUE, enabled_at = NOW(), last_used_step = ? WHERE user_uuid = ? AND enabled = FALSE`
+	result := tx.Exec(sql, step, uuid)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "EnableTOTP update error: %s", result.Error.Error())
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return false, nil
+	}
+
+	if err := replaceRecoveryCodes(tx, uuid, codeHashes); err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "EnableTOTP replace recovery codes error: %s", err.Error())
+		return false, err
+	}
+
+	return true, tx.Commit().Error
+}
+
+// DisableTOTP 关闭两步验证, 同时删除密钥与全部恢复码
+func (d *DAO) DisableTOTP(ctx *gin.Context, uuid string) error {
+	tx := db.GlobalDB.Begin()
+
+	sql := `DELETE FROM user_recovery_codes WHERE user_uuid = ?`
+	result := tx.Exec(sql, uuid)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "DisableTOTP delete recovery codes error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	sql = `DELETE FROM user_totp WHERE user_uuid = ?`
+	result = tx.Exec(sql, uuid)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "DisableTOTP delete error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	return tx.Commit().Error
+}
+
+// ConsumeTOTPStep 记录已使用的时间步, 时间步不大于上次使用值时返回 false, 防止验证码被重放
+func (d *DAO) ConsumeTOTPStep(ctx *gin.Context, uuid string, step int64) (bool, error) {
+	sql := `UPDATE user_totp SET last_used_step = ? WHERE user_uuid = ? AND enabled = TRUE AND last_used_step < ?`
+
+	result := db.GlobalDB.Exec(sql, step, uuid, step)
+	if result.Error != nil {
+		logger.Error(ctx, "ConsumeTOTPStep update error: %s", result.Error.Error())
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ConsumeRecoveryCode 将未使用的恢复码标记为已使用, 恢复码不存在或已使用时返回 false
+func (d *DAO) ConsumeRecoveryCode(ctx *gin.Context, uuid, codeHash string) (bool, error) {
+	sql := `UPDATE user_recovery_codes SET used_at = NOW() WHERE user_uuid = ? AND code_hash = ? AND used_at IS NULL`
+
+	result := db.GlobalDB.Exec(sql, uuid, codeHash)
+	if result.Error != nil {
+		logger.Error(ctx, "ConsumeRecoveryCode update error: %s", result.Error.Error())
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ReplaceRecoveryCodes 重新生成恢复码, 旧的恢复码全部作废
+func (d *DAO) ReplaceRecoveryCodes(ctx *gin.Context, uuid string, codeHashes []string) error {
+	tx := db.GlobalDB.Begin()
+
+	if err := replaceRecoveryCodes(tx, uuid, codeHashes); err != nil {
+		tx.Rollback()
+		logger.Error(ctx, "ReplaceRecoveryCodes error: %s", err.Error())
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// CountRecoveryCodes 统计用户剩余可用的恢复码数量
+func (d *DAO) CountRecoveryCodes(ctx *gin.Context, uuid string) (int64, error) {
+	var count int64
+	sql := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_uuid = ? AND used_at IS NULL`
+
+	result := db.GlobalDB.Raw(sql, uuid).Scan(&count)
+	if result.Error != nil {
+		logger.Error(ctx, "CountRecoveryCodes query error: %s", result.Error.Error())
+		return 0, result.Error
+	}
+	return count, nil
+}
+
+// replaceRecoveryCodes 在事务中删除旧恢复码并批量写入新恢复码
+func replaceRecoveryCodes(tx *gorm.DB, uuid string, codeHashes []string) error {
+	sql := `DELETE FROM user_recovery_codes WHERE user_uuid = ?`
+	if err := tx.Exec(sql, uuid).Error; err != nil {
+		return err
+	}
+
+	if len(codeHashes) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(codeHashes))
+	args := make([]any, 0, len(codeHashes)*2)
+	for _, hash := range codeHashes {
+		values = append(values, "(?, ?)")
+		args = append(args, uuid, hash)
+	}
+
+	sql = `INSERT INTO user_recovery_codes (user_uuid, code_hash) VALUES ` + strings.Join(values, ", ")
+	return tx.Exec(sql, args...).Error
+}
+
+// GetUserIDByIdentity 根据第三方账号查询绑定的用户, 未绑定时返回空串
+func (d *DAO) GetUserIDByIdentity(ctx *gin.Context, provider, subject string) (string, error) {
+	var uuid string
+	sql := `SELECT user_uuid FROM user_identities WHERE provider = ? AND subject = ?`
+
+	result := db.GlobalDB.Raw(sql, provider, subject).Scan(&uuid)
+	if result.Error != nil {
+		logger.Error(ctx, "GetUserIDByIdentity query error: %s", result.Error.Error())
+		return "", result.Error
+	}
+	return uuid, nil
+}
+
+// CreateIdentity 为已有用户绑定第三方账号
+func (d *DAO) CreateIdentity(ctx *gin.Context, identity *user_do.TableUserIdentityDO) error {
+	sql := `INSERT INTO user_identities (user_uuid, provider, subject, email, last_login_at) VALUES (?, ?, ?, ?, NOW())`
+
+	result := db.GlobalDB.Exec(sql, identity.UserUUID, identity.Provider, identity.Subject, identity.Email)
+	if result.Error != nil {
+		logger.Error(ctx, "CreateIdentity insert error: %s", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// CreateUserWithIdentity 第三方账号首次登录且邮箱未注册时, 在同一事务中创建用户并绑定
+func (d *DAO) CreateUserWithIdentity(ctx *gin.Context, userDO *user_do.TableUserDO, identity *user_do.TableUserIdentityDO) error {
+	tx := db.GlobalDB.Begin()
+
+	sql := `INSERT INTO users (uuid, avatar, nickname, email, password_hash) VALUES (?, ?, ?, ?, ?)`
+	result := tx.Exec(sql, userDO.UUID, userDO.Avatar, userDO.Nickname, userDO.Email, userDO.PasswordHash)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "CreateUserWithIdentity insert user error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	sql = `INSERT INTO user_identities (user_uuid, provider, subject, email, last_login_at) VALUES (?, ?, ?, ?, NOW())`
+	result = tx.Exec(sql, userDO.UUID, identity.Provider, identity.Subject, identity.Email)
+	if result.Error != nil {
+		tx.Rollback()
+		logger.Error(ctx, "CreateUserWithIdentity insert identity error: %s", result.Error.Error())
+		return result.Error
+	}
+
+	return tx.Commit().Error
+}
+
+// TouchIdentity 更新第三方账号的邮箱与最近登录时间
+func (d *DAO) TouchIdentity(ctx *gin.Context, provider, subject, email string) error {
+	sql := `UPDATE user_identities SET email = ?, last_login_at = NOW() WHERE provider = ? AND subject = ?`
+
+	result := db.GlobalDB.Exec(sql, email, provider, subject)
+	if result.Error != nil {
+		logger.Error(ctx, "TouchIdentity update error: %s", result.Error.Error())
+		return result.Error
+	}
+	return nil
+}
+
+// ListIdentities 查询用户绑定的全部第三方账号
+func (d *DAO) ListIdentities(ctx *gin.Context, uuid string) ([]*user_do.TableUserIdentityDO, error) {
+	var identities = make([]*user_do.TableUserIdentityDO, 0)
+	sql := `SELECT id, user_uuid, provider, subject, email, last_login_at, created_at
+		FROM user_identities WHERE user_uuid = ? ORDER BY created_at`
+
+	result := db.GlobalDB.Raw(sql, uuid).Scan(&identities)
+	if result.Error != nil {
+		logger.Error(ctx, "ListIdentities query error: %s", result.Error.Error())
+		return nil, result.Error
+	}
+	return identities, nil
+}
+
+// DeleteIdentity 解绑用户的第三方账号, 返回是否存在绑定
+func (d *DAO) DeleteIdentity(ctx *gin.Context, uuid, provider string) (bool, error) {
+	sql := `DELETE FROM user_identities WHERE user_uuid = ? AND provider = ?`
+
+	result := db.GlobalDB.Exec(sql, uuid, provider)
+	if result.Error != nil {
+		logger.Error(ctx, "DeleteIdentity delete error: %s", result.Error.Error())
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
 // userCredentials 接收查询结果
 type userCredentials struct {
 	UUID         string `gorm:"column:uuid"`
@@ -0,0 +1,49 @@
+// Package gallery 对应画廊相关表中的 DO 结构
+package gallery
+
+// TableGalleryPostDO 对应 gallery_posts 表中的 DO 结构
+type TableGalleryPostDO struct {
+	ID            uint64 `gorm:"column:id" json:"id"`
+	TaskID        string `gorm:"column:task_id" json:"task_id"`
+	UserUUID      string `gorm:"column:user_uuid" json:"user_uuid"`
+	Title         string `gorm:"column:title" json:"title"`
+	LikeCount     int64  `gorm:"column:like_count" json:"like_count"`
+	FavoriteCount int64  `gorm:"column:favorite_count" json:"favorite_count"`
+	RemixCount    int64  `gorm:"column:remix_count" json:"remix_count"`
+	CreatedAt     string `gorm:"column:created_at" json:"created_at"`
+}
+
+// GalleryPostDetailDO 作品连同任务生成参数与作者信息
+type GalleryPostDetailDO struct {
+	ID            uint64 `gorm:"column:id"`
+	TaskID        string `gorm:"column:task_id"`
+	UserUUID      string `gorm:"column:user_uuid"`
+	Title         string `gorm:"column:title"`
+	LikeCount     int64  `gorm:"column:like_count"`
+	FavoriteCount int64  `gorm:"column:favorite_count"`
+	RemixCount    int64  `gorm:"column:remix_count"`
+	CreatedAt     string `gorm:"column:created_at"`
+
+	// 作者
+	Nickname string `gorm:"column:nickname"`
+	Avatar   string `gorm:"column:avatar"`
+
+	// 生成参数
+	TaskType          int8    `gorm:"column:task_type"`
+	Prompt            string  `gorm:"column:prompt"`
+	NegativePrompt    string  `gorm:"column:negative_prompt"`
+	ModelID           string  `gorm:"column:model_id"`
+	Width             int     `gorm:"column:width"`
+	Height            int     `gorm:"column:height"`
+	NumInferenceSteps int     `gorm:"column:num_inference_steps"`
+	GuidanceScale     float64 `gorm:"column:guidance_scale"`
+	Seed              int64   `gorm:"column:seed"`
+	ActualSeed        int64   `gorm:"column:actual_seed"`
+	NumImages         int     `gorm:"column:num_images"`
+	Sampler           string  `gorm:"column:sampler"`
+	Strength          float64 `gorm:"column:strength"`
+	OutputImageURL    string  `gorm:"column:output_image_url"`
+
+	// 热门榜单时间窗口内的点赞数
+	RecentLikes int64 `gorm:"column:recent_likes"`
+}
@@ -10,9 +10,11 @@ type TableImageGenerationTaskDO struct {
 	// 任务基本信息
 	TaskType int8 `gorm:"column:task_type" json:"task_type"` // 1-文生图, 2-图生图
 	Status   int8 `gorm:"column:status" json:"status"`       // 0-待处理, 1-队列中, 2-处理中, 3-已完成, 4-失败, 5-已取消
+	Priority int8 `gorm:"column:priority" json:"priority"`   // 队列优先级 0-9
 
 	// 输入参数
 	Prompt            string  `gorm:"column:prompt" json:"prompt"`
+	OriginalPrompt    string  `gorm:"column:original_prompt" json:"original_prompt"`
 	NegativePrompt    string  `gorm:"column:negative_prompt" json:"negative_prompt"`
 	ModelID           string  `gorm:"column:model_id" json:"model_id"`
 	Width             int     `gorm:"column:width" json:"width"`
@@ -20,11 +22,34 @@ type TableImageGenerationTaskDO struct {
 	NumInferenceSteps int     `gorm:"column:num_inference_steps" json:"num_inference_steps"`
 	GuidanceScale     float64 `gorm:"column:guidance_scale" json:"guidance_scale"`
 	Seed              int64   `gorm:"column:seed" json:"seed"`
+	NumImages         int     `gorm:"column:num_images" json:"num_images"`
+	CredentialID      uint64  `gorm:"column:credential_id" json:"credential_id"`
+	Sampler           string  `gorm:"column:sampler" json:"sampler"`
 
 	// 图生图专用参数
 	InputImageURL string  `gorm:"column:input_image_url" json:"input_image_url"`
 	Strength      float64 `gorm:"column:strength" json:"strength"`
 
+	// 局部重绘/扩图专用参数
+	MaskImageURL string `gorm:"column:mask_image_url" json:"mask_image_url"`
+	ExtendLeft   int    `gorm:"column:extend_left" json:"extend_left"`
+	ExtendRight  int    `gorm:"column:extend_right" json:"extend_right"`
+	ExtendTop    int    `gorm:"column:extend_top" json:"extend_top"`
+	ExtendBottom int    `gorm:"column:extend_bottom" json:"extend_bottom"`
+
+	// 上游任务
+	UpstreamTaskID   string `gorm:"column:upstream_task_id" json:"upstream_task_id"`
+	PollerInstance   string `gorm:"column:poller_instance" json:"poller_instance"`
+	PollerLeaseUntil string `gorm:"column:poller_lease_until" json:"poller_lease_until"`
+
+	// 后处理
+	PostProcess string `gorm:"column:post_process" json:"post_process"`
+	PostStatus  int8   `gorm:"column:post_status" json:"post_status"`
+	PostError   string `gorm:"column:post_error" json:"post_error"`
+
+	// 访问控制
+	IsPublic bool `gorm:"column:is_public" json:"is_public"`
+
 	// 生成结果
 	OutputImageURL string `gorm:"column:output_image_url" json:"output_image_url"`
 	ActualSeed     int64  `gorm:"column:actual_seed" json:"actual_seed"`
@@ -33,6 +58,7 @@ type TableImageGenerationTaskDO struct {
 	ErrorMessage string `gorm:"column:error_message" json:"error_message"`
 	RetryCount   int8   `gorm:"column:retry_count" json:"retry_count"`
 	MaxRetry     int8   `gorm:"column:max_retry" json:"max_retry"`
+	NextRetryAt  string `gorm:"column:next_retry_at" json:"next_retry_at"`
 
 	// 性能指标
 	GenerationTimeMs int `gorm:"column:generation_time_ms" json:"generation_time_ms"`
@@ -42,6 +68,7 @@ type TableImageGenerationTaskDO struct {
 	QueuedAt    string `gorm:"column:queued_at" json:"queued_at"`
 	StartedAt   string `gorm:"column:started_at" json:"started_at"`
 	CompletedAt string `gorm:"column:completed_at" json:"completed_at"`
+	PurgedAt    string `gorm:"column:purged_at" json:"purged_at"`
 	UpdatedAt   string `gorm:"column:updated_at" json:"updated_at"`
 }
 
@@ -68,23 +95,77 @@ type TableImageGenerationModelsDO struct {
 	IsActive      bool `gorm:"column:is_active" json:"is_active"`
 	IsRecommended bool `gorm:"column:is_recommended" json:"is_recommended"`
 
+	// 健康检查
+	AutoDisabledAt string `gorm:"column:auto_disabled_at" json:"auto_disabled_at"`
+	DisabledReason string `gorm:"column:disabled_reason" json:"disabled_reason"`
+	LastProbeAt    string `gorm:"column:last_probe_at" json:"last_probe_at"`
+	HealthResetAt  string `gorm:"column:health_reset_at" json:"health_reset_at"`
+
 	// 第三方平台相关
 	ThirdPartyModelID string `gorm:"column:third_party_model_id" json:"third_party_model_id"`
 	BaseURL           string `gorm:"column:base_url" json:"base_url"`
+	CredentialID      uint64 `gorm:"column:credential_id" json:"credential_id"`
 
 	// 能力参数
-	DefaultWidth  int `gorm:"column:default_width" json:"default_width"`
-	DefaultHeight int `gorm:"column:default_height" json:"default_height"`
-	MaxWidth      int `gorm:"column:max_width" json:"max_width"`
-	MaxHeight     int `gorm:"column:max_height" json:"max_height"`
-	MinSteps      int `gorm:"column:min_steps" json:"min_steps"`
-	MaxSteps      int `gorm:"column:max_steps" json:"max_steps"`
+	DefaultWidth  int    `gorm:"column:default_width" json:"default_width"`
+	DefaultHeight int    `gorm:"column:default_height" json:"default_height"`
+	MaxWidth      int    `gorm:"column:max_width" json:"max_width"`
+	MaxHeight     int    `gorm:"column:max_height" json:"max_height"`
+	MinSteps      int    `gorm:"column:min_steps" json:"min_steps"`
+	MaxSteps      int    `gorm:"column:max_steps" json:"max_steps"`
+	MaxNumImages  int    `gorm:"column:max_num_images" json:"max_num_images"`
+	Capabilities  string `gorm:"column:capabilities" json:"capabilities"`
 
 	// 时间戳
 	CreatedAt string `gorm:"column:created_at" json:"created_at"`
 	UpdatedAt string `gorm:"column:updated_at" json:"updated_at"`
 }
 
+// TableModelHealthEventDO 对应 model_health_events 表中的 DO 结构
+type TableModelHealthEventDO struct {
+	ID               int64  `gorm:"column:id"`
+	ModelID          string `gorm:"column:model_id"`
+	Success          bool   `gorm:"column:success"`
+	GenerationTimeMs int64  `gorm:"column:generation_time_ms"`
+	ErrorClass       string `gorm:"column:error_class"`
+	IsProbe          bool   `gorm:"column:is_probe"`
+	CreatedAt        string `gorm:"column:created_at"`
+}
+
+// ModelHealthStatsDO 模型在统计窗口内的健康指标
+type ModelHealthStatsDO struct {
+	Samples      int            // 计入成功率的调用数, 不含调用方错误
+	Successes    int            // 成功次数
+	Failures     int            // 计入成功率的失败次数
+	CallerErrors int            // 凭证、参数等调用方错误次数
+	SuccessRate  float64        // 成功率百分比, 无样本时为 100
+	P50Ms        int64          // 成功调用生成耗时的中位数
+	P95Ms        int64          // 成功调用生成耗时的 p95
+	ErrorClasses map[string]int // 各类失败的次数
+}
+
+// TableImageGenerationOutputDO 对应 image_generation_outputs 表中的 DO 结构
+type TableImageGenerationOutputDO struct {
+	ID           int64  `gorm:"column:id" json:"id"`
+	TaskID       string `gorm:"column:task_id" json:"task_id"`
+	ImageIndex   int    `gorm:"column:image_index" json:"image_index"`
+	ImageURL     string `gorm:"column:image_url" json:"image_url"`
+	ProcessedURL string `gorm:"column:processed_url" json:"processed_url"`
+	CreatedAt    string `gorm:"column:created_at" json:"created_at"`
+}
+
+// TableImageProviderCredentialDO 对应 image_provider_credentials 表中的 DO 结构
+type TableImageProviderCredentialDO struct {
+	ID        uint64 `gorm:"column:id" json:"id"`
+	UserUUID  string `gorm:"column:user_uuid" json:"user_uuid"`
+	Provider  string `gorm:"column:provider" json:"provider"`
+	Name      string `gorm:"column:name" json:"name"`
+	IsActive  bool   `gorm:"column:is_active" json:"is_active"`
+	APIKeyEnc []byte `gorm:"column:api_key_enc" json:"-"`
+	CreatedAt string `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt string `gorm:"column:updated_at" json:"updated_at"`
+}
+
 // TableDeadLetterTasksDO 对应 dead_letter_tasks 表中的 DO 结构
 type TableDeadLetterTasksDO struct {
 	ID             int64  `gorm:"column:id" json:"id"`
@@ -95,3 +176,22 @@ type TableDeadLetterTasksDO struct {
 	OriginalStatus int8   `gorm:"column:original_status" json:"original_status"`
 	CreatedAt      string `gorm:"column:created_at" json:"created_at"`
 }
+
+// TableTaskOutboxDO 对应 task_outbox 表中的 DO 结构
+type TableTaskOutboxDO struct {
+	ID          uint64 `gorm:"column:id" json:"id"`
+	TaskID      string `gorm:"column:task_id" json:"task_id"`
+	TaskType    int8   `gorm:"column:task_type" json:"task_type"`
+	Message     string `gorm:"column:message" json:"message"`
+	Attempts    int    `gorm:"column:attempts" json:"attempts"`
+	LastError   string `gorm:"column:last_error" json:"last_error"`
+	ClaimToken  string `gorm:"column:claim_token" json:"claim_token"`
+	AvailableAt string `gorm:"column:available_at" json:"available_at"`
+	CreatedAt   string `gorm:"column:created_at" json:"created_at"`
+}
+
+// ImageAccessDO 图片所属用户与公开状态, 用于文件访问鉴权
+type ImageAccessDO struct {
+	UserUUID string `gorm:"column:user_uuid" json:"user_uuid"`
+	IsPublic bool   `gorm:"column:is_public" json:"is_public"`
+}
@@ -9,11 +9,44 @@ type TableUserDO struct {
 	Avatar       string `gorm:"column:avatar"`
 	Email        string `gorm:"column:email"`
 	PasswordHash string `gorm:"column:password_hash"`
+	Tier         string `gorm:"column:tier"`
+	Role         string `gorm:"column:role"`
 	LastLogin    string `gorm:"column:last_login"`
 	CreatedAt    string `gorm:"column:created_at"`
 	UpdatedAt    string `gorm:"column:updated_at"`
 }
 
+// TableRoleDO 对应 roles 表中的 DO 结构
+type TableRoleDO struct {
+	Name        string `gorm:"column:name"`
+	Description string `gorm:"column:description"`
+	Permissions string `gorm:"column:permissions"`
+	IsBuiltin   bool   `gorm:"column:is_builtin"`
+	CreatedAt   string `gorm:"column:created_at"`
+	UpdatedAt   string `gorm:"column:updated_at"`
+}
+
+// TableUserTOTPDO 对应 user_totp 表中的 DO 结构
+type TableUserTOTPDO struct {
+	UserUUID     string  `gorm:"column:user_uuid"`
+	SecretEnc    []byte  `gorm:"column:secret_enc"`
+	Enabled      bool    `gorm:"column:enabled"`
+	LastUsedStep int64   `gorm:"column:last_used_step"`
+	EnabledAt    *string `gorm:"column:enabled_at"`
+	CreatedAt    string  `gorm:"column:created_at"`
+}
+
+// TableUserIdentityDO 对应 user_identities 表中的 DO 结构
+type TableUserIdentityDO struct {
+	ID          int64   `gorm:"column:id"`
+	UserUUID    string  `gorm:"column:user_uuid"`
+	Provider    string  `gorm:"column:provider"`
+	Subject     string  `gorm:"column:subject"`
+	Email       string  `gorm:"column:email"`
+	LastLoginAt *string `gorm:"column:last_login_at"`
+	CreatedAt   string  `gorm:"column:created_at"`
+}
+
 // TableUserVerificationCodesDO 对应user_verification_codes表中的DO结构
 type TableUserVerificationCodesDO struct {
 	ID       int64  `gorm:"column:id"`
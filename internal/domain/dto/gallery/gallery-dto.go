@@ -0,0 +1,13 @@
+// Package gallery 画廊模块 DTO 结构
+package gallery
+
+// PublishDTO 发布已完成的任务到画廊
+type PublishDTO struct {
+	TaskID string `json:"task_id"`
+	Title  string `json:"title"`
+}
+
+// PostActionDTO 针对单个作品的操作: 取消发布、点赞、收藏、remix
+type PostActionDTO struct {
+	PostID uint64 `json:"post_id"`
+}
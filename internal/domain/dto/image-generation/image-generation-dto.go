@@ -5,23 +5,32 @@ import "mime/multipart"
 
 // ModelCreateDTO 添加模型请求
 type ModelCreateDTO struct {
-	ModelID           string `json:"model_id"`
-	ModelName         string `json:"model_name"`
-	ModelType         string `json:"model_type"`
-	Provider          string `json:"provider"`
-	Description       string `json:"description"`
-	Tags              string `json:"tags,omitempty"`
-	SortOrder         int    `json:"sort_order"`
-	IsActive          bool   `json:"is_active"`
-	IsRecommended     bool   `json:"is_recommended"`
-	ThirdPartyModelID string `json:"third_party_model_id"`
-	BaseURL           string `json:"base_url"`
-	DefaultWidth      int    `json:"default_width"`
-	DefaultHeight     int    `json:"default_height"`
-	MaxWidth          int    `json:"max_width"`
-	MaxHeight         int    `json:"max_height"`
-	MinSteps          int    `json:"min_steps"`
-	MaxSteps          int    `json:"max_steps"`
+	ModelID           string                `json:"model_id"`
+	ModelName         string                `json:"model_name"`
+	ModelType         string                `json:"model_type"`
+	Provider          string                `json:"provider"`
+	Description       string                `json:"description"`
+	Tags              string                `json:"tags,omitempty"`
+	SortOrder         int                   `json:"sort_order"`
+	IsActive          bool                  `json:"is_active"`
+	IsRecommended     bool                  `json:"is_recommended"`
+	ThirdPartyModelID string                `json:"third_party_model_id"`
+	BaseURL           string                `json:"base_url"`
+	DefaultWidth      int                   `json:"default_width"`
+	DefaultHeight     int                   `json:"default_height"`
+	MaxWidth          int                   `json:"max_width"`
+	MaxHeight         int                   `json:"max_height"`
+	MinSteps          int                   `json:"min_steps"`
+	MaxSteps          int                   `json:"max_steps"`
+	MaxNumImages      int                   `json:"max_num_images"`
+	CredentialID      uint64                `json:"credential_id,omitempty"`
+	Capabilities      *ModelCapabilitiesDTO `json:"capabilities,omitempty"`
+}
+
+// ModelCapabilitiesDTO 模型允许的宽高比与采样器, 列表为空表示不限制, 第一个采样器作为默认值
+type ModelCapabilitiesDTO struct {
+	AspectRatios []string `json:"aspect_ratios,omitempty"`
+	Samplers     []string `json:"samplers,omitempty"`
 }
 
 // BatchCreateModelsDTO 批量添加模型
@@ -31,35 +40,64 @@ type BatchCreateModelsDTO struct {
 
 // ModelUpdateDTO 更新模型
 type ModelUpdateDTO struct {
-	ModelID           string  `json:"model_id"`
-	ModelName         *string `json:"model_name"`
-	ModelType         *string `json:"model_type"`
-	Provider          *string `json:"provider"`
-	Description       *string `json:"description"`
-	Tags              *string `json:"tags,omitempty"`
-	SortOrder         *int    `json:"sort_order"`
-	IsActive          *bool   `json:"is_active"`
-	IsRecommended     *bool   `json:"is_recommended"`
-	ThirdPartyModelID *string `json:"third_party_model_id"`
-	BaseURL           *string `json:"base_url"`
-	DefaultWidth      *int    `json:"default_width"`
-	DefaultHeight     *int    `json:"default_height"`
-	MaxWidth          *int    `json:"max_width"`
-	MaxHeight         *int    `json:"max_height"`
-	MinSteps          *int    `json:"min_steps"`
-	MaxSteps          *int    `json:"max_steps"`
+	ModelID           string                `json:"model_id"`
+	ModelName         *string               `json:"model_name"`
+	ModelType         *string               `json:"model_type"`
+	Provider          *string               `json:"provider"`
+	Description       *string               `json:"description"`
+	Tags              *string               `json:"tags,omitempty"`
+	SortOrder         *int                  `json:"sort_order"`
+	IsActive          *bool                 `json:"is_active"`
+	IsRecommended     *bool                 `json:"is_recommended"`
+	ThirdPartyModelID *string               `json:"third_party_model_id"`
+	BaseURL           *string               `json:"base_url"`
+	DefaultWidth      *int                  `json:"default_width"`
+	DefaultHeight     *int                  `json:"default_height"`
+	MaxWidth          *int                  `json:"max_width"`
+	MaxHeight         *int                  `json:"max_height"`
+	MinSteps          *int                  `json:"min_steps"`
+	MaxSteps          *int                  `json:"max_steps"`
+	MaxNumImages      *int                  `json:"max_num_images"`
+	CredentialID      *uint64               `json:"credential_id"`
+	Capabilities      *ModelCapabilitiesDTO `json:"capabilities"`
 }
 
 // Text2ImgDTO 文生图负载
 type Text2ImgDTO struct {
-	Prompt            string  `json:"prompt"`
-	NegativePrompt    string  `json:"negative_prompt,omitempty"`
-	ModelID           string  `json:"model_id"`
-	Width             int     `json:"width,omitempty"`
-	Height            int     `json:"height,omitempty"`
-	NumInferenceSteps int     `json:"num_inference_steps,omitempty"`
-	GuidanceScale     float64 `json:"guidance_scale,omitempty"`
-	Seed              int64   `json:"seed,omitempty"`
+	Prompt            string            `json:"prompt"`
+	NegativePrompt    string            `json:"negative_prompt,omitempty"`
+	ModelID           string            `json:"model_id"`
+	Width             int               `json:"width,omitempty"`
+	Height            int               `json:"height,omitempty"`
+	NumInferenceSteps int               `json:"num_inference_steps,omitempty"`
+	GuidanceScale     float64           `json:"guidance_scale,omitempty"`
+	Seed              int64             `json:"seed,omitempty"`
+	NumImages         int               `json:"num_images,omitempty"`
+	Sampler           string            `json:"sampler,omitempty"`
+	CredentialID      uint64            `json:"credential_id,omitempty"`
+	Priority          string            `json:"priority,omitempty"`
+	PostProcess       *PostProcessDTO   `json:"post_process,omitempty"`
+	EnhancePrompt     *EnhancePromptDTO `json:"enhance_prompt,omitempty"`
+}
+
+// EnhancePromptDTO 入队前使用用户的对话 API Key 扩写提示词, multipart 请求以 JSON 字符串传入 enhance_prompt 字段
+type EnhancePromptDTO struct {
+	APIKeyID uint64 `json:"api_key_id"`
+	Model    string `json:"model"`
+}
+
+// EnhancePromptPreviewDTO 预览提示词扩写结果, 不创建任务
+type EnhancePromptPreviewDTO struct {
+	Prompt string `json:"prompt"`
+	EnhancePromptDTO
+}
+
+// PostProcessDTO 生成完成后的后处理配置, multipart 请求以 JSON 字符串传入 post_process 字段
+type PostProcessDTO struct {
+	Upscale     int    `json:"upscale,omitempty"`
+	AspectRatio string `json:"aspect_ratio,omitempty"`
+	TargetWidth int    `json:"target_width,omitempty"`
+	Watermark   bool   `json:"watermark,omitempty"`
 }
 
 // Img2ImgDTO 图生图负载
@@ -75,4 +113,75 @@ type Img2ImgDTO struct {
 	InputImage        *multipart.FileHeader `form:"input_image"`
 	Strength          float64               `form:"strength,omitempty"`
 	Sha256            string                `form:"sha256"`
+	NumImages         int                   `form:"num_images,omitempty"`
+	Sampler           string                `form:"sampler,omitempty"`
+	CredentialID      uint64                `form:"credential_id,omitempty"`
+	Priority          string                `form:"priority,omitempty"`
+	PostProcess       string                `form:"post_process,omitempty"`
+	EnhancePrompt     string                `form:"enhance_prompt,omitempty"`
+}
+
+// InpaintDTO 局部重绘负载, 蒙版需与原图尺寸一致, 白色区域重绘、黑色区域保留
+type InpaintDTO struct {
+	Prompt            string                `form:"prompt"`
+	NegativePrompt    string                `form:"negative_prompt,omitempty"`
+	ModelID           string                `form:"model_id"`
+	NumInferenceSteps int                   `form:"num_inference_steps,omitempty"`
+	GuidanceScale     float64               `form:"guidance_scale,omitempty"`
+	Seed              int64                 `form:"seed,omitempty"`
+	InputImage        *multipart.FileHeader `form:"input_image"`
+	Sha256            string                `form:"sha256"`
+	MaskImage         *multipart.FileHeader `form:"mask_image"`
+	MaskSha256        string                `form:"mask_sha256"`
+	Strength          float64               `form:"strength,omitempty"`
+	NumImages         int                   `form:"num_images,omitempty"`
+	CredentialID      uint64                `form:"credential_id,omitempty"`
+	Priority          string                `form:"priority,omitempty"`
+	PostProcess       string                `form:"post_process,omitempty"`
+}
+
+// OutpaintDTO 扩图负载, 四个方向的扩展像素至少有一个大于 0
+type OutpaintDTO struct {
+	Prompt            string                `form:"prompt"`
+	NegativePrompt    string                `form:"negative_prompt,omitempty"`
+	ModelID           string                `form:"model_id"`
+	NumInferenceSteps int                   `form:"num_inference_steps,omitempty"`
+	GuidanceScale     float64               `form:"guidance_scale,omitempty"`
+	Seed              int64                 `form:"seed,omitempty"`
+	InputImage        *multipart.FileHeader `form:"input_image"`
+	Sha256            string                `form:"sha256"`
+	ExtendLeft        int                   `form:"extend_left,omitempty"`
+	ExtendRight       int                   `form:"extend_right,omitempty"`
+	ExtendTop         int                   `form:"extend_top,omitempty"`
+	ExtendBottom      int                   `form:"extend_bottom,omitempty"`
+	NumImages         int                   `form:"num_images,omitempty"`
+	CredentialID      uint64                `form:"credential_id,omitempty"`
+	Priority          string                `form:"priority,omitempty"`
+	PostProcess       string                `form:"post_process,omitempty"`
+}
+
+// CredentialCreateDTO 创建生图凭证
+type CredentialCreateDTO struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name"`
+	APIKey   string `json:"api_key"`
+}
+
+// CredentialUpdateDTO 更新生图凭证, 传入 api_key 即完成轮换
+type CredentialUpdateDTO struct {
+	ID       uint64  `json:"id"`
+	Name     *string `json:"name"`
+	APIKey   *string `json:"api_key"`
+	IsActive *bool   `json:"is_active"`
+}
+
+// TaskVisibilityDTO 设置任务输出图片是否公开
+type TaskVisibilityDTO struct {
+	TaskID   string `json:"task_id"`
+	IsPublic *bool  `json:"is_public"`
+}
+
+// DeadLetterReplayDTO 重放死信任务, 支持一次重放多条
+type DeadLetterReplayDTO struct {
+	IDs []int64 `json:"ids"`
 }
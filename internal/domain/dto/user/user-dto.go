@@ -26,6 +26,31 @@ type LoginRequest struct {
 	PassWord   string `json:"password,omitempty" form:"password,omitempty"`
 	VerifyCode string `json:"verify_code,omitempty" form:"verify_code,omitempty"`
 	Purpose    string `json:"purpose,omitempty" form:"purpose,omitempty"`
+	DeviceName string `json:"device_name,omitempty" form:"device_name,omitempty"`
+}
+
+// RefreshTokenRequest 刷新访问令牌请求
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+// TwoFactorCodeRequest 两步验证操作请求, 验证码与恢复码二选一
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code,omitempty" form:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty" form:"recovery_code,omitempty"`
+}
+
+// TwoFactorLoginRequest 登录第二步请求, 验证码与恢复码二选一
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" form:"challenge_token"`
+	Code           string `json:"code,omitempty" form:"code,omitempty"`
+	RecoveryCode   string `json:"recovery_code,omitempty" form:"recovery_code,omitempty"`
+}
+
+// OAuthCallbackRequest 第三方授权回调请求, 前端将回跳地址中的 state 与 code 原样提交
+type OAuthCallbackRequest struct {
+	State string `json:"state" form:"state"`
+	Code  string `json:"code" form:"code"`
 }
 
 // UpdateInfoRequest 用户更新数据请求
@@ -43,3 +68,23 @@ type UpdatePasswordRequest struct {
 	VerifyCode    string `json:"verify_code" form:"verify_code"`
 	Purpose       string `json:"purpose" form:"purpose"`
 }
+
+// RoleCreateRequest 创建自定义角色请求
+type RoleCreateRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// RoleUpdateRequest 更新自定义角色请求, 未传的字段保持不变
+type RoleUpdateRequest struct {
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+	Permissions *[]string `json:"permissions"`
+}
+
+// AssignRoleRequest 为用户分配角色请求
+type AssignRoleRequest struct {
+	UUID string `json:"uuid"`
+	Role string `json:"role"`
+}
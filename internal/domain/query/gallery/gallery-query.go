@@ -0,0 +1,12 @@
+// Package gallery 画廊模块的 query 请求
+package gallery
+
+// FeedQuery 画廊列表查询结构体
+type FeedQuery struct {
+	// 分页参数
+	PageIndex int `form:"pageIndex"`
+	PageSize  int `form:"pageSize"`
+
+	// 热门榜单统计点赞的时间窗口: 24h, 7d, 30d, 默认 7d
+	Window string `form:"window"`
+}
@@ -23,3 +23,31 @@ type ModelsQuery struct {
 	// 全文搜索关键字，在 model_name/description/tags 上做 OR 模糊
 	Q *string `form:"q"`
 }
+
+// TasksQuery 生图任务历史查询结构体
+type TasksQuery struct {
+	// 分页参数
+	PageIndex int `form:"pageIndex"`
+	PageSize  int `form:"pageSize"`
+
+	// 筛选字段
+	Status    *int8   `form:"status"`
+	ModelID   *string `form:"model_id"`
+	TaskType  *int8   `form:"task_type"`
+	StartDate *string `form:"start_date"` // 创建时间下界, 如 2025-11-01
+	EndDate   *string `form:"end_date"`   // 创建时间上界(包含当天), 如 2025-11-30
+}
+
+// DeadLettersQuery 死信任务查询结构体
+type DeadLettersQuery struct {
+	// 分页参数
+	PageIndex int `form:"pageIndex"`
+	PageSize  int `form:"pageSize"`
+
+	// 筛选字段
+	Reason    *string `form:"reason"` // 死信原因关键字, 模糊匹配
+	UserID    *string `form:"user_id"`
+	TaskType  *int8   `form:"task_type"`
+	StartDate *string `form:"start_date"` // 进入死信时间下界, 如 2025-11-01
+	EndDate   *string `form:"end_date"`   // 进入死信时间上界(包含当天), 如 2025-11-30
+}
@@ -0,0 +1,50 @@
+// Package gallery 画廊模块 VO 结构
+package gallery
+
+// PostVO 画廊作品, 生成参数全部公开
+type PostVO struct {
+	ID     uint64   `json:"id"`
+	Title  string   `json:"title"`
+	Images []string `json:"images"`
+
+	// 作者
+	Nickname string `json:"nickname"`
+	Avatar   string `json:"avatar"`
+
+	// 生成参数
+	TaskType          int8    `json:"task_type"`
+	Prompt            string  `json:"prompt"`
+	NegativePrompt    string  `json:"negative_prompt"`
+	ModelID           string  `json:"model_id"`
+	Width             int     `json:"width"`
+	Height            int     `json:"height"`
+	NumInferenceSteps int     `json:"num_inference_steps"`
+	GuidanceScale     float64 `json:"guidance_scale"`
+	Seed              int64   `json:"seed"`
+	Sampler           string  `json:"sampler,omitempty"`
+	Strength          float64 `json:"strength,omitempty"`
+
+	// 互动
+	LikeCount     int64 `json:"like_count"`
+	FavoriteCount int64 `json:"favorite_count"`
+	RemixCount    int64 `json:"remix_count"`
+	RecentLikes   int64 `json:"recent_likes,omitempty"`
+	Liked         bool  `json:"liked"`
+	Favorited     bool  `json:"favorited"`
+
+	CreatedAt string `json:"created_at"`
+}
+
+// QueryPostsVO 画廊作品列表
+type QueryPostsVO struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    dataForQueryPosts `json:"data"`
+}
+
+type dataForQueryPosts struct {
+	PageIndex int       `json:"pageIndex"`
+	PageSize  int       `json:"pageSize"`
+	Total     int       `json:"total"`
+	Posts     []*PostVO `json:"posts"`
+}
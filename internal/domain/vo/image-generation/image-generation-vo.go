@@ -12,6 +12,13 @@ type GetModelInfoVO struct {
 	Model   *image_generation_do.TableImageGenerationModelsDO `json:"model"`
 }
 
+// GetModelHealthVO 获取模型健康状态
+type GetModelHealthVO struct {
+	Code    int              `json:"code"`
+	Message string           `json:"message"`
+	Models  []*ModelHealthVO `json:"models"`
+}
+
 // QueryModelsVO 查询模型
 type QueryModelsVO struct {
 	Code    int                `json:"code"`
@@ -25,3 +32,133 @@ type dataForQueryModels struct {
 	Total     int                                                 `json:"total"`
 	Models    []*image_generation_do.TableImageGenerationModelsDO `json:"models"`
 }
+
+// ModelHealthVO 模型在统计窗口内的健康状态, 成功率不含凭证、参数等调用方错误
+type ModelHealthVO struct {
+	ModelID        string         `json:"model_id"`
+	IsActive       bool           `json:"is_active"`
+	AutoDisabledAt string         `json:"auto_disabled_at,omitempty"`
+	DisabledReason string         `json:"disabled_reason,omitempty"`
+	LastProbeAt    string         `json:"last_probe_at,omitempty"`
+	Window         string         `json:"window"`
+	Samples        int            `json:"samples"`
+	Successes      int            `json:"successes"`
+	Failures       int            `json:"failures"`
+	CallerErrors   int            `json:"caller_errors"`
+	SuccessRate    float64        `json:"success_rate"`
+	P50Ms          int64          `json:"p50_ms"`
+	P95Ms          int64          `json:"p95_ms"`
+	ErrorClasses   map[string]int `json:"error_classes"`
+}
+
+// TaskVO 单个生图任务的对外数据
+type TaskVO struct {
+	TaskID            string   `json:"task_id"`
+	TaskType          int8     `json:"task_type"`
+	Status            int8     `json:"status"`
+	StatusText        string   `json:"status_text"`
+	Priority          int8     `json:"priority"`
+	Prompt            string   `json:"prompt"`
+	OriginalPrompt    string   `json:"original_prompt,omitempty"`
+	NegativePrompt    string   `json:"negative_prompt"`
+	ModelID           string   `json:"model_id"`
+	Width             int      `json:"width"`
+	Height            int      `json:"height"`
+	NumInferenceSteps int      `json:"num_inference_steps"`
+	GuidanceScale     float64  `json:"guidance_scale"`
+	Seed              int64    `json:"seed"`
+	NumImages         int      `json:"num_images"`
+	Sampler           string   `json:"sampler,omitempty"`
+	InputImageURL     string   `json:"input_image_url,omitempty"`
+	Strength          float64  `json:"strength,omitempty"`
+	MaskImageURL      string   `json:"mask_image_url,omitempty"`
+	ExtendLeft        int      `json:"extend_left,omitempty"`
+	ExtendRight       int      `json:"extend_right,omitempty"`
+	ExtendTop         int      `json:"extend_top,omitempty"`
+	ExtendBottom      int      `json:"extend_bottom,omitempty"`
+	OutputImageURL    string   `json:"output_image_url"`
+	OutputImages      []string `json:"output_images"`
+	PostProcess       any      `json:"post_process,omitempty"`
+	PostStatus        string   `json:"post_status,omitempty"`
+	PostError         string   `json:"post_error,omitempty"`
+	ProcessedImages   []string `json:"processed_images,omitempty"`
+	IsPublic          bool     `json:"is_public"`
+	ActualSeed        int64    `json:"actual_seed"`
+	ErrorMessage      string   `json:"error_message"`
+	RetryCount        int8     `json:"retry_count"`
+	MaxRetry          int8     `json:"max_retry"`
+	NextRetryAt       string   `json:"next_retry_at,omitempty"`
+	GenerationTimeMs  int      `json:"generation_time_ms"`
+	CreatedAt         string   `json:"created_at"`
+	QueuedAt          string   `json:"queued_at"`
+	StartedAt         string   `json:"started_at"`
+	CompletedAt       string   `json:"completed_at"`
+	PurgedAt          string   `json:"purged_at,omitempty"`
+}
+
+// GetTaskInfoVO 获取任务详情
+type GetTaskInfoVO struct {
+	Code    int     `json:"code"`
+	Message string  `json:"message"`
+	Task    *TaskVO `json:"task"`
+}
+
+// QueryTasksVO 查询任务历史
+type QueryTasksVO struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    dataForQueryTasks `json:"data"`
+}
+
+type dataForQueryTasks struct {
+	PageIndex int       `json:"pageIndex"`
+	PageSize  int       `json:"pageSize"`
+	Total     int       `json:"total"`
+	Tasks     []*TaskVO `json:"tasks"`
+}
+
+// CredentialVO 生图凭证的对外数据, API Key 仅返回掩码
+type CredentialVO struct {
+	ID         uint64 `json:"id"`
+	Provider   string `json:"provider"`
+	Name       string `json:"name"`
+	IsActive   bool   `json:"is_active"`
+	APIKeyMask string `json:"api_key_mask"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+}
+
+// QueryCredentialsVO 查询生图凭证
+type QueryCredentialsVO struct {
+	Code        int             `json:"code"`
+	Message     string          `json:"message"`
+	Credentials []*CredentialVO `json:"credentials"`
+}
+
+// QueryDeadLettersVO 查询死信任务
+type QueryDeadLettersVO struct {
+	Code    int                     `json:"code"`
+	Message string                  `json:"message"`
+	Data    dataForQueryDeadLetters `json:"data"`
+}
+
+type dataForQueryDeadLetters struct {
+	PageIndex   int                                           `json:"pageIndex"`
+	PageSize    int                                           `json:"pageSize"`
+	Total       int                                           `json:"total"`
+	DeadLetters []*image_generation_do.TableDeadLetterTasksDO `json:"dead_letters"`
+}
+
+// DeadLetterDetailVO 死信记录及其原始任务
+type DeadLetterDetailVO struct {
+	DeadLetter *image_generation_do.TableDeadLetterTasksDO `json:"dead_letter"`
+	Task       *TaskVO                                     `json:"task"`
+}
+
+// ReplayDeadLetterResultVO 单条死信的重放结果
+type ReplayDeadLetterResultVO struct {
+	ID       int64  `json:"id"`
+	TaskID   string `json:"task_id,omitempty"`
+	Replayed bool   `json:"replayed"`
+	Error    string `json:"error,omitempty"`
+}
@@ -3,9 +3,14 @@ package user
 
 // LoginVO 用户登录信息VO
 type LoginVO struct {
-	Code     int32  `json:"code"`
-	Message  string `json:"message"`
-	JWTToken string `json:"token"`
+	Code         int32  `json:"code"`
+	Message      string `json:"message"`
+	JWTToken     string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	// 开启两步验证的账号密码校验通过后不下发令牌, 需携带 challenge_token 调用 /user/login/2fa
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	ChallengeToken    string `json:"challenge_token,omitempty"`
 }
 
 // InfoVO 用户信息VO
@@ -14,6 +19,7 @@ type InfoVO struct {
 	Nickname string `json:"nickname"`
 	Email    string `json:"email"`
 	Avatar   string `json:"avatar"`
+	Role     string `json:"role"`
 }
 
 // ListUserInfoVO 所有用户信息
@@ -33,7 +39,49 @@ type TableUserVO struct {
 	Nickname  string `json:"nickname"`
 	Avatar    string `json:"avatar"`
 	Email     string `json:"email"`
+	Role      string `json:"role"`
 	LastLogin string `json:"last_login"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"update_at"`
 }
+
+// SessionVO 单个设备上的登录会话
+type SessionVO struct {
+	SessionID string `json:"session_id"`
+	Device    string `json:"device"`
+	IP        string `json:"ip"`
+	CreatedAt string `json:"created_at"`
+	LastSeen  string `json:"last_seen"`
+	Current   bool   `json:"current"`
+}
+
+// TwoFactorSetupVO 两步验证绑定信息, 前端将 provisioning_uri 渲染为二维码
+type TwoFactorSetupVO struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// TwoFactorStatusVO 两步验证状态
+type TwoFactorStatusVO struct {
+	Enabled                bool   `json:"enabled"`
+	EnabledAt              string `json:"enabled_at,omitempty"`
+	RecoveryCodesRemaining int64  `json:"recovery_codes_remaining"`
+}
+
+// IdentityVO 已绑定的第三方账号
+type IdentityVO struct {
+	Provider    string `json:"provider"`
+	Email       string `json:"email"`
+	CreatedAt   string `json:"created_at"`
+	LastLoginAt string `json:"last_login_at,omitempty"`
+}
+
+// RoleVO 角色及其权限
+type RoleVO struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	IsBuiltin   bool     `json:"is_builtin"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
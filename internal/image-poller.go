@@ -0,0 +1,544 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	image_generation_dao "github.com/Zhiruosama/ai_nexus/internal/dao/image-generation"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/third"
+	ws "github.com/Zhiruosama/ai_nexus/internal/pkg/ws"
+	"github.com/google/uuid"
+)
+
+const (
+	// pollInitialInterval 首次轮询间隔
+	pollInitialInterval = 2 * time.Second
+	// pollMaxInterval 退避后的最大轮询间隔
+	pollMaxInterval = 30 * time.Second
+	// pollTimeout 单个上游任务的最长等待时间
+	pollTimeout = 10 * time.Minute
+	// pollTick 调度循环检查到期任务的周期
+	pollTick = time.Second
+	// pollConcurrency 同时进行的上游状态查询数量
+	pollConcurrency = 16
+	// pollMaxErrors 连续查询上游状态失败达到该次数才判定任务失败, 偶发错误只退避重试
+	pollMaxErrors = 5
+	// pollLeaseTTL 实例跟踪上游任务的租约时长, 实例退出后租约过期, 其他实例才会接管
+	pollLeaseTTL = 2 * time.Minute
+	// pollLeaseRenew 续租并接管过期任务的周期
+	pollLeaseRenew = 30 * time.Second
+)
+
+// pendingJob 一个已提交到上游、等待结果的任务
+type pendingJob struct {
+	Message        *queue.TaskMessage
+	TaskType       int8
+	ModelID        string
+	NumImages      int
+	Seed           int64
+	Client         third.ImageProvider
+	UpstreamTaskID string
+
+	interval   time.Duration
+	nextPollAt time.Time
+	deadline   time.Time
+	polling    bool
+	errCount   int
+}
+
+// Poller 共享的上游任务轮询器, Worker 提交后即返回, 由 Poller 统一跟踪结果
+type Poller struct {
+	instance   string
+	mu         sync.Mutex
+	jobs       map[string]*pendingJob
+	submitting map[string]context.CancelFunc
+	sem        chan struct{}
+}
+
+// GlobalPoller 全局唯一的轮询器
+var GlobalPoller = &Poller{
+	instance:   pollerInstance(),
+	jobs:       make(map[string]*pendingJob),
+	submitting: make(map[string]context.CancelFunc),
+	sem:        make(chan struct{}, pollConcurrency),
+}
+
+// StartPoller 恢复重启前本实例未完成的上游任务并启动轮询循环
+func StartPoller() {
+	log.Printf("[Poller] Upstream task poller starting, instance %s\n", GlobalPoller.instance)
+
+	GlobalPoller.recoverTracking(GlobalPoller.instance)
+	go GlobalPoller.run()
+	go GlobalPoller.renewLeases()
+	go GlobalPoller.listenCancel()
+}
+
+// pollerInstance 实例标识, 同一容器重启后保持不变, 重启后可立即恢复自己的任务
+func pollerInstance() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return uuid.New().String()
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// SubmitContext 返回 Worker 提交上游时使用的 context, 任务被取消时会被中断
+func (p *Poller) SubmitContext(taskID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	p.mu.Lock()
+	p.submitting[taskID] = cancel
+	p.mu.Unlock()
+
+	return ctx, func() {
+		p.mu.Lock()
+		delete(p.submitting, taskID)
+		p.mu.Unlock()
+		cancel()
+	}
+}
+
+// Cancel 中断正在提交的请求, 停止跟踪并尽量取消上游任务
+func (p *Poller) Cancel(taskID string) {
+	p.mu.Lock()
+	if cancel, ok := p.submitting[taskID]; ok {
+		cancel()
+	}
+	p.mu.Unlock()
+
+	if job := p.remove(taskID); job != nil {
+		cancelUpstream(job.Client, taskID, job.UpstreamTaskID)
+	}
+}
+
+// listenCancel 订阅取消事件, 所有实例都会收到, 只有持有该任务的实例会真正处理
+func (p *Poller) listenCancel() {
+	sub := rdb.Rdb.Subscribe(rdb.Ctx, rdb.ChannelTaskCancel)
+	defer func() {
+		if err := sub.Close(); err != nil {
+			log.Printf("[Poller] Failed to close cancel subscription: %v\n", err)
+		}
+	}()
+
+	for msg := range sub.Channel() {
+		p.Cancel(msg.Payload)
+	}
+}
+
+// Track 登记一个待轮询的上游任务
+func (p *Poller) Track(job *pendingJob) {
+	now := time.Now()
+	job.interval = pollInitialInterval
+	job.nextPollAt = now.Add(job.interval)
+	job.deadline = now.Add(pollTimeout)
+
+	p.mu.Lock()
+	p.jobs[job.Message.TaskID] = job
+	p.mu.Unlock()
+
+	log.Printf("[Poller] Tracking task %s, upstream task %s\n", job.Message.TaskID, job.UpstreamTaskID)
+}
+
+// Untrack 停止跟踪任务并丢弃未读取的同步结果, 返回被移除的任务
+func (p *Poller) Untrack(taskID string) *pendingJob {
+	job := p.remove(taskID)
+	if job != nil {
+		third.DiscardSyncResult(job.UpstreamTaskID)
+	}
+	return job
+}
+
+// remove 从跟踪列表中移除任务
+func (p *Poller) remove(taskID string) *pendingJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	job, ok := p.jobs[taskID]
+	if !ok {
+		return nil
+	}
+	delete(p.jobs, taskID)
+	return job
+}
+
+func (p *Poller) run() {
+	ticker := time.NewTicker(pollTick)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		p.mu.Lock()
+		due := make([]*pendingJob, 0)
+		for _, job := range p.jobs {
+			if !job.polling && !now.Before(job.nextPollAt) {
+				job.polling = true
+				due = append(due, job)
+			}
+		}
+		p.mu.Unlock()
+
+		for _, job := range due {
+			p.sem <- struct{}{}
+			go func(job *pendingJob) {
+				defer func() { <-p.sem }()
+				p.poll(job)
+			}(job)
+		}
+	}
+}
+
+// poll 查询一次上游状态, 未完成时按指数退避安排下一次查询
+func (p *Poller) poll(job *pendingJob) {
+	taskID := job.Message.TaskID
+	dao := &image_generation_dao.DAO{}
+
+	// 任务已被取消则不再跟踪, 兜底处理错过的取消事件
+	status, err := image_generation_dao.GetTaskInfo[int8](dao, "status", taskID)
+	if err == nil && status == 5 {
+		if p.remove(taskID) != nil {
+			cancelUpstream(job.Client, taskID, job.UpstreamTaskID)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	result, err := job.Client.GetTaskStatus(ctx, job.UpstreamTaskID)
+	cancel()
+
+	switch {
+	case err != nil:
+		job.errCount++
+		log.Printf("[Poller] Get upstream status for task %s error (%d/%d): %v\n", taskID, job.errCount, pollMaxErrors, err)
+		if job.errCount >= pollMaxErrors {
+			if p.Untrack(taskID) != nil {
+				recordModelHealth(dao, job.ModelID, 0, err, false)
+				failOrRetry(dao, job, err)
+			}
+			return
+		}
+
+	case result.TaskStatus == third.TaskStatusSucceed:
+		if p.Untrack(taskID) == nil {
+			return
+		}
+		if len(result.OutputImages) == 0 {
+			err := fmt.Errorf("task succeed but no output images")
+			recordModelHealth(dao, job.ModelID, 0, err, false)
+			failOrRetry(dao, job, err)
+			return
+		}
+		// 上游已成功, 之后的落盘失败不计入模型健康
+		recordModelHealth(dao, job.ModelID, generationTimeMs(result), nil, false)
+		if err := completeTask(dao, job, result); err != nil {
+			failOrRetry(dao, job, err)
+		}
+		return
+
+	case result.TaskStatus == third.TaskStatusFailed:
+		if p.Untrack(taskID) != nil {
+			err := fmt.Errorf("task failed: %s", result.Message)
+			recordModelHealth(dao, job.ModelID, 0, err, false)
+			failOrRetry(dao, job, err)
+		}
+		return
+
+	case result.TaskStatus != third.TaskStatusPending && result.TaskStatus != third.TaskStatusProcessing:
+		if p.Untrack(taskID) != nil {
+			err := fmt.Errorf("unknown task status: %s", result.TaskStatus)
+			recordModelHealth(dao, job.ModelID, 0, err, false)
+			failOrRetry(dao, job, err)
+		}
+		return
+
+	default:
+		job.errCount = 0
+	}
+
+	now := time.Now()
+	if now.After(job.deadline) {
+		if p.Untrack(taskID) != nil {
+			err := fmt.Errorf("%w: task not completed within %s", third.ErrUpstreamTimeout, pollTimeout)
+			recordModelHealth(dao, job.ModelID, 0, err, false)
+			failOrRetry(dao, job, err)
+		}
+		return
+	}
+
+	p.mu.Lock()
+	job.interval = min(job.interval*3/2, pollMaxInterval)
+	job.nextPollAt = now.Add(job.interval)
+	job.polling = false
+	p.mu.Unlock()
+}
+
+// renewLeases 定期为跟踪中的任务续租, 并接管租约已过期(原实例已退出)的任务
+func (p *Poller) renewLeases() {
+	dao := &image_generation_dao.DAO{}
+	ticker := time.NewTicker(pollLeaseRenew)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		p.mu.Lock()
+		taskIDs := make([]string, 0, len(p.jobs))
+		for taskID := range p.jobs {
+			taskIDs = append(taskIDs, taskID)
+		}
+		p.mu.Unlock()
+
+		if err := dao.RenewTrackingLeases(p.instance, taskIDs, pollLeaseTTL); err != nil {
+			log.Printf("[Poller] Failed to renew tracking leases: %v\n", err)
+		}
+
+		p.recoverTracking("")
+	}
+}
+
+// recoverTracking 接管属于 instance 或租约已过期的上游任务, instance 为空时只接管租约已过期的任务
+// 同步型上游的结果随原进程丢失, 接管后直接重新提交, 不再轮询
+func (p *Poller) recoverTracking(instance string) {
+	dao := &image_generation_dao.DAO{}
+
+	tasks, err := dao.ListTrackingTasks(instance)
+	if err != nil {
+		log.Printf("[Poller] Failed to load tracking tasks: %v\n", err)
+		return
+	}
+
+	for _, task := range tasks {
+		p.mu.Lock()
+		_, tracking := p.jobs[task.TaskID]
+		p.mu.Unlock()
+		if tracking {
+			continue
+		}
+
+		claimed, err := dao.ClaimTrackingTask(task.TaskID, p.instance, pollLeaseTTL)
+		if err != nil || !claimed {
+			continue
+		}
+
+		msg := queue.NewTaskMessageFromDO(task)
+		job := &pendingJob{
+			Message:        msg,
+			TaskType:       task.TaskType,
+			ModelID:        task.ModelID,
+			NumImages:      task.NumImages,
+			Seed:           task.Seed,
+			UpstreamTaskID: task.UpstreamTaskID,
+		}
+
+		provider, err := image_generation_dao.GetInfoFromModel[string](dao, "provider", task.ModelID)
+		if err != nil {
+			failOrRetry(dao, job, err)
+			continue
+		}
+		if third.IsSyncProvider(provider) {
+			failOrRetry(dao, job, fmt.Errorf("sync result of upstream task %s lost with poller instance %s", task.UpstreamTaskID, task.PollerInstance))
+			continue
+		}
+
+		client, _, err := newModelProvider(dao, task.ModelID, task.UserUUID, task.CredentialID)
+		if err != nil {
+			failOrRetry(dao, job, err)
+			continue
+		}
+		job.Client = client
+
+		p.Track(job)
+	}
+}
+
+// cancelUpstream 调用上游取消接口, 不支持取消的 provider 只记录日志, 最后丢弃未读取的同步结果
+func cancelUpstream(client third.ImageProvider, taskID, upstreamTaskID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := client.CancelTask(ctx, upstreamTaskID)
+	switch {
+	case errors.Is(err, third.ErrCancelNotSupported):
+		log.Printf("[Poller] Task %s cancelled, provider does not support upstream cancellation\n", taskID)
+	case err != nil:
+		log.Printf("[Poller] Failed to cancel upstream task %s for task %s: %v\n", upstreamTaskID, taskID, err)
+	default:
+		log.Printf("[Poller] Upstream task %s cancelled for task %s\n", upstreamTaskID, taskID)
+	}
+	third.DiscardSyncResult(upstreamTaskID)
+}
+
+// completeTask 保存上游结果并将任务标记为完成
+func completeTask(dao *image_generation_dao.DAO, job *pendingJob, result *third.TaskResult) error {
+	taskID := job.Message.TaskID
+
+	// 保存图片到存储, 同时写入生成参数
+	storedURLs, err := saveOutputImages(result.OutputImages, job.NumImages, generationMetadata(dao, job))
+	if err != nil {
+		return err
+	}
+
+	// 只有仍处于处理中的任务才能完成, 期间被取消的任务丢弃本次结果
+	completed, err := dao.CompleteTask(taskID, storedURLs, job.Seed, generationTimeMs(result))
+	if err != nil {
+		removeOutputImages(storedURLs)
+		return fmt.Errorf("CompleteTask error: %s", err.Error())
+	}
+	if !completed {
+		removeOutputImages(storedURLs)
+		log.Printf("[Poller] Task %s is no longer processing, result discarded\n", taskID)
+		return nil
+	}
+
+	if err = dao.UpdateModelUsage(true, job.ModelID); err != nil {
+		log.Printf("[Poller] Failed to update model usage for model_id %s: %v\n", job.ModelID, err)
+	}
+
+	// 推送给前端我完成了
+	ws.GlobalHub.SendToUser(job.Message.UserUUID, ws.MessageTypeTaskCompleted, ws.TaskCompletedData{
+		TaskID:           taskID,
+		Status:           "completed",
+		OutputImageURL:   signedImageURL(storedURLs[0]),
+		OutputImageURLs:  signedImageURLs(storedURLs),
+		GenerationTimeMs: generationTimeMs(result),
+	})
+
+	log.Printf("[Poller] Task completed: %s\n", taskID)
+
+	schedulePostProcess(dao, job)
+	return nil
+}
+
+// generationTimeMs 上游返回的耗时单位为秒, 转换为毫秒
+func generationTimeMs(result *third.TaskResult) int64 {
+	return int64(result.TimeTaken * 1000)
+}
+
+// generationMetadata 组装写入输出图片的生成参数便于复现, 查询失败时返回 nil, 不影响任务完成
+func generationMetadata(dao *image_generation_dao.DAO, job *pendingJob) *pkg.GenerationMetadata {
+	taskID := job.Message.TaskID
+
+	task, err := dao.GetTask(taskID)
+	if err != nil || task == nil {
+		log.Printf("[Poller] Failed to load task %s for metadata: %v\n", taskID, err)
+		return nil
+	}
+
+	return &pkg.GenerationMetadata{
+		TaskID:            taskID,
+		Prompt:            task.Prompt,
+		NegativePrompt:    task.NegativePrompt,
+		ModelID:           task.ModelID,
+		Seed:              job.Seed,
+		NumInferenceSteps: task.NumInferenceSteps,
+		GuidanceScale:     task.GuidanceScale,
+		Width:             task.Width,
+		Height:            task.Height,
+	}
+}
+
+// schedulePostProcess 任务配置了后处理时投递到后处理队列, 投递失败只标记后处理失败, 不影响已完成的原图
+func schedulePostProcess(dao *image_generation_dao.DAO, job *pendingJob) {
+	taskID := job.Message.TaskID
+
+	raw, err := image_generation_dao.GetTaskInfo[string](dao, "post_process", taskID)
+	if err != nil || raw == "" {
+		return
+	}
+
+	var options queue.PostProcessOptions
+	if err = json.Unmarshal([]byte(raw), &options); err != nil {
+		failPostProcess(dao, taskID, job.Message.UserUUID, fmt.Errorf("unmarshal post_process error: %w", err))
+		return
+	}
+
+	credentialID, _ := image_generation_dao.GetTaskInfo[uint64](dao, "credential_id", taskID)
+
+	if err = dao.UpdateTaskParams("post_status", 1, taskID); err != nil {
+		log.Printf("[Poller] Failed to update post status for task %s: %v\n", taskID, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = queue.PublishPostProcess(ctx, &queue.TaskMessage{
+		TaskID:   taskID,
+		UserUUID: job.Message.UserUUID,
+		Payload: queue.PostProcessPayload{
+			ModelID:      job.ModelID,
+			CredentialID: credentialID,
+			Options:      options,
+		},
+		Priority: job.Message.Priority,
+	})
+	if err != nil {
+		failPostProcess(dao, taskID, job.Message.UserUUID, fmt.Errorf("publish post process error: %w", err))
+	}
+}
+
+// failOrRetry 消息已被确认, 可重试的失败由 Poller 投递到延迟队列, 永久错误或重试耗尽则标记失败
+func failOrRetry(dao *image_generation_dao.DAO, job *pendingJob, cause error) {
+	taskID := job.Message.TaskID
+	log.Printf("[Poller] Task %s failed: %v\n", taskID, cause)
+
+	retryCount, err := image_generation_dao.GetTaskInfo[int8](dao, "retry_count", taskID)
+	if err != nil {
+		log.Printf("[Poller] Failed to get retry count for task_id %s: %v\n", taskID, err)
+	}
+	maxRetries, err := image_generation_dao.GetTaskInfo[int8](dao, "max_retry", taskID)
+	if err != nil {
+		log.Printf("[Poller] Failed to get max retry for task_id %s: %v\n", taskID, err)
+	}
+
+	if third.IsRetryable(cause) && retryCount < maxRetries {
+		delay := queue.RetryDelay(retryCount)
+
+		if errs := dao.UpdateTaskParams("retry_count", retryCount+1, taskID); errs != nil {
+			log.Printf("[Poller] Failed to update retry count for task_id %s: %v\n", taskID, errs)
+		}
+		if errs := dao.UpdateTaskParams("upstream_task_id", "", taskID); errs != nil {
+			log.Printf("[Poller] Failed to reset upstream task id for task_id %s: %v\n", taskID, errs)
+		}
+		if errs := dao.UpdateTaskParams("next_retry_at", time.Now().Add(delay), taskID); errs != nil {
+			log.Printf("[Poller] Failed to update next retry time for task_id %s: %v\n", taskID, errs)
+		}
+		if errs := dao.UpdateTaskParams("status", 1, taskID); errs != nil {
+			log.Printf("[Poller] Failed to update status for task_id %s: %v\n", taskID, errs)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		errs := queue.PublishRetry(ctx, int(job.TaskType), job.Message, delay)
+		if errs == nil {
+			return
+		}
+		log.Printf("[Poller] Failed to republish task_id %s: %v\n", taskID, errs)
+	}
+
+	if errs := dao.UpdateTaskParams("status", 4, taskID); errs != nil {
+		log.Printf("[Poller] Failed to update status for task_id %s: %v\n", taskID, errs)
+	}
+
+	if errs := dao.UpdateTaskParams("error_message", cause.Error(), taskID); errs != nil {
+		log.Printf("[Poller] Failed to update error message for task_id %s: %v\n", taskID, errs)
+	}
+
+	if errs := dao.UpdateTaskParams("completed_at", time.Now(), taskID); errs != nil {
+		log.Printf("[Poller] Failed to update error time for task_id %s: %v\n", taskID, errs)
+	}
+
+	if errs := dao.UpdateModelUsage(false, job.ModelID); errs != nil {
+		log.Printf("[Poller] Failed to update model usage for model_id %s: %v\n", job.ModelID, errs)
+	}
+
+	ws.GlobalHub.SendToUser(job.Message.UserUUID, ws.MessageTypeTaskFailed, ws.TaskFailedData{
+		TaskID:       taskID,
+		Status:       "failed",
+		ErrorMessage: cause.Error(),
+	})
+}
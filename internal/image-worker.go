@@ -1,11 +1,13 @@
-// Package internal 包含文生图和图生图的 Worker
+// Package internal 包含文生图、图生图、局部重绘和扩图的 Worker
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Zhiruosama/ai_nexus/configs"
@@ -13,10 +15,14 @@ import (
 	image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/storage"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/third"
 	ws "github.com/Zhiruosama/ai_nexus/internal/pkg/ws"
 )
 
+// providerImageURLTTL 提交给上游的原图与蒙版签名地址的有效期
+const providerImageURLTTL = 24 * time.Hour
+
 // StartWorker 启动 Worker
 func StartWorker(count int, fun func()) {
 	for range count {
@@ -44,6 +50,26 @@ func StartImg2ImgWorker() {
 	}
 }
 
+// StartInpaintWorker 启动局部重绘 Worker
+func StartInpaintWorker() {
+	log.Println("[Worker] Inpaint worker starting")
+
+	err := queue.Consume(queue.QueueInpaint, handleInpaintTask)
+	if err != nil {
+		log.Printf("[Worker] Inpaint worker stopped: %v\n", err)
+	}
+}
+
+// StartOutpaintWorker 启动扩图 Worker
+func StartOutpaintWorker() {
+	log.Println("[Worker] Outpaint worker starting")
+
+	err := queue.Consume(queue.QueueOutpaint, handleOutpaintTask)
+	if err != nil {
+		log.Printf("[Worker] Outpaint worker stopped: %v\n", err)
+	}
+}
+
 // StartDeadLetterWorker 启动死信消费 Worker
 func StartDeadLetterWorker() {
 	log.Println("[Worker] DeadLetter worker starting")
@@ -92,6 +118,12 @@ func handleText2ImgTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
 		return false, 0, 0, nil
 	}
 
+	// outbox 至少投递一次, 已提交上游的任务收到重复消息时直接跳过
+	if isDuplicateDelivery(dao, msg.TaskID, status) {
+		log.Printf("[Worker] Duplicate text2img message skipped: %s\n", msg.TaskID)
+		return false, 0, 0, nil
+	}
+
 	// 更新状态为处理中
 	if err = dao.UpdateTaskParams("status", 2, msg.TaskID); err != nil {
 		return true, retryCount, maxRetries, err
@@ -108,87 +140,170 @@ func handleText2ImgTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
 	})
 
 	// 调用 第三方API 进行生图
-	baseURL, err := image_generation_dao.GetInfoFromModel[string](dao, "base_url", payload.ModelID)
+	client, thirdPartyModelID, err := newModelProvider(dao, payload.ModelID, msg.UserUUID, payload.CredentialID)
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		return third.IsRetryable(err), retryCount, maxRetries, err
 	}
 
-	thirdPartyModelID, err := image_generation_dao.GetInfoFromModel[string](dao, "third_party_model_id", payload.ModelID)
+	submitCtx, done := GlobalPoller.SubmitContext(msg.TaskID)
+	taskID, err := client.CreateText2ImgTask(submitCtx, thirdPartyModelID, payload)
+	cancelled := submitCtx.Err() != nil || isTaskCancelled(dao, msg.TaskID)
+	done()
+	if cancelled {
+		if taskID != "" {
+			cancelUpstream(client, msg.TaskID, taskID)
+		}
+		log.Printf("[Worker] Text2Img task cancelled during submission: %s\n", msg.TaskID)
+		return false, 0, 0, nil
+	}
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		recordModelHealth(dao, payload.ModelID, 0, err, false)
+		// 429、5xx 和网络错误延迟重试, 参数错误等永久错误直接失败
+		return third.IsRetryable(err), retryCount, maxRetries, err
 	}
 
-	apiKey := os.Getenv("MODELSCOPE_API_KEY")
-	client := third.NewModelScopeClient(baseURL, apiKey)
-
-	taskID, err := client.CreateText2ImgTask(thirdPartyModelID, payload)
-	if err != nil {
+	// 记录上游任务 ID 后交给 Poller 跟踪, Worker 立即处理下一条消息
+	if err = dao.SetUpstreamTask(msg.TaskID, taskID, GlobalPoller.instance, pollLeaseTTL); err != nil {
 		return true, retryCount, maxRetries, err
 	}
 
-	taskResp, err := client.WaitForTaskCompletion(taskID, 10, 5*time.Second)
+	GlobalPoller.Track(&pendingJob{
+		Message:        msg,
+		TaskType:       1,
+		ModelID:        payload.ModelID,
+		NumImages:      payload.NumImages,
+		Seed:           payload.Seed,
+		Client:         client,
+		UpstreamTaskID: taskID,
+	})
+
+	log.Printf("[Worker] Text2Img task submitted upstream: %s\n", msg.TaskID)
+	return false, 0, 0, nil
+}
+
+// handleImg2ImgTask 处理图生图任务
+func handleImg2ImgTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
+	log.Printf("[Worker] Processing img2img task: %s\n", msg.TaskID)
+
+	dao := &image_generation_dao.DAO{}
+
+	// 1. 解析 payload
+	var payload queue.Img2ImgPayload
+
+	payloadBytes, err := json.Marshal(msg.Payload)
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		return false, 0, 0, fmt.Errorf("marshal payload error: %w", err)
+	}
+	if err = json.Unmarshal(payloadBytes, &payload); err != nil {
+		return false, 0, 0, fmt.Errorf("unmarshal payload error: %w", err)
 	}
 
-	// 保存图片到本地
-	path, err := pkg.DownloadAndSaveImages(taskResp.OutputImages[0], 80)
+	// 2. 检查任务状态和重试次数
+	maxRetries, err := image_generation_dao.GetTaskInfo[int8](dao, "max_retry", msg.TaskID)
 	if err != nil {
-		return true, retryCount, maxRetries, fmt.Errorf("DownloadAndSaveImages error: %s", err.Error())
+		return false, 0, 0, err
 	}
 
-	// 更新数据库
-	err = dao.UpdateTaskParams("status", 3, msg.TaskID)
+	retryCount, err := image_generation_dao.GetTaskInfo[int8](dao, "retry_count", msg.TaskID)
 	if err != nil {
-		return true, retryCount, maxRetries, fmt.Errorf("UpdateTaskParams error: %s", err.Error())
+		return false, 0, 0, err
 	}
 
-	err = dao.UpdateTaskParams("output_image_url", "/"+path, msg.TaskID)
+	status, err := image_generation_dao.GetTaskInfo[int8](dao, "status", msg.TaskID)
 	if err != nil {
 		return true, retryCount, maxRetries, err
 	}
 
-	err = dao.UpdateModelUsage(true, payload.ModelID)
-	if err != nil {
+	if status == 3 || status == 5 {
+		return false, 0, 0, nil
+	}
+
+	if isDuplicateDelivery(dao, msg.TaskID, status) {
+		log.Printf("[Worker] Duplicate img2img message skipped: %s\n", msg.TaskID)
+		return false, 0, 0, nil
+	}
+
+	// 3. 更新状态为"处理中"
+	if err = dao.UpdateTaskParams("status", 2, msg.TaskID); err != nil {
 		return true, retryCount, maxRetries, err
 	}
 
-	err = dao.UpdateTaskParams("actual_seed", payload.Seed, msg.TaskID)
-	if err != nil {
+	if err = dao.UpdateTaskParams("started_at", time.Now(), msg.TaskID); err != nil {
 		return true, retryCount, maxRetries, err
 	}
 
-	err = dao.UpdateTaskParams("generation_time_ms", int64(taskResp.TimeTaken), msg.TaskID)
+	// 4. 推送消息
+	ws.GlobalHub.SendToUser(msg.UserUUID, ws.MessageTypeTaskProgress, ws.TaskProgressData{
+		TaskID: msg.TaskID,
+		Status: "processing",
+	})
+
+	// 5. 调用第三方 Img2Img API
+	client, thirdPartyModelID, err := newModelProvider(dao, payload.ModelID, msg.UserUUID, payload.CredentialID)
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		return third.IsRetryable(err), retryCount, maxRetries, err
 	}
 
-	err = dao.UpdateTaskParams("completed_at", time.Now(), msg.TaskID)
+	// 原图默认私有, 提交前换成限时签名地址供上游拉取
+	payload.InputImageURL = providerImageURL(payload.InputImageURL)
+
+	submitCtx, done := GlobalPoller.SubmitContext(msg.TaskID)
+	taskID, err := client.CreateImg2ImgTask(submitCtx, thirdPartyModelID, payload)
+	cancelled := submitCtx.Err() != nil || isTaskCancelled(dao, msg.TaskID)
+	done()
+	if cancelled {
+		if taskID != "" {
+			cancelUpstream(client, msg.TaskID, taskID)
+		}
+		log.Printf("[Worker] Img2Img task cancelled during submission: %s\n", msg.TaskID)
+		return false, 0, 0, nil
+	}
 	if err != nil {
+		recordModelHealth(dao, payload.ModelID, 0, err, false)
+		// 429、5xx 和网络错误延迟重试, 参数错误等永久错误直接失败
+		return third.IsRetryable(err), retryCount, maxRetries, err
+	}
+
+	// 记录上游任务 ID 后交给 Poller 跟踪, Worker 立即处理下一条消息
+	if err = dao.SetUpstreamTask(msg.TaskID, taskID, GlobalPoller.instance, pollLeaseTTL); err != nil {
 		return true, retryCount, maxRetries, err
 	}
 
-	// 推送给前端我完成了
-	ws.GlobalHub.SendToUser(msg.UserUUID, ws.MessageTypeTaskCompleted, ws.TaskCompletedData{
-		TaskID:           msg.TaskID,
-		Status:           "completed",
-		OutputImageURL:   "http://" + configs.GlobalConfig.Server.SerialStringPublic() + "/" + path,
-		GenerationTimeMs: int64(taskResp.TimeTaken),
+	GlobalPoller.Track(&pendingJob{
+		Message:        msg,
+		TaskType:       2,
+		ModelID:        payload.ModelID,
+		NumImages:      payload.NumImages,
+		Seed:           payload.Seed,
+		Client:         client,
+		UpstreamTaskID: taskID,
 	})
 
-	log.Printf("[Worker] Text2Img task completed: %s\n", msg.TaskID)
+	log.Printf("[Worker] Img2Img task submitted upstream: %s\n", msg.TaskID)
 	return false, 0, 0, nil
 }
 
-// handleImg2ImgTask 处理图生图任务
-func handleImg2ImgTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
-	log.Printf("[Worker] Processing img2img task: %s\n", msg.TaskID)
+// handleInpaintTask 处理局部重绘任务
+func handleInpaintTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
+	log.Printf("[Worker] Processing inpaint task: %s\n", msg.TaskID)
 
-	dao := &image_generation_dao.DAO{}
+	var payload queue.InpaintPayload
+	payloadBytes, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("marshal payload error: %w", err)
+	}
+	if err = json.Unmarshal(payloadBytes, &payload); err != nil {
+		return false, 0, 0, fmt.Errorf("unmarshal payload error: %w", err)
+	}
 
-	// 1. 解析 payload
-	var payload queue.Img2ImgPayload
+	return submitMaskedTask(msg, 3, payload)
+}
+
+// handleOutpaintTask 处理扩图任务, 画布与蒙版已由服务端生成, 上游按局部重绘提交
+func handleOutpaintTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
+	log.Printf("[Worker] Processing outpaint task: %s\n", msg.TaskID)
 
+	var payload queue.OutpaintPayload
 	payloadBytes, err := json.Marshal(msg.Payload)
 	if err != nil {
 		return false, 0, 0, fmt.Errorf("marshal payload error: %w", err)
@@ -197,7 +312,14 @@ func handleImg2ImgTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
 		return false, 0, 0, fmt.Errorf("unmarshal payload error: %w", err)
 	}
 
-	// 2. 检查任务状态和重试次数
+	return submitMaskedTask(msg, 4, payload.ToInpaint())
+}
+
+// submitMaskedTask 局部重绘与扩图共用的提交流程
+func submitMaskedTask(msg *queue.TaskMessage, taskType int8, payload queue.InpaintPayload) (bool, int8, int8, error) {
+	dao := &image_generation_dao.DAO{}
+
+	// 1. 检查任务状态和重试次数
 	maxRetries, err := image_generation_dao.GetTaskInfo[int8](dao, "max_retry", msg.TaskID)
 	if err != nil {
 		return false, 0, 0, err
@@ -217,7 +339,12 @@ func handleImg2ImgTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
 		return false, 0, 0, nil
 	}
 
-	// 3. 更新状态为"处理中"
+	if isDuplicateDelivery(dao, msg.TaskID, status) {
+		log.Printf("[Worker] Duplicate masked task message skipped: %s\n", msg.TaskID)
+		return false, 0, 0, nil
+	}
+
+	// 2. 更新状态为"处理中"
 	if err = dao.UpdateTaskParams("status", 2, msg.TaskID); err != nil {
 		return true, retryCount, maxRetries, err
 	}
@@ -226,83 +353,190 @@ func handleImg2ImgTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
 		return true, retryCount, maxRetries, err
 	}
 
-	// 4. 推送消息
+	// 3. 推送消息
 	ws.GlobalHub.SendToUser(msg.UserUUID, ws.MessageTypeTaskProgress, ws.TaskProgressData{
 		TaskID: msg.TaskID,
 		Status: "processing",
 	})
 
-	// 5. 调用 ModelScope Img2Img API
-	baseURL, err := image_generation_dao.GetInfoFromModel[string](dao, "base_url", payload.ModelID)
+	// 4. 调用第三方局部重绘 API, 不支持蒙版的 provider 返回永久错误
+	client, thirdPartyModelID, err := newModelProvider(dao, payload.ModelID, msg.UserUUID, payload.CredentialID)
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		return third.IsRetryable(err), retryCount, maxRetries, err
 	}
 
-	thirdPartyModelID, err := image_generation_dao.GetInfoFromModel[string](dao, "third_party_model_id", payload.ModelID)
+	payload.InputImageURL = providerImageURL(payload.InputImageURL)
+	payload.MaskImageURL = providerImageURL(payload.MaskImageURL)
+
+	submitCtx, done := GlobalPoller.SubmitContext(msg.TaskID)
+	taskID, err := client.CreateInpaintTask(submitCtx, thirdPartyModelID, payload)
+	cancelled := submitCtx.Err() != nil || isTaskCancelled(dao, msg.TaskID)
+	done()
+	if cancelled {
+		if taskID != "" {
+			cancelUpstream(client, msg.TaskID, taskID)
+		}
+		log.Printf("[Worker] Masked task cancelled during submission: %s\n", msg.TaskID)
+		return false, 0, 0, nil
+	}
 	if err != nil {
+		recordModelHealth(dao, payload.ModelID, 0, err, false)
+		return third.IsRetryable(err), retryCount, maxRetries, err
+	}
+
+	if err = dao.SetUpstreamTask(msg.TaskID, taskID, GlobalPoller.instance, pollLeaseTTL); err != nil {
 		return true, retryCount, maxRetries, err
 	}
 
-	apiKey := os.Getenv("MODELSCOPE_API_KEY")
-	client := third.NewModelScopeClient(baseURL, apiKey)
+	GlobalPoller.Track(&pendingJob{
+		Message:        msg,
+		TaskType:       taskType,
+		ModelID:        payload.ModelID,
+		NumImages:      payload.NumImages,
+		Seed:           payload.Seed,
+		Client:         client,
+		UpstreamTaskID: taskID,
+	})
 
-	taskID, err := client.CreateImg2ImgTask(thirdPartyModelID, payload)
-	if err != nil {
-		return true, retryCount, maxRetries, err
+	log.Printf("[Worker] Masked task submitted upstream: %s\n", msg.TaskID)
+	return false, 0, 0, nil
+}
+
+// isTaskCancelled 提交上游期间任务可能已被取消, 提交完成后再确认一次
+func isTaskCancelled(dao *image_generation_dao.DAO, taskID string) bool {
+	status, err := image_generation_dao.GetTaskInfo[int8](dao, "status", taskID)
+	return err == nil && status == 5
+}
+
+// isDuplicateDelivery 处理中且已记录上游任务 ID, 说明同一任务已被提交过
+// 重试前 Poller 会清空 upstream_task_id, 因此不会误判正常的重试消息
+func isDuplicateDelivery(dao *image_generation_dao.DAO, taskID string, status int8) bool {
+	if status != 2 {
+		return false
 	}
+	upstreamTaskID, err := image_generation_dao.GetTaskInfo[string](dao, "upstream_task_id", taskID)
+	return err == nil && upstreamTaskID != ""
+}
 
-	taskResp, err := client.WaitForTaskCompletion(taskID, 30, 5*time.Second)
+// newModelProvider 按模型的 provider 字段创建生图客户端, 每个任务都重新读取凭证, 轮换后无需重启
+func newModelProvider(dao *image_generation_dao.DAO, modelID, userUUID string, credentialID uint64) (third.ImageProvider, string, error) {
+	provider, err := image_generation_dao.GetInfoFromModel[string](dao, "provider", modelID)
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		return nil, "", err
 	}
 
-	// 6. 保存生成的图片
-	path, err := pkg.DownloadAndSaveImages(taskResp.OutputImages[0], 80)
+	baseURL, err := image_generation_dao.GetInfoFromModel[string](dao, "base_url", modelID)
 	if err != nil {
-		return true, retryCount, maxRetries, fmt.Errorf("DownloadAndSaveImages error: %s", err.Error())
+		return nil, "", err
 	}
 
-	// 7. 更新数据库
-	err = dao.UpdateTaskParams("status", 3, msg.TaskID)
+	thirdPartyModelID, err := image_generation_dao.GetInfoFromModel[string](dao, "third_party_model_id", modelID)
 	if err != nil {
-		return true, retryCount, maxRetries, fmt.Errorf("UpdateTaskParams error: %s", err.Error())
+		return nil, "", err
 	}
 
-	err = dao.UpdateTaskParams("output_image_url", "/"+path, msg.TaskID)
-	if err != nil {
-		return true, retryCount, maxRetries, err
+	if provider == "" {
+		provider = third.ProviderModelScope
 	}
 
-	err = dao.UpdateModelUsage(true, payload.ModelID)
+	apiKey, err := resolveAPIKey(dao, provider, modelID, userUUID, credentialID)
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		return nil, "", err
 	}
 
-	err = dao.UpdateTaskParams("actual_seed", payload.Seed, msg.TaskID)
+	client, err := third.NewImageProvider(provider, baseURL, apiKey)
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		return nil, "", third.Permanent(err)
 	}
+	return client, thirdPartyModelID, nil
+}
 
-	err = dao.UpdateTaskParams("generation_time_ms", int64(taskResp.TimeTaken), msg.TaskID)
-	if err != nil {
-		return true, retryCount, maxRetries, err
+// resolveAPIKey 依次使用用户自带凭证、模型绑定的平台凭证, 都没有时回退到 <PROVIDER>_API_KEY 环境变量
+func resolveAPIKey(dao *image_generation_dao.DAO, provider, modelID, userUUID string, credentialID uint64) (string, error) {
+	owner := userUUID
+	if credentialID == 0 {
+		modelCredentialID, err := dao.GetModelCredentialID(modelID)
+		if err != nil {
+			return "", err
+		}
+		if modelCredentialID == 0 {
+			return os.Getenv(strings.ToUpper(provider) + "_API_KEY"), nil
+		}
+		credentialID = modelCredentialID
+		owner = ""
 	}
 
-	err = dao.UpdateTaskParams("completed_at", time.Now(), msg.TaskID)
+	credential, err := dao.GetCredential(credentialID, owner)
 	if err != nil {
-		return true, retryCount, maxRetries, err
+		return "", err
+	}
+	if credential == nil {
+		return "", third.Permanent(fmt.Errorf("credential %d does not exist or is inactive", credentialID))
+	}
+	if credential.Provider != provider {
+		return "", third.Permanent(fmt.Errorf("credential provider '%s' does not match model provider '%s'", credential.Provider, provider))
 	}
 
-	// 8. WebSocket 推送通知
-	ws.GlobalHub.SendToUser(msg.UserUUID, ws.MessageTypeTaskCompleted, ws.TaskCompletedData{
-		TaskID:           msg.TaskID,
-		Status:           "completed",
-		OutputImageURL:   "http://" + configs.GlobalConfig.Server.SerialStringPublic() + "/" + path,
-		GenerationTimeMs: int64(taskResp.TimeTaken),
-	})
+	return pkg.Decrypt(credential.APIKeyEnc, configs.GlobalConfig.Chat.EncryptionKey)
+}
 
-	log.Printf("[Worker] Img2Img task completed: %s\n", msg.TaskID)
-	return false, 0, 0, nil
+// saveOutputImages 下载并转换上游返回的全部图片写入存储, 最多保留 numImages 张
+func saveOutputImages(imageURLs []string, numImages int, meta *pkg.GenerationMetadata) ([]string, error) {
+	if len(imageURLs) == 0 {
+		return nil, fmt.Errorf("no output images")
+	}
+	if numImages > 0 && len(imageURLs) > numImages {
+		imageURLs = imageURLs[:numImages]
+	}
+
+	storedURLs := make([]string, 0, len(imageURLs))
+	for _, imageURL := range imageURLs {
+		storedURL, err := pkg.DownloadAndSaveImages(imageURL, 80, meta)
+		if err != nil {
+			return nil, fmt.Errorf("DownloadAndSaveImages error: %s", err.Error())
+		}
+		storedURLs = append(storedURLs, storedURL)
+	}
+
+	return storedURLs, nil
+}
+
+// removeOutputImages 删除已写入存储但不再使用的输出图片, 失败只记录日志
+func removeOutputImages(storedURLs []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, storedURL := range storedURLs {
+		key := storage.KeyFromURL(storedURL)
+		if key == "" {
+			continue
+		}
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			log.Printf("[Worker] Failed to remove output image %s: %v\n", storedURL, err)
+		}
+	}
+}
+
+// signedImageURL 生成推送给用户的限时签名地址
+func signedImageURL(storedURL string) string {
+	return storage.SignedURL(context.Background(), storedURL, storage.SignedURLTTL())
+}
+
+// signedImageURLs 批量生成推送给用户的限时签名地址
+func signedImageURLs(storedURLs []string) []string {
+	urls := make([]string, len(storedURLs))
+	for i, storedURL := range storedURLs {
+		urls[i] = signedImageURL(storedURL)
+	}
+	return urls
+}
+
+// providerImageURL 生成供上游拉取原图与蒙版的签名地址, 有效期覆盖异步 provider 的排队时间
+func providerImageURL(storedURL string) string {
+	if storedURL == "" {
+		return ""
+	}
+	return storage.SignedURL(context.Background(), storedURL, providerImageURLTTL)
 }
 
 // handleDeadLetterTask 处理死信队列中的任务
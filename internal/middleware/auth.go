@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/session"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -13,6 +14,9 @@ import (
 // UserIDKey 用户 ID 上下文
 const UserIDKey = "user_id"
 
+// SessionIDKey 当前请求所属会话 ID 上下文
+const SessionIDKey = "session_id"
+
 // AuthMiddleware 创建一个用于验证 JWT Token 的 Gin 中间件
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -37,14 +41,45 @@ func AuthMiddleware() gin.HandlerFunc {
 		claims, err := ParseToken(tokenString)
 
 		if err != nil {
-			if errors.Is(err, jwt.ErrSignatureInvalid) || errors.Is(err, jwt.ErrTokenExpired) {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token error"})
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token error"})
+			return
+		}
+
+		// 会话注销后访问令牌立即失效
+		if err = ValidateSession(claims, c.ClientIP()); err != nil {
+			if errors.Is(err, session.ErrRevoked) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
 				return
 			}
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "failed to verify session"})
 			return
 		}
 
 		c.Set(UserIDKey, claims.UserID)
+		c.Set(SessionIDKey, claims.SessionID)
 		c.Next()
 	}
 }
+
+// OptionalAuthMiddleware Token 有效时写入用户 ID, 缺失或无效时按匿名请求继续处理
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			if claims, err := ParseToken(parts[1]); err == nil && ValidateSession(claims, c.ClientIP()) == nil {
+				c.Set(UserIDKey, claims.UserID)
+				c.Set(SessionIDKey, claims.SessionID)
+			}
+		}
+		c.Next()
+	}
+}
+
+// ValidateSession 校验访问令牌所属会话仍然有效, 会话注销后未过期的访问令牌同样被拒绝
+func ValidateSession(claims *Claims, ip string) error {
+	return session.Validate(claims.SessionID, claims.UserID, ip)
+}
@@ -25,6 +25,12 @@ func DeduplicationMiddleware() gin.HandlerFunc {
 	}
 
 	return func(c *gin.Context) {
+		// 已由 IdempotencyMiddleware 接管的请求, 重复提交由其回放首次响应, 不在这里拦截
+		if c.GetBool(IdempotencyHandledKey) {
+			c.Next()
+			return
+		}
+
 		method := c.Request.Method
 
 		if method != http.MethodGet && method != http.MethodPut && method != http.MethodDelete && method != http.MethodPost {
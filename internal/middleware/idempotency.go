@@ -0,0 +1,227 @@
+// Package middleware 幂等键中间件
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// IdempotencyKeyHeader 客户端传入的幂等键请求头
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyHandledKey 请求已由 IdempotencyMiddleware 接管的上下文标记, DeduplicationMiddleware 据此跳过判断
+const IdempotencyHandledKey = "idempotency_handled"
+
+const (
+	idempotencyStateProcessing = "processing"
+	idempotencyStateCompleted  = "completed"
+
+	maxIdempotencyKeyLength = 255
+
+	defaultIdempotencyLock = 2 * time.Minute
+	defaultIdempotencyTTL  = 24 * time.Hour
+)
+
+// idempotencyRecord 保存在 Redis 中的幂等记录
+type idempotencyRecord struct {
+	State       string `json:"state"`
+	BodyHash    string `json:"body_hash"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// idempotencyWriter 在写给客户端的同时记录响应体, 流式响应同样适用
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// IdempotencyMiddleware 按 用户 + 路由 + Idempotency-Key 保存首次响应, 重复请求直接回放
+// 未携带幂等键的请求不受影响; 同一个键仍在处理中时返回 409, 键被复用于不同请求体时返回 422
+// 需要挂载在 DeduplicationMiddleware 之前, 接管的请求会设置 IdempotencyHandledKey
+func IdempotencyMiddleware() gin.HandlerFunc {
+	rdbClient := rdb.Rdb
+	ctx := rdb.Ctx
+
+	lockDuration := configs.GlobalConfig.Idempotency.LockDuration
+	if lockDuration <= 0 {
+		lockDuration = defaultIdempotencyLock
+	}
+	ttl := configs.GlobalConfig.Idempotency.TTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+
+	if rdbClient == nil {
+		panic("IdempotencyMiddleware requires Redis client (rdb.Rdb) to be initialized.")
+	}
+
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"code":    http.StatusBadRequest,
+				"message": fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength),
+			})
+			return
+		}
+
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "can't read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+		bodyHash := hashRequestBody(bodyBytes)
+
+		// idem:<User>:<Method>:<Path>:<Key>
+		redisKey := fmt.Sprintf("idem:%v:%s:%s:%s", c.GetString(UserIDKey), c.Request.Method, c.Request.URL.Path, key)
+
+		processing, err := json.Marshal(idempotencyRecord{State: idempotencyStateProcessing, BodyHash: bodyHash})
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		acquired, err := rdbClient.SetNX(ctx, redisKey, processing, lockDuration).Result()
+		if err != nil {
+			log.Printf("[Idempotency] Redis idempotency check failed, request allowed: %v\n", err)
+			c.Next()
+			return
+		}
+
+		if !acquired {
+			replayIdempotentResponse(c, rdbClient, redisKey, bodyHash, lockDuration)
+			return
+		}
+
+		c.Set(IdempotencyHandledKey, true)
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		stored := false
+		defer func() {
+			// 处理失败或 panic 时释放幂等键, 允许客户端用同一个键重试
+			if !stored {
+				rdbClient.Del(ctx, redisKey)
+			}
+		}()
+
+		c.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || status == http.StatusConflict || status == http.StatusTooManyRequests {
+			return
+		}
+
+		completed, err := json.Marshal(idempotencyRecord{
+			State:       idempotencyStateCompleted,
+			BodyHash:    bodyHash,
+			Status:      status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		})
+		if err != nil {
+			return
+		}
+
+		if err = rdbClient.Set(ctx, redisKey, completed, ttl).Err(); err != nil {
+			log.Printf("[Idempotency] Redis idempotency save failed: %v\n", err)
+			return
+		}
+		stored = true
+	}
+}
+
+// hashRequestBody 请求体摘要, 同一个幂等键只能用于相同的请求体
+func hashRequestBody(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// replayIdempotentResponse 幂等键已存在时回放首次响应, 或告知客户端请求仍在处理
+func replayIdempotentResponse(c *gin.Context, rdbClient *redis.Client, redisKey, bodyHash string, lockDuration time.Duration) {
+	raw, err := rdbClient.Get(rdb.Ctx, redisKey).Bytes()
+	respondIdempotentRecord(c, raw, err, bodyHash, lockDuration)
+}
+
+// respondIdempotentRecord 根据读取到的幂等记录决定回放、409 或 422, err 为读取 Redis 的结果
+func respondIdempotentRecord(c *gin.Context, raw []byte, err error, bodyHash string, lockDuration time.Duration) {
+	if errors.Is(err, redis.Nil) {
+		// 首个请求刚刚结束且未保存结果, 交给客户端重试
+		c.Header("Retry-After", "1")
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"code":    http.StatusConflict,
+			"message": "a request with this Idempotency-Key has just finished, please retry",
+		})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "failed to read idempotency record",
+		})
+		return
+	}
+
+	var record idempotencyRecord
+	if err = json.Unmarshal(raw, &record); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "invalid idempotency record",
+		})
+		return
+	}
+
+	if record.BodyHash != bodyHash {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"code":    http.StatusUnprocessableEntity,
+			"message": "Idempotency-Key has already been used with a different request body",
+		})
+		return
+	}
+
+	if record.State == idempotencyStateProcessing {
+		c.Header("Retry-After", strconv.Itoa(int(lockDuration.Seconds())))
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"code":    http.StatusConflict,
+			"message": "a request with this Idempotency-Key is still being processed",
+		})
+		return
+	}
+
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.Status, record.ContentType, record.Body)
+	c.Abort()
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestHashRequestBody(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		// printf '%s' '{"prompt":"cat"}' | sha256sum
+		{`{"prompt":"cat"}`, "67c3aa923cd483dc6d2b7f6a4d9075ca176e992cc01ceaa0fc30df16a026ff45"},
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+
+	for _, tt := range tests {
+		if got := hashRequestBody([]byte(tt.body)); got != tt.want {
+			t.Errorf("hashRequestBody(%q) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+
+	// 空白不同即视为不同的请求体
+	if hashRequestBody([]byte(`{"prompt":"cat"}`)) == hashRequestBody([]byte(`{"prompt": "cat"}`)) {
+		t.Error("bodies differing in whitespace share a hash")
+	}
+}
+
+func TestRespondIdempotentRecord(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	bodyHash := hashRequestBody([]byte(`{"prompt":"cat"}`))
+	otherHash := hashRequestBody([]byte(`{"prompt":"dog"}`))
+	lockDuration := 2 * time.Minute
+
+	record := func(r idempotencyRecord) []byte {
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	completed := record(idempotencyRecord{
+		State:       idempotencyStateCompleted,
+		BodyHash:    bodyHash,
+		Status:      http.StatusOK,
+		ContentType: "application/json; charset=utf-8",
+		Body:        []byte(`{"code":200,"data":{"task_id":"t-1"}}`),
+	})
+
+	tests := []struct {
+		name           string
+		raw            []byte
+		err            error
+		wantStatus     int
+		wantRetryAfter string
+		wantReplayed   bool
+		wantBody       string
+	}{
+		{
+			name:           "record expired between SETNX and GET",
+			err:            redis.Nil,
+			wantStatus:     http.StatusConflict,
+			wantRetryAfter: "1",
+		},
+		{
+			name:       "redis error",
+			err:        errors.New("connection refused"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "corrupted record",
+			raw:        []byte("not json"),
+			wantStatus: http.StatusInternalServerError,
+		},
+		{
+			name:       "key reused with another body",
+			raw:        record(idempotencyRecord{State: idempotencyStateCompleted, BodyHash: otherHash, Status: http.StatusOK}),
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "key reused with another body while processing",
+			raw:        record(idempotencyRecord{State: idempotencyStateProcessing, BodyHash: otherHash}),
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:           "first request still processing",
+			raw:            record(idempotencyRecord{State: idempotencyStateProcessing, BodyHash: bodyHash}),
+			wantStatus:     http.StatusConflict,
+			wantRetryAfter: "120",
+		},
+		{
+			name:         "replay completed response",
+			raw:          completed,
+			wantStatus:   http.StatusOK,
+			wantReplayed: true,
+			wantBody:     `{"code":200,"data":{"task_id":"t-1"}}`,
+		},
+		{
+			name:         "replay client error response",
+			raw:          record(idempotencyRecord{State: idempotencyStateCompleted, BodyHash: bodyHash, Status: http.StatusBadRequest, Body: []byte(`{"code":400}`)}),
+			wantStatus:   http.StatusBadRequest,
+			wantReplayed: true,
+			wantBody:     `{"code":400}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			respondIdempotentRecord(c, tt.raw, tt.err, bodyHash, lockDuration)
+
+			if !c.IsAborted() {
+				t.Error("handler chain was not aborted")
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.wantRetryAfter)
+			}
+			if got := w.Header().Get("Idempotent-Replayed") == "true"; got != tt.wantReplayed {
+				t.Errorf("Idempotent-Replayed = %v, want %v", got, tt.wantReplayed)
+			}
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -11,7 +11,8 @@ import (
 // 定义JWT密钥 从环境变量中加载
 var jwtSecret []byte
 
-func init() {
+// InitJWT 从环境变量加载 JWT 密钥, 未设置时直接退出, 由 main 在启动时调用
+func InitJWT() {
 	secret := os.Getenv("JWT_SECRET")
 
 	if secret == "" {
@@ -22,16 +23,18 @@ func init() {
 
 // Claims 定义了 JWT Payload中包含的而信息
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken 用于生成 JWT Token
-func GenerateToken(userID string) (string, error) {
-	expirationTime := time.Now().Add(time.Hour * 24 * 7)
+// GenerateToken 用于生成绑定会话的短期 JWT Token, 会话注销后即使未过期也会被拒绝
+func GenerateToken(userID, sessionID string, ttl time.Duration) (string, error) {
+	expirationTime := time.Now().Add(ttl)
 
 	claims := Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -0,0 +1,122 @@
+// Package middleware 角色权限中间件
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/db"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RoleUser 普通用户, 注册时的默认角色
+	RoleUser = "user"
+	// RoleAdmin 管理员, 可访问全部管理接口
+	RoleAdmin = "admin"
+
+	// UserRoleKey 用户角色上下文
+	UserRoleKey = "user_role"
+)
+
+const (
+	// PermModelManage 管理模型配置与查看模型健康状态
+	PermModelManage = "model:manage"
+	// PermCredentialManage 管理平台生图凭证
+	PermCredentialManage = "credential:manage"
+	// PermDeadLetterManage 查看、重放与清理死信任务
+	PermDeadLetterManage = "dead_letter:manage"
+	// PermUserRead 查看全部用户信息
+	PermUserRead = "user:read"
+	// PermTaskPriorityHigh 提交 high 优先级的生图任务
+	PermTaskPriorityHigh = "task:priority_high"
+)
+
+// Permissions 返回可授予自定义角色的全部权限
+func Permissions() []string {
+	return []string{PermModelManage, PermCredentialManage, PermDeadLetterManage, PermUserRead, PermTaskPriorityHigh}
+}
+
+// RequireRole 要求当前用户的角色为 role, 或所属自定义角色被授予了全部 permissions, 需要组合在 AuthMiddleware 之后
+// 角色每次从数据库读取, 调整角色或权限后立即生效; 管理接口访问量很小, 不做缓存
+func RequireRole(role string, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetString(UserIDKey)
+		if userID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"code":    http.StatusUnauthorized,
+				"message": "login required",
+			})
+			return
+		}
+
+		userRole, allowed, err := CheckRole(userID, role, permissions...)
+		if err != nil {
+			log.Printf("[RBAC] Load role of user %s error: %v\n", userID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"code":    http.StatusInternalServerError,
+				"message": "failed to load user role",
+			})
+			return
+		}
+
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"code":    http.StatusForbidden,
+				"message": "permission denied",
+			})
+			return
+		}
+
+		c.Set(UserRoleKey, userRole)
+		c.Next()
+	}
+}
+
+// CheckRole 判断用户角色是否为 role, 或所属自定义角色被授予了全部 permissions, 同时返回用户角色
+func CheckRole(userID, role string, permissions ...string) (string, bool, error) {
+	userRole, granted, err := loadRole(userID)
+	if err != nil {
+		return "", false, err
+	}
+
+	if userRole == role {
+		return userRole, true, nil
+	}
+	if len(permissions) == 0 {
+		return userRole, false, nil
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(granted, permission) {
+			return userRole, false, nil
+		}
+	}
+	return userRole, true, nil
+}
+
+// loadRole 读取用户角色与角色被授予的权限, 用户不存在时角色为空
+func loadRole(userID string) (string, []string, error) {
+	var row struct {
+		Role        string `gorm:"column:role"`
+		Permissions string `gorm:"column:permissions"`
+	}
+
+	sql := `SELECT u.role, COALESCE(r.permissions, '[]') AS permissions
+		FROM users u
+		LEFT JOIN roles r ON r.name = u.role
+		WHERE u.uuid = ?`
+
+	if err := db.GlobalDB.Raw(sql, userID).Scan(&row).Error; err != nil {
+		return "", nil, err
+	}
+
+	var permissions []string
+	if row.Permissions != "" {
+		if err := json.Unmarshal([]byte(row.Permissions), &permissions); err != nil {
+			return "", nil, err
+		}
+	}
+	return row.Role, permissions, nil
+}
@@ -0,0 +1,295 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	image_generation_dao "github.com/Zhiruosama/ai_nexus/internal/dao/image-generation"
+	user_dao "github.com/Zhiruosama/ai_nexus/internal/dao/user"
+	image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
+	"github.com/Zhiruosama/ai_nexus/internal/middleware"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/third"
+	ws "github.com/Zhiruosama/ai_nexus/internal/pkg/ws"
+	"github.com/google/uuid"
+)
+
+const (
+	// healthLockKey 多实例部署时保证同一时刻只有一个实例执行健康检查
+	healthLockKey = "model:health:lock"
+	// healthDefaultInterval 未配置评估周期时的默认值
+	healthDefaultInterval = time.Minute
+	// healthDefaultWindow 未配置统计窗口时的默认值
+	healthDefaultWindow = 15 * time.Minute
+	// healthDefaultMinSamples 未配置最少样本数时的默认值
+	healthDefaultMinSamples = 20
+	// healthDefaultProbeInterval 未配置探测间隔时的默认值
+	healthDefaultProbeInterval = 10 * time.Minute
+	// healthDefaultProbeTimeout 未配置探测超时时的默认值
+	healthDefaultProbeTimeout = 3 * time.Minute
+	// healthDefaultProbePrompt 未配置探测提示词时的默认值
+	healthDefaultProbePrompt = "a red apple on a white table"
+	// healthProbePollInterval 探测任务的轮询间隔
+	healthProbePollInterval = 3 * time.Second
+	// healthProbeSteps 模型未配置最小步数时探测使用的推理步数
+	healthProbeSteps = 10
+)
+
+// errProbeSkipped 图生图模型未配置探测原图, 需要管理员手动重新启用
+var errProbeSkipped = errors.New("probe image is not configured for img2img models")
+
+// StartModelHealthMonitor 启动模型健康检查, 按滚动窗口统计成功率与生成耗时, 不达标的模型自动停用并定期探测恢复
+func StartModelHealthMonitor() {
+	cfg := configs.GlobalConfig.Health
+	if !cfg.Enabled {
+		log.Println("[Health] Model health monitor disabled")
+		return
+	}
+	go runModelHealthMonitor(cfg)
+}
+
+func runModelHealthMonitor(cfg configs.HealthConfig) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = healthDefaultInterval
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = healthDefaultWindow
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = healthDefaultMinSamples
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = healthDefaultProbeInterval
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = healthDefaultProbeTimeout
+	}
+	if cfg.ProbePrompt == "" {
+		cfg.ProbePrompt = healthDefaultProbePrompt
+	}
+	log.Printf("[Health] Model health monitor starting, window: %s, min success rate: %.1f%%\n", cfg.Window, cfg.MinSuccessRate)
+
+	dao := &image_generation_dao.DAO{}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// 探测可能耗时较长, 锁的有效期覆盖一次探测, 避免其他实例重复探测
+		token := uuid.New().String()
+		acquired, err := rdb.Rdb.SetNX(rdb.Ctx, healthLockKey, token, cfg.Interval+cfg.ProbeTimeout).Result()
+		if err != nil {
+			log.Printf("[Health] Failed to acquire lock: %v\n", err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		evaluateModels(dao, cfg)
+		probeModels(dao, cfg)
+		purgeHealthEvents(dao, cfg)
+
+		if err = rdb.Rdb.Eval(rdb.Ctx, releaseLockScript, []string{healthLockKey}, token).Err(); err != nil {
+			log.Printf("[Health] Failed to release lock: %v\n", err)
+		}
+	}
+}
+
+// evaluateModels 停用统计窗口内成功率或 p95 生成耗时不达标的模型
+func evaluateModels(dao *image_generation_dao.DAO, cfg configs.HealthConfig) {
+	modelIDs, err := dao.ListActiveModelIDs()
+	if err != nil {
+		return
+	}
+
+	since := time.Now().Add(-cfg.Window)
+	for _, modelID := range modelIDs {
+		events, err := dao.ListModelHealthEvents(modelID, since)
+		if err != nil {
+			continue
+		}
+
+		reason := unhealthyReason(third.SummarizeHealth(events), cfg)
+		if reason == "" {
+			continue
+		}
+
+		disabled, err := dao.DisableUnhealthyModel(modelID, reason)
+		if err != nil || !disabled {
+			continue
+		}
+		log.Printf("[Health] Model %s disabled: %s\n", modelID, reason)
+		notifyModelHealth(cfg, modelID, "disabled", reason)
+	}
+}
+
+// unhealthyReason 返回模型不达标的原因, 样本不足或健康时返回空串
+func unhealthyReason(stats *image_generation_do.ModelHealthStatsDO, cfg configs.HealthConfig) string {
+	if stats.Samples < cfg.MinSamples {
+		return ""
+	}
+
+	if stats.SuccessRate < cfg.MinSuccessRate {
+		return fmt.Sprintf("success rate %.1f%% is below %.1f%% over the last %s (%d samples)",
+			stats.SuccessRate, cfg.MinSuccessRate, cfg.Window, stats.Samples)
+	}
+
+	p95 := time.Duration(stats.P95Ms) * time.Millisecond
+	if cfg.MaxP95 > 0 && p95 > cfg.MaxP95 {
+		return fmt.Sprintf("p95 generation time %s exceeds %s over the last %s (%d samples)",
+			p95, cfg.MaxP95, cfg.Window, stats.Samples)
+	}
+	return ""
+}
+
+// probeModels 探测自动停用的模型, 探测成功后重新启用, 统计从启用时刻重新开始
+func probeModels(dao *image_generation_dao.DAO, cfg configs.HealthConfig) {
+	models, err := dao.ListModelsDueForProbe(cfg.ProbeInterval)
+	if err != nil {
+		return
+	}
+
+	for _, model := range models {
+		if err = dao.UpdateModelProbeTime(model.ModelID); err != nil {
+			continue
+		}
+
+		elapsedMs, err := probeModel(dao, model, cfg)
+		if errors.Is(err, errProbeSkipped) {
+			log.Printf("[Health] Probe of model %s skipped: %v\n", model.ModelID, err)
+			continue
+		}
+		recordModelHealth(dao, model.ModelID, elapsedMs, err, true)
+		if err != nil {
+			log.Printf("[Health] Probe of model %s failed: %v\n", model.ModelID, err)
+			continue
+		}
+
+		reactivated, err := dao.ReactivateModel(model.ModelID)
+		if err != nil || !reactivated {
+			continue
+		}
+		log.Printf("[Health] Model %s recovered after probe\n", model.ModelID)
+		notifyModelHealth(cfg, model.ModelID, "recovered", "")
+	}
+}
+
+// probeModel 以最小参数向上游提交一次生成并等待结果, 返回生成耗时(毫秒), 探测结果不落盘
+func probeModel(dao *image_generation_dao.DAO, model *image_generation_do.TableImageGenerationModelsDO, cfg configs.HealthConfig) (int64, error) {
+	if model.ModelType == "img2img" && cfg.ProbeImageURL == "" {
+		return 0, errProbeSkipped
+	}
+
+	client, thirdPartyModelID, err := newModelProvider(dao, model.ModelID, "", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ProbeTimeout)
+	defer cancel()
+
+	width, height, steps := model.DefaultWidth, model.DefaultHeight, model.MinSteps
+	if width <= 0 || height <= 0 {
+		width, height = 512, 512
+	}
+	if steps <= 0 {
+		steps = healthProbeSteps
+	}
+
+	var upstreamTaskID string
+	if model.ModelType == "img2img" {
+		upstreamTaskID, err = client.CreateImg2ImgTask(ctx, thirdPartyModelID, queue.Img2ImgPayload{
+			Prompt:            cfg.ProbePrompt,
+			ModelID:           model.ModelID,
+			Width:             width,
+			Height:            height,
+			NumInferenceSteps: steps,
+			GuidanceScale:     7.5,
+			InputImageURL:     cfg.ProbeImageURL,
+			Strength:          0.8,
+			NumImages:         1,
+		})
+	} else {
+		upstreamTaskID, err = client.CreateText2ImgTask(ctx, thirdPartyModelID, queue.Text2ImgPayload{
+			Prompt:            cfg.ProbePrompt,
+			ModelID:           model.ModelID,
+			Width:             width,
+			Height:            height,
+			NumInferenceSteps: steps,
+			GuidanceScale:     7.5,
+			NumImages:         1,
+		})
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	maxAttempts := max(int(cfg.ProbeTimeout/healthProbePollInterval), 1)
+	result, err := third.WaitForTaskCompletion(ctx, client, upstreamTaskID, maxAttempts, healthProbePollInterval)
+	if err != nil {
+		return 0, err
+	}
+	return generationTimeMs(result), nil
+}
+
+// purgeHealthEvents 删除超过保留时长的调用记录, 保留时长不短于统计窗口
+func purgeHealthEvents(dao *image_generation_dao.DAO, cfg configs.HealthConfig) {
+	if cfg.EventRetention <= 0 {
+		return
+	}
+
+	purged, err := dao.PurgeModelHealthEvents(time.Now().Add(-max(cfg.EventRetention, cfg.Window)))
+	if err == nil && purged > 0 {
+		log.Printf("[Health] Purged %d model health events\n", purged)
+	}
+}
+
+// recordModelHealth 记录一次上游调用结果供健康检查统计, 任务取消不计入
+func recordModelHealth(dao *image_generation_dao.DAO, modelID string, generationTimeMs int64, cause error, probe bool) {
+	if !configs.GlobalConfig.Health.Enabled || modelID == "" {
+		return
+	}
+
+	event := &image_generation_do.TableModelHealthEventDO{
+		ModelID:          modelID,
+		Success:          cause == nil,
+		GenerationTimeMs: generationTimeMs,
+		IsProbe:          probe,
+	}
+	if cause != nil {
+		event.ErrorClass = third.ErrorClass(cause)
+		event.GenerationTimeMs = 0
+		if event.ErrorClass == third.ErrorClassCancelled {
+			return
+		}
+	}
+
+	if err := dao.RecordModelHealthEvent(event); err != nil {
+		log.Printf("[Health] Failed to record health event for model %s: %v\n", modelID, err)
+	}
+}
+
+// notifyModelHealth 通过 WebSocket 通知全部管理员与额外配置的用户
+func notifyModelHealth(cfg configs.HealthConfig, modelID, status, reason string) {
+	// 查询失败时 DAO 已记录日志, 仍通知额外配置的用户
+	recipients, _ := (&user_dao.DAO{}).ListUserUUIDsByRole(middleware.RoleAdmin)
+	for _, userUUID := range cfg.NotifyUsers {
+		if !slices.Contains(recipients, userUUID) {
+			recipients = append(recipients, userUUID)
+		}
+	}
+
+	for _, userUUID := range recipients {
+		ws.GlobalHub.SendToUser(userUUID, ws.MessageTypeModelHealth, ws.ModelHealthData{
+			ModelID: modelID,
+			Status:  status,
+			Reason:  reason,
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	image_generation_dao "github.com/Zhiruosama/ai_nexus/internal/dao/image-generation"
+	image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+	"github.com/google/uuid"
+)
+
+const (
+	outboxPollInterval = 500 * time.Millisecond
+	outboxBatchSize    = 100
+	outboxLease        = 30 * time.Second
+	outboxMaxBackoff   = time.Minute
+	outboxMaxAttempts  = 20
+)
+
+// errMalformedOutbox outbox 消息无法解析, 重试也不会成功
+var errMalformedOutbox = errors.New("malformed outbox message")
+
+// StartOutboxRelay 启动 outbox relay, 把与任务同一事务写入的消息投递到 RabbitMQ
+// 投递使用 publisher confirm, 确认后才删除记录; 崩溃时租约到期会被重新领取, 保证至少投递一次
+func StartOutboxRelay() {
+	go runOutboxRelay()
+}
+
+func runOutboxRelay() {
+	log.Println("[Outbox] Relay starting")
+
+	dao := &image_generation_dao.DAO{}
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// 一批领满说明还有积压, 继续领取直到清空
+		for {
+			if relayOutboxBatch(dao) < outboxBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// relayOutboxBatch 领取并投递一批 outbox 记录, 返回领取到的条数
+func relayOutboxBatch(dao *image_generation_dao.DAO) int {
+	rows, err := dao.ClaimOutbox(uuid.New().String(), outboxBatchSize, outboxLease)
+	if err != nil {
+		return 0
+	}
+
+	for _, row := range rows {
+		if err := publishOutbox(row); err != nil {
+			attempts := row.Attempts + 1
+			if errors.Is(err, errMalformedOutbox) || attempts >= outboxMaxAttempts {
+				log.Printf("[Outbox] Giving up task %s after %d attempts, moving to dead letter: %v\n", row.TaskID, attempts, err)
+
+				reason := fmt.Sprintf("outbox publish failed after %d attempts: %v", attempts, err)
+				if errs := dao.DeadLetterOutbox(row.ID, row.TaskID, reason); errs != nil {
+					log.Printf("[Outbox] Failed to dead letter outbox %d: %v\n", row.ID, errs)
+				}
+				continue
+			}
+
+			delay := min(time.Second<<min(row.Attempts, 6), outboxMaxBackoff)
+			log.Printf("[Outbox] Failed to publish task %s (attempt %d), retry in %s: %v\n", row.TaskID, attempts, delay, err)
+
+			if errs := dao.RescheduleOutbox(row.ID, err.Error(), delay); errs != nil {
+				log.Printf("[Outbox] Failed to reschedule outbox %d: %v\n", row.ID, errs)
+			}
+			continue
+		}
+
+		if err := dao.DeleteOutbox(row.ID); err != nil {
+			// 记录未删除会在租约到期后重复投递, Worker 会跳过已提交上游的任务
+			log.Printf("[Outbox] Failed to delete outbox %d: %v\n", row.ID, err)
+		}
+	}
+
+	return len(rows)
+}
+
+// publishOutbox 投递单条 outbox 消息并等待 broker 确认
+func publishOutbox(row *image_generation_do.TableTaskOutboxDO) error {
+	var message queue.TaskMessage
+	if err := json.Unmarshal([]byte(row.Message), &message); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedOutbox, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return queue.Publish(ctx, int(row.TaskType), &message)
+}
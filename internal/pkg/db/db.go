@@ -13,8 +13,9 @@ import (
 // GlobalDB 全局的 Mysql 实例
 var GlobalDB *gorm.DB
 
-// mysql 初始化
-func init() {
+// Init 连接 MySQL, 连接失败时直接退出, 由 main 在启动时调用
+// 包被导入时不会建立连接, 单元测试可以直接引用依赖数据库的包
+func Init() {
 	dsn := configs.GlobalConfig.MySQL.DsnString()
 
 	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
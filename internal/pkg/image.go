@@ -1,24 +1,34 @@
 package pkg
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"image"
+	"image/color"
 
 	// 导入图片解码器以支持 gif, jpeg, png 格式
 	_ "image/gif"
 	_ "image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/logger"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/storage"
 	"github.com/chai2010/webp"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
+// storageTimeout 单张图片写入存储的超时时间
+const storageTimeout = time.Minute
+
 // ProcessImageToWebP 异步处理图片转webp格式并压缩
 func ProcessImageToWebP(ctx *gin.Context, srcPath string, quality int) bool {
 	file, err := os.Open(srcPath)
@@ -72,147 +82,141 @@ func ProcessImageToWebP(ctx *gin.Context, srcPath string, quality int) bool {
 	return true
 }
 
-// DownloadAndSaveImages 从URL切片下载图片并保存到本地,转换为WebP格式
-func DownloadAndSaveImages(imgURL string, quality int) (string, error) {
+// DownloadAndSaveImages 下载图片并转换为 WebP 格式写入存储, meta 不为空时一并写入生成参数, 返回写入数据库的地址
+func DownloadAndSaveImages(imgURL string, quality int, meta *GenerationMetadata) (string, error) {
 	if len(imgURL) == 0 {
 		return "", fmt.Errorf("image URL is empty")
 	}
 
-	savePath := "static/images/"
-
-	// 确保保存目录存在
-	if err := os.MkdirAll(savePath, 0755); err != nil {
-		return "", fmt.Errorf("create save directory error: %w", err)
-	}
-
-	var outputPath string
-	client := &http.Client{}
-
-	// 下载图片
-	resp, err := client.Get(imgURL)
+	// 下载图片, data URL 直接解码
+	body, urlPath, err := openImageSource(imgURL)
 	if err != nil {
-		return "", fmt.Errorf("download image error: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		errs := resp.Body.Close()
-		if errs != nil {
-			logger.Error(nil, "Close response body error: %s", errs.Error())
-		}
-		return "", fmt.Errorf("download image failed with status: %d", resp.StatusCode)
+		return "", err
 	}
 
-	// 从URL中提取文件名
-	urlPath := filepath.Base(imgURL)
-	ext := filepath.Ext(urlPath)
-	if ext == "" {
-		ext = ".png"
+	img, _, err := image.Decode(body)
+	if errs := body.Close(); errs != nil {
+		logger.Error(nil, "Close response body error: %s", errs.Error())
 	}
-
-	// 生成临时文件路径
-	tempFilePath := filepath.Join(savePath, urlPath)
-	if filepath.Ext(tempFilePath) == "" {
-		tempFilePath += ext
+	if err != nil {
+		return "", fmt.Errorf("decode image error: %w", err)
 	}
 
-	// 保存临时图片
-	tempFile, err := os.Create(tempFilePath)
+	// 在临时目录完成编码与元数据写入, 再整体上传到存储
+	tempFile, err := os.CreateTemp("", "ainexus-*.webp")
 	if err != nil {
-		errs := resp.Body.Close()
-		if errs != nil {
-			logger.Error(nil, "Close response body error: %s", errs.Error())
-		}
 		return "", fmt.Errorf("create temp file error: %w", err)
 	}
-
-	_, err = io.Copy(tempFile, resp.Body)
-	errs := resp.Body.Close()
-	if errs != nil {
-		logger.Error(nil, "Close response body error: %s", errs.Error())
-	}
-	errs = tempFile.Close()
-	if errs != nil {
+	tempFilePath := tempFile.Name()
+	if errs := tempFile.Close(); errs != nil {
 		logger.Error(nil, "Close temp file error: %s", errs.Error())
-		return "", fmt.Errorf("close temp file error: %w", err)
 	}
-
-	if err != nil {
-		errs = os.Remove(tempFilePath)
-		if errs != nil {
+	defer func() {
+		if errs := os.Remove(tempFilePath); errs != nil && !os.IsNotExist(errs) {
 			logger.Error(nil, "Remove temp file error: %s", errs.Error())
 		}
-		return "", fmt.Errorf("save image to temp file error: %w", err)
+	}()
+
+	if err = SaveWebP(tempFilePath, img, quality); err != nil {
+		return "", err
 	}
 
-	// 转换为WebP
-	file, err := os.Open(tempFilePath)
-	if err != nil {
-		errs = os.Remove(tempFilePath)
-		if errs != nil {
-			logger.Error(nil, "Remove temp file error: %s", errs.Error())
+	if meta != nil {
+		if err = EmbedGenerationMetadata(tempFilePath, meta); err != nil {
+			logger.Error(nil, "Embed generation metadata error: %s", err.Error())
 		}
-		return "", fmt.Errorf("open temp file error: %w", err)
 	}
 
-	img, _, err := image.Decode(file)
-	errs = file.Close()
-	if errs != nil {
-		logger.Error(nil, "Close temp file error: %s", errs.Error())
-		return "", fmt.Errorf("close temp file error: %w", err)
+	key := "images/" + strings.TrimSuffix(urlPath, filepath.Ext(urlPath)) + ".webp"
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	if err = storage.PutFile(ctx, key, tempFilePath); err != nil {
+		return "", fmt.Errorf("save image to storage error: %w", err)
 	}
 
-	if err != nil {
-		errs = os.Remove(tempFilePath)
-		if errs != nil {
-			logger.Error(nil, "Remove temp file error: %s", errs.Error())
+	return storage.Default.URL(key), nil
+}
+
+// openImageSource 打开图片来源, 支持 http(s) URL 与 base64 data URL, 返回内容与用于命名的文件名
+func openImageSource(imgURL string) (io.ReadCloser, string, error) {
+	if strings.HasPrefix(imgURL, "data:") {
+		comma := strings.Index(imgURL, ",")
+		if comma < 0 || !strings.Contains(imgURL[:comma], ";base64") {
+			return nil, "", fmt.Errorf("invalid data URL")
 		}
-		return "", fmt.Errorf("decode image error: %w", err)
+
+		data, err := base64.StdEncoding.DecodeString(imgURL[comma+1:])
+		if err != nil {
+			return nil, "", fmt.Errorf("decode data URL error: %w", err)
+		}
+		return io.NopCloser(bytes.NewReader(data)), uuid.New().String() + ".png", nil
 	}
 
-	// 生成WebP文件路径
-	webpPath := strings.TrimSuffix(tempFilePath, filepath.Ext(tempFilePath)) + ".webp"
-	outFile, err := os.Create(webpPath)
+	client := &http.Client{}
+	resp, err := client.Get(imgURL)
 	if err != nil {
-		errs = os.Remove(tempFilePath)
+		return nil, "", fmt.Errorf("download image error: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		errs := resp.Body.Close()
 		if errs != nil {
-			logger.Error(nil, "Remove temp file error: %s", errs.Error())
+			logger.Error(nil, "Close response body error: %s", errs.Error())
 		}
-		return "", fmt.Errorf("create webp file error: %w", err)
+		return nil, "", fmt.Errorf("download image failed with status: %d", resp.StatusCode)
 	}
 
-	if quality <= 0 || quality > 100 {
-		quality = 80
-	}
+	// 从URL中提取文件名
+	return resp.Body, filepath.Base(imgURL), nil
+}
 
-	err = webp.Encode(outFile, img, &webp.Options{
-		Lossless: false,
-		Quality:  float32(quality),
-	})
-	errs = outFile.Close()
-	if errs != nil {
-		logger.Error(nil, "Close output file error: %s", errs.Error())
-		return "", fmt.Errorf("close output file error: %w", err)
+// BuildOutpaintCanvas 向四周扩展画布, 新增区域复制最近的边缘像素作为重绘底图
+// 返回的蒙版中新增区域以及向原图内收 overlap 像素的接缝为白色(重绘), 其余为黑色(保留)
+func BuildOutpaintCanvas(src image.Image, left, right, top, bottom, overlap int) (*image.NRGBA, *image.Gray) {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	canvasW, canvasH := srcW+left+right, srcH+top+bottom
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, canvasW, canvasH))
+	mask := image.NewGray(image.Rect(0, 0, canvasW, canvasH))
+
+	for y := 0; y < canvasH; y++ {
+		sy := min(max(y-top, 0), srcH-1)
+		for x := 0; x < canvasW; x++ {
+			sx := min(max(x-left, 0), srcW-1)
+			canvas.Set(x, y, src.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+
+			keep := x >= left+edgeOverlap(left, overlap) && x < left+srcW-edgeOverlap(right, overlap) &&
+				y >= top+edgeOverlap(top, overlap) && y < top+srcH-edgeOverlap(bottom, overlap)
+			if !keep {
+				mask.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
 	}
 
-	if err != nil {
-		errs := os.Remove(tempFilePath)
-		if errs != nil {
-			logger.Error(nil, "Remove temp file error: %s", errs.Error())
-		}
-		errs = os.Remove(webpPath)
-		if errs != nil {
-			logger.Error(nil, "Remove webp file error: %s", errs.Error())
-		}
-		return "", fmt.Errorf("encode webp error: %w", err)
+	return canvas, mask
+}
+
+// edgeOverlap 只有实际扩展的方向才需要接缝重绘
+func edgeOverlap(extend, overlap int) int {
+	if extend <= 0 {
+		return 0
 	}
+	return overlap
+}
 
-	// 删除原始临时文件
-	err = os.Remove(tempFilePath)
+// SavePNG 把图片编码为 PNG 写入 path
+func SavePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
 	if err != nil {
-		logger.Error(nil, "Remove temp file error: %s", err.Error())
+		return fmt.Errorf("create png file error: %w", err)
 	}
 
-	outputPath = webpPath
-
-	return outputPath, nil
+	if err = png.Encode(file, img); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("encode png error: %w", err)
+	}
+	return file.Close()
 }
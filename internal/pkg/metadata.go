@@ -0,0 +1,406 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// xmpNamespace 生成参数在 XMP 中使用的命名空间
+const xmpNamespace = "https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/"
+
+// pngXMPKeyword PNG iTXt 中存放 XMP 的标准关键字
+const pngXMPKeyword = "XML:com.adobe.xmp"
+
+// ErrNoMetadata 图片中没有可识别的生成参数
+var ErrNoMetadata = errors.New("no generation metadata found")
+
+// GenerationMetadata 写入输出图片的生成参数, 用于复现结果
+type GenerationMetadata struct {
+	TaskID            string  `json:"task_id,omitempty" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ TaskID,attr"`
+	Prompt            string  `json:"prompt" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ Prompt,attr"`
+	NegativePrompt    string  `json:"negative_prompt" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ NegativePrompt,attr"`
+	ModelID           string  `json:"model_id" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ ModelID,attr"`
+	Seed              int64   `json:"seed" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ Seed,attr"`
+	NumInferenceSteps int     `json:"num_inference_steps" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ Steps,attr"`
+	GuidanceScale     float64 `json:"guidance_scale" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ GuidanceScale,attr"`
+	Width             int     `json:"width,omitempty" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ Width,attr"`
+	Height            int     `json:"height,omitempty" xml:"https://github.com/Zhiruosama/ai_nexus/ns/generation/1.0/ Height,attr"`
+}
+
+// xmpMeta 解析 XMP 时只关心 rdf:Description 上的属性
+type xmpMeta struct {
+	Descriptions []GenerationMetadata `xml:"RDF>Description"`
+}
+
+// EmbedGenerationMetadata 把生成参数以 XMP 写入本地图片, 支持 WebP 与 PNG
+func EmbedGenerationMetadata(path string, meta *GenerationMetadata) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read image error: %w", err)
+	}
+
+	packet := buildXMP(meta)
+
+	var out []byte
+	switch {
+	case isWebP(data):
+		out, err = embedWebPXMP(data, packet)
+	case isPNG(data):
+		out, err = embedPNGText(data, pngXMPKeyword, packet)
+	default:
+		err = fmt.Errorf("unsupported image format for metadata: %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再替换, 避免写到一半时图片损坏
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, out, 0644); err != nil {
+		return fmt.Errorf("write image error: %w", err)
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("replace image error: %w", err)
+	}
+	return nil
+}
+
+// ReadGenerationMetadata 从图片中读取生成参数, 支持本服务写入的 XMP 以及 SD WebUI 写入 PNG 的 parameters 文本
+func ReadGenerationMetadata(data []byte) (*GenerationMetadata, error) {
+	switch {
+	case isWebP(data):
+		if packet, ok := extractWebPXMP(data); ok {
+			return parseXMP(packet)
+		}
+	case isPNG(data):
+		texts := readPNGText(data)
+		if packet, ok := texts[pngXMPKeyword]; ok {
+			return parseXMP([]byte(packet))
+		}
+		if params, ok := texts["parameters"]; ok {
+			return parseA1111Parameters(params)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported image format")
+	}
+	return nil, ErrNoMetadata
+}
+
+// buildXMP 生成只包含一个 rdf:Description 的 XMP 包
+func buildXMP(meta *GenerationMetadata) []byte {
+	attrs := [][2]string{
+		{"TaskID", meta.TaskID},
+		{"Prompt", meta.Prompt},
+		{"NegativePrompt", meta.NegativePrompt},
+		{"ModelID", meta.ModelID},
+		{"Seed", strconv.FormatInt(meta.Seed, 10)},
+		{"Steps", strconv.Itoa(meta.NumInferenceSteps)},
+		{"GuidanceScale", strconv.FormatFloat(meta.GuidanceScale, 'f', -1, 64)},
+		{"Width", strconv.Itoa(meta.Width)},
+		{"Height", strconv.Itoa(meta.Height)},
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	buf.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	buf.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	buf.WriteString("  <rdf:Description rdf:about=\"\" xmlns:ainexus=\"" + xmpNamespace + "\"")
+	for _, attr := range attrs {
+		buf.WriteString("\n   ainexus:" + attr[0] + "=\"")
+		_ = xml.EscapeText(&buf, []byte(attr[1]))
+		buf.WriteString("\"")
+	}
+	buf.WriteString("/>\n")
+	buf.WriteString(" </rdf:RDF>\n")
+	buf.WriteString("</x:xmpmeta>\n")
+	buf.WriteString("<?xpacket end=\"w\"?>")
+	return buf.Bytes()
+}
+
+func parseXMP(packet []byte) (*GenerationMetadata, error) {
+	var meta xmpMeta
+	if err := xml.Unmarshal(packet, &meta); err != nil {
+		return nil, fmt.Errorf("parse xmp error: %w", err)
+	}
+
+	for i := range meta.Descriptions {
+		if meta.Descriptions[i].Prompt != "" || meta.Descriptions[i].TaskID != "" {
+			return &meta.Descriptions[i], nil
+		}
+	}
+	return nil, ErrNoMetadata
+}
+
+// parseA1111Parameters 解析 SD WebUI 的 parameters 文本:
+// 第一段为正向提示词, "Negative prompt:" 开头的为负向提示词, 最后一行为逗号分隔的 "键: 值"
+func parseA1111Parameters(params string) (*GenerationMetadata, error) {
+	lines := strings.Split(strings.TrimSpace(params), "\n")
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, ErrNoMetadata
+	}
+
+	meta := &GenerationMetadata{}
+	last := lines[len(lines)-1]
+	if strings.HasPrefix(last, "Steps:") {
+		lines = lines[:len(lines)-1]
+		for field := range strings.SplitSeq(last, ",") {
+			key, value, ok := strings.Cut(field, ":")
+			if !ok {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			switch strings.TrimSpace(key) {
+			case "Steps":
+				meta.NumInferenceSteps, _ = strconv.Atoi(value)
+			case "CFG scale":
+				meta.GuidanceScale, _ = strconv.ParseFloat(value, 64)
+			case "Seed":
+				meta.Seed, _ = strconv.ParseInt(value, 10, 64)
+			case "Model":
+				meta.ModelID = value
+			case "Size":
+				w, h, _ := strings.Cut(value, "x")
+				meta.Width, _ = strconv.Atoi(w)
+				meta.Height, _ = strconv.Atoi(h)
+			}
+		}
+	}
+
+	var prompt, negative []string
+	target := &prompt
+	for _, line := range lines {
+		if rest, ok := strings.CutPrefix(line, "Negative prompt:"); ok {
+			target = &negative
+			line = strings.TrimSpace(rest)
+		}
+		*target = append(*target, line)
+	}
+	meta.Prompt = strings.TrimSpace(strings.Join(prompt, "\n"))
+	meta.NegativePrompt = strings.TrimSpace(strings.Join(negative, "\n"))
+	return meta, nil
+}
+
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+func isPNG(data []byte) bool {
+	return len(data) >= 8 && string(data[:8]) == "\x89PNG\r\n\x1a\n"
+}
+
+// riffChunk WebP 中的一个 RIFF 块
+type riffChunk struct {
+	fourCC  string
+	payload []byte
+}
+
+func readRIFFChunks(data []byte) ([]riffChunk, error) {
+	var chunks []riffChunk
+	for offset := 12; offset+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		end := offset + 8 + size
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated webp chunk")
+		}
+		chunks = append(chunks, riffChunk{fourCC: string(data[offset : offset+4]), payload: data[offset+8 : end]})
+		// 块长度为奇数时补一个字节
+		offset = end + size%2
+	}
+	return chunks, nil
+}
+
+func writeRIFFChunks(chunks []riffChunk) []byte {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for _, chunk := range chunks {
+		body.WriteString(chunk.fourCC)
+		_ = binary.Write(&body, binary.LittleEndian, uint32(len(chunk.payload)))
+		body.Write(chunk.payload)
+		if len(chunk.payload)%2 == 1 {
+			body.WriteByte(0)
+		}
+	}
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	_ = binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// embedWebPXMP 写入 XMP 块, 简单格式(VP8/VP8L)需要先补一个 VP8X 头转为扩展格式
+func embedWebPXMP(data, packet []byte) ([]byte, error) {
+	chunks, err := readRIFFChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("empty webp")
+	}
+
+	const (
+		flagAlpha = 0x10
+		flagXMP   = 0x04
+	)
+
+	if chunks[0].fourCC != "VP8X" {
+		width, height, alpha, err := webpImageSize(chunks[0])
+		if err != nil {
+			return nil, err
+		}
+		header := make([]byte, 10)
+		if alpha {
+			header[0] |= flagAlpha
+		}
+		putUint24(header[4:7], width-1)
+		putUint24(header[7:10], height-1)
+		chunks = append([]riffChunk{{fourCC: "VP8X", payload: header}}, chunks...)
+	}
+
+	header := append([]byte(nil), chunks[0].payload...)
+	header[0] |= flagXMP
+	chunks[0].payload = header
+
+	// XMP 块必须位于图像数据之后, 已存在时替换
+	kept := chunks[:0]
+	for _, chunk := range chunks {
+		if chunk.fourCC != "XMP " {
+			kept = append(kept, chunk)
+		}
+	}
+	kept = append(kept, riffChunk{fourCC: "XMP ", payload: packet})
+
+	return writeRIFFChunks(kept), nil
+}
+
+func extractWebPXMP(data []byte) ([]byte, bool) {
+	chunks, err := readRIFFChunks(data)
+	if err != nil {
+		return nil, false
+	}
+	for _, chunk := range chunks {
+		if chunk.fourCC == "XMP " {
+			return chunk.payload, true
+		}
+	}
+	return nil, false
+}
+
+// webpImageSize 从 VP8/VP8L 位流头读取宽高
+func webpImageSize(chunk riffChunk) (int, int, bool, error) {
+	p := chunk.payload
+	switch chunk.fourCC {
+	case "VP8 ":
+		// 3 字节帧标记 + 3 字节起始码 9d 01 2a + 各 14 位的宽高
+		if len(p) < 10 || p[3] != 0x9d || p[4] != 0x01 || p[5] != 0x2a {
+			return 0, 0, false, fmt.Errorf("invalid vp8 header")
+		}
+		width := int(binary.LittleEndian.Uint16(p[6:8]) & 0x3fff)
+		height := int(binary.LittleEndian.Uint16(p[8:10]) & 0x3fff)
+		return width, height, false, nil
+	case "VP8L":
+		// 1 字节签名 0x2f + 14 位宽-1 + 14 位高-1 + 1 位 alpha
+		if len(p) < 5 || p[0] != 0x2f {
+			return 0, 0, false, fmt.Errorf("invalid vp8l header")
+		}
+		bits := binary.LittleEndian.Uint32(p[1:5])
+		width := int(bits&0x3fff) + 1
+		height := int((bits>>14)&0x3fff) + 1
+		alpha := (bits>>28)&1 == 1
+		return width, height, alpha, nil
+	default:
+		return 0, 0, false, fmt.Errorf("unexpected webp chunk: %s", chunk.fourCC)
+	}
+}
+
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+// embedPNGText 在 IEND 之前插入未压缩的 iTXt 块, 同名关键字的旧块会被移除
+func embedPNGText(data []byte, keyword string, text []byte) ([]byte, error) {
+	var out bytes.Buffer
+	out.Write(data[:8])
+
+	for offset := 8; offset+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		end := offset + 12 + length
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated png chunk")
+		}
+		chunkType := string(data[offset+4 : offset+8])
+		payload := data[offset+8 : offset+8+length]
+
+		if chunkType == "IEND" {
+			// 关键字 + 0 + 压缩标记 0 + 压缩方法 0 + 空语言标签 0 + 空翻译关键字 0 + 文本
+			itxt := append([]byte(keyword), 0, 0, 0, 0, 0)
+			writePNGChunk(&out, "iTXt", append(itxt, text...))
+		}
+
+		if !(chunkType == "iTXt" && bytes.HasPrefix(payload, append([]byte(keyword), 0))) {
+			out.Write(data[offset:end])
+		}
+		offset = end
+	}
+	return out.Bytes(), nil
+}
+
+func writePNGChunk(out *bytes.Buffer, chunkType string, payload []byte) {
+	_ = binary.Write(out, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(payload)
+	out.WriteString(chunkType)
+	out.Write(payload)
+	_ = binary.Write(out, binary.BigEndian, crc.Sum32())
+}
+
+// readPNGText 读取 tEXt 与未压缩的 iTXt 块
+func readPNGText(data []byte) map[string]string {
+	texts := make(map[string]string)
+	for offset := 8; offset+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		end := offset + 12 + length
+		if end > len(data) {
+			break
+		}
+		chunkType := string(data[offset+4 : offset+8])
+		payload := data[offset+8 : offset+8+length]
+		offset = end
+
+		keyword, rest, ok := bytes.Cut(payload, []byte{0})
+		if !ok {
+			continue
+		}
+		switch chunkType {
+		case "tEXt":
+			texts[string(keyword)] = string(rest)
+		case "iTXt":
+			// 压缩标记 + 压缩方法 + 语言标签\0 + 翻译关键字\0 + 文本, 只支持未压缩的文本
+			if len(rest) < 2 || rest[0] != 0 {
+				continue
+			}
+			_, afterLang, ok := bytes.Cut(rest[2:], []byte{0})
+			if !ok {
+				continue
+			}
+			_, text, ok := bytes.Cut(afterLang, []byte{0})
+			if !ok {
+				continue
+			}
+			texts[string(keyword)] = string(text)
+		}
+	}
+	return texts
+}
@@ -0,0 +1,112 @@
+package oauth
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+)
+
+const (
+	githubDefaultBaseURL = "https://github.com"
+	githubDefaultAPIURL  = "https://api.github.com"
+	githubAccept         = "application/vnd.github+json"
+)
+
+// GitHubProvider GitHub OAuth App 登录, 邮箱取自 /user/emails 中已验证的主邮箱
+type GitHubProvider struct {
+	cfg     configs.OAuthProviderConfig
+	scopes  []string
+	baseURL string
+	apiURL  string
+}
+
+// NewGitHubProvider 创建 GitHub provider, baseurl 与 apiurl 可指向 GitHub Enterprise 或本地模拟服务
+func NewGitHubProvider(cfg configs.OAuthProviderConfig) *GitHubProvider {
+	p := &GitHubProvider{
+		cfg:     cfg,
+		scopes:  cfg.Scopes,
+		baseURL: strings.TrimSuffix(cfg.BaseURL, "/"),
+		apiURL:  strings.TrimSuffix(cfg.APIURL, "/"),
+	}
+	if len(p.scopes) == 0 {
+		p.scopes = []string{"read:user", "user:email"}
+	}
+	if p.baseURL == "" {
+		p.baseURL = githubDefaultBaseURL
+	}
+	if p.apiURL == "" {
+		p.apiURL = githubDefaultAPIURL
+	}
+	return p
+}
+
+// AuthCodeURL 拼接 GitHub 授权地址, GitHub 不使用 nonce
+func (p *GitHubProvider) AuthCodeURL(_ context.Context, state, _, codeChallenge string) (string, error) {
+	query := url.Values{}
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	return p.baseURL + "/login/oauth/authorize?" + query.Encode(), nil
+}
+
+// Authenticate 换取访问令牌后查询账号与邮箱
+func (p *GitHubProvider) Authenticate(ctx context.Context, code, codeVerifier, _ string) (*Identity, error) {
+	token, err := exchangeCode(ctx, p.baseURL+"/login/oauth/access_token", p.cfg, code, codeVerifier, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Name      string `json:"name"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err = getJSON(ctx, p.apiURL+"/user", token.AccessToken, githubAccept, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%w: github user id is missing", ErrProviderResponse)
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err = getJSON(ctx, p.apiURL+"/user/emails", token.AccessToken, githubAccept, &emails); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	// 优先使用已验证的主邮箱, 主邮箱未验证时退而使用任一已验证邮箱
+	for _, email := range emails {
+		if !email.Verified {
+			continue
+		}
+		if identity.Email == "" || email.Primary {
+			identity.Email = email.Email
+			identity.EmailVerified = true
+		}
+		if email.Primary {
+			break
+		}
+	}
+	return identity, nil
+}
@@ -0,0 +1,326 @@
+package oauth
+
+import (
+	"cmp"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksRefreshInterval 遇到未知 kid 时重新拉取公钥的最小间隔, 防止伪造 kid 打满提供方
+	jwksRefreshInterval = time.Minute
+	// idTokenLeeway 校验 exp 与 iat 时允许的时钟偏差
+	idTokenLeeway = time.Minute
+)
+
+// idTokenAlgorithms 接受的 ID Token 签名算法, 不接受 HS256 与 none
+var idTokenAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// OIDCProvider 标准 OpenID Connect 登录, 端点通过 discovery 获取, ID Token 使用 JWKS 公钥验签
+type OIDCProvider struct {
+	cfg    configs.OAuthProviderConfig
+	scopes []string
+
+	mu            sync.Mutex
+	metadata      *oidcMetadata
+	keys          map[string]any
+	keysFetchedAt time.Time
+}
+
+// oidcMetadata discovery 文档中用到的字段
+type oidcMetadata struct {
+	Issuer                   string   `json:"issuer"`
+	AuthorizationEndpoint    string   `json:"authorization_endpoint"`
+	TokenEndpoint            string   `json:"token_endpoint"`
+	UserinfoEndpoint         string   `json:"userinfo_endpoint"`
+	JWKSURI                  string   `json:"jwks_uri"`
+	TokenEndpointAuthMethods []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// idTokenClaims ID Token 与 userinfo 中用到的声明
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	Name          string       `json:"name"`
+	Picture       string       `json:"picture"`
+}
+
+// flexibleBool 部分提供方把 email_verified 编码为字符串 "true"
+type flexibleBool bool
+
+// UnmarshalJSON 同时接受布尔值与字符串
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = flexibleBool(strings.EqualFold(v, "true"))
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// NewOIDCProvider 创建 OIDC provider, discovery 在首次使用时进行, 失败后下次请求重试
+func NewOIDCProvider(cfg configs.OAuthProviderConfig) *OIDCProvider {
+	p := &OIDCProvider{cfg: cfg, scopes: cfg.Scopes}
+	if len(p.scopes) == 0 {
+		p.scopes = []string{"openid", "email", "profile"}
+	}
+	if !slices.Contains(p.scopes, "openid") {
+		p.scopes = append([]string{"openid"}, p.scopes...)
+	}
+	return p
+}
+
+// AuthCodeURL 拼接授权地址, nonce 写入 ID Token 用于防止重放
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Authenticate 换取令牌并校验 ID Token, ID Token 不含邮箱时再查询 userinfo
+func (p *OIDCProvider) Authenticate(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// 未声明支持的认证方式时按规范默认使用 client_secret_basic
+	basicAuth := len(metadata.TokenEndpointAuthMethods) == 0 ||
+		slices.Contains(metadata.TokenEndpointAuthMethods, "client_secret_basic")
+
+	token, err := exchangeCode(ctx, metadata.TokenEndpoint, p.cfg, code, codeVerifier, basicAuth)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: id_token is missing, check the openid scope", ErrProviderResponse)
+	}
+
+	claims, err := p.verifyIDToken(ctx, metadata, token.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Email == "" && metadata.UserinfoEndpoint != "" {
+		userinfo := &idTokenClaims{}
+		if err = getJSON(ctx, metadata.UserinfoEndpoint, token.AccessToken, "application/json", userinfo); err != nil {
+			return nil, err
+		}
+		if userinfo.Subject != claims.Subject {
+			return nil, fmt.Errorf("%w: userinfo subject does not match id_token", ErrProviderResponse)
+		}
+		claims.Email, claims.EmailVerified = userinfo.Email, userinfo.EmailVerified
+		claims.Name = cmp.Or(claims.Name, userinfo.Name)
+		claims.Picture = cmp.Or(claims.Picture, userinfo.Picture)
+	}
+
+	return &Identity{
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          claims.Name,
+		AvatarURL:     claims.Picture,
+	}, nil
+}
+
+// verifyIDToken 校验签名、签发方、受众、有效期与 nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, metadata *oidcMetadata, rawIDToken, nonce string) (*idTokenClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(idTokenAlgorithms),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+	)
+
+	claims := &idTokenClaims{}
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, metadata, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid id_token: %v", ErrProviderResponse, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: id_token subject is missing", ErrProviderResponse)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: id_token nonce mismatch", ErrProviderResponse)
+	}
+	return claims, nil
+}
+
+// discover 读取并缓存 discovery 文档, issuer 必须与配置一致
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	issuer := strings.TrimSuffix(p.cfg.Issuer, "/")
+	metadata := &oidcMetadata{}
+	if err := getJSON(ctx, issuer+"/.well-known/openid-configuration", "", "application/json", metadata); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("%w: discovery issuer %q does not match %q", ErrProviderResponse, metadata.Issuer, p.cfg.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document is incomplete", ErrProviderResponse)
+	}
+
+	p.metadata = metadata
+	return metadata, nil
+}
+
+// publicKey 按 kid 查找验签公钥, 找不到时按最小间隔重新拉取 JWKS, 以适应提供方轮换密钥
+func (p *OIDCProvider) publicKey(ctx context.Context, metadata *oidcMetadata, kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := lookupKey(p.keys, kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("signing key %q not found", kid)
+	}
+
+	keys, err := fetchJWKS(ctx, metadata.JWKSURI)
+	p.keysFetchedAt = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+
+	if key, ok := lookupKey(p.keys, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("signing key %q not found", kid)
+}
+
+// lookupKey ID Token 未携带 kid 时只有 JWKS 恰好一个公钥才能确定
+func lookupKey(keys map[string]any, kid string) (any, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// fetchJWKS 拉取并解析 JWKS, 忽略非签名用途与不支持类型的公钥
+func fetchJWKS(ctx context.Context, jwksURI string) (map[string]any, error) {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, "", "application/json", &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]any, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		switch jwk.Kty {
+		case "RSA":
+			n, errN := decodeBigInt(jwk.N)
+			e, errE := decodeBigInt(jwk.E)
+			if errN != nil || errE != nil || !e.IsInt64() {
+				continue
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve := ellipticCurve(jwk.Crv)
+			x, errX := decodeBigInt(jwk.X)
+			y, errY := decodeBigInt(jwk.Y)
+			if curve == nil || errX != nil || errY != nil {
+				continue
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: jwks contains no usable signing keys", ErrProviderResponse)
+	}
+	return keys, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func ellipticCurve(name string) elliptic.Curve {
+	switch name {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,360 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "ainexus"
+	testClientSecret = "secret"
+	testKid          = "key-1"
+	testNonce        = "nonce-0S6_WzA2Mj"
+	testCode         = "SplxlOBeZQQYbYS6WxSbIA"
+	// testVerifier 与 testChallenge 取自 RFC 7636 附录 B
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+// testOIDCServer 模拟 OIDC 提供方, 提供 discovery、JWKS 与令牌端点
+type testOIDCServer struct {
+	*httptest.Server
+	key      *rsa.PrivateKey
+	idToken  func(s *testOIDCServer) string
+	jwksHits atomic.Int32
+}
+
+func newTestOIDCServer(t *testing.T, key *rsa.PrivateKey, idToken func(s *testOIDCServer) string) *testOIDCServer {
+	t.Helper()
+
+	s := &testOIDCServer{key: key, idToken: idToken}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                s.URL,
+			"authorization_endpoint":                s.URL + "/authorize",
+			"token_endpoint":                        s.URL + "/token",
+			"jwks_uri":                              s.URL + "/jwks",
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, _ *http.Request) {
+		s.jwksHits.Add(1)
+		writeJSON(w, http.StatusOK, map[string]any{
+			"keys": []map[string]any{{
+				"kty": "RSA",
+				"kid": testKid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, ok := r.BasicAuth()
+		if !ok || clientID != testClientID || clientSecret != testClientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "invalid_client"})
+			return
+		}
+		if r.PostFormValue("code") != testCode || codeChallengeS256(r.PostFormValue("code_verifier")) != testChallenge {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"id_token":     s.idToken(s),
+		})
+	})
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testOIDCServer) provider() *OIDCProvider {
+	return NewOIDCProvider(configs.OAuthProviderConfig{
+		Type:         TypeOIDC,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  "http://localhost/callback",
+		Issuer:       s.URL,
+	})
+}
+
+// claims 返回一组合法的 ID Token 声明, 测试用例在此基础上修改
+func (s *testOIDCServer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            testClientID,
+		"sub":            "248289761001",
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+		"nonce":          testNonce,
+		"email":          "jane@example.com",
+		"email_verified": true,
+		"name":           "Jane Doe",
+	}
+}
+
+// sign 使用提供方的 RSA 私钥签发 ID Token, 在令牌端点的 goroutine 中调用, 失败时不能使用 t.Fatalf
+func (s *testOIDCServer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(s.key)
+	if err != nil {
+		t.Errorf("sign id_token: %v", err)
+	}
+	return raw
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func generateTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	return key
+}
+
+func TestOIDCAuthenticate(t *testing.T) {
+	key := generateTestKey(t)
+	otherKey := generateTestKey(t)
+
+	tests := []struct {
+		name         string
+		idToken      func(t *testing.T, s *testOIDCServer) string
+		wantErr      string
+		wantVerified bool
+	}{
+		{
+			name: "valid id_token",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				return s.sign(t, testKid, s.claims())
+			},
+			wantVerified: true,
+		},
+		{
+			name: "email_verified as string true",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				claims := s.claims()
+				claims["email_verified"] = "true"
+				return s.sign(t, testKid, claims)
+			},
+			wantVerified: true,
+		},
+		{
+			name: "email_verified as string false",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				claims := s.claims()
+				claims["email_verified"] = "false"
+				return s.sign(t, testKid, claims)
+			},
+			wantVerified: false,
+		},
+		{
+			name: "nonce mismatch",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				claims := s.claims()
+				claims["nonce"] = "another-nonce"
+				return s.sign(t, testKid, claims)
+			},
+			wantErr: "nonce mismatch",
+		},
+		{
+			name: "wrong audience",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				claims := s.claims()
+				claims["aud"] = "another-client"
+				return s.sign(t, testKid, claims)
+			},
+			wantErr: "invalid audience",
+		},
+		{
+			name: "wrong issuer",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				claims := s.claims()
+				claims["iss"] = "https://attacker.example.com"
+				return s.sign(t, testKid, claims)
+			},
+			wantErr: "invalid issuer",
+		},
+		{
+			name: "expired",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				claims := s.claims()
+				claims["exp"] = time.Now().Add(-time.Hour).Unix()
+				return s.sign(t, testKid, claims)
+			},
+			wantErr: "token is expired",
+		},
+		{
+			name: "alg HS256 signed with client secret",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, s.claims())
+				token.Header["kid"] = testKid
+				raw, err := token.SignedString([]byte(testClientSecret))
+				if err != nil {
+					t.Errorf("sign id_token: %v", err)
+				}
+				return raw
+			},
+			wantErr: "signing method HS256 is invalid",
+		},
+		{
+			name: "alg none",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodNone, s.claims())
+				token.Header["kid"] = testKid
+				raw, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+				if err != nil {
+					t.Errorf("sign id_token: %v", err)
+				}
+				return raw
+			},
+			wantErr: "signing method none is invalid",
+		},
+		{
+			name: "unknown kid",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				return s.sign(t, "unknown", s.claims())
+			},
+			wantErr: "signing key \"unknown\" not found",
+		},
+		{
+			name: "signed by another key",
+			idToken: func(t *testing.T, s *testOIDCServer) string {
+				token := jwt.NewWithClaims(jwt.SigningMethodRS256, s.claims())
+				token.Header["kid"] = testKid
+				raw, err := token.SignedString(otherKey)
+				if err != nil {
+					t.Errorf("sign id_token: %v", err)
+				}
+				return raw
+			},
+			wantErr: "verification error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestOIDCServer(t, key, func(s *testOIDCServer) string {
+				return tt.idToken(t, s)
+			})
+
+			identity, err := server.provider().Authenticate(t.Context(), testCode, testVerifier, testNonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Authenticate() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			if identity.Subject != "248289761001" || identity.Email != "jane@example.com" || identity.Name != "Jane Doe" {
+				t.Errorf("Authenticate() identity = %+v", identity)
+			}
+			if identity.EmailVerified != tt.wantVerified {
+				t.Errorf("Authenticate() EmailVerified = %v, want %v", identity.EmailVerified, tt.wantVerified)
+			}
+		})
+	}
+}
+
+func TestOIDCAuthenticateRejectsWrongVerifier(t *testing.T) {
+	server := newTestOIDCServer(t, generateTestKey(t), func(s *testOIDCServer) string {
+		return s.sign(t, testKid, s.claims())
+	})
+
+	if _, err := server.provider().Authenticate(t.Context(), testCode, "wrong-verifier", testNonce); err == nil {
+		t.Fatalf("Authenticate() with wrong code_verifier succeeded, want error")
+	}
+}
+
+func TestOIDCUnknownKidThrottlesJWKSRefresh(t *testing.T) {
+	server := newTestOIDCServer(t, generateTestKey(t), func(s *testOIDCServer) string {
+		return s.sign(t, "rotated", s.claims())
+	})
+	provider := server.provider()
+
+	for range 3 {
+		if _, err := provider.Authenticate(t.Context(), testCode, testVerifier, testNonce); err == nil {
+			t.Fatalf("Authenticate() with unknown kid succeeded, want error")
+		}
+	}
+	if hits := server.jwksHits.Load(); hits != 1 {
+		t.Fatalf("jwks fetched %d times within refresh interval, want 1", hits)
+	}
+
+	// 超过最小间隔后允许再次拉取
+	provider.mu.Lock()
+	provider.keysFetchedAt = time.Now().Add(-jwksRefreshInterval)
+	provider.mu.Unlock()
+
+	if _, err := provider.Authenticate(t.Context(), testCode, testVerifier, testNonce); err == nil {
+		t.Fatalf("Authenticate() with unknown kid succeeded, want error")
+	}
+	if hits := server.jwksHits.Load(); hits != 2 {
+		t.Fatalf("jwks fetched %d times after refresh interval, want 2", hits)
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                 "https://attacker.example.com",
+			"authorization_endpoint": "https://attacker.example.com/authorize",
+			"token_endpoint":         "https://attacker.example.com/token",
+			"jwks_uri":               "https://attacker.example.com/jwks",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	provider := NewOIDCProvider(configs.OAuthProviderConfig{
+		Type:        TypeOIDC,
+		ClientID:    testClientID,
+		RedirectURL: "http://localhost/callback",
+		Issuer:      server.URL,
+	})
+	if _, err := provider.AuthCodeURL(t.Context(), "state", testNonce, testChallenge); err == nil {
+		t.Fatalf("AuthCodeURL() with mismatched discovery issuer succeeded, want error")
+	}
+}
+
+func TestCodeChallengeS256(t *testing.T) {
+	if got := codeChallengeS256(testVerifier); got != testChallenge {
+		t.Fatalf("codeChallengeS256() = %q, want %q", got, testChallenge)
+	}
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatalf("NewPKCE() error = %v", err)
+	}
+	if len(verifier) != 43 || challenge != codeChallengeS256(verifier) {
+		t.Fatalf("NewPKCE() = %q, %q", verifier, challenge)
+	}
+}
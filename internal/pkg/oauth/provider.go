@@ -0,0 +1,175 @@
+// Package oauth 第三方登录, 统一使用授权码模式 + PKCE
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+)
+
+const (
+	// TypeGitHub GitHub OAuth App, 不支持 OIDC, 通过 REST API 获取账号信息
+	TypeGitHub = "github"
+	// TypeOIDC 标准 OpenID Connect 提供方, 如 Google 与公司统一认证
+	TypeOIDC = "oidc"
+
+	// maxResponseSize 提供方响应体的读取上限
+	maxResponseSize = 1 << 20
+)
+
+// ErrProviderResponse 提供方拒绝授权码或返回了无法识别的数据
+var ErrProviderResponse = errors.New("oauth provider returned an invalid response")
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Identity 第三方账号信息
+type Identity struct {
+	Subject       string // 提供方内唯一且不变的账号 ID
+	Email         string
+	EmailVerified bool
+	Name          string
+	AvatarURL     string
+}
+
+// Provider 第三方登录提供方
+type Provider interface {
+	// AuthCodeURL 拼接授权地址, codeChallenge 为 PKCE S256 摘要, nonce 只有 OIDC 使用
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	// Authenticate 使用授权码与 PKCE verifier 换取令牌, 返回第三方账号信息
+	Authenticate(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// NewProviders 根据配置创建全部已启用的 provider, 配置有误的 provider 记录日志后跳过
+func NewProviders(cfg map[string]configs.OAuthProviderConfig) map[string]Provider {
+	providers := make(map[string]Provider, len(cfg))
+	for name, providerCfg := range cfg {
+		if providerCfg.ClientID == "" {
+			continue
+		}
+
+		provider, err := NewProvider(providerCfg)
+		if err != nil {
+			log.Printf("[OAuth] Provider %s disabled: %v\n", name, err)
+			continue
+		}
+		providers[name] = provider
+	}
+	return providers
+}
+
+// NewProvider 根据 type 字段创建对应实例, 不会访问网络
+func NewProvider(cfg configs.OAuthProviderConfig) (Provider, error) {
+	if cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("redirecturl is required")
+	}
+
+	switch cfg.Type {
+	case TypeGitHub:
+		return NewGitHubProvider(cfg), nil
+	case TypeOIDC:
+		if cfg.Issuer == "" {
+			return nil, fmt.Errorf("issuer is required for oidc providers")
+		}
+		return NewOIDCProvider(cfg), nil
+	default:
+		return nil, fmt.Errorf("unsupported oauth provider type: %s", cfg.Type)
+	}
+}
+
+// tokenResponse 令牌端点的响应
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode 在令牌端点用授权码换取令牌, basicAuth 为 false 时客户端密钥放在表单中
+func exchangeCode(ctx context.Context, tokenURL string, cfg configs.OAuthProviderConfig, code, codeVerifier string, basicAuth bool) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	if !basicAuth {
+		form.Set("client_id", cfg.ClientID)
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basicAuth {
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+
+	token := &tokenResponse{}
+	status, err := doJSON(req, token)
+	if err != nil {
+		return nil, err
+	}
+	// GitHub 换取失败时同样返回 200, 只能依据 error 字段判断
+	if token.Error != "" {
+		return nil, fmt.Errorf("%w: %s", ErrProviderResponse, strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+	}
+	if status != http.StatusOK || token.AccessToken == "" {
+		return nil, fmt.Errorf("%w: token endpoint status %d", ErrProviderResponse, status)
+	}
+	return token, nil
+}
+
+// getJSON 携带访问令牌请求 JSON 接口
+func getJSON(ctx context.Context, endpoint, accessToken, accept string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", accept)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	status, err := doJSON(req, out)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("%w: %s status %d", ErrProviderResponse, endpoint, status)
+	}
+	return nil
+}
+
+// doJSON 发送请求并解析 JSON 响应, 非 2xx 响应只返回状态码
+func doJSON(req *http.Request, out any) (int, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return 0, err
+	}
+
+	if err = json.Unmarshal(body, out); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return resp.StatusCode, nil
+		}
+		return resp.StatusCode, fmt.Errorf("%w: %v", ErrProviderResponse, err)
+	}
+	return resp.StatusCode, nil
+}
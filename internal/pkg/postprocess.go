@@ -0,0 +1,159 @@
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/chai2010/webp"
+)
+
+// ParseAspectRatio 解析 "16:9" 形式的宽高比
+func ParseAspectRatio(ratio string) (int, int, error) {
+	parts := strings.Split(ratio, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio: %s", ratio)
+	}
+
+	w, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || w <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio: %s", ratio)
+	}
+	h, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || h <= 0 {
+		return 0, 0, fmt.Errorf("invalid aspect ratio: %s", ratio)
+	}
+	return w, h, nil
+}
+
+// CropToAspect 以中心为基准裁剪到目标宽高比, 只裁掉多出的一边
+func CropToAspect(src image.Image, ratioW, ratioH int) *image.NRGBA {
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	cropW, cropH := w, w*ratioH/ratioW
+	if cropH > h {
+		cropW, cropH = h*ratioW/ratioH, h
+	}
+
+	offset := image.Pt(bounds.Min.X+(w-cropW)/2, bounds.Min.Y+(h-cropH)/2)
+	dst := image.NewNRGBA(image.Rect(0, 0, cropW, cropH))
+	draw.Draw(dst, dst.Bounds(), src, offset, draw.Src)
+	return dst
+}
+
+// ResizeImage 双线性插值缩放到指定宽高, 用于没有超分能力时的本地放大
+func ResizeImage(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	// 统一转换为 NRGBA 便于按下标取像素
+	in := image.NewNRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(in, in.Bounds(), src, bounds.Min, draw.Src)
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	scaleX := float64(srcW) / float64(width)
+	scaleY := float64(srcH) / float64(height)
+
+	for y := range height {
+		fy := (float64(y)+0.5)*scaleY - 0.5
+		y0 := clampIndex(int(fy), srcH)
+		y1 := clampIndex(y0+1, srcH)
+		wy := min(max(fy-float64(y0), 0), 1)
+
+		for x := range width {
+			fx := (float64(x)+0.5)*scaleX - 0.5
+			x0 := clampIndex(int(fx), srcW)
+			x1 := clampIndex(x0+1, srcW)
+			wx := min(max(fx-float64(x0), 0), 1)
+
+			p00 := in.NRGBAAt(x0, y0)
+			p10 := in.NRGBAAt(x1, y0)
+			p01 := in.NRGBAAt(x0, y1)
+			p11 := in.NRGBAAt(x1, y1)
+
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: lerpChannel(p00.R, p10.R, p01.R, p11.R, wx, wy),
+				G: lerpChannel(p00.G, p10.G, p01.G, p11.G, wx, wy),
+				B: lerpChannel(p00.B, p10.B, p01.B, p11.B, wx, wy),
+				A: lerpChannel(p00.A, p10.A, p01.A, p11.A, wx, wy),
+			})
+		}
+	}
+
+	return dst
+}
+
+func clampIndex(i, n int) int {
+	return min(max(i, 0), n-1)
+}
+
+func lerpChannel(c00, c10, c01, c11 uint8, wx, wy float64) uint8 {
+	top := float64(c00)*(1-wx) + float64(c10)*wx
+	bottom := float64(c01)*(1-wx) + float64(c11)*wx
+	return uint8(top*(1-wy) + bottom*wy + 0.5)
+}
+
+// OverlayWatermark 把水印按透明度叠加到右下角, 水印宽度超过底图 1/4 时等比缩小
+func OverlayWatermark(src image.Image, mark image.Image, opacity float64, margin int) *image.NRGBA {
+	bounds := src.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+
+	markW, markH := mark.Bounds().Dx(), mark.Bounds().Dy()
+	if maxW := bounds.Dx() / 4; markW > maxW && maxW > 0 {
+		markH = markH * maxW / markW
+		markW = maxW
+		mark = ResizeImage(mark, markW, max(markH, 1))
+	}
+
+	if opacity <= 0 || opacity > 1 {
+		opacity = 1
+	}
+	alpha := image.NewUniform(color.Alpha{A: uint8(opacity * 255)})
+
+	pos := image.Pt(bounds.Dx()-markW-margin, bounds.Dy()-markH-margin)
+	rect := image.Rectangle{Min: pos, Max: pos.Add(image.Pt(markW, markH))}
+	draw.DrawMask(dst, rect, mark, mark.Bounds().Min, alpha, image.Point{}, draw.Over)
+	return dst
+}
+
+// LoadImage 解码本地图片文件
+func LoadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open image error: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode image error: %w", err)
+	}
+	return img, nil
+}
+
+// SaveWebP 把图片编码为 WebP 写入 path
+func SaveWebP(path string, img image.Image, quality int) error {
+	if quality <= 0 || quality > 100 {
+		quality = 80
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create webp file error: %w", err)
+	}
+
+	if err = webp.Encode(file, img, &webp.Options{Quality: float32(quality)}); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("encode webp error: %w", err)
+	}
+	return file.Close()
+}
@@ -2,6 +2,7 @@
 package queue
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"reflect"
@@ -59,16 +60,34 @@ func Consume(queueName string, handler MessageHandler) error {
 		if err != nil {
 			log.Printf("[RabbitMQ] Handler failed for task_id %s: %v\n", msg.MessageId, err)
 
-			// 可以重试
+			// 可以重试, 投递到延迟队列, 指数退避后再回到原队列
 			if retry && retryCount < maxRetries {
-				// 重试
-				if errs := msg.Nack(false, true); errs != nil {
-					log.Printf("[RabbitMQ] Failed to nack message for task_id %s: %v\n", msg.MessageId, err)
-				}
+				delay := RetryDelay(retryCount)
 
-				// 更新重试次数
+				// 更新重试次数和下次重试时间
 				if errs := dao.UpdateTaskParams("retry_count", retryCount+1, msg.MessageId); errs != nil {
-					log.Printf("[RabbitMQ] Failed to update retry count for task_id %s: %v\n", msg.MessageId, err)
+					log.Printf("[RabbitMQ] Failed to update retry count for task_id %s: %v\n", msg.MessageId, errs)
+				}
+
+				if errs := dao.UpdateTaskParams("next_retry_at", time.Now().Add(delay), msg.MessageId); errs != nil {
+					log.Printf("[RabbitMQ] Failed to update next retry time for task_id %s: %v\n", msg.MessageId, errs)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+				errs := publishDelayed(ctx, msg.RoutingKey, msg.MessageId, msg.Priority, msg.Body, delay)
+				cancel()
+
+				if errs == nil {
+					if errs = msg.Ack(false); errs != nil {
+						log.Printf("[RabbitMQ] Failed to ack message for task_id %s: %v\n", msg.MessageId, errs)
+					}
+					continue
+				}
+
+				// 延迟投递失败时退回立即重新入队
+				log.Printf("[RabbitMQ] Failed to schedule retry for task_id %s, requeue immediately: %v\n", msg.MessageId, errs)
+				if errs = msg.Nack(false, true); errs != nil {
+					log.Printf("[RabbitMQ] Failed to nack message for task_id %s: %v\n", msg.MessageId, errs)
 				}
 
 				continue
@@ -1,10 +1,13 @@
 package queue
 
+import image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
+
 // TaskMessage 任务消息结构
 type TaskMessage struct {
 	TaskID   string `json:"task_id"`
 	UserUUID string `json:"user_uuid"`
 	Payload  any    `json:"payload"`
+	Priority uint8  `json:"priority,omitempty"`
 }
 
 // Text2ImgPayload 文生图任务负载
@@ -17,6 +20,9 @@ type Text2ImgPayload struct {
 	NumInferenceSteps int     `json:"num_inference_steps"`
 	GuidanceScale     float64 `json:"guidance_scale"`
 	Seed              int64   `json:"seed"`
+	NumImages         int     `json:"num_images"`
+	Sampler           string  `json:"sampler,omitempty"`
+	CredentialID      uint64  `json:"credential_id,omitempty"`
 }
 
 // Img2ImgPayload 图生图任务负载
@@ -31,4 +37,157 @@ type Img2ImgPayload struct {
 	Seed              int64   `json:"seed"`
 	InputImageURL     string  `json:"input_image_url"`
 	Strength          float64 `json:"strength"`
+	NumImages         int     `json:"num_images"`
+	Sampler           string  `json:"sampler,omitempty"`
+	CredentialID      uint64  `json:"credential_id,omitempty"`
+}
+
+// InpaintPayload 局部重绘任务负载, 蒙版与原图尺寸一致, 白色区域重绘、黑色区域保留
+type InpaintPayload struct {
+	Prompt            string  `json:"prompt"`
+	NegativePrompt    string  `json:"negative_prompt"`
+	ModelID           string  `json:"model_id"`
+	Width             int     `json:"width"`
+	Height            int     `json:"height"`
+	NumInferenceSteps int     `json:"num_inference_steps"`
+	GuidanceScale     float64 `json:"guidance_scale"`
+	Seed              int64   `json:"seed"`
+	InputImageURL     string  `json:"input_image_url"`
+	MaskImageURL      string  `json:"mask_image_url"`
+	Strength          float64 `json:"strength"`
+	NumImages         int     `json:"num_images"`
+	CredentialID      uint64  `json:"credential_id,omitempty"`
+}
+
+// OutpaintPayload 扩图任务负载, InputImageURL 为已扩展并填充边缘的画布, 蒙版覆盖新增区域
+type OutpaintPayload struct {
+	Prompt            string  `json:"prompt"`
+	NegativePrompt    string  `json:"negative_prompt"`
+	ModelID           string  `json:"model_id"`
+	Width             int     `json:"width"`
+	Height            int     `json:"height"`
+	NumInferenceSteps int     `json:"num_inference_steps"`
+	GuidanceScale     float64 `json:"guidance_scale"`
+	Seed              int64   `json:"seed"`
+	InputImageURL     string  `json:"input_image_url"`
+	MaskImageURL      string  `json:"mask_image_url"`
+	ExtendLeft        int     `json:"extend_left"`
+	ExtendRight       int     `json:"extend_right"`
+	ExtendTop         int     `json:"extend_top"`
+	ExtendBottom      int     `json:"extend_bottom"`
+	NumImages         int     `json:"num_images"`
+	CredentialID      uint64  `json:"credential_id,omitempty"`
+}
+
+// ToInpaint 扩图在上游按局部重绘提交, 新增区域完全重绘
+func (p OutpaintPayload) ToInpaint() InpaintPayload {
+	return InpaintPayload{
+		Prompt:            p.Prompt,
+		NegativePrompt:    p.NegativePrompt,
+		ModelID:           p.ModelID,
+		Width:             p.Width,
+		Height:            p.Height,
+		NumInferenceSteps: p.NumInferenceSteps,
+		GuidanceScale:     p.GuidanceScale,
+		Seed:              p.Seed,
+		InputImageURL:     p.InputImageURL,
+		MaskImageURL:      p.MaskImageURL,
+		Strength:          1,
+		NumImages:         p.NumImages,
+		CredentialID:      p.CredentialID,
+	}
+}
+
+// PostProcessOptions 生成完成后的后处理配置, 按 放大 -> 裁剪 -> 缩放 -> 水印 的顺序执行
+type PostProcessOptions struct {
+	Upscale     int    `json:"upscale,omitempty"`      // 放大倍数 2 或 4, 优先调用 provider 超分, 不支持时本地重采样
+	AspectRatio string `json:"aspect_ratio,omitempty"` // 目标宽高比, 如 16:9, 居中裁剪
+	TargetWidth int    `json:"target_width,omitempty"` // 裁剪后缩放到的宽度, 高度按比例计算
+	Watermark   bool   `json:"watermark,omitempty"`    // 是否叠加平台水印
+}
+
+// PostProcessPayload 后处理任务负载, 输入图片从任务的输出表读取
+type PostProcessPayload struct {
+	ModelID      string             `json:"model_id"`
+	CredentialID uint64             `json:"credential_id,omitempty"`
+	Options      PostProcessOptions `json:"options"`
+}
+
+// NewTaskMessageFromDO 根据任务记录重建队列消息, 用于重新投递
+func NewTaskMessageFromDO(task *image_generation_do.TableImageGenerationTaskDO) *TaskMessage {
+	msg := &TaskMessage{
+		TaskID:   task.TaskID,
+		UserUUID: task.UserUUID,
+		Priority: uint8(task.Priority),
+	}
+
+	switch task.TaskType {
+	case 4:
+		msg.Payload = OutpaintPayload{
+			Prompt:            task.Prompt,
+			NegativePrompt:    task.NegativePrompt,
+			ModelID:           task.ModelID,
+			Width:             task.Width,
+			Height:            task.Height,
+			NumInferenceSteps: task.NumInferenceSteps,
+			GuidanceScale:     task.GuidanceScale,
+			Seed:              task.Seed,
+			InputImageURL:     task.InputImageURL,
+			MaskImageURL:      task.MaskImageURL,
+			ExtendLeft:        task.ExtendLeft,
+			ExtendRight:       task.ExtendRight,
+			ExtendTop:         task.ExtendTop,
+			ExtendBottom:      task.ExtendBottom,
+			NumImages:         task.NumImages,
+			CredentialID:      task.CredentialID,
+		}
+	case 3:
+		msg.Payload = InpaintPayload{
+			Prompt:            task.Prompt,
+			NegativePrompt:    task.NegativePrompt,
+			ModelID:           task.ModelID,
+			Width:             task.Width,
+			Height:            task.Height,
+			NumInferenceSteps: task.NumInferenceSteps,
+			GuidanceScale:     task.GuidanceScale,
+			Seed:              task.Seed,
+			InputImageURL:     task.InputImageURL,
+			MaskImageURL:      task.MaskImageURL,
+			Strength:          task.Strength,
+			NumImages:         task.NumImages,
+			CredentialID:      task.CredentialID,
+		}
+	case 2:
+		msg.Payload = Img2ImgPayload{
+			Prompt:            task.Prompt,
+			NegativePrompt:    task.NegativePrompt,
+			ModelID:           task.ModelID,
+			Width:             task.Width,
+			Height:            task.Height,
+			NumInferenceSteps: task.NumInferenceSteps,
+			GuidanceScale:     task.GuidanceScale,
+			Seed:              task.Seed,
+			InputImageURL:     task.InputImageURL,
+			Strength:          task.Strength,
+			NumImages:         task.NumImages,
+			Sampler:           task.Sampler,
+			CredentialID:      task.CredentialID,
+		}
+	default:
+		msg.Payload = Text2ImgPayload{
+			Prompt:            task.Prompt,
+			NegativePrompt:    task.NegativePrompt,
+			ModelID:           task.ModelID,
+			Width:             task.Width,
+			Height:            task.Height,
+			NumInferenceSteps: task.NumInferenceSteps,
+			GuidanceScale:     task.GuidanceScale,
+			Seed:              task.Seed,
+			NumImages:         task.NumImages,
+			Sampler:           task.Sampler,
+			CredentialID:      task.CredentialID,
+		}
+	}
+
+	return msg
 }
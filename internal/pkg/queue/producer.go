@@ -4,14 +4,33 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// publishConfirmTimeout 等待 broker 发布确认的最长时间, 调用方的 ctx 更早结束时以 ctx 为准
+const publishConfirmTimeout = 5 * time.Second
+
 // Publish 发送任务消息到队列
 func Publish(ctx context.Context, taskType int, message *TaskMessage) error {
+	routingKey, err := routingKeyForTaskType(taskType)
+	if err != nil {
+		return err
+	}
+
+	return publish(ctx, routingKey, message)
+}
+
+// PublishPostProcess 发送后处理消息, 任务生成完成后由 Poller 投递
+func PublishPostProcess(ctx context.Context, message *TaskMessage) error {
+	return publish(ctx, RoutingKeyPostProcess, message)
+}
+
+// publish 以发布确认模式发送消息到生图 Exchange
+func publish(ctx context.Context, routingKey string, message *TaskMessage) error {
 	// 获取通道
 	ch, err := GlobalMQ.GetChannel()
 	if err != nil {
@@ -29,21 +48,12 @@ func Publish(ctx context.Context, taskType int, message *TaskMessage) error {
 		return err
 	}
 
-	var routingKey string
-	switch taskType {
-	case 1:
-		routingKey = RoutingKeyText2Img
-	case 2:
-		routingKey = RoutingKeyImg2Img
-	default:
-		return errors.New("invalid task type")
-	}
-
 	// 发送消息并获取确认
 	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, ExchangeGenImg, routingKey, false, false,
 		amqp.Publishing{
 			DeliveryMode: amqp.Persistent,
 			MessageId:    message.TaskID,
+			Priority:     message.Priority,
 			Timestamp:    time.Now(),
 			ContentType:  "application/json",
 			Body:         body,
@@ -54,11 +64,42 @@ func Publish(ctx context.Context, taskType int, message *TaskMessage) error {
 	}
 
 	// 等待确认
-	if !confirmation.Wait() {
-		return errors.New("RabbitMQ publish not confirmed")
+	if err = waitConfirm(ctx, confirmation); err != nil {
+		return err
 	}
 
 	log.Printf("[RabbitMQ] Message published successfully, task_id: %s, routing_key: %s\n", message.TaskID, routingKey)
 
 	return nil
 }
+
+// waitConfirm 等待 broker 确认消息, 超时或被拒绝时返回错误, 避免连接异常时永久阻塞
+func waitConfirm(ctx context.Context, confirmation *amqp.DeferredConfirmation) error {
+	ctx, cancel := context.WithTimeout(ctx, publishConfirmTimeout)
+	defer cancel()
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("wait for RabbitMQ publish confirm: %w", err)
+	}
+	if !acked {
+		return errors.New("RabbitMQ publish not confirmed")
+	}
+	return nil
+}
+
+// routingKeyForTaskType 任务类型对应的路由键
+func routingKeyForTaskType(taskType int) (string, error) {
+	switch taskType {
+	case 1:
+		return RoutingKeyText2Img, nil
+	case 2:
+		return RoutingKeyImg2Img, nil
+	case 3:
+		return RoutingKeyInpaint, nil
+	case 4:
+		return RoutingKeyOutpaint, nil
+	default:
+		return "", errors.New("invalid task type")
+	}
+}
@@ -2,8 +2,11 @@
 package queue
 
 import (
+	"errors"
+	"fmt"
 	"log"
 
+	"github.com/Zhiruosama/ai_nexus/configs"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -17,6 +20,12 @@ const (
 	QueueText2Img = "queue.text2img"
 	// QueueImg2Img 名称
 	QueueImg2Img = "queue.img2img"
+	// QueueInpaint 名称
+	QueueInpaint = "queue.inpaint"
+	// QueueOutpaint 名称
+	QueueOutpaint = "queue.outpaint"
+	// QueuePostProcess 名称
+	QueuePostProcess = "queue.postprocess"
 	// QueueDeadLetter 名称
 	QueueDeadLetter = "queue.dead_letter"
 
@@ -24,8 +33,17 @@ const (
 	RoutingKeyText2Img = "generation.text2img"
 	// RoutingKeyImg2Img 名称
 	RoutingKeyImg2Img = "generation.img2img"
+	// RoutingKeyInpaint 名称
+	RoutingKeyInpaint = "generation.inpaint"
+	// RoutingKeyOutpaint 名称
+	RoutingKeyOutpaint = "generation.outpaint"
+	// RoutingKeyPostProcess 名称
+	RoutingKeyPostProcess = "generation.postprocess"
 	// RoutingKeyDeadLetter 名称
 	RoutingKeyDeadLetter = "dead_letter"
+
+	// MaxPriority 生图队列支持的最大优先级, 消息优先级取值 0 ~ MaxPriority
+	MaxPriority = 9
 )
 
 // InitQueues 初始化 RabbitMQ 队列、Exchange 和绑定关系
@@ -55,6 +73,14 @@ func InitQueues() error {
 		"x-max-length":              int32(1000),          // 最大队列长度
 		"x-dead-letter-exchange":    ExchangeDLX,          // 死信交换机
 		"x-dead-letter-routing-key": RoutingKeyDeadLetter, // 死信路由键
+		"x-max-priority":            int32(MaxPriority),   // 优先级队列, 旧版本创建的队列由 migrateQueue 处理
+	}
+
+	// 旧版本创建的文生图与图生图队列没有 x-max-priority, 直接重新声明会因参数不一致失败
+	for _, name := range []string{QueueText2Img, QueueImg2Img, QueueInpaint, QueueOutpaint, QueuePostProcess} {
+		if err = migrateQueue(name, queueArgs); err != nil {
+			return err
+		}
 	}
 
 	// 文生图队列
@@ -69,6 +95,24 @@ func InitQueues() error {
 		return err
 	}
 
+	// 局部重绘队列
+	_, err = ch.QueueDeclare(QueueInpaint, true, false, false, false, queueArgs)
+	if err != nil {
+		return err
+	}
+
+	// 扩图队列
+	_, err = ch.QueueDeclare(QueueOutpaint, true, false, false, false, queueArgs)
+	if err != nil {
+		return err
+	}
+
+	// 后处理队列, 生成完成后的放大、裁剪、水印
+	_, err = ch.QueueDeclare(QueuePostProcess, true, false, false, false, queueArgs)
+	if err != nil {
+		return err
+	}
+
 	// 死信队列, TTL: 7 天
 	_, err = ch.QueueDeclare(QueueDeadLetter, true, false, false, false,
 		amqp.Table{
@@ -92,12 +136,67 @@ func InitQueues() error {
 		return err
 	}
 
+	// 绑定局部重绘队列
+	err = ch.QueueBind(QueueInpaint, RoutingKeyInpaint, ExchangeGenImg, false, nil)
+	if err != nil {
+		return err
+	}
+
+	// 绑定扩图队列
+	err = ch.QueueBind(QueueOutpaint, RoutingKeyOutpaint, ExchangeGenImg, false, nil)
+	if err != nil {
+		return err
+	}
+
+	// 绑定后处理队列
+	err = ch.QueueBind(QueuePostProcess, RoutingKeyPostProcess, ExchangeGenImg, false, nil)
+	if err != nil {
+		return err
+	}
+
 	// 绑定死信队列
 	err = ch.QueueBind(QueueDeadLetter, RoutingKeyDeadLetter, ExchangeDLX, false, nil)
 	if err != nil {
 		return err
 	}
 
+	// 延迟重试队列
+	if err = declareRetryQueues(ch); err != nil {
+		return err
+	}
+
 	log.Println("[RabbitMQ] All queues initialized successfully")
 	return nil
 }
+
+// migrateQueue 试探按新参数声明队列, 与已存在的队列参数不一致时, 开启 rabbitmq.recreatequeues 后删除该队列, 由调用方重新声明
+// 只删除空队列, 队列中还有任务时返回错误, 需要先停止提交并等待消费完毕; 声明失败会关闭通道, 因此使用独立通道试探
+func migrateQueue(name string, args amqp.Table) error {
+	ch, err := GlobalMQ.NewChannel()
+	if err != nil {
+		return err
+	}
+	_, err = ch.QueueDeclare(name, true, false, false, false, args)
+	_ = ch.Close()
+
+	var amqpErr *amqp.Error
+	if err == nil || !errors.As(err, &amqpErr) || amqpErr.Code != amqp.PreconditionFailed {
+		return err
+	}
+
+	if !configs.GlobalConfig.RabbitMQ.RecreateQueues {
+		return fmt.Errorf("queue %s already exists with different arguments, set rabbitmq.recreatequeues to true to recreate it once it is empty: %w", name, err)
+	}
+
+	ch, err = GlobalMQ.NewChannel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if _, err = ch.QueueDelete(name, false, true, false); err != nil {
+		return fmt.Errorf("delete queue %s failed, stop submitting tasks and wait for it to drain: %w", name, err)
+	}
+	log.Printf("[RabbitMQ] Queue %s deleted, redeclare it with new arguments\n", name)
+	return nil
+}
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// ExchangeRetry 延迟重试 Headers Exchange, 按 x-retry-delay 头路由到对应档位的延迟队列
+	ExchangeRetry = "exchange.generation.retry"
+
+	// headerRetryDelay 延迟档位头
+	headerRetryDelay = "x-retry-delay"
+
+	defaultRetryBaseDelay = 5 * time.Second
+	defaultRetryMaxDelay  = 5 * time.Minute
+)
+
+// retryTiers 延迟队列档位, 每档队列的 TTL 即该档上限
+// 消息按实际延迟设置 per-message TTL, 同一档内的队头阻塞最多一个档位的时长
+var retryTiers = []time.Duration{
+	5 * time.Second,
+	10 * time.Second,
+	20 * time.Second,
+	40 * time.Second,
+	80 * time.Second,
+	160 * time.Second,
+	320 * time.Second,
+}
+
+// retryQueueName 延迟档位对应的队列名
+func retryQueueName(tier time.Duration) string {
+	return fmt.Sprintf("queue.retry.%ds", int(tier.Seconds()))
+}
+
+// retryTier 选出不小于 delay 的最小档位
+func retryTier(delay time.Duration) time.Duration {
+	for _, tier := range retryTiers {
+		if delay <= tier {
+			return tier
+		}
+	}
+	return retryTiers[len(retryTiers)-1]
+}
+
+// RetryDelay 计算第 retryCount 次重试前的等待时间
+// 指数退避 base * 2^retryCount, 不超过上限, 再取 [d/2, d] 之间的随机值避免大量任务同时重试
+func RetryDelay(retryCount int8) time.Duration {
+	base := time.Duration(configs.GlobalConfig.ImageGen.RetryBaseDelay) * time.Second
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	maxDelay := time.Duration(configs.GlobalConfig.ImageGen.RetryMaxDelay) * time.Second
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	maxDelay = min(maxDelay, retryTiers[len(retryTiers)-1])
+
+	delay := base
+	for i := int8(0); i < retryCount && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// PublishRetry 延迟 delay 后重新投递任务消息
+func PublishRetry(ctx context.Context, taskType int, message *TaskMessage, delay time.Duration) error {
+	routingKey, err := routingKeyForTaskType(taskType)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return publishDelayed(ctx, routingKey, message.TaskID, message.Priority, body, delay)
+}
+
+// publishDelayed 将消息投递到延迟队列, 过期后按原路由键死信回生图 Exchange
+func publishDelayed(ctx context.Context, routingKey, messageID string, priority uint8, body []byte, delay time.Duration) error {
+	ch, err := GlobalMQ.GetChannel()
+	if err != nil {
+		return err
+	}
+
+	if err = ch.Confirm(false); err != nil {
+		return err
+	}
+
+	tier := retryTier(delay)
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, ExchangeRetry, routingKey, false, false,
+		amqp.Publishing{
+			Headers:      amqp.Table{headerRetryDelay: retryQueueName(tier)},
+			DeliveryMode: amqp.Persistent,
+			MessageId:    messageID,
+			Priority:     priority,
+			Expiration:   strconv.FormatInt(min(delay, tier).Milliseconds(), 10),
+			Timestamp:    time.Now(),
+			ContentType:  "application/json",
+			Body:         body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err = waitConfirm(ctx, confirmation); err != nil {
+		return err
+	}
+
+	log.Printf("[RabbitMQ] Message scheduled for retry in %s, task_id: %s, routing_key: %s\n", delay, messageID, routingKey)
+	return nil
+}
+
+// declareRetryQueues 声明延迟重试 Exchange 与各档位队列
+func declareRetryQueues(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(ExchangeRetry, "headers", true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, tier := range retryTiers {
+		name := retryQueueName(tier)
+
+		// 不设置 x-dead-letter-routing-key, 过期后保留原路由键回到对应的生图队列
+		_, err = ch.QueueDeclare(name, true, false, false, false, amqp.Table{
+			"x-message-ttl":          int32(tier.Milliseconds()),
+			"x-dead-letter-exchange": ExchangeGenImg,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = ch.QueueBind(name, "", ExchangeRetry, false, amqp.Table{
+			"x-match":        "all",
+			headerRetryDelay: name,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
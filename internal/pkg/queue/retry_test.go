@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+)
+
+func TestRetryTier(t *testing.T) {
+	tests := []struct {
+		delay time.Duration
+		want  time.Duration
+	}{
+		{0, 5 * time.Second},
+		{time.Second, 5 * time.Second},
+		{5 * time.Second, 5 * time.Second},
+		{5*time.Second + time.Millisecond, 10 * time.Second},
+		{30 * time.Second, 40 * time.Second},
+		{160 * time.Second, 160 * time.Second},
+		{200 * time.Second, 320 * time.Second},
+		{320 * time.Second, 320 * time.Second},
+		{time.Hour, 320 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := retryTier(tt.delay); got != tt.want {
+			t.Errorf("retryTier(%s) = %s, want %s", tt.delay, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		baseDelay  int
+		maxDelay   int
+		retryCount int8
+		wantMax    time.Duration
+	}{
+		{"default base", 0, 0, 0, 5 * time.Second},
+		{"default doubles", 0, 0, 2, 20 * time.Second},
+		{"default max delay", 0, 0, 10, 5 * time.Minute},
+		{"configured base", 3, 60, 1, 6 * time.Second},
+		{"configured max", 3, 60, 6, 60 * time.Second},
+		{"max above last tier", 10, 3600, 20, 320 * time.Second},
+		{"large retry count", 5, 300, 127, 300 * time.Second},
+	}
+
+	cfg := &configs.GlobalConfig.ImageGen
+	base, maxDelay := cfg.RetryBaseDelay, cfg.RetryMaxDelay
+	t.Cleanup(func() {
+		cfg.RetryBaseDelay, cfg.RetryMaxDelay = base, maxDelay
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.RetryBaseDelay, cfg.RetryMaxDelay = tt.baseDelay, tt.maxDelay
+
+			// 抖动取 [d/2, d], 多次采样确认不越界
+			for range 200 {
+				got := RetryDelay(tt.retryCount)
+				if got < tt.wantMax/2 || got > tt.wantMax {
+					t.Fatalf("RetryDelay(%d) = %s, want within [%s, %s]", tt.retryCount, got, tt.wantMax/2, tt.wantMax)
+				}
+				if tier := retryTier(got); got > tier {
+					t.Fatalf("RetryDelay(%d) = %s exceeds tier %s", tt.retryCount, got, tier)
+				}
+			}
+		})
+	}
+}
@@ -12,6 +12,9 @@ import (
 	"github.com/Zhiruosama/ai_nexus/configs"
 )
 
+// ChannelTaskCancel 生图任务取消事件的发布订阅频道, 消息内容为任务 ID
+const ChannelTaskCancel = "image_generation:task:cancel"
+
 var (
 	// Rdb Redis客户端实例
 	Rdb *redis.Client
@@ -19,7 +22,8 @@ var (
 	Ctx = context.Background()
 )
 
-func init() {
+// Init 连接 Redis, 连接失败时直接退出, 由 main 在启动时调用
+func Init() {
 	cfg := configs.GlobalConfig.Redis
 
 	Rdb = redis.NewClient(&redis.Options{
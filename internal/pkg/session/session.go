@@ -0,0 +1,324 @@
+// Package session 登录会话存储, 会话与刷新令牌摘要保存在 Redis, 访问令牌由调用方按 AccessTTL 签发
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	sessionKeyPrefix     = "session:"
+	userSessionsPrefix   = "sessions:"
+	defaultAccessTTL     = 15 * time.Minute
+	defaultRefreshTTL    = 30 * 24 * time.Hour
+	defaultMaxSessions   = 10
+	maxDeviceLength      = 128
+	lastSeenUpdatePeriod = time.Minute
+)
+
+// ErrRevoked 会话已注销、过期或被挤下线
+var ErrRevoked = errors.New("session has been revoked")
+
+// ErrInvalidRefreshToken 刷新令牌无效或已被使用
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// rotateRefreshScript 校验并轮换刷新令牌
+// 返回 1 轮换成功, 0 会话不存在, -1 出示的是上一个刷新令牌(疑似被盗用), -2 令牌不匹配
+var rotateRefreshScript = redis.NewScript(`
+local current = redis.call("HGET", KEYS[1], "refresh_hash")
+if not current then
+	return 0
+end
+if current ~= ARGV[1] then
+	if redis.call("HGET", KEYS[1], "prev_refresh_hash") == ARGV[1] then
+		return -1
+	end
+	return -2
+end
+redis.call("HSET", KEYS[1], "refresh_hash", ARGV[2], "prev_refresh_hash", ARGV[1], "last_seen", ARGV[4], "ip", ARGV[5])
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return 1
+`)
+
+// addSessionScript 把会话写入用户的会话索引, 同时挤掉超出上限的最早会话, 返回被挤掉的会话数
+// 写入与裁剪在同一脚本中执行, 并发登录时不会同时判断为未超限而多保留会话
+// ARGV: 会话 ID, 登录时间(纳秒), 索引有效期(秒), 会话上限, 会话 key 前缀
+var addSessionScript = redis.NewScript(`
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+local excess = redis.call("ZCARD", KEYS[1]) - tonumber(ARGV[4])
+if excess <= 0 then
+	return 0
+end
+local oldest = redis.call("ZRANGE", KEYS[1], 0, excess - 1)
+for _, id in ipairs(oldest) do
+	redis.call("DEL", ARGV[5] .. id)
+end
+redis.call("ZREM", KEYS[1], unpack(oldest))
+return #oldest
+`)
+
+// Grant 登录或刷新后得到的会话, 刷新令牌格式为 <会话ID>.<随机串>
+type Grant struct {
+	UserID       string
+	SessionID    string
+	RefreshToken string
+}
+
+// Session 一个设备上的登录会话
+type Session struct {
+	ID        string
+	Device    string
+	IP        string
+	CreatedAt time.Time
+	LastSeen  time.Time
+}
+
+// AccessTTL 访问令牌有效期
+func AccessTTL() time.Duration {
+	return config().AccessTTL
+}
+
+// Issue 为一次登录创建会话, 超过 session.maxsessions 时挤掉最早登录的会话
+func Issue(userID, device, ip string) (*Grant, error) {
+	cfg := config()
+	sessionID := uuid.New().String()
+	now := time.Now()
+
+	secret, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	device = strings.TrimSpace(device)
+	if len([]rune(device)) > maxDeviceLength {
+		device = string([]rune(device)[:maxDeviceLength])
+	}
+
+	key := sessionKeyPrefix + sessionID
+
+	pipe := rdb.Rdb.TxPipeline()
+	pipe.HSet(rdb.Ctx, key, map[string]any{
+		"user_id":      userID,
+		"device":       device,
+		"ip":           ip,
+		"created_at":   now.Unix(),
+		"last_seen":    now.Unix(),
+		"refresh_hash": hashSecret(secret),
+	})
+	pipe.Expire(rdb.Ctx, key, cfg.RefreshTTL)
+	if _, err = pipe.Exec(rdb.Ctx); err != nil {
+		return nil, err
+	}
+
+	err = addSessionScript.Run(rdb.Ctx, rdb.Rdb, []string{userSessionsPrefix + userID},
+		sessionID, now.UnixNano(), int(cfg.RefreshTTL.Seconds()), cfg.MaxSessions, sessionKeyPrefix).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Grant{UserID: userID, SessionID: sessionID, RefreshToken: sessionID + "." + secret}, nil
+}
+
+// Refresh 校验刷新令牌并轮换, 旧令牌被再次使用时视为泄露并注销整个会话
+func Refresh(refreshToken, ip string) (*Grant, error) {
+	cfg := config()
+
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	key := sessionKeyPrefix + sessionID
+	userID, err := rdb.Rdb.HGet(rdb.Ctx, key, "user_id").Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	newSecret, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := rotateRefreshScript.Run(rdb.Ctx, rdb.Rdb, []string{key},
+		hashSecret(secret), hashSecret(newSecret), int(cfg.RefreshTTL.Seconds()), time.Now().Unix(), ip).Int()
+	if err != nil {
+		return nil, err
+	}
+
+	switch result {
+	case 1:
+	case -1:
+		if _, err = Revoke(userID, sessionID); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: token reuse detected, session revoked", ErrInvalidRefreshToken)
+	default:
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err = rdb.Rdb.Expire(rdb.Ctx, userSessionsPrefix+userID, cfg.RefreshTTL).Err(); err != nil {
+		return nil, err
+	}
+	return &Grant{UserID: userID, SessionID: sessionID, RefreshToken: sessionID + "." + newSecret}, nil
+}
+
+// Validate 校验会话仍然有效且属于 userID, 并按分钟粒度更新最近活跃时间与 IP
+func Validate(sessionID, userID, ip string) error {
+	if sessionID == "" {
+		return ErrRevoked
+	}
+
+	key := sessionKeyPrefix + sessionID
+	values, err := rdb.Rdb.HMGet(rdb.Ctx, key, "user_id", "last_seen").Result()
+	if err != nil {
+		return err
+	}
+
+	owner, _ := values[0].(string)
+	if owner == "" || owner != userID {
+		return ErrRevoked
+	}
+
+	lastSeenStr, _ := values[1].(string)
+	lastSeen, _ := strconv.ParseInt(lastSeenStr, 10, 64)
+	if now := time.Now(); now.Sub(time.Unix(lastSeen, 0)) >= lastSeenUpdatePeriod {
+		if err = rdb.Rdb.HSet(rdb.Ctx, key, "last_seen", now.Unix(), "ip", ip).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List 按登录时间倒序列出用户的全部有效会话, 顺带清理已过期的会话索引
+func List(userID string) ([]*Session, error) {
+	listKey := userSessionsPrefix + userID
+	sessionIDs, err := rdb.Rdb.ZRevRange(rdb.Ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*Session, 0, len(sessionIDs))
+	var expired []any
+	for _, sessionID := range sessionIDs {
+		values, err := rdb.Rdb.HGetAll(rdb.Ctx, sessionKeyPrefix+sessionID).Result()
+		if err != nil {
+			return nil, err
+		}
+		if values["user_id"] != userID {
+			expired = append(expired, sessionID)
+			continue
+		}
+
+		createdAt, _ := strconv.ParseInt(values["created_at"], 10, 64)
+		lastSeen, _ := strconv.ParseInt(values["last_seen"], 10, 64)
+		sessions = append(sessions, &Session{
+			ID:        sessionID,
+			Device:    values["device"],
+			IP:        values["ip"],
+			CreatedAt: time.Unix(createdAt, 0),
+			LastSeen:  time.Unix(lastSeen, 0),
+		})
+	}
+
+	if len(expired) > 0 {
+		if err = rdb.Rdb.ZRem(rdb.Ctx, listKey, expired...).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// Revoke 注销用户的指定会话, 返回会话是否存在
+func Revoke(userID, sessionID string) (bool, error) {
+	key := sessionKeyPrefix + sessionID
+	owner, err := rdb.Rdb.HGet(rdb.Ctx, key, "user_id").Result()
+	if errors.Is(err, redis.Nil) || (err == nil && owner != userID) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	pipe := rdb.Rdb.TxPipeline()
+	pipe.Del(rdb.Ctx, key)
+	pipe.ZRem(rdb.Ctx, userSessionsPrefix+userID, sessionID)
+	if _, err = pipe.Exec(rdb.Ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RevokeAll 注销用户的全部会话, exceptSessionID 不为空时保留该会话, 返回注销的会话数
+func RevokeAll(userID, exceptSessionID string) (int, error) {
+	listKey := userSessionsPrefix + userID
+	sessionIDs, err := rdb.Rdb.ZRange(rdb.Ctx, listKey, 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	sessionIDs = slices.DeleteFunc(sessionIDs, func(id string) bool { return id == exceptSessionID })
+	if len(sessionIDs) == 0 {
+		return 0, nil
+	}
+
+	keys := make([]string, 0, len(sessionIDs))
+	members := make([]any, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, sessionKeyPrefix+sessionID)
+		members = append(members, sessionID)
+	}
+
+	pipe := rdb.Rdb.TxPipeline()
+	pipe.Del(rdb.Ctx, keys...)
+	pipe.ZRem(rdb.Ctx, listKey, members...)
+	if _, err = pipe.Exec(rdb.Ctx); err != nil {
+		return 0, err
+	}
+	return len(sessionIDs), nil
+}
+
+// config 读取会话配置, 未配置的项使用默认值
+func config() configs.SessionConfig {
+	cfg := configs.GlobalConfig.Session
+	if cfg.AccessTTL <= 0 {
+		cfg.AccessTTL = defaultAccessTTL
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = defaultRefreshTTL
+	}
+	if cfg.MaxSessions <= 0 {
+		cfg.MaxSessions = defaultMaxSessions
+	}
+	return cfg
+}
+
+func randomSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashSecret Redis 中只保存刷新令牌的摘要
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// localRoot 本地存储根目录, 只有 avatar 子目录由 /static 路由公开, 图片经文件路由访问
+	localRoot = "static"
+	// localURLPrefix 本地对象写入数据库的地址前缀
+	localURLPrefix = "/static/"
+)
+
+// LocalStorage 本地文件系统存储
+type LocalStorage struct {
+	root      string
+	urlPrefix string
+}
+
+// NewLocalStorage 创建以 root 为根目录的本地存储
+func NewLocalStorage(root, urlPrefix string) *LocalStorage {
+	return &LocalStorage{root: root, urlPrefix: urlPrefix}
+}
+
+// Put 先写临时文件再重命名, 避免读到写了一半的文件
+func (s *LocalStorage) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("create directory error: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("write file error: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("close temp file error: %w", err)
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("chmod file error: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("rename file error: %w", err)
+	}
+	return nil
+}
+
+// Get 打开本地文件
+func (s *LocalStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	dst, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(dst)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open file error: %w", err)
+	}
+	return file, nil
+}
+
+// Delete 删除本地文件
+func (s *LocalStorage) Delete(_ context.Context, key string) error {
+	dst, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove file error: %w", err)
+	}
+	return nil
+}
+
+// PresignedURL 本地文件不对外公开, 返回经文件路由访问的 HMAC 签名地址
+func (s *LocalStorage) PresignedURL(_ context.Context, key string, expires time.Duration) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return SignedFileURL(cleaned, expires), nil
+}
+
+// URL 返回 /static 开头的相对地址, 作为对象在数据库中的标识
+func (s *LocalStorage) URL(key string) string {
+	return s.urlPrefix + key
+}
+
+// Stat 读取本地文件信息
+func (s *LocalStorage) Stat(_ context.Context, key string) (*ObjectInfo, error) {
+	dst, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(dst)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("stat file error: %w", err)
+	}
+	return &ObjectInfo{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// List 递归遍历 prefix 对应的目录, 目录不存在时视为空
+func (s *LocalStorage) List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	dir, err := s.path(prefix)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// 遍历期间被删除的文件直接跳过
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		return fn(ObjectInfo{Key: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+	})
+	return err
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
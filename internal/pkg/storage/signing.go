@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+)
+
+const (
+	// FileRoutePrefix 私有图片的访问路由, 由处理器校验签名或归属后从存储读取
+	FileRoutePrefix = "/image-generation/file/"
+	// defaultSignedURLTTL 未配置 signedurlttl 时签名地址的有效期
+	defaultSignedURLTTL = time.Hour
+)
+
+// signingKeyLabel 由共享密钥派生签名密钥时使用的标签, 避免与共享密钥的其他用途混用
+const signingKeyLabel = "ainexus storage signing key"
+
+var signingKey []byte
+
+func init() {
+	key, err := resolveSigningKey(configs.GlobalConfig.Storage.SigningKey, configs.GlobalConfig.Chat.EncryptionKey)
+	if err != nil {
+		panic(fmt.Sprintf("[ERROR] Storage init error, err is: %s", err.Error()))
+	}
+	signingKey = key
+}
+
+// resolveSigningKey 优先使用 storage.signingkey, 未配置时由各实例共享的 chat.encryptionkey 派生,
+// 保证重启后已签发的地址仍然有效且多实例之间互认; 两者都未配置时拒绝启动
+func resolveSigningKey(signingKey, sharedSecret string) ([]byte, error) {
+	if signingKey != "" {
+		return []byte(signingKey), nil
+	}
+	if sharedSecret == "" {
+		return nil, errors.New("storage.signingkey and chat.encryptionkey are both empty, cannot sign image urls")
+	}
+
+	mac := hmac.New(sha256.New, []byte(sharedSecret))
+	mac.Write([]byte(signingKeyLabel))
+	log.Println("[Storage] signingkey is empty, derived from chat.encryptionkey")
+	return mac.Sum(nil), nil
+}
+
+// SignedURLTTL 接口返回签名地址的有效期
+func SignedURLTTL() time.Duration {
+	if ttl := configs.GlobalConfig.Storage.SignedURLTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultSignedURLTTL
+}
+
+// FileURL 不带签名的访问地址, 仅对公开图片或携带登录态的归属用户有效
+func FileURL(key string) string {
+	return PublicURL(FileRoutePrefix + key)
+}
+
+// SignedFileURL 带 HMAC 签名的限时访问地址
+func SignedFileURL(key string, ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", signature(key, expires))
+	return FileURL(key) + "?" + query.Encode()
+}
+
+// VerifySignature 校验签名地址中的 expires 与 signature
+func VerifySignature(key, expires, sig string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	return hmac.Equal([]byte(signature(key, expires)), []byte(sig))
+}
+
+func signature(key, expires string) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedURL 把数据库中保存的地址转换为限时访问地址, 无法解析出 key 的地址原样返回
+func SignedURL(ctx context.Context, storedURL string, ttl time.Duration) string {
+	key := KeyFromURL(storedURL)
+	if key == "" {
+		return storedURL
+	}
+
+	signed, err := Default.PresignedURL(ctx, key, ttl)
+	if err != nil {
+		log.Printf("[Storage] Presign %s error: %v\n", key, err)
+		return ""
+	}
+	return signed
+}
+
+// PublicFileURL 把数据库中保存的地址转换为公开图片的固定访问地址
+func PublicFileURL(storedURL string) string {
+	key := KeyFromURL(storedURL)
+	if key == "" {
+		return storedURL
+	}
+	return FileURL(key)
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseSignedURL 取出签名地址中的 key、expires 与 signature
+func parseSignedURL(t *testing.T, signed string) (key, expires, sig string) {
+	t.Helper()
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse signed url %q: %v", signed, err)
+	}
+	key, ok := strings.CutPrefix(u.Path, FileRoutePrefix)
+	if !ok {
+		t.Fatalf("signed url %q does not start with %s", signed, FileRoutePrefix)
+	}
+	return key, u.Query().Get("expires"), u.Query().Get("signature")
+}
+
+func TestSignedFileURL(t *testing.T) {
+	const objectKey = "image-generation/user-1/task-1/0.png"
+
+	key, expires, sig := parseSignedURL(t, SignedFileURL(objectKey, time.Hour))
+	if key != objectKey {
+		t.Fatalf("key = %q, want %q", key, objectKey)
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		t.Fatalf("expires %q is not a unix timestamp", expires)
+	}
+	if d := time.Until(time.Unix(expiresAt, 0)); d < 59*time.Minute || d > time.Hour+time.Second {
+		t.Fatalf("expires in %s, want about 1h", d)
+	}
+
+	_, expiredAt, expiredSig := parseSignedURL(t, SignedFileURL(objectKey, -time.Second))
+	extended := strconv.FormatInt(expiresAt+3600, 10)
+
+	tests := []struct {
+		name    string
+		key     string
+		expires string
+		sig     string
+		want    bool
+	}{
+		{"valid", objectKey, expires, sig, true},
+		{"expired", objectKey, expiredAt, expiredSig, false},
+		{"other key", "image-generation/user-2/task-1/0.png", expires, sig, false},
+		{"extended expires", objectKey, extended, sig, false},
+		{"tampered signature", objectKey, expires, strings.Repeat("0", len(sig)), false},
+		{"truncated signature", objectKey, expires, sig[:len(sig)-1], false},
+		{"empty signature", objectKey, expires, "", false},
+		{"invalid expires", objectKey, "tomorrow", sig, false},
+		{"empty expires", objectKey, "", sig, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifySignature(tt.key, tt.expires, tt.sig); got != tt.want {
+				t.Errorf("VerifySignature(%q, %q, %q) = %v, want %v", tt.key, tt.expires, tt.sig, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureRejectsOtherSigningKey(t *testing.T) {
+	const objectKey = "image-generation/user-1/task-1/0.png"
+
+	_, expires, sig := parseSignedURL(t, SignedFileURL(objectKey, time.Hour))
+
+	original := signingKey
+	t.Cleanup(func() { signingKey = original })
+	signingKey = []byte("another-instance-signing-key")
+
+	if VerifySignature(objectKey, expires, sig) {
+		t.Fatal("signature issued with another signing key was accepted")
+	}
+}
+
+func TestResolveSigningKey(t *testing.T) {
+	configured, err := resolveSigningKey("configured-key", "shared-secret")
+	if err != nil || string(configured) != "configured-key" {
+		t.Fatalf("resolveSigningKey with signingkey = (%q, %v), want the configured key", configured, err)
+	}
+
+	derived, err := resolveSigningKey("", "shared-secret")
+	if err != nil {
+		t.Fatalf("resolveSigningKey from shared secret: %v", err)
+	}
+	again, _ := resolveSigningKey("", "shared-secret")
+	if string(derived) != string(again) {
+		t.Error("keys derived from the same secret differ, instances would reject each other's urls")
+	}
+	if string(derived) == "shared-secret" {
+		t.Error("shared secret used as the signing key without derivation")
+	}
+	other, _ := resolveSigningKey("", "another-secret")
+	if string(derived) == string(other) {
+		t.Error("different secrets derive the same key")
+	}
+
+	if _, err := resolveSigningKey("", ""); err == nil {
+		t.Error("resolveSigningKey without any secret succeeded, want an error")
+	}
+}
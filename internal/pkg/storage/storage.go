@@ -0,0 +1,156 @@
+// Package storage 文件存储抽象, 上传图片、头像与生成结果统一通过 Default 读写
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("object not found")
+
+// Storage 文件存储接口, key 为形如 images/xxx.webp 的相对路径
+type Storage interface {
+	// Put 写入对象, 已存在时覆盖
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象, 不存在时返回 ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete 删除对象, 不存在时忽略
+	Delete(ctx context.Context, key string) error
+	// PresignedURL 生成限时访问地址
+	PresignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+	// URL 返回写入数据库的访问地址, 本地存储为 /static 开头的相对地址
+	URL(key string) string
+	// Stat 查询对象大小与修改时间, 不存在时返回 ErrNotFound
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List 遍历 prefix 下的全部对象, fn 返回错误时停止遍历并返回该错误
+	List(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+}
+
+// ObjectInfo 对象元信息
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Default 全局存储实例
+var Default Storage
+
+func init() {
+	cfg := configs.GlobalConfig.Storage
+	if cfg.Driver == "" {
+		cfg.Driver = "local"
+	}
+
+	switch cfg.Driver {
+	case "local":
+		Default = NewLocalStorage(localRoot, localURLPrefix)
+	case "s3":
+		s3, err := NewS3Storage(cfg.S3)
+		if err != nil {
+			panic(fmt.Sprintf("[ERROR] Storage init error, err is: %s", err.Error()))
+		}
+		Default = s3
+	default:
+		panic(fmt.Sprintf("[ERROR] Storage init error, unknown driver: %s", cfg.Driver))
+	}
+	log.Printf("[Storage] Storage driver: %s\n", cfg.Driver)
+}
+
+// PutFile 把本地文件写入存储, Content-Type 按扩展名推断
+func PutFile(ctx context.Context, key, filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("open file error: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat file error: %w", err)
+	}
+
+	return Default.Put(ctx, key, file, info.Size(), ContentType(key))
+}
+
+// ReadAll 读取对象的全部内容
+func ReadAll(ctx context.Context, key string) ([]byte, error) {
+	body, err := Default.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+
+	return io.ReadAll(body)
+}
+
+// ContentType 按扩展名推断 Content-Type
+func ContentType(key string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(key)); ct != "" {
+		return ct
+	}
+	if strings.EqualFold(filepath.Ext(key), ".webp") {
+		return "image/webp"
+	}
+	return "application/octet-stream"
+}
+
+// KeyFromURL 从数据库中保存的地址解析出对象 key, 兼容带主机名的本地地址, 无法识别时返回空串
+func KeyFromURL(rawURL string) string {
+	// 预签名地址带有查询参数
+	if i := strings.IndexAny(rawURL, "?#"); i >= 0 {
+		rawURL = rawURL[:i]
+	}
+	if rawURL == "" {
+		return ""
+	}
+
+	base := Default.URL("")
+	if strings.HasPrefix(rawURL, base) {
+		return strings.TrimPrefix(rawURL, base)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if strings.HasPrefix(u.Path, base) {
+		return strings.TrimPrefix(u.Path, base)
+	}
+	return ""
+}
+
+// PublicURL 把相对地址补全为公网地址, 已是绝对地址时原样返回
+func PublicURL(storedURL string) string {
+	if !strings.HasPrefix(storedURL, "/") {
+		return storedURL
+	}
+	return "http://" + configs.GlobalConfig.Server.SerialStringPublic() + storedURL
+}
+
+// cleanKey 规范化 key, 拒绝空值与越出根目录的路径
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." {
+		return "", fmt.Errorf("invalid object key: %q", key)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,138 @@
+package third
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// StatusError 上游返回了非预期的 HTTP 状态码
+type StatusError struct {
+	Op         string
+	StatusCode int
+	Body       string
+}
+
+// Error 实现 error 接口
+func (e *StatusError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%s failed with status %d", e.Op, e.StatusCode)
+	}
+	return fmt.Sprintf("%s failed with status %d: %s", e.Op, e.StatusCode, e.Body)
+}
+
+// permanentError 标记重试也无法成功的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent 将错误标记为不可重试, 如参数错误、凭证缺失
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsRetryable 判断错误是否值得重试
+// 网络错误、超时、408、429 和 5xx 可重试, 其余 4xx 与 Permanent 标记的错误直接失败
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusRequestTimeout,
+			statusErr.StatusCode == http.StatusTooManyRequests,
+			statusErr.StatusCode >= http.StatusInternalServerError:
+			return true
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// ErrUpstreamTimeout 上游任务在轮询期限内未结束
+var ErrUpstreamTimeout = errors.New("timeout")
+
+// 模型健康统计使用的错误分类
+const (
+	ErrorClassTimeout     = "timeout"
+	ErrorClassRateLimited = "rate_limited"
+	ErrorClassAuth        = "auth"
+	ErrorClassBadRequest  = "bad_request"
+	ErrorClassServer      = "server_error"
+	ErrorClassNetwork     = "network"
+	ErrorClassPermanent   = "permanent"
+	ErrorClassUpstream    = "upstream_failed"
+	ErrorClassCancelled   = "cancelled"
+)
+
+// ErrorClass 将上游调用错误归类, 用于统计模型近期的失败原因
+func ErrorClass(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return ErrorClassCancelled
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrUpstreamTimeout) {
+		return ErrorClassTimeout
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusUnauthorized, statusErr.StatusCode == http.StatusForbidden:
+			return ErrorClassAuth
+		case statusErr.StatusCode == http.StatusRequestTimeout, statusErr.StatusCode == http.StatusGatewayTimeout:
+			return ErrorClassTimeout
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return ErrorClassRateLimited
+		case statusErr.StatusCode >= http.StatusInternalServerError:
+			return ErrorClassServer
+		default:
+			return ErrorClassBadRequest
+		}
+	}
+
+	var perm *permanentError
+	if errors.As(err, &perm) {
+		return ErrorClassPermanent
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassNetwork
+	}
+
+	return ErrorClassUpstream
+}
+
+// IsCallerError 凭证、参数等调用方问题, 只展示不计入模型成功率
+func IsCallerError(class string) bool {
+	return class == ErrorClassAuth || class == ErrorClassBadRequest || class == ErrorClassPermanent
+}
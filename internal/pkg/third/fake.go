@@ -0,0 +1,99 @@
+package third
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+
+	rabbitmq "github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+)
+
+// FakeProvider 不访问网络的假实现, 按 prompt 生成纯色图片, 用于本地联调与测试
+type FakeProvider struct{}
+
+// NewFakeProvider 创建假 provider
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+// CreateText2ImgTask 生成纯色图片
+func (p *FakeProvider) CreateText2ImgTask(_ context.Context, _ string, payload rabbitmq.Text2ImgPayload) (string, error) {
+	return p.generate(payload.Prompt, payload.Width, payload.Height, payload.NumImages)
+}
+
+// CreateImg2ImgTask 生成纯色图片, 忽略输入图片
+func (p *FakeProvider) CreateImg2ImgTask(_ context.Context, _ string, payload rabbitmq.Img2ImgPayload) (string, error) {
+	return p.generate(payload.Prompt, payload.Width, payload.Height, payload.NumImages)
+}
+
+// CreateInpaintTask 生成纯色图片, 忽略输入图片与蒙版
+func (p *FakeProvider) CreateInpaintTask(_ context.Context, _ string, payload rabbitmq.InpaintPayload) (string, error) {
+	return p.generate(payload.Prompt, payload.Width, payload.Height, payload.NumImages)
+}
+
+// GetTaskStatus 读取暂存的生成结果
+func (p *FakeProvider) GetTaskStatus(_ context.Context, taskID string) (*TaskResult, error) {
+	return loadSyncResult(taskID)
+}
+
+// CancelTask 将未读取的结果标记为失败
+func (p *FakeProvider) CancelTask(_ context.Context, taskID string) error {
+	val, ok := syncResults.Load(taskID)
+	if !ok {
+		return fmt.Errorf("task %s not found", taskID)
+	}
+
+	result := val.(*TaskResult)
+	syncResults.Store(taskID, &TaskResult{
+		TaskID:     result.TaskID,
+		TaskStatus: TaskStatusFailed,
+		Message:    "task cancelled",
+	})
+	return nil
+}
+
+func (p *FakeProvider) generate(prompt string, width, height, n int) (string, error) {
+	if width <= 0 || width > 2048 {
+		width = 64
+	}
+	if height <= 0 || height > 2048 {
+		height = 64
+	}
+	if n <= 0 {
+		n = 1
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(prompt))
+	sum := h.Sum32()
+
+	result := &TaskResult{TaskStatus: TaskStatusSucceed}
+	for i := 0; i < n; i++ {
+		c := color.RGBA{R: uint8(sum >> 16), G: uint8(sum >> 8), B: uint8(sum) + uint8(i*32), A: 255}
+		img := image.NewUniform(c)
+
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, &boundedImage{img, image.Rect(0, 0, width, height)}); err != nil {
+			return "", fmt.Errorf("encode fake image: %w", err)
+		}
+		result.OutputImages = append(result.OutputImages, "data:image/png;base64,"+base64.StdEncoding.EncodeToString(buf.Bytes()))
+	}
+
+	return storeSyncResult(result), nil
+}
+
+// boundedImage 给无限大小的 image.Uniform 限定边界
+type boundedImage struct {
+	*image.Uniform
+	bounds image.Rectangle
+}
+
+// Bounds 返回限定后的边界
+func (b *boundedImage) Bounds() image.Rectangle {
+	return b.bounds
+}
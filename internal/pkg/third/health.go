@@ -0,0 +1,55 @@
+package third
+
+import (
+	"slices"
+
+	image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
+)
+
+// SummarizeHealth 汇总统计窗口内的调用记录, 调用方错误只计入分类不计入成功率
+func SummarizeHealth(events []*image_generation_do.TableModelHealthEventDO) *image_generation_do.ModelHealthStatsDO {
+	stats := &image_generation_do.ModelHealthStatsDO{
+		SuccessRate:  100,
+		ErrorClasses: make(map[string]int),
+	}
+
+	durations := make([]int64, 0, len(events))
+	for _, event := range events {
+		if event.Success {
+			stats.Samples++
+			stats.Successes++
+			// 部分上游不返回耗时, 记录为 0 的样本不参与分位数计算
+			if event.GenerationTimeMs > 0 {
+				durations = append(durations, event.GenerationTimeMs)
+			}
+			continue
+		}
+
+		stats.ErrorClasses[event.ErrorClass]++
+		if IsCallerError(event.ErrorClass) {
+			stats.CallerErrors++
+			continue
+		}
+		stats.Samples++
+		stats.Failures++
+	}
+
+	if stats.Samples > 0 {
+		stats.SuccessRate = float64(stats.Successes) * 100 / float64(stats.Samples)
+	}
+
+	slices.Sort(durations)
+	stats.P50Ms = percentile(durations, 50)
+	stats.P95Ms = percentile(durations, 95)
+	return stats
+}
+
+// percentile 最近秩法计算已排序样本的分位数, 无样本时返回 0
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
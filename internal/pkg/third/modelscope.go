@@ -1,8 +1,9 @@
-// Package third 提供 ModelScope 第三方 API 调用
+// Package third 提供第三方生图 API 调用, 包含 ModelScope / OpenAI images / SD WebUI 等实现
 package third
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -34,6 +35,7 @@ type ModelScopeCreateText2ImgRequest struct {
 	NumInferenceSteps int     `json:"num_inference_steps"`
 	GuidanceScale     float64 `json:"guidance_scale"`
 	Seed              int64   `json:"seed"`
+	N                 int     `json:"n,omitempty"`
 }
 
 // ModelScopeCreateImg2ImgRequest ModelScope 创建任务请求
@@ -48,6 +50,7 @@ type ModelScopeCreateImg2ImgRequest struct {
 	NumInferenceSteps int     `json:"num_inference_steps"`
 	GuidanceScale     float64 `json:"guidance_scale"`
 	Seed              int64   `json:"seed"`
+	N                 int     `json:"n,omitempty"`
 }
 
 // ModelScopeCreateResponse ModelScope 创建任务响应
@@ -86,7 +89,7 @@ func NewModelScopeClient(baseURL, apiKey string) *ModelScopeClient {
 }
 
 // CreateText2ImgTask 创建图像生成任务
-func (c *ModelScopeClient) CreateText2ImgTask(thirdPartyModelID string, payload rabbitmq.Text2ImgPayload) (string, error) {
+func (c *ModelScopeClient) CreateText2ImgTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.Text2ImgPayload) (string, error) {
 	reqPayload := ModelScopeCreateText2ImgRequest{
 		Model:             thirdPartyModelID,
 		Prompt:            payload.Prompt,
@@ -96,6 +99,7 @@ func (c *ModelScopeClient) CreateText2ImgTask(thirdPartyModelID string, payload
 		NumInferenceSteps: payload.NumInferenceSteps,
 		GuidanceScale:     payload.GuidanceScale,
 		Seed:              payload.Seed,
+		N:                 payload.NumImages,
 	}
 
 	reqBody, err := json.Marshal(reqPayload)
@@ -103,7 +107,7 @@ func (c *ModelScopeClient) CreateText2ImgTask(thirdPartyModelID string, payload
 		return "", fmt.Errorf("marshal request payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.baseURL+"v1/images/generations", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"v1/images/generations", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return "", fmt.Errorf("create request: %w", err)
 	}
@@ -129,7 +133,7 @@ func (c *ModelScopeClient) CreateText2ImgTask(thirdPartyModelID string, payload
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("task submit failed with status %d: %s", resp.StatusCode, string(body))
+		return "", &StatusError{Op: "task submit", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var createResp ModelScopeCreateResponse
@@ -141,7 +145,7 @@ func (c *ModelScopeClient) CreateText2ImgTask(thirdPartyModelID string, payload
 }
 
 // CreateImg2ImgTask 创建图像生成任务
-func (c *ModelScopeClient) CreateImg2ImgTask(thirdPartyModelID string, payload rabbitmq.Img2ImgPayload) (string, error) {
+func (c *ModelScopeClient) CreateImg2ImgTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.Img2ImgPayload) (string, error) {
 	reqPayload := ModelScopeCreateImg2ImgRequest{
 		Model:             thirdPartyModelID,
 		InputImageURL:     payload.InputImageURL,
@@ -153,6 +157,7 @@ func (c *ModelScopeClient) CreateImg2ImgTask(thirdPartyModelID string, payload r
 		NumInferenceSteps: payload.NumInferenceSteps,
 		GuidanceScale:     payload.GuidanceScale,
 		Seed:              payload.Seed,
+		N:                 payload.NumImages,
 	}
 
 	reqBody, err := json.Marshal(reqPayload)
@@ -160,7 +165,7 @@ func (c *ModelScopeClient) CreateImg2ImgTask(thirdPartyModelID string, payload r
 		return "", fmt.Errorf("marshal request payload: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.baseURL+"v1/images/generations", bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"v1/images/generations", bytes.NewBuffer(reqBody))
 	if err != nil {
 		return "", fmt.Errorf("create request: %w", err)
 	}
@@ -186,7 +191,7 @@ func (c *ModelScopeClient) CreateImg2ImgTask(thirdPartyModelID string, payload r
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("task submit failed with status %d: %s", resp.StatusCode, string(body))
+		return "", &StatusError{Op: "task submit", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var createResp ModelScopeCreateResponse
@@ -197,40 +202,14 @@ func (c *ModelScopeClient) CreateImg2ImgTask(thirdPartyModelID string, payload r
 	return createResp.TaskID, nil
 }
 
-// WaitForTaskCompletion 等待任务完成
-func (c *ModelScopeClient) WaitForTaskCompletion(taskID string, maxAttempts int, pollInterval time.Duration) (*ModelScopeTaskResponse, error) {
-	for attempts := 1; attempts <= maxAttempts; attempts++ {
-		taskResp, err := c.GetTaskStatus(taskID)
-		if err != nil {
-			return nil, err
-		}
-
-		switch taskResp.TaskStatus {
-		case TaskStatusSucceed:
-			if len(taskResp.OutputImages) == 0 {
-				return nil, fmt.Errorf("task succeed but no output images")
-			}
-			return taskResp, nil
-
-		case TaskStatusFailed:
-			return nil, fmt.Errorf("task failed: %s", taskResp.Message)
-
-		case TaskStatusPending, TaskStatusProcessing:
-			if attempts < maxAttempts {
-				time.Sleep(pollInterval)
-			}
-
-		default:
-			return nil, fmt.Errorf("unknown task status: %s", taskResp.TaskStatus)
-		}
-	}
-
-	return nil, fmt.Errorf("timeout: task not completed within %d attempts", maxAttempts)
+// CreateInpaintTask ModelScope 异步接口不支持蒙版
+func (c *ModelScopeClient) CreateInpaintTask(_ context.Context, _ string, _ rabbitmq.InpaintPayload) (string, error) {
+	return "", ErrInpaintNotSupported
 }
 
 // GetTaskStatus 获取任务状态
-func (c *ModelScopeClient) GetTaskStatus(taskID string) (*ModelScopeTaskResponse, error) {
-	req, err := http.NewRequest("GET", c.baseURL+"v1/tasks/"+taskID, nil)
+func (c *ModelScopeClient) GetTaskStatus(ctx context.Context, taskID string) (*TaskResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.baseURL+"v1/tasks/"+taskID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create status request: %w", err)
 	}
@@ -256,7 +235,7 @@ func (c *ModelScopeClient) GetTaskStatus(taskID string) (*ModelScopeTaskResponse
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("get task status failed with status %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{Op: "get task status", StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	var taskResp ModelScopeTaskResponse
@@ -264,5 +243,16 @@ func (c *ModelScopeClient) GetTaskStatus(taskID string) (*ModelScopeTaskResponse
 		return nil, fmt.Errorf("unmarshal status response: %w", err)
 	}
 
-	return &taskResp, nil
+	return &TaskResult{
+		TaskID:       taskResp.TaskID,
+		TaskStatus:   taskResp.TaskStatus,
+		OutputImages: taskResp.OutputImages,
+		Message:      taskResp.Message,
+		TimeTaken:    taskResp.TimeTaken,
+	}, nil
+}
+
+// CancelTask ModelScope 异步接口暂未提供取消能力
+func (c *ModelScopeClient) CancelTask(_ context.Context, _ string) error {
+	return ErrCancelNotSupported
 }
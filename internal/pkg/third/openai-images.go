@@ -0,0 +1,244 @@
+package third
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+
+	// 注册蒙版可能使用的解码器
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/logger"
+	rabbitmq "github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+)
+
+// OpenAIImagesRequest OpenAI images 生成请求
+type OpenAIImagesRequest struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	N              int    `json:"n,omitempty"`
+	Size           string `json:"size,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+}
+
+// OpenAIImagesResponse OpenAI images 生成响应
+type OpenAIImagesResponse struct {
+	Created int64 `json:"created"`
+	Data    []struct {
+		URL     string `json:"url,omitempty"`
+		B64JSON string `json:"b64_json,omitempty"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// OpenAIImagesClient OpenAI images 兼容接口客户端, 上游为同步接口
+type OpenAIImagesClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewOpenAIImagesClient 创建 OpenAI images 兼容客户端
+func NewOpenAIImagesClient(baseURL, apiKey string) *OpenAIImagesClient {
+	return &OpenAIImagesClient{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+// CreateText2ImgTask 同步生成图片, 结果暂存后返回本地任务 ID
+func (c *OpenAIImagesClient) CreateText2ImgTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.Text2ImgPayload) (string, error) {
+	reqPayload := OpenAIImagesRequest{
+		Model:          thirdPartyModelID,
+		Prompt:         payload.Prompt,
+		N:              payload.NumImages,
+		Size:           fmt.Sprintf("%dx%d", payload.Width, payload.Height),
+		ResponseFormat: "url",
+	}
+
+	reqBody, err := json.Marshal(reqPayload)
+	if err != nil {
+		return "", fmt.Errorf("marshal request payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"v1/images/generations", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req)
+}
+
+// CreateImg2ImgTask 通过 images/edits 接口同步生成图片
+func (c *OpenAIImagesClient) CreateImg2ImgTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.Img2ImgPayload) (string, error) {
+	imageData, err := fetchImageBytes(ctx, c.httpClient, payload.InputImageURL)
+	if err != nil {
+		return "", err
+	}
+
+	return c.edit(ctx, thirdPartyModelID, payload.Prompt, payload.NumImages, payload.Width, payload.Height, imageData, nil)
+}
+
+// CreateInpaintTask 通过 images/edits 接口附带蒙版同步生成图片
+func (c *OpenAIImagesClient) CreateInpaintTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.InpaintPayload) (string, error) {
+	imageData, err := fetchImageBytes(ctx, c.httpClient, payload.InputImageURL)
+	if err != nil {
+		return "", err
+	}
+	maskData, err := fetchImageBytes(ctx, c.httpClient, payload.MaskImageURL)
+	if err != nil {
+		return "", err
+	}
+
+	// OpenAI 以透明区域表示需要重绘的部分
+	alphaMask, err := maskToAlpha(maskData)
+	if err != nil {
+		return "", Permanent(err)
+	}
+
+	return c.edit(ctx, thirdPartyModelID, payload.Prompt, payload.NumImages, payload.Width, payload.Height, imageData, alphaMask)
+}
+
+// edit 以 multipart 调用 images/edits, mask 为空时不上传蒙版
+func (c *OpenAIImagesClient) edit(ctx context.Context, model, prompt string, n, width, height int, imageData, maskData []byte) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := map[string]string{
+		"model":           model,
+		"prompt":          prompt,
+		"n":               strconv.Itoa(n),
+		"size":            fmt.Sprintf("%dx%d", width, height),
+		"response_format": "url",
+	}
+	for key, val := range fields {
+		if err := writer.WriteField(key, val); err != nil {
+			return "", fmt.Errorf("write form field: %w", err)
+		}
+	}
+
+	files := map[string][]byte{"image": imageData}
+	if maskData != nil {
+		files["mask"] = maskData
+	}
+	for field, data := range files {
+		part, err := writer.CreateFormFile(field, field+".png")
+		if err != nil {
+			return "", fmt.Errorf("create form file: %w", err)
+		}
+		if _, err := part.Write(data); err != nil {
+			return "", fmt.Errorf("write form file: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("close multipart writer: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"v1/images/edits", &body)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return c.do(req)
+}
+
+// maskToAlpha 把黑白蒙版转换为 PNG 透明蒙版, 白色(重绘)区域变为透明
+func maskToAlpha(maskData []byte) ([]byte, error) {
+	mask, _, err := image.Decode(bytes.NewReader(maskData))
+	if err != nil {
+		return nil, fmt.Errorf("decode mask image: %w", err)
+	}
+
+	bounds := mask.Bounds()
+	out := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray := color.GrayModel.Convert(mask.At(x, y)).(color.Gray)
+			alpha := uint8(255)
+			if gray.Y >= 128 {
+				alpha = 0
+			}
+			out.SetNRGBA(x, y, color.NRGBA{A: alpha})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, out); err != nil {
+		return nil, fmt.Errorf("encode mask image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// GetTaskStatus 读取暂存的同步生成结果
+func (c *OpenAIImagesClient) GetTaskStatus(_ context.Context, taskID string) (*TaskResult, error) {
+	return loadSyncResult(taskID)
+}
+
+// CancelTask 同步接口在返回前无法取消
+func (c *OpenAIImagesClient) CancelTask(_ context.Context, _ string) error {
+	return ErrCancelNotSupported
+}
+
+// do 发送请求并把返回的图片列表转换为 TaskResult
+func (c *OpenAIImagesClient) do(req *http.Request) (string, error) {
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer func() {
+		errs := resp.Body.Close()
+		if errs != nil {
+			logger.Error(nil, "Close response body error: %s", errs.Error())
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Op: "task submit", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var imagesResp OpenAIImagesResponse
+	if err := json.Unmarshal(body, &imagesResp); err != nil {
+		return "", fmt.Errorf("unmarshal images response: %w", err)
+	}
+
+	result := &TaskResult{
+		TaskStatus: TaskStatusSucceed,
+		TimeTaken:  time.Since(start).Seconds(),
+	}
+	if imagesResp.Error != nil {
+		result.TaskStatus = TaskStatusFailed
+		result.Message = imagesResp.Error.Message
+	}
+	for _, item := range imagesResp.Data {
+		if item.URL != "" {
+			result.OutputImages = append(result.OutputImages, item.URL)
+		} else if item.B64JSON != "" {
+			result.OutputImages = append(result.OutputImages, "data:image/png;base64,"+item.B64JSON)
+		}
+	}
+
+	return storeSyncResult(result), nil
+}
@@ -0,0 +1,181 @@
+package third
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/logger"
+	rabbitmq "github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+	"github.com/google/uuid"
+)
+
+const (
+	// ProviderModelScope ModelScope 异步生图接口
+	ProviderModelScope = "modelscope"
+	// ProviderOpenAI OpenAI images 兼容接口
+	ProviderOpenAI = "openai"
+	// ProviderSDWebUI Stable Diffusion WebUI 风格接口
+	ProviderSDWebUI = "sdwebui"
+	// ProviderFake 本地假实现, 用于测试与联调
+	ProviderFake = "fake"
+)
+
+// ErrCancelNotSupported 上游不支持取消任务
+var ErrCancelNotSupported = errors.New("provider does not support task cancellation")
+
+// ErrInpaintNotSupported 上游不支持局部重绘, 扩图同样依赖局部重绘, 重试无意义
+var ErrInpaintNotSupported = Permanent(errors.New("provider does not support inpainting"))
+
+// ImageProvider 定义生图提供商的统一接口
+type ImageProvider interface {
+	// CreateText2ImgTask 提交文生图任务, 返回上游任务 ID
+	CreateText2ImgTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.Text2ImgPayload) (string, error)
+	// CreateImg2ImgTask 提交图生图任务, 返回上游任务 ID
+	CreateImg2ImgTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.Img2ImgPayload) (string, error)
+	// CreateInpaintTask 提交局部重绘任务, 扩图也转换为局部重绘提交, 不支持时返回 ErrInpaintNotSupported
+	CreateInpaintTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.InpaintPayload) (string, error)
+	// GetTaskStatus 查询一次上游任务状态
+	GetTaskStatus(ctx context.Context, taskID string) (*TaskResult, error)
+	// CancelTask 取消上游任务, 不支持时返回 ErrCancelNotSupported
+	CancelTask(ctx context.Context, taskID string) error
+}
+
+// Upscaler 支持超分放大的 provider 可选实现此接口, 未实现时后处理使用本地重采样
+type Upscaler interface {
+	// Upscale 同步放大一张图片, 返回 PNG 数据
+	Upscale(ctx context.Context, imageData []byte, scale int) ([]byte, error)
+}
+
+// TaskResult 上游任务状态的统一结构
+type TaskResult struct {
+	TaskID       string
+	TaskStatus   string
+	OutputImages []string
+	Message      string
+	TimeTaken    float64
+}
+
+// SupportedProviders 返回全部已实现的 provider 名称
+func SupportedProviders() []string {
+	return []string{ProviderModelScope, ProviderOpenAI, ProviderSDWebUI, ProviderFake}
+}
+
+// IsSyncProvider 同步型上游的结果只保存在提交任务的实例内存中, 其他实例或重启后无法继续轮询
+func IsSyncProvider(provider string) bool {
+	switch provider {
+	case ProviderOpenAI, ProviderSDWebUI, ProviderFake:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewImageProvider 根据模型的 provider 字段创建对应实例
+func NewImageProvider(provider, baseURL, apiKey string) (ImageProvider, error) {
+	switch provider {
+	case ProviderModelScope, "":
+		return NewModelScopeClient(baseURL, apiKey), nil
+	case ProviderOpenAI:
+		return NewOpenAIImagesClient(baseURL, apiKey), nil
+	case ProviderSDWebUI:
+		return NewSDWebUIClient(baseURL, apiKey), nil
+	case ProviderFake:
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unsupported image provider: %s", provider)
+	}
+}
+
+// WaitForTaskCompletion 轮询上游直到任务结束
+func WaitForTaskCompletion(ctx context.Context, p ImageProvider, taskID string, maxAttempts int, pollInterval time.Duration) (*TaskResult, error) {
+	for attempts := 1; attempts <= maxAttempts; attempts++ {
+		taskResp, err := p.GetTaskStatus(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch taskResp.TaskStatus {
+		case TaskStatusSucceed:
+			if len(taskResp.OutputImages) == 0 {
+				return nil, fmt.Errorf("task succeed but no output images")
+			}
+			return taskResp, nil
+
+		case TaskStatusFailed:
+			return nil, fmt.Errorf("task failed: %s", taskResp.Message)
+
+		case TaskStatusPending, TaskStatusProcessing:
+			if attempts < maxAttempts {
+				select {
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				case <-time.After(pollInterval):
+				}
+			}
+
+		default:
+			return nil, fmt.Errorf("unknown task status: %s", taskResp.TaskStatus)
+		}
+	}
+
+	return nil, fmt.Errorf("timeout: task not completed within %d attempts", maxAttempts)
+}
+
+// syncResults 保存同步型上游(OpenAI/SD WebUI/Fake)的生成结果, 让它们也能走 create + poll 流程
+var syncResults sync.Map
+
+// storeSyncResult 保存一次同步生成的结果并返回生成的任务 ID
+func storeSyncResult(result *TaskResult) string {
+	result.TaskID = uuid.New().String()
+	syncResults.Store(result.TaskID, result)
+	return result.TaskID
+}
+
+// loadSyncResult 读取同步生成的结果, 终态结果读取后即删除
+func loadSyncResult(taskID string) (*TaskResult, error) {
+	val, ok := syncResults.Load(taskID)
+	if !ok {
+		return nil, fmt.Errorf("task %s not found", taskID)
+	}
+
+	result := val.(*TaskResult)
+	if result.TaskStatus == TaskStatusSucceed || result.TaskStatus == TaskStatusFailed {
+		syncResults.Delete(taskID)
+	}
+	return result, nil
+}
+
+// DiscardSyncResult 任务被取消或不再跟踪时删除未读取的同步结果, 异步上游的任务 ID 不在其中, 调用无副作用
+func DiscardSyncResult(taskID string) {
+	syncResults.Delete(taskID)
+}
+
+// fetchImageBytes 下载图片原始字节, 供需要上传原图的同步型上游使用
+func fetchImageBytes(ctx context.Context, client *http.Client, imageURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create image request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download input image: %w", err)
+	}
+	defer func() {
+		errs := resp.Body.Close()
+		if errs != nil {
+			logger.Error(nil, "Close response body error: %s", errs.Error())
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Op: "download input image", StatusCode: resp.StatusCode}
+	}
+
+	return io.ReadAll(resp.Body)
+}
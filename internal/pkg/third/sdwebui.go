@@ -0,0 +1,296 @@
+package third
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/logger"
+	rabbitmq "github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+)
+
+// SDWebUIText2ImgRequest SD WebUI txt2img 请求
+type SDWebUIText2ImgRequest struct {
+	Prompt           string         `json:"prompt"`
+	NegativePrompt   string         `json:"negative_prompt,omitempty"`
+	Width            int            `json:"width"`
+	Height           int            `json:"height"`
+	Steps            int            `json:"steps"`
+	CfgScale         float64        `json:"cfg_scale"`
+	Seed             int64          `json:"seed"`
+	BatchSize        int            `json:"batch_size"`
+	SamplerName      string         `json:"sampler_name,omitempty"`
+	OverrideSettings map[string]any `json:"override_settings,omitempty"`
+}
+
+// SDWebUIImg2ImgRequest SD WebUI img2img 请求
+type SDWebUIImg2ImgRequest struct {
+	SDWebUIText2ImgRequest
+	InitImages        []string `json:"init_images"`
+	DenoisingStrength float64  `json:"denoising_strength"`
+}
+
+// SDWebUIInpaintRequest SD WebUI img2img 局部重绘请求, mask 白色区域重绘
+type SDWebUIInpaintRequest struct {
+	SDWebUIImg2ImgRequest
+	Mask           string `json:"mask"`
+	MaskBlur       int    `json:"mask_blur"`
+	InpaintingFill int    `json:"inpainting_fill"`
+	InpaintFullRes bool   `json:"inpaint_full_res"`
+}
+
+// SDWebUIUpscaleRequest SD WebUI extras 单图放大请求
+type SDWebUIUpscaleRequest struct {
+	Image           string `json:"image"`
+	UpscalingResize int    `json:"upscaling_resize"`
+	Upscaler1       string `json:"upscaler_1"`
+}
+
+// SDWebUIUpscaleResponse SD WebUI extras 单图放大响应, image 为 base64 编码的 PNG
+type SDWebUIUpscaleResponse struct {
+	Image string `json:"image"`
+}
+
+// SDWebUIResponse SD WebUI 生成响应, images 为 base64 编码的 PNG
+type SDWebUIResponse struct {
+	Images []string `json:"images"`
+	Error  string   `json:"error,omitempty"`
+	Detail string   `json:"detail,omitempty"`
+}
+
+// SDWebUIClient Stable Diffusion WebUI 风格接口客户端, 上游为同步接口
+type SDWebUIClient struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+// NewSDWebUIClient 创建 SD WebUI 客户端, apiKey 为空时不发送认证头
+func NewSDWebUIClient(baseURL, apiKey string) *SDWebUIClient {
+	return &SDWebUIClient{
+		baseURL: baseURL,
+		apiKey:  apiKey,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+	}
+}
+
+// CreateText2ImgTask 同步生成图片, 结果暂存后返回本地任务 ID
+func (c *SDWebUIClient) CreateText2ImgTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.Text2ImgPayload) (string, error) {
+	reqPayload := c.buildText2ImgRequest(thirdPartyModelID, payload.Prompt, payload.NegativePrompt,
+		payload.Width, payload.Height, payload.NumInferenceSteps, payload.GuidanceScale, payload.Seed, payload.NumImages)
+	reqPayload.SamplerName = payload.Sampler
+
+	return c.generate(ctx, "sdapi/v1/txt2img", reqPayload)
+}
+
+// CreateImg2ImgTask 下载输入图片并以 base64 提交 img2img
+func (c *SDWebUIClient) CreateImg2ImgTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.Img2ImgPayload) (string, error) {
+	imageData, err := fetchImageBytes(ctx, c.httpClient, payload.InputImageURL)
+	if err != nil {
+		return "", err
+	}
+
+	reqPayload := SDWebUIImg2ImgRequest{
+		SDWebUIText2ImgRequest: c.buildText2ImgRequest(thirdPartyModelID, payload.Prompt, payload.NegativePrompt,
+			payload.Width, payload.Height, payload.NumInferenceSteps, payload.GuidanceScale, payload.Seed, payload.NumImages),
+		InitImages:        []string{base64.StdEncoding.EncodeToString(imageData)},
+		DenoisingStrength: payload.Strength,
+	}
+	reqPayload.SamplerName = payload.Sampler
+
+	return c.generate(ctx, "sdapi/v1/img2img", reqPayload)
+}
+
+// CreateInpaintTask 下载输入图片与蒙版并以 base64 提交 img2img 局部重绘
+func (c *SDWebUIClient) CreateInpaintTask(ctx context.Context, thirdPartyModelID string, payload rabbitmq.InpaintPayload) (string, error) {
+	imageData, err := fetchImageBytes(ctx, c.httpClient, payload.InputImageURL)
+	if err != nil {
+		return "", err
+	}
+	maskData, err := fetchImageBytes(ctx, c.httpClient, payload.MaskImageURL)
+	if err != nil {
+		return "", err
+	}
+
+	reqPayload := SDWebUIInpaintRequest{
+		SDWebUIImg2ImgRequest: SDWebUIImg2ImgRequest{
+			SDWebUIText2ImgRequest: c.buildText2ImgRequest(thirdPartyModelID, payload.Prompt, payload.NegativePrompt,
+				payload.Width, payload.Height, payload.NumInferenceSteps, payload.GuidanceScale, payload.Seed, payload.NumImages),
+			InitImages:        []string{base64.StdEncoding.EncodeToString(imageData)},
+			DenoisingStrength: payload.Strength,
+		},
+		Mask:           base64.StdEncoding.EncodeToString(maskData),
+		MaskBlur:       4,
+		InpaintingFill: 1, // 以原图内容为底进行重绘
+	}
+
+	return c.generate(ctx, "sdapi/v1/img2img", reqPayload)
+}
+
+// Upscale 调用 extras 接口使用 R-ESRGAN 放大图片
+func (c *SDWebUIClient) Upscale(ctx context.Context, imageData []byte, scale int) ([]byte, error) {
+	reqBody, err := json.Marshal(SDWebUIUpscaleRequest{
+		Image:           base64.StdEncoding.EncodeToString(imageData),
+		UpscalingResize: scale,
+		Upscaler1:       "R-ESRGAN 4x+",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"sdapi/v1/extra-single-image", bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send request: %w", err)
+	}
+	defer func() {
+		errs := resp.Body.Close()
+		if errs != nil {
+			logger.Error(nil, "Close response body error: %s", errs.Error())
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Op: "upscale", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var upscaleResp SDWebUIUpscaleResponse
+	if err := json.Unmarshal(body, &upscaleResp); err != nil {
+		return nil, fmt.Errorf("unmarshal upscale response: %w", err)
+	}
+
+	return base64.StdEncoding.DecodeString(upscaleResp.Image)
+}
+
+// GetTaskStatus 读取暂存的同步生成结果
+func (c *SDWebUIClient) GetTaskStatus(_ context.Context, taskID string) (*TaskResult, error) {
+	return loadSyncResult(taskID)
+}
+
+// CancelTask 中断 WebUI 当前正在执行的生成
+func (c *SDWebUIClient) CancelTask(ctx context.Context, _ string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"sdapi/v1/interrupt", nil)
+	if err != nil {
+		return fmt.Errorf("create interrupt request: %w", err)
+	}
+	c.setAuth(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send interrupt request: %w", err)
+	}
+	defer func() {
+		errs := resp.Body.Close()
+		if errs != nil {
+			logger.Error(nil, "Close response body error: %s", errs.Error())
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Op: "interrupt", StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+func (c *SDWebUIClient) buildText2ImgRequest(model, prompt, negativePrompt string, width, height, steps int, cfgScale float64, seed int64, n int) SDWebUIText2ImgRequest {
+	if n <= 0 {
+		n = 1
+	}
+	if seed == 0 {
+		seed = -1
+	}
+
+	req := SDWebUIText2ImgRequest{
+		Prompt:         prompt,
+		NegativePrompt: negativePrompt,
+		Width:          width,
+		Height:         height,
+		Steps:          steps,
+		CfgScale:       cfgScale,
+		Seed:           seed,
+		BatchSize:      n,
+	}
+	if model != "" {
+		req.OverrideSettings = map[string]any{"sd_model_checkpoint": model}
+	}
+	return req
+}
+
+func (c *SDWebUIClient) setAuth(req *http.Request) {
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+}
+
+// generate 发送生成请求并把返回的 base64 图片转换为 data URL
+func (c *SDWebUIClient) generate(ctx context.Context, path string, reqPayload any) (string, error) {
+	reqBody, err := json.Marshal(reqPayload)
+	if err != nil {
+		return "", fmt.Errorf("marshal request payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.setAuth(req)
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("send request: %w", err)
+	}
+	defer func() {
+		errs := resp.Body.Close()
+		if errs != nil {
+			logger.Error(nil, "Close response body error: %s", errs.Error())
+		}
+	}()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Op: "task submit", StatusCode: resp.StatusCode, Body: string(body)}
+	}
+
+	var sdResp SDWebUIResponse
+	if err := json.Unmarshal(body, &sdResp); err != nil {
+		return "", fmt.Errorf("unmarshal sdwebui response: %w", err)
+	}
+
+	result := &TaskResult{
+		TaskStatus: TaskStatusSucceed,
+		TimeTaken:  time.Since(start).Seconds(),
+	}
+	if sdResp.Error != "" {
+		result.TaskStatus = TaskStatusFailed
+		result.Message = sdResp.Error + " " + sdResp.Detail
+	}
+	for _, img := range sdResp.Images {
+		result.OutputImages = append(result.OutputImages, "data:image/png;base64,"+img)
+	}
+
+	return storeSyncResult(result), nil
+}
@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录 B 中 SHA1 测试向量的密钥 "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC 给出 8 位验证码, 6 位验证码取其后 6 位
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	const code = "005924" // 1234567890 所在时间步的验证码
+	issuedAt := time.Unix(1234567890, 0)
+	step := issuedAt.Unix() / totpPeriod
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      time.Time
+		wantOK   bool
+		wantStep int64
+	}{
+		{"same step", rfc6238Secret, code, issuedAt, true, step},
+		{"one step later", rfc6238Secret, code, issuedAt.Add(totpPeriod * time.Second), true, step},
+		{"one step earlier", rfc6238Secret, code, issuedAt.Add(-totpPeriod * time.Second), true, step},
+		{"two steps later", rfc6238Secret, code, issuedAt.Add(2 * totpPeriod * time.Second), false, 0},
+		{"two steps earlier", rfc6238Secret, code, issuedAt.Add(-2 * totpPeriod * time.Second), false, 0},
+		{"surrounding spaces", rfc6238Secret, " " + code + " ", issuedAt, true, step},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), code, issuedAt, true, step},
+		{"wrong code", rfc6238Secret, "005925", issuedAt, false, 0},
+		{"too short", rfc6238Secret, "05924", issuedAt, false, 0},
+		{"too long", rfc6238Secret, "0005924", issuedAt, false, 0},
+		{"invalid secret", "not-base32!", code, issuedAt, false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, tt.now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP() = (%d, %v), want (%d, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes, want 10", len(codes))
+	}
+
+	seen := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		groups := strings.Split(code, "-")
+		if len(groups) != 4 {
+			t.Errorf("code %q has %d groups, want 4", code, len(groups))
+		}
+		for _, group := range groups {
+			if len(group) != 5 || group != strings.ToLower(group) {
+				t.Errorf("code %q has malformed group %q", code, group)
+			}
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"abcde-fghij-klmno-pqrst", "abcdefghijklmnopqrst"},
+		{"ABCDE-FGHIJ-KLMNO-PQRST", "abcdefghijklmnopqrst"},
+		{"  abcde fghij klmno pqrst\n", "abcdefghijklmnopqrst"},
+		{"abcdefghijklmnopqrst", "abcdefghijklmnopqrst"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.input); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -23,6 +23,14 @@ const (
 	MessageTypeTaskFailed MessageType = "task_failed"
 	// MessageTypeTaskCancelled 任务已取消
 	MessageTypeTaskCancelled MessageType = "task_cancelled"
+
+	// MessageTypePostProcessCompleted 后处理完成
+	MessageTypePostProcessCompleted MessageType = "post_process_completed"
+	// MessageTypePostProcessFailed 后处理失败, 原图仍然可用
+	MessageTypePostProcessFailed MessageType = "post_process_failed"
+
+	// MessageTypeModelHealth 模型被健康检查自动停用或探测后恢复, 只发送给管理员
+	MessageTypeModelHealth MessageType = "model_health"
 )
 
 // Message WebSocket 消息结构
@@ -39,12 +47,27 @@ type TaskProgressData struct {
 	Status string `json:"status"`
 }
 
+// TaskQueuedData 任务入队数据
+type TaskQueuedData struct {
+	TaskID   string `json:"task_id"`
+	Status   string `json:"status"`
+	Priority uint8  `json:"priority"`
+	Position int64  `json:"position"`
+}
+
 // TaskCompletedData 任务完成数据
 type TaskCompletedData struct {
-	TaskID           string `json:"task_id"`
-	Status           string `json:"status"`
-	OutputImageURL   string `json:"output_image_url"`
-	GenerationTimeMs int64  `json:"generation_time_ms"`
+	TaskID           string   `json:"task_id"`
+	Status           string   `json:"status"`
+	OutputImageURL   string   `json:"output_image_url"`
+	OutputImageURLs  []string `json:"output_image_urls"`
+	GenerationTimeMs int64    `json:"generation_time_ms"`
+}
+
+// TaskCancelledData 任务取消数据
+type TaskCancelledData struct {
+	TaskID string `json:"task_id"`
+	Status string `json:"status"`
 }
 
 // TaskFailedData 任务失败数据
@@ -54,6 +77,27 @@ type TaskFailedData struct {
 	ErrorMessage string `json:"error_message"`
 }
 
+// PostProcessCompletedData 后处理完成数据
+type PostProcessCompletedData struct {
+	TaskID             string   `json:"task_id"`
+	Status             string   `json:"status"`
+	ProcessedImageURLs []string `json:"processed_image_urls"`
+}
+
+// PostProcessFailedData 后处理失败数据
+type PostProcessFailedData struct {
+	TaskID       string `json:"task_id"`
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message"`
+}
+
+// ModelHealthData 模型健康状态变更数据
+type ModelHealthData struct {
+	ModelID string `json:"model_id"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+}
+
 // ConnectedData 连接成功数据
 type ConnectedData struct {
 	SuccessMsg string `json:"success_msg"`
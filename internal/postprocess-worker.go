@@ -0,0 +1,281 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	image_generation_dao "github.com/Zhiruosama/ai_nexus/internal/dao/image-generation"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/storage"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/third"
+	ws "github.com/Zhiruosama/ai_nexus/internal/pkg/ws"
+)
+
+const (
+	// upscaleTimeout 单张图片调用 provider 超分的超时时间
+	upscaleTimeout = 2 * time.Minute
+	// watermarkMargin 水印距右下角的边距
+	watermarkMargin = 16
+	// processedQuality 后处理结果的 WebP 质量
+	processedQuality = 90
+	// maxPostErrorLen post_error 列长度
+	maxPostErrorLen = 512
+	// storageTimeout 单张图片读写存储的超时时间
+	storageTimeout = time.Minute
+)
+
+// StartPostProcessWorker 启动后处理 Worker
+func StartPostProcessWorker() {
+	log.Println("[Worker] PostProcess worker starting")
+
+	err := queue.Consume(queue.QueuePostProcess, handlePostProcessTask)
+	if err != nil {
+		log.Printf("[Worker] PostProcess worker stopped: %v\n", err)
+	}
+}
+
+// handlePostProcessTask 对任务的全部输出依次执行后处理
+// 任务本身已完成, 失败只记录到 post_status, 因此始终返回 nil 避免消费者把任务标记为失败
+func handlePostProcessTask(msg *queue.TaskMessage) (bool, int8, int8, error) {
+	log.Printf("[Worker] Processing post process task: %s\n", msg.TaskID)
+
+	dao := &image_generation_dao.DAO{}
+
+	var payload queue.PostProcessPayload
+	payloadBytes, err := json.Marshal(msg.Payload)
+	if err == nil {
+		err = json.Unmarshal(payloadBytes, &payload)
+	}
+	if err != nil {
+		failPostProcess(dao, msg.TaskID, msg.UserUUID, fmt.Errorf("unmarshal payload error: %w", err))
+		return false, 0, 0, nil
+	}
+
+	postStatus, err := image_generation_dao.GetTaskInfo[int8](dao, "post_status", msg.TaskID)
+	if err != nil {
+		log.Printf("[Worker] Failed to load post status for task %s: %v\n", msg.TaskID, err)
+		return false, 0, 0, nil
+	}
+	if postStatus == 3 {
+		log.Printf("[Worker] Duplicate post process message skipped: %s\n", msg.TaskID)
+		return false, 0, 0, nil
+	}
+
+	if err = dao.UpdateTaskParams("post_status", 2, msg.TaskID); err != nil {
+		log.Printf("[Worker] Failed to update post status for task %s: %v\n", msg.TaskID, err)
+	}
+
+	outputs, err := dao.GetTaskOutputs(msg.TaskID)
+	if err != nil {
+		failPostProcess(dao, msg.TaskID, msg.UserUUID, err)
+		return false, 0, 0, nil
+	}
+	if len(outputs) == 0 {
+		failPostProcess(dao, msg.TaskID, msg.UserUUID, fmt.Errorf("no output images"))
+		return false, 0, 0, nil
+	}
+
+	var upscaler third.Upscaler
+	if payload.Options.Upscale > 0 {
+		upscaler = resolveUpscaler(dao, payload, msg.UserUUID)
+	}
+
+	storedURLs := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		storedURL, err := postProcessImage(output.ImageURL, payload.Options, upscaler)
+		if err != nil {
+			failPostProcess(dao, msg.TaskID, msg.UserUUID, err)
+			return false, 0, 0, nil
+		}
+		storedURLs = append(storedURLs, storedURL)
+	}
+
+	if err = dao.UpdateProcessedOutputs(msg.TaskID, storedURLs); err != nil {
+		failPostProcess(dao, msg.TaskID, msg.UserUUID, err)
+		return false, 0, 0, nil
+	}
+
+	if err = dao.UpdateTaskParams("post_status", 3, msg.TaskID); err != nil {
+		log.Printf("[Worker] Failed to update post status for task %s: %v\n", msg.TaskID, err)
+	}
+
+	ws.GlobalHub.SendToUser(msg.UserUUID, ws.MessageTypePostProcessCompleted, ws.PostProcessCompletedData{
+		TaskID:             msg.TaskID,
+		Status:             "completed",
+		ProcessedImageURLs: signedImageURLs(storedURLs),
+	})
+
+	log.Printf("[Worker] Post process completed: %s\n", msg.TaskID)
+	return false, 0, 0, nil
+}
+
+// postProcessImage 按 放大 -> 裁剪 -> 缩放 -> 水印 的顺序处理一张图片, 结果另存为 *-processed.webp, 原图保留
+func postProcessImage(srcURL string, options queue.PostProcessOptions, upscaler third.Upscaler) (string, error) {
+	srcKey := storage.KeyFromURL(srcURL)
+	if srcKey == "" {
+		return "", fmt.Errorf("unrecognized image url: %s", srcURL)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	data, err := storage.ReadAll(ctx, srcKey)
+	cancel()
+	if err != nil {
+		return "", fmt.Errorf("read image %s error: %w", srcKey, err)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("decode image error: %w", err)
+	}
+
+	if options.Upscale > 0 {
+		maxSize := configs.GlobalConfig.ImageGen.MaxProcessedSize
+		if maxSize <= 0 {
+			maxSize = 4096
+		}
+		width, height := img.Bounds().Dx()*options.Upscale, img.Bounds().Dy()*options.Upscale
+		if width > maxSize || height > maxSize {
+			return "", fmt.Errorf("upscaled size %dx%d exceeds %d", width, height, maxSize)
+		}
+		img = upscaleImage(img, options.Upscale, upscaler)
+	}
+
+	if options.AspectRatio != "" {
+		ratioW, ratioH, err := pkg.ParseAspectRatio(options.AspectRatio)
+		if err != nil {
+			return "", err
+		}
+		img = pkg.CropToAspect(img, ratioW, ratioH)
+	}
+
+	if options.TargetWidth > 0 {
+		bounds := img.Bounds()
+		height := max(bounds.Dy()*options.TargetWidth/bounds.Dx(), 1)
+		img = pkg.ResizeImage(img, options.TargetWidth, height)
+	}
+
+	if options.Watermark {
+		mark, err := pkg.LoadImage(configs.GlobalConfig.ImageGen.WatermarkPath)
+		if err != nil {
+			return "", fmt.Errorf("load watermark error: %w", err)
+		}
+		img = pkg.OverlayWatermark(img, mark, configs.GlobalConfig.ImageGen.WatermarkOpacity, watermarkMargin)
+	}
+
+	tempFile, err := os.CreateTemp("", "ainexus-processed-*.webp")
+	if err != nil {
+		return "", fmt.Errorf("create temp file error: %w", err)
+	}
+	tempPath := tempFile.Name()
+	_ = tempFile.Close()
+	defer func() {
+		if err := os.Remove(tempPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("[Worker] Failed to remove temp file %s: %v\n", tempPath, err)
+		}
+	}()
+
+	if err = pkg.SaveWebP(tempPath, img, processedQuality); err != nil {
+		return "", err
+	}
+
+	// 重新编码会丢失元数据, 从原图复制生成参数
+	if meta, err := pkg.ReadGenerationMetadata(data); err == nil {
+		if err = pkg.EmbedGenerationMetadata(tempPath, meta); err != nil {
+			log.Printf("[Worker] Failed to embed metadata into processed %s: %v\n", srcKey, err)
+		}
+	}
+
+	// 放大可能耗时较长, 上传使用新的超时
+	putCtx, putCancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer putCancel()
+
+	dstKey := strings.TrimSuffix(srcKey, path.Ext(srcKey)) + "-processed.webp"
+	if err = storage.PutFile(putCtx, dstKey, tempPath); err != nil {
+		return "", fmt.Errorf("save processed image error: %w", err)
+	}
+	return storage.Default.URL(dstKey), nil
+}
+
+// upscaleImage 优先调用 provider 超分, 不支持或调用失败时回退到本地双线性重采样
+func upscaleImage(img image.Image, scale int, upscaler third.Upscaler) image.Image {
+	bounds := img.Bounds()
+	if upscaler != nil {
+		upscaled, err := upscaleByProvider(img, scale, upscaler)
+		if err == nil {
+			return upscaled
+		}
+		log.Printf("[Worker] Provider upscale failed, fall back to local resampling: %v\n", err)
+	}
+
+	return pkg.ResizeImage(img, bounds.Dx()*scale, bounds.Dy()*scale)
+}
+
+func upscaleByProvider(img image.Image, scale int, upscaler third.Upscaler) (image.Image, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("encode png error: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), upscaleTimeout)
+	defer cancel()
+
+	data, err := upscaler.Upscale(ctx, buf.Bytes(), scale)
+	if err != nil {
+		return nil, err
+	}
+
+	upscaled, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode upscaled image error: %w", err)
+	}
+	return upscaled, nil
+}
+
+// resolveUpscaler 生成模型所属 provider 支持超分时复用其凭证
+func resolveUpscaler(dao *image_generation_dao.DAO, payload queue.PostProcessPayload, userUUID string) third.Upscaler {
+	client, _, err := newModelProvider(dao, payload.ModelID, userUUID, payload.CredentialID)
+	if err != nil {
+		log.Printf("[Worker] Failed to create provider for upscale, use local resampling: %v\n", err)
+		return nil
+	}
+
+	upscaler, ok := client.(third.Upscaler)
+	if !ok {
+		return nil
+	}
+	return upscaler
+}
+
+// failPostProcess 记录后处理失败并通知用户, 任务本身仍为已完成
+func failPostProcess(dao *image_generation_dao.DAO, taskID, userUUID string, cause error) {
+	log.Printf("[Worker] Post process failed for task %s: %v\n", taskID, cause)
+
+	message := cause.Error()
+	if runes := []rune(message); len(runes) > maxPostErrorLen {
+		message = string(runes[:maxPostErrorLen])
+	}
+
+	if err := dao.UpdateTaskParams("post_status", 4, taskID); err != nil {
+		log.Printf("[Worker] Failed to update post status for task %s: %v\n", taskID, err)
+	}
+	if err := dao.UpdateTaskParams("post_error", message, taskID); err != nil {
+		log.Printf("[Worker] Failed to update post error for task %s: %v\n", taskID, err)
+	}
+
+	ws.GlobalHub.SendToUser(userUUID, ws.MessageTypePostProcessFailed, ws.PostProcessFailedData{
+		TaskID:       taskID,
+		Status:       "failed",
+		ErrorMessage: message,
+	})
+}
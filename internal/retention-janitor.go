@@ -0,0 +1,329 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Zhiruosama/ai_nexus/configs"
+	image_generation_dao "github.com/Zhiruosama/ai_nexus/internal/dao/image-generation"
+	image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	// retentionLockKey 多实例部署时保证同一时刻只有一个实例执行清理
+	retentionLockKey = "retention:janitor:lock"
+	// retentionImagePrefix 生成结果与上传原图所在的存储前缀, 头像不参与清理
+	retentionImagePrefix = "images/"
+	// retentionReferenceBatch 孤儿文件每批查询引用的数量
+	retentionReferenceBatch = 200
+	// retentionDefaultInterval 未配置清理周期时的默认值
+	retentionDefaultInterval = time.Hour
+	// retentionDefaultBatchSize 未配置单轮处理数量时的默认值
+	retentionDefaultBatchSize = 500
+)
+
+// releaseLockScript 只释放自己持有的锁
+const releaseLockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+// errOrphanLimit 孤儿文件达到单轮上限, 用于提前结束遍历
+var errOrphanLimit = errors.New("orphan limit reached")
+
+// retentionReport 单轮清理的统计结果
+type retentionReport struct {
+	Tasks   int   // 超过保留期限被清理的任务数
+	Inputs  int   // 清理上传原图的任务数
+	Orphans int   // 删除的孤儿文件数
+	Files   int   // 删除的文件总数
+	Bytes   int64 // 回收的存储空间
+	Errors  int   // 删除失败的文件数
+}
+
+// StartRetentionJanitor 启动图片保留策略清理, 按用户等级删除过期图片、清理已结束任务的上传原图并回收无引用的孤儿文件
+// dry run 模式只记录将要删除的文件, 不删除文件也不修改数据库
+func StartRetentionJanitor() {
+	cfg := configs.GlobalConfig.Retention
+	if !cfg.Enabled {
+		log.Println("[Retention] Janitor disabled")
+		return
+	}
+	go runRetentionJanitor(cfg)
+}
+
+func runRetentionJanitor(cfg configs.RetentionConfig) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = retentionDefaultInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = retentionDefaultBatchSize
+	}
+	log.Printf("[Retention] Janitor starting, interval: %s, dry run: %t\n", cfg.Interval, cfg.DryRun)
+
+	dao := &image_generation_dao.DAO{}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		token := uuid.New().String()
+		acquired, err := rdb.Rdb.SetNX(rdb.Ctx, retentionLockKey, token, cfg.Interval).Result()
+		if err != nil {
+			log.Printf("[Retention] Failed to acquire lock: %v\n", err)
+			continue
+		}
+		if !acquired {
+			continue
+		}
+
+		runRetention(dao, cfg)
+
+		if err = rdb.Rdb.Eval(rdb.Ctx, releaseLockScript, []string{retentionLockKey}, token).Err(); err != nil {
+			log.Printf("[Retention] Failed to release lock: %v\n", err)
+		}
+	}
+}
+
+// runRetention 执行一轮清理并输出回收空间报告
+func runRetention(dao *image_generation_dao.DAO, cfg configs.RetentionConfig) {
+	start := time.Now()
+	report := &retentionReport{}
+
+	expireTasks(dao, cfg, report)
+	cleanTaskInputs(dao, cfg, report)
+	collectOrphans(dao, cfg, report)
+
+	mode := ""
+	if cfg.DryRun {
+		mode = " (dry run, nothing deleted)"
+	}
+	log.Printf("[Retention] Run finished in %s%s: %d tasks expired, %d task inputs cleaned, %d orphans, %d files, %s reclaimed, %d errors\n",
+		time.Since(start).Round(time.Millisecond), mode, report.Tasks, report.Inputs, report.Orphans, report.Files, formatBytes(report.Bytes), report.Errors)
+}
+
+// expireTasks 按用户等级清理超过保留期限的任务图片, 保留时长为 0 的等级永久保留
+func expireTasks(dao *image_generation_dao.DAO, cfg configs.RetentionConfig, report *retentionReport) {
+	tiers := slices.Sorted(maps.Keys(cfg.Tiers))
+
+	for _, tier := range tiers {
+		if ttl := cfg.Tiers[tier]; ttl > 0 {
+			tasks, err := dao.ListExpiredTasks([]string{tier}, true, time.Now().Add(-ttl), cfg.BatchSize)
+			if err != nil {
+				log.Printf("[Retention] Failed to list expired tasks of tier %s: %v\n", tier, err)
+				report.Errors++
+				continue
+			}
+			purgeTasks(dao, tasks, cfg.DryRun, report)
+		}
+	}
+
+	// 未单独配置的等级与已注销用户使用默认保留时长
+	if cfg.Default > 0 {
+		tasks, err := dao.ListExpiredTasks(tiers, false, time.Now().Add(-cfg.Default), cfg.BatchSize)
+		if err != nil {
+			log.Printf("[Retention] Failed to list expired tasks of default tier: %v\n", err)
+			report.Errors++
+			return
+		}
+		purgeTasks(dao, tasks, cfg.DryRun, report)
+	}
+}
+
+// purgeTasks 删除任务的全部图片后清空数据库中的地址, 任一文件删除失败时保留记录等待下一轮重试
+func purgeTasks(dao *image_generation_dao.DAO, tasks []*image_generation_do.TableImageGenerationTaskDO, dryRun bool, report *retentionReport) {
+	for _, task := range tasks {
+		outputs, err := dao.GetTaskOutputs(task.TaskID)
+		if err != nil {
+			continue
+		}
+
+		urls := []string{task.OutputImageURL, task.InputImageURL, task.MaskImageURL}
+		for _, output := range outputs {
+			urls = append(urls, output.ImageURL, output.ProcessedURL)
+		}
+
+		if !deleteImages(urls, dryRun, report) {
+			continue
+		}
+		report.Tasks++
+
+		if dryRun {
+			continue
+		}
+		if err = dao.PurgeTaskImages(task.TaskID); err != nil {
+			log.Printf("[Retention] Failed to purge task %s: %v\n", task.TaskID, err)
+		}
+	}
+}
+
+// cleanTaskInputs 任务结束超过 inputretention 后删除上传原图与蒙版
+func cleanTaskInputs(dao *image_generation_dao.DAO, cfg configs.RetentionConfig, report *retentionReport) {
+	if cfg.InputRetention <= 0 {
+		return
+	}
+
+	tasks, err := dao.ListFinishedTasksWithInputs(time.Now().Add(-cfg.InputRetention), cfg.BatchSize)
+	if err != nil {
+		return
+	}
+
+	for _, task := range tasks {
+		if !deleteImages([]string{task.InputImageURL, task.MaskImageURL}, cfg.DryRun, report) {
+			continue
+		}
+		report.Inputs++
+
+		if cfg.DryRun {
+			continue
+		}
+		if err = dao.ClearTaskInputs(task.TaskID); err != nil {
+			log.Printf("[Retention] Failed to clear inputs of task %s: %v\n", task.TaskID, err)
+		}
+	}
+}
+
+// collectOrphans 删除超过 orphangrace 且没有任何任务引用的图片文件
+// 宽限期覆盖 Worker 写入存储到落库、上传原图到创建任务之间的窗口
+func collectOrphans(dao *image_generation_dao.DAO, cfg configs.RetentionConfig, report *retentionReport) {
+	if cfg.OrphanGrace <= 0 {
+		return
+	}
+
+	cutoff := time.Now().Add(-cfg.OrphanGrace)
+	batch := make([]storage.ObjectInfo, 0, retentionReferenceBatch)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		defer func() {
+			batch = batch[:0]
+		}()
+		return deleteOrphans(dao, batch, cfg.BatchSize, cfg.DryRun, report)
+	}
+
+	err := storage.Default.List(context.Background(), retentionImagePrefix, func(obj storage.ObjectInfo) error {
+		if obj.ModTime.After(cutoff) {
+			return nil
+		}
+
+		batch = append(batch, obj)
+		if len(batch) < retentionReferenceBatch {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil && !errors.Is(err, errOrphanLimit) {
+		log.Printf("[Retention] Failed to collect orphans: %v\n", err)
+	}
+}
+
+// deleteOrphans 查询一批文件的引用情况并删除无引用的文件, 达到单轮上限时返回 errOrphanLimit
+func deleteOrphans(dao *image_generation_dao.DAO, objects []storage.ObjectInfo, limit int, dryRun bool, report *retentionReport) error {
+	// 旧版本保存的是带主机名的本地地址, 两种形式都视为引用
+	urls := make([]string, 0, len(objects)*2)
+	for _, obj := range objects {
+		storedURL := storage.Default.URL(obj.Key)
+		urls = append(urls, storedURL, storage.PublicURL(storedURL))
+	}
+
+	referenced, err := dao.GetReferencedImageURLs(urls)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		storedURL := storage.Default.URL(obj.Key)
+		if referenced[storedURL] || referenced[storage.PublicURL(storedURL)] {
+			continue
+		}
+
+		if err = deleteObject(obj.Key, obj.Size, dryRun, report); err != nil {
+			continue
+		}
+		report.Orphans++
+		if report.Orphans >= limit {
+			return errOrphanLimit
+		}
+	}
+	return nil
+}
+
+// deleteImages 删除数据库中保存的图片地址对应的文件, 全部成功时返回 true
+func deleteImages(urls []string, dryRun bool, report *retentionReport) bool {
+	ok := true
+	seen := make(map[string]bool, len(urls))
+
+	for _, storedURL := range urls {
+		if storedURL == "" {
+			continue
+		}
+
+		key := storage.KeyFromURL(storedURL)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+		info, err := storage.Default.Stat(ctx, key)
+		cancel()
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("[Retention] Failed to stat %s: %v\n", key, err)
+			report.Errors++
+			ok = false
+			continue
+		}
+
+		if err = deleteObject(key, info.Size, dryRun, report); err != nil {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// deleteObject 删除单个对象并计入报告, dry run 时只记录日志
+func deleteObject(key string, size int64, dryRun bool, report *retentionReport) error {
+	if dryRun {
+		log.Printf("[Retention] Would delete %s (%s)\n", key, formatBytes(size))
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+		defer cancel()
+
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			log.Printf("[Retention] Failed to delete %s: %v\n", key, err)
+			report.Errors++
+			return err
+		}
+	}
+
+	report.Files++
+	report.Bytes += size
+	return nil
+}
+
+// formatBytes 以可读单位输出字节数
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
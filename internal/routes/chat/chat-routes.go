@@ -33,7 +33,7 @@ func InitChatRoutes(r *gin.Engine) {
 			convs.GET("/:conv_id", c.GetConversationDetail)
 			convs.DELETE("/:conv_id", c.DeleteConversation)
 			convs.PUT("/:conv_id/title", c.UpdateConversationTitle)
-			convs.POST("/:conv_id/messages", c.SendMessage)
+			convs.POST("/:conv_id/messages", middleware.IdempotencyMiddleware(), c.SendMessage)
 		}
 
 		// 预设管理
@@ -0,0 +1,45 @@
+// Package gallery 画廊路由
+package gallery
+
+import (
+	gallery_controller "github.com/Zhiruosama/ai_nexus/internal/controller/gallery"
+	"github.com/Zhiruosama/ai_nexus/internal/middleware"
+	gallery_service "github.com/Zhiruosama/ai_nexus/internal/service/gallery"
+	"github.com/gin-gonic/gin"
+)
+
+// InitGalleryRoutes 初始化画廊模块的路由
+func InitGalleryRoutes(r *gin.Engine) {
+	gs := gallery_service.NewService()
+	gc := gallery_controller.NewController(gs)
+
+	gallery := r.Group("/gallery")
+	{
+		// 浏览无需登录, 登录后返回点赞与收藏状态
+		feed := gallery.Group("")
+		feed.Use(middleware.OptionalAuthMiddleware(), middleware.RateLimitingMiddleware())
+		{
+			feed.GET("/latest", gc.QueryLatest)
+			feed.GET("/trending", gc.QueryTrending)
+			feed.GET("/post/:id", gc.GetPost)
+		}
+
+		post := gallery.Group("/post")
+		post.Use(middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware())
+		{
+			post.POST("/publish", gc.Publish)
+			post.DELETE("/unpublish", gc.Unpublish)
+			post.POST("/like", gc.Like)
+			post.DELETE("/like", gc.Unlike)
+			post.POST("/favorite", gc.Favorite)
+			post.DELETE("/favorite", gc.Unfavorite)
+			post.POST("/remix", gc.Remix)
+		}
+
+		mine := gallery.Group("")
+		mine.Use(middleware.AuthMiddleware(), middleware.RateLimitingMiddleware())
+		{
+			mine.GET("/favorites", gc.QueryFavorites)
+		}
+	}
+}
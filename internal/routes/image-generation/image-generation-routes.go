@@ -15,23 +15,87 @@ func InitImageGenerationRoutes(r *gin.Engine) {
 
 	imageGeneration := r.Group("/image-generation")
 	{
+		// 模型列表供前端选择模型, 无需登录
 		model := imageGeneration.Group("/model")
 		model.Use(middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware())
 		{
-			model.POST("/create", igc.CreateModel)
-			model.POST("/batchcreate", igc.BatchCreateModels)
-			model.DELETE("/delete", igc.DeleteModel)
-			model.PUT("/update", igc.UpdateModel)
 			model.GET("/info", igc.GetModelInfo)
 			model.GET("/query", igc.QueryModels)
 		}
 
+		// 模型管理
+		modelAdmin := imageGeneration.Group("/model")
+		modelAdmin.Use(middleware.AuthMiddleware(), middleware.RequireRole(middleware.RoleAdmin, middleware.PermModelManage), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware())
+		{
+			modelAdmin.POST("/create", igc.CreateModel)
+			modelAdmin.POST("/batchcreate", igc.BatchCreateModels)
+			modelAdmin.DELETE("/delete", igc.DeleteModel)
+			modelAdmin.PUT("/update", igc.UpdateModel)
+			modelAdmin.GET("/health", igc.GetModelHealth)
+		}
+
+		// 平台凭证, 模型通过 credential_id 引用
+		credential := imageGeneration.Group("/credential")
+		credential.Use(middleware.AuthMiddleware(), middleware.RequireRole(middleware.RoleAdmin, middleware.PermCredentialManage), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware())
+		{
+			credential.POST("/create", igc.CreateCredential)
+			credential.PUT("/update", igc.UpdateCredential)
+			credential.DELETE("/delete", igc.DeleteCredential)
+			credential.GET("/query", igc.QueryCredentials)
+		}
+
+		// 用户自带凭证, 提交任务时通过 credential_id 指定
+		userCredential := imageGeneration.Group("/user-credential")
+		userCredential.Use(middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware())
+		{
+			userCredential.POST("/create", igc.CreateUserCredential)
+			userCredential.PUT("/update", igc.UpdateUserCredential)
+			userCredential.DELETE("/delete", igc.DeleteUserCredential)
+			userCredential.GET("/query", igc.QueryUserCredentials)
+		}
+
+		// 死信任务管理
+		deadLetter := imageGeneration.Group("/dead-letter")
+		deadLetter.Use(middleware.AuthMiddleware(), middleware.RequireRole(middleware.RoleAdmin, middleware.PermDeadLetterManage), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware())
+		{
+			deadLetter.GET("/query", igc.QueryDeadLetters)
+			deadLetter.GET("/info/:id", igc.GetDeadLetter)
+			deadLetter.POST("/replay", igc.ReplayDeadLetters)
+			deadLetter.DELETE("/purge", igc.PurgeDeadLetters)
+		}
+
+		// 提交任务的接口先经过幂等中间件, 携带 Idempotency-Key 的重试由其回放首次响应, 不会被防重放拦截
+		submit := imageGeneration.Group("/image")
+		submit.Use(middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), middleware.IdempotencyMiddleware(), middleware.DeduplicationMiddleware())
+		{
+			submit.POST("/text2img", igc.Text2Img)
+			submit.POST("/img2img", igc.Img2Img)
+			submit.POST("/inpaint", igc.Inpaint)
+			submit.POST("/outpaint", igc.Outpaint)
+		}
+
 		img := imageGeneration.Group("/image")
 		img.Use(middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware())
 		{
-			img.POST("/text2img", igc.Text2Img)
-			img.POST("/img2img", igc.Img2Img)
 			img.PUT("/cancel", igc.CancelTask)
+			img.PUT("/visibility", igc.SetTaskVisibility)
+			img.POST("/enhance-prompt", igc.PreviewEnhancePrompt)
+			img.POST("/metadata", igc.ReadImageMetadata)
+		}
+
+		// 任务查询会被前端轮询, 不挂载防重放中间件
+		task := imageGeneration.Group("/image")
+		task.Use(middleware.AuthMiddleware(), middleware.RateLimitingMiddleware())
+		{
+			task.GET("/task/:id", igc.GetTaskInfo)
+			task.GET("/tasks", igc.QueryTasks)
+		}
+
+		// 图片文件访问, 签名地址与公开图片无需登录, 未签名的私有图片校验归属用户
+		file := imageGeneration.Group("/file")
+		file.Use(middleware.OptionalAuthMiddleware(), middleware.RateLimitingMiddleware())
+		{
+			file.GET("/*key", igc.ServeImage)
 		}
 	}
 }
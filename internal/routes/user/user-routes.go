@@ -18,12 +18,57 @@ func InitUserRoutes(r *gin.Engine) {
 		user.POST("/send-code", uc.SendEmailCode)
 		user.POST("/register", uc.Register)
 		user.POST("/login", uc.Login)
+		user.POST("/login/2fa", middleware.RateLimitingMiddleware(), uc.LoginTwoFactor)
+		user.POST("/refresh", middleware.RateLimitingMiddleware(), uc.RefreshToken)
 		user.GET("/logout", middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware(), uc.Logout)
 		user.GET("/get-userinfo", middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware(), uc.GetUserInfo)
-		user.GET("/getall-userinfo", uc.GetAllUsers)
+		user.GET("/getall-userinfo", middleware.AuthMiddleware(), middleware.RequireRole(middleware.RoleAdmin, middleware.PermUserRead), middleware.RateLimitingMiddleware(), uc.GetAllUsers)
 		user.PUT("/update-userinfo", middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware(), uc.UpdateUserInfo)
 		user.POST("/reset-password", middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware(), uc.ResetUserPassword)
 		user.DELETE("/destroy", middleware.AuthMiddleware(), uc.DestroyUser)
 		user.GET("/ws", middleware.RateLimitingMiddleware(), uc.HandleWebSocket)
 	}
+
+	// 当前用户的登录会话
+	session := r.Group("/user/session")
+	session.Use(middleware.AuthMiddleware(), middleware.RateLimitingMiddleware())
+	{
+		session.GET("/query", uc.QuerySessions)
+		session.DELETE("/revoke", uc.RevokeSession)
+		session.DELETE("/revoke-all", uc.RevokeAllSessions)
+	}
+
+	// 当前用户的两步验证
+	twoFactor := r.Group("/user/2fa")
+	twoFactor.Use(middleware.AuthMiddleware(), middleware.RateLimitingMiddleware())
+	{
+		twoFactor.GET("/status", uc.GetTwoFactorStatus)
+		twoFactor.POST("/setup", uc.SetupTwoFactor)
+		twoFactor.POST("/enable", uc.EnableTwoFactor)
+		twoFactor.POST("/disable", uc.DisableTwoFactor)
+		twoFactor.POST("/recovery-codes", uc.RegenerateRecoveryCodes)
+	}
+
+	// 第三方登录与账号绑定
+	oauth := r.Group("/user/oauth")
+	{
+		oauth.GET("/providers", uc.QueryOAuthProviders)
+		oauth.GET("/authorize", middleware.RateLimitingMiddleware(), uc.OAuthAuthorize)
+		oauth.POST("/callback", middleware.RateLimitingMiddleware(), uc.OAuthCallback)
+		oauth.GET("/link", middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), uc.OAuthLink)
+		oauth.POST("/link/callback", middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), uc.OAuthCallback)
+		oauth.GET("/identities", middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), uc.QueryIdentities)
+		oauth.DELETE("/unlink", middleware.AuthMiddleware(), middleware.RateLimitingMiddleware(), uc.UnlinkIdentity)
+	}
+
+	// 角色管理只开放给管理员, 不可授予自定义角色
+	role := r.Group("/user/role")
+	role.Use(middleware.AuthMiddleware(), middleware.RequireRole(middleware.RoleAdmin), middleware.RateLimitingMiddleware(), middleware.DeduplicationMiddleware())
+	{
+		role.GET("/query", uc.QueryRoles)
+		role.POST("/create", uc.CreateRole)
+		role.PUT("/update", uc.UpdateRole)
+		role.DELETE("/delete", uc.DeleteRole)
+		role.PUT("/assign", uc.AssignRole)
+	}
 }
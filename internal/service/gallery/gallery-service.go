@@ -0,0 +1,322 @@
+// Package gallery 画廊服务
+package gallery
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	gallery_dao "github.com/Zhiruosama/ai_nexus/internal/dao/gallery"
+	image_generation_dao "github.com/Zhiruosama/ai_nexus/internal/dao/image-generation"
+	gallery_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/gallery"
+	gallery_dto "github.com/Zhiruosama/ai_nexus/internal/domain/dto/gallery"
+	image_generation_dto "github.com/Zhiruosama/ai_nexus/internal/domain/dto/image-generation"
+	gallery_query "github.com/Zhiruosama/ai_nexus/internal/domain/query/gallery"
+	gallery_vo "github.com/Zhiruosama/ai_nexus/internal/domain/vo/gallery"
+	"github.com/Zhiruosama/ai_nexus/internal/middleware"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/storage"
+	"github.com/gin-gonic/gin"
+)
+
+// maxTitleLen 作品标题最大字符数
+const maxTitleLen = 128
+
+// ErrPostNotFound 作品不存在, 或作者已取消发布、把任务改为私有
+var ErrPostNotFound = errors.New("post does not exist")
+
+// trendingWindows 热门榜单支持的时间窗口
+var trendingWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+}
+
+// DefaultTrendingWindow 未指定时间窗口时使用的默认值
+const DefaultTrendingWindow = "7d"
+
+// Service 画廊服务层
+type Service struct {
+	GalleryDAO         *gallery_dao.DAO
+	ImageGenerationDAO *image_generation_dao.DAO
+}
+
+// NewService 创建 Service 实例
+func NewService() *Service {
+	return &Service{
+		GalleryDAO:         &gallery_dao.DAO{},
+		ImageGenerationDAO: &image_generation_dao.DAO{},
+	}
+}
+
+// ValidTrendingWindow 判断时间窗口是否受支持
+func ValidTrendingWindow(window string) bool {
+	_, ok := trendingWindows[window]
+	return ok
+}
+
+// Publish 发布已完成的任务到画廊, 发布后任务自动公开, 返回作品 ID
+func (s *Service) Publish(ctx *gin.Context, dto *gallery_dto.PublishDTO) (uint64, error) {
+	userUUID := ctx.GetString(middleware.UserIDKey)
+
+	task, err := s.ImageGenerationDAO.GetTaskByID(ctx, dto.TaskID, userUUID)
+	if err != nil {
+		return 0, err
+	}
+	if task == nil {
+		return 0, fmt.Errorf("task_id '%s' does not exist", dto.TaskID)
+	}
+	if task.Status != 3 {
+		return 0, fmt.Errorf("only completed tasks can be published")
+	}
+	if task.PurgedAt != "" {
+		return 0, fmt.Errorf("images of this task have expired")
+	}
+
+	if err = moderatePost(dto.Title, task.Prompt, task.NegativePrompt); err != nil {
+		return 0, err
+	}
+
+	existing, err := s.GalleryDAO.GetPostByTaskID(ctx, dto.TaskID)
+	if err != nil {
+		return 0, err
+	}
+	if existing != nil {
+		return 0, fmt.Errorf("task_id '%s' has already been published", dto.TaskID)
+	}
+
+	return s.GalleryDAO.CreatePost(ctx, &gallery_do.TableGalleryPostDO{
+		TaskID:   dto.TaskID,
+		UserUUID: userUUID,
+		Title:    dto.Title,
+	})
+}
+
+// Unpublish 取消发布, 任务的公开状态不变
+func (s *Service) Unpublish(ctx *gin.Context, postID uint64) error {
+	deleted, err := s.GalleryDAO.DeletePost(ctx, postID, ctx.GetString(middleware.UserIDKey))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// GetPost 获取作品详情
+func (s *Service) GetPost(ctx *gin.Context, postID uint64) (*gallery_vo.PostVO, error) {
+	post, err := s.GalleryDAO.GetPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, ErrPostNotFound
+	}
+
+	posts, err := s.toPostVOs(ctx, []*gallery_do.GalleryPostDetailDO{post})
+	if err != nil {
+		return nil, err
+	}
+	return posts[0], nil
+}
+
+// QueryLatest 最新发布的作品
+func (s *Service) QueryLatest(ctx *gin.Context, query *gallery_query.FeedQuery) ([]*gallery_vo.PostVO, int64, error) {
+	posts, total, err := s.GalleryDAO.QueryLatestPosts(ctx, query.PageIndex*query.PageSize, query.PageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	vos, err := s.toPostVOs(ctx, posts)
+	return vos, total, err
+}
+
+// QueryTrending 时间窗口内点赞最多的作品
+func (s *Service) QueryTrending(ctx *gin.Context, query *gallery_query.FeedQuery) ([]*gallery_vo.PostVO, int64, error) {
+	window, ok := trendingWindows[query.Window]
+	if !ok {
+		window = trendingWindows[DefaultTrendingWindow]
+	}
+
+	posts, total, err := s.GalleryDAO.QueryTrendingPosts(ctx, time.Now().Add(-window), query.PageIndex*query.PageSize, query.PageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	vos, err := s.toPostVOs(ctx, posts)
+	return vos, total, err
+}
+
+// QueryFavorites 当前用户收藏的作品
+func (s *Service) QueryFavorites(ctx *gin.Context, query *gallery_query.FeedQuery) ([]*gallery_vo.PostVO, int64, error) {
+	posts, total, err := s.GalleryDAO.QueryFavoritePosts(ctx, ctx.GetString(middleware.UserIDKey), query.PageIndex*query.PageSize, query.PageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	vos, err := s.toPostVOs(ctx, posts)
+	return vos, total, err
+}
+
+// Like 点赞, 重复点赞不报错
+func (s *Service) Like(ctx *gin.Context, postID uint64) error {
+	if err := s.ensureVisible(ctx, postID); err != nil {
+		return err
+	}
+	_, err := s.GalleryDAO.LikePost(ctx, postID, ctx.GetString(middleware.UserIDKey))
+	return err
+}
+
+// Unlike 取消点赞, 作品已隐藏时也允许取消
+func (s *Service) Unlike(ctx *gin.Context, postID uint64) error {
+	_, err := s.GalleryDAO.UnlikePost(ctx, postID, ctx.GetString(middleware.UserIDKey))
+	return err
+}
+
+// Favorite 收藏, 重复收藏不报错
+func (s *Service) Favorite(ctx *gin.Context, postID uint64) error {
+	if err := s.ensureVisible(ctx, postID); err != nil {
+		return err
+	}
+	_, err := s.GalleryDAO.FavoritePost(ctx, postID, ctx.GetString(middleware.UserIDKey))
+	return err
+}
+
+// Unfavorite 取消收藏, 作品已隐藏时也允许取消
+func (s *Service) Unfavorite(ctx *gin.Context, postID uint64) error {
+	_, err := s.GalleryDAO.UnfavoritePost(ctx, postID, ctx.GetString(middleware.UserIDKey))
+	return err
+}
+
+// Remix 返回以作品生成参数预填的文生图请求, 前端据此打开新的文生图表单, 提交仍走 /image/text2img
+func (s *Service) Remix(ctx *gin.Context, postID uint64) (*image_generation_dto.Text2ImgDTO, error) {
+	post, err := s.GalleryDAO.GetPost(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, ErrPostNotFound
+	}
+
+	if err = s.GalleryDAO.IncrementRemixCount(ctx, postID); err != nil {
+		return nil, err
+	}
+
+	return &image_generation_dto.Text2ImgDTO{
+		Prompt:            post.Prompt,
+		NegativePrompt:    post.NegativePrompt,
+		ModelID:           post.ModelID,
+		Width:             post.Width,
+		Height:            post.Height,
+		NumInferenceSteps: post.NumInferenceSteps,
+		GuidanceScale:     post.GuidanceScale,
+		Seed:              postSeed(post),
+		NumImages:         post.NumImages,
+		Sampler:           post.Sampler,
+	}, nil
+}
+
+// ensureVisible 只允许对画廊中可见的作品点赞与收藏
+func (s *Service) ensureVisible(ctx *gin.Context, postID uint64) error {
+	post, err := s.GalleryDAO.GetPost(ctx, postID)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// toPostVOs 补全作品图片地址与当前用户的点赞收藏状态
+func (s *Service) toPostVOs(ctx *gin.Context, posts []*gallery_do.GalleryPostDetailDO) ([]*gallery_vo.PostVO, error) {
+	vos := make([]*gallery_vo.PostVO, 0, len(posts))
+	if len(posts) == 0 {
+		return vos, nil
+	}
+
+	taskIDs := make([]string, 0, len(posts))
+	postIDs := make([]uint64, 0, len(posts))
+	for _, post := range posts {
+		taskIDs = append(taskIDs, post.TaskID)
+		postIDs = append(postIDs, post.ID)
+	}
+
+	outputs, err := s.ImageGenerationDAO.GetOutputsByTaskIDs(ctx, taskIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	liked, favorited, err := s.GalleryDAO.GetUserReactions(ctx, ctx.GetString(middleware.UserIDKey), postIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, post := range posts {
+		// 作品都已公开, 使用无需签名的文件地址; 有后处理结果时展示后处理图
+		images := make([]string, 0, len(outputs[post.TaskID]))
+		for _, output := range outputs[post.TaskID] {
+			imageURL := output.ImageURL
+			if output.ProcessedURL != "" {
+				imageURL = output.ProcessedURL
+			}
+			images = append(images, storage.PublicFileURL(imageURL))
+		}
+		if len(images) == 0 && post.OutputImageURL != "" {
+			images = append(images, storage.PublicFileURL(post.OutputImageURL))
+		}
+
+		vos = append(vos, &gallery_vo.PostVO{
+			ID:                post.ID,
+			Title:             post.Title,
+			Images:            images,
+			Nickname:          post.Nickname,
+			Avatar:            post.Avatar,
+			TaskType:          post.TaskType,
+			Prompt:            post.Prompt,
+			NegativePrompt:    post.NegativePrompt,
+			ModelID:           post.ModelID,
+			Width:             post.Width,
+			Height:            post.Height,
+			NumInferenceSteps: post.NumInferenceSteps,
+			GuidanceScale:     post.GuidanceScale,
+			Seed:              postSeed(post),
+			Sampler:           post.Sampler,
+			Strength:          post.Strength,
+			LikeCount:         post.LikeCount,
+			FavoriteCount:     post.FavoriteCount,
+			RemixCount:        post.RemixCount,
+			RecentLikes:       post.RecentLikes,
+			Liked:             liked[post.ID],
+			Favorited:         favorited[post.ID],
+			CreatedAt:         post.CreatedAt,
+		})
+	}
+	return vos, nil
+}
+
+// moderatePost 发布前的内容审核, 标题与正反向提示词都要通过违禁词检查
+func moderatePost(title, prompt, negativePrompt string) error {
+	if len([]rune(title)) > maxTitleLen {
+		return fmt.Errorf("title must be at most %d characters", maxTitleLen)
+	}
+
+	for _, text := range []string{title, prompt, negativePrompt} {
+		if text == "" {
+			continue
+		}
+		if err := pkg.ValidatePrompt(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postSeed 优先展示实际使用的种子, 随机种子任务也能复现
+func postSeed(post *gallery_do.GalleryPostDetailDO) int64 {
+	if post.ActualSeed != 0 {
+		return post.ActualSeed
+	}
+	return post.Seed
+}
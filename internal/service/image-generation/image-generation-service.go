@@ -5,37 +5,120 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"image"
 	"io"
-	"net/url"
+	"math"
+	"mime/multipart"
 	"os"
+	"path"
 	"path/filepath"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/Zhiruosama/ai_nexus/configs"
+	chat_dao "github.com/Zhiruosama/ai_nexus/internal/dao/chat"
 	image_generation_dao "github.com/Zhiruosama/ai_nexus/internal/dao/image-generation"
 	image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
 	image_generation_dto "github.com/Zhiruosama/ai_nexus/internal/domain/dto/image-generation"
 	image_generation_query "github.com/Zhiruosama/ai_nexus/internal/domain/query/image-generation"
+	image_generation_vo "github.com/Zhiruosama/ai_nexus/internal/domain/vo/image-generation"
+	"github.com/Zhiruosama/ai_nexus/internal/middleware"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/chat"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/logger"
 	rabbitmq "github.com/Zhiruosama/ai_nexus/internal/pkg/queue"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/storage"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/third"
+	ws "github.com/Zhiruosama/ai_nexus/internal/pkg/ws"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// ErrTooManyInFlight 用户未完成的任务数已达上限
+var ErrTooManyInFlight = errors.New("too many unfinished tasks")
+
+// ErrPriorityNotAllowed 当前用户的等级与角色不能使用 high 优先级
+var ErrPriorityNotAllowed = errors.New("high priority is not available for this account")
+
+// ErrInvalidImage 上传的原图或蒙版不符合要求
+var ErrInvalidImage = errors.New("invalid image")
+
+// ErrInvalidPostProcess 后处理配置不合法
+var ErrInvalidPostProcess = errors.New("invalid post_process")
+
+// ErrImageNotFound 图片不存在
+var ErrImageNotFound = errors.New("image not found")
+
+// ErrImageForbidden 签名无效或过期, 或图片未公开且不属于当前用户
+var ErrImageForbidden = errors.New("image access denied")
+
+// ErrInvalidEnhance 提示词扩写配置不合法, 或扩写结果未通过内容审核
+var ErrInvalidEnhance = errors.New("invalid enhance_prompt")
+
+// ErrEnhanceFailed 调用对话模型扩写提示词失败
+var ErrEnhanceFailed = errors.New("prompt enhancement failed")
+
+// ErrModelUnavailable 模型已被管理员停用或被健康检查自动停用
+var ErrModelUnavailable = errors.New("model is unavailable")
+
+// ErrInvalidParams 生成参数超出模型允许的范围
+var ErrInvalidParams = errors.New("invalid generation parameters")
+
+const (
+	// outpaintOverlap 扩图时向原图内收的接缝宽度, 让新增区域与原图自然衔接
+	outpaintOverlap = 8
+	// defaultMaxCanvasSize 模型未配置最大宽高时允许的画布边长
+	defaultMaxCanvasSize = 2048
+	// defaultCanvasSize 模型未配置默认宽高时使用的画布边长
+	defaultCanvasSize = 512
+	// defaultInferenceSteps 未指定推理步数时的默认值, 会被限制在模型的步数范围内
+	defaultInferenceSteps = 20
+	// defaultMaxInFlightPerUser 未配置 imagegen.maxinflightperuser 时每个用户未完成任务的上限
+	defaultMaxInFlightPerUser = 20
+	// aspectRatioTolerance 宽高比允许的相对误差, 上游通常要求宽高为 8 或 64 的倍数, 无法精确等于比例
+	aspectRatioTolerance = 0.02
+	// defaultMaxProcessedSize 未配置 imagegen.maxprocessedsize 时后处理输出的最大边长
+	defaultMaxProcessedSize = 4096
+	// maxMetadataImageSize 读取元数据时允许上传的图片大小
+	maxMetadataImageSize = 20 << 20
+	// enhanceTimeout 扩写提示词的超时时间, 任务提交会同步等待
+	enhanceTimeout = 30 * time.Second
+	// maxEnhancedPromptLen 扩写结果的最大字符数
+	maxEnhancedPromptLen = 2000
+	// defaultHealthWindow 未配置 health.window 时健康统计的窗口
+	defaultHealthWindow = 15 * time.Minute
+)
+
+// enhanceSystemPrompt 提示词扩写的系统预设
+const enhanceSystemPrompt = `You are a prompt engineer for text-to-image diffusion models.
+Expand the user's image prompt into a single detailed prompt: keep the original subject and intent,
+add concrete details about composition, lighting, style, color and quality.
+Reply with the expanded prompt only, in the same language as the input, without quotes, explanations or line breaks.`
+
 // Service 对应 imagegeneration 模块的 Service 结构
 type Service struct {
 	ImageGenerationDAO *image_generation_dao.DAO
+	ChatDAO            *chat_dao.DAO
 }
 
 // NewService 对应 imagegeneration 模块的 Service 工厂方法
 func NewService() *Service {
 	return &Service{
 		ImageGenerationDAO: &image_generation_dao.DAO{},
+		ChatDAO:            &chat_dao.DAO{},
 	}
 }
 
+// SupportedModelTypes 返回模型可选的类型, 与四种任务类型一一对应
+func SupportedModelTypes() []string {
+	return []string{"text2img", "img2img", "inpaint", "outpaint"}
+}
+
 // CreateModel 创建模型
 func (s *Service) CreateModel(ctx *gin.Context, dto *image_generation_dto.ModelCreateDTO) error {
 	// 唯一性检验
@@ -65,6 +148,20 @@ func (s *Service) CreateModel(ctx *gin.Context, dto *image_generation_dto.ModelC
 		MaxHeight:         dto.MaxHeight,
 		MinSteps:          dto.MinSteps,
 		MaxSteps:          dto.MaxSteps,
+		MaxNumImages:      dto.MaxNumImages,
+		CredentialID:      dto.CredentialID,
+	}
+
+	capabilities, err := buildCapabilities(dto.Capabilities)
+	if err != nil {
+		return err
+	}
+	model.Capabilities = capabilities
+
+	if dto.CredentialID != 0 {
+		if err := s.checkCredential(dto.Provider, dto.CredentialID, ""); err != nil {
+			return err
+		}
 	}
 
 	if err := s.ImageGenerationDAO.CreateModel(ctx, model); err != nil {
@@ -118,13 +215,16 @@ func (s *Service) UpdateModel(ctx *gin.Context, dto *image_generation_dto.ModelU
 	}
 
 	if dto.ModelType != nil {
-		if *dto.ModelType != "text2img" && *dto.ModelType != "img2img" {
-			return fmt.Errorf("model_type must be either 'text2img' or 'img2img'")
+		if !slices.Contains(SupportedModelTypes(), *dto.ModelType) {
+			return fmt.Errorf("model_type must be one of %s", strings.Join(SupportedModelTypes(), ", "))
 		}
 		updates["model_type"] = *dto.ModelType
 	}
 
 	if dto.Provider != nil {
+		if !slices.Contains(third.SupportedProviders(), *dto.Provider) {
+			return fmt.Errorf("provider must be one of %s", strings.Join(third.SupportedProviders(), ", "))
+		}
 		updates["provider"] = *dto.Provider
 	}
 
@@ -140,8 +240,14 @@ func (s *Service) UpdateModel(ctx *gin.Context, dto *image_generation_dto.ModelU
 		updates["sort_order"] = *dto.SortOrder
 	}
 
+	// 手动启停后不再由健康检查接管, 重新启用时健康统计从此刻重新开始
 	if dto.IsActive != nil {
 		updates["is_active"] = *dto.IsActive
+		updates["auto_disabled_at"] = nil
+		updates["disabled_reason"] = ""
+		if *dto.IsActive {
+			updates["health_reset_at"] = time.Now()
+		}
 	}
 
 	if dto.IsRecommended != nil {
@@ -180,6 +286,36 @@ func (s *Service) UpdateModel(ctx *gin.Context, dto *image_generation_dto.ModelU
 		updates["max_steps"] = *dto.MaxSteps
 	}
 
+	if dto.MaxNumImages != nil {
+		updates["max_num_images"] = *dto.MaxNumImages
+	}
+
+	// capabilities 传空对象表示取消限制
+	if dto.Capabilities != nil {
+		capabilities, err := buildCapabilities(dto.Capabilities)
+		if err != nil {
+			return err
+		}
+		updates["capabilities"] = image_generation_dao.NullableJSON(capabilities)
+	}
+
+	// credential_id 传 0 表示解除绑定, 回退到环境变量
+	if dto.CredentialID != nil {
+		if *dto.CredentialID != 0 {
+			provider, err := image_generation_dao.GetInfoFromModel[string](s.ImageGenerationDAO, "provider", dto.ModelID)
+			if err != nil {
+				return err
+			}
+			if dto.Provider != nil {
+				provider = *dto.Provider
+			}
+			if err := s.checkCredential(provider, *dto.CredentialID, ""); err != nil {
+				return err
+			}
+		}
+		updates["credential_id"] = image_generation_dao.NullableID(*dto.CredentialID)
+	}
+
 	if len(updates) == 0 {
 		return fmt.Errorf("no fields to update")
 	}
@@ -193,6 +329,9 @@ func (s *Service) UpdateModel(ctx *gin.Context, dto *image_generation_dto.ModelU
 	if dto.MinSteps != nil && dto.MaxSteps != nil && *dto.MinSteps > *dto.MaxSteps {
 		return fmt.Errorf("min_steps must not be greater than max_steps")
 	}
+	if dto.MaxNumImages != nil && (*dto.MaxNumImages < 1 || *dto.MaxNumImages > 10) {
+		return fmt.Errorf("max_num_images must be between 1 and 10")
+	}
 
 	if err := s.ImageGenerationDAO.UpdateModel(ctx, dto.ModelID, updates); err != nil {
 		return err
@@ -201,6 +340,56 @@ func (s *Service) UpdateModel(ctx *gin.Context, dto *image_generation_dto.ModelU
 	return nil
 }
 
+// GetModelHealth 获取模型在统计窗口内的健康状态, modelID 为空时返回全部模型
+func (s *Service) GetModelHealth(ctx *gin.Context, modelID string) ([]*image_generation_vo.ModelHealthVO, error) {
+	var models []*image_generation_do.TableImageGenerationModelsDO
+	if modelID != "" {
+		model, err := s.GetModelInfo(ctx, modelID)
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, model)
+	} else {
+		var err error
+		if models, err = s.ImageGenerationDAO.ListModels(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	window := configs.GlobalConfig.Health.Window
+	if window <= 0 {
+		window = defaultHealthWindow
+	}
+	since := time.Now().Add(-window)
+
+	vos := make([]*image_generation_vo.ModelHealthVO, 0, len(models))
+	for _, model := range models {
+		events, err := s.ImageGenerationDAO.ListModelHealthEvents(model.ModelID, since)
+		if err != nil {
+			return nil, err
+		}
+		stats := third.SummarizeHealth(events)
+
+		vos = append(vos, &image_generation_vo.ModelHealthVO{
+			ModelID:        model.ModelID,
+			IsActive:       model.IsActive,
+			AutoDisabledAt: model.AutoDisabledAt,
+			DisabledReason: model.DisabledReason,
+			LastProbeAt:    model.LastProbeAt,
+			Window:         window.String(),
+			Samples:        stats.Samples,
+			Successes:      stats.Successes,
+			Failures:       stats.Failures,
+			CallerErrors:   stats.CallerErrors,
+			SuccessRate:    stats.SuccessRate,
+			P50Ms:          stats.P50Ms,
+			P95Ms:          stats.P95Ms,
+			ErrorClasses:   stats.ErrorClasses,
+		})
+	}
+	return vos, nil
+}
+
 // QueryModels 根据具体信息查询模型列表
 func (s *Service) QueryModels(ctx *gin.Context, query *image_generation_query.ModelsQuery) ([]*image_generation_do.TableImageGenerationModelsDO, int64, error) {
 	models, total, err := s.ImageGenerationDAO.QueryModels(ctx, query)
@@ -225,28 +414,50 @@ func (s *Service) Text2Img(ctx *gin.Context, dto *image_generation_dto.Text2ImgD
 		return "", fmt.Errorf("model_id '%s' does not exist", dto.ModelID)
 	}
 
+	if err := s.checkModelAvailable(dto.ModelID); err != nil {
+		return "", err
+	}
+
+	if err := s.checkNumImages(dto.ModelID, dto.NumImages); err != nil {
+		return "", err
+	}
+
+	if err := s.applyModelParams(ctx, dto.ModelID, &dto.Width, &dto.Height, &dto.NumInferenceSteps, &dto.Sampler); err != nil {
+		return "", err
+	}
+
+	postProcess, err := buildPostProcess(dto.PostProcess)
+	if err != nil {
+		return "", err
+	}
+
 	taskID := uuid.New().String()
 	uuid, _ := ctx.Get("user_id")
 
-	do := image_generation_do.TableImageGenerationTaskDO{
-		TaskID:            taskID,
-		UserUUID:          uuid.(string),
-		TaskType:          1,
-		Status:            0,
-		Prompt:            dto.Prompt,
-		NegativePrompt:    dto.NegativePrompt,
-		ModelID:           dto.ModelID,
-		Width:             dto.Width,
-		Height:            dto.Height,
-		NumInferenceSteps: dto.NumInferenceSteps,
-		GuidanceScale:     dto.GuidanceScale,
-		Seed:              dto.Seed,
+	if dto.CredentialID != 0 {
+		provider, err := image_generation_dao.GetInfoFromModel[string](s.ImageGenerationDAO, "provider", dto.ModelID)
+		if err != nil {
+			return "", err
+		}
+		if err := s.checkCredential(provider, dto.CredentialID, uuid.(string)); err != nil {
+			return "", err
+		}
 	}
 
-	if err := s.ImageGenerationDAO.CreateText2ImgTask(ctx, &do); err != nil {
+	priority, err := s.schedulePriority(ctx, uuid.(string), dto.Priority)
+	if err != nil {
 		return "", err
 	}
 
+	originalPrompt := ""
+	if dto.EnhancePrompt != nil {
+		enhanced, err := s.enhancePrompt(ctx, uuid.(string), dto.Prompt, dto.EnhancePrompt)
+		if err != nil {
+			return "", err
+		}
+		originalPrompt, dto.Prompt = dto.Prompt, enhanced
+	}
+
 	message := rabbitmq.TaskMessage{
 		TaskID:   taskID,
 		UserUUID: uuid.(string),
@@ -259,32 +470,49 @@ func (s *Service) Text2Img(ctx *gin.Context, dto *image_generation_dto.Text2ImgD
 			NumInferenceSteps: dto.NumInferenceSteps,
 			GuidanceScale:     dto.GuidanceScale,
 			Seed:              dto.Seed,
+			NumImages:         dto.NumImages,
+			Sampler:           dto.Sampler,
+			CredentialID:      dto.CredentialID,
 		},
+		Priority: priority,
 	}
 
-	c, cancel := context.WithTimeout(context.Background(), time.Second*3)
-	defer cancel()
-
-	if err := rabbitmq.Publish(c, 1, &message); err != nil {
-		logger.Error(ctx, "Publish to mq error(text2img): %s", err.Error())
-
-		errs := s.ImageGenerationDAO.DeleteTask(ctx, taskID)
-		if errs != nil {
-			logger.Error(ctx, "DeleteTask error: %s", errs.Error())
-		}
-
+	body, err := json.Marshal(&message)
+	if err != nil {
 		return "", err
 	}
 
-	now := time.Now()
-	mysqlDatetime := now.Format("2006-01-02 15:04:05")
-	if err := s.ImageGenerationDAO.UpdateTaskParams("queued_at", mysqlDatetime, taskID); err != nil {
-		return "", err
+	do := image_generation_do.TableImageGenerationTaskDO{
+		TaskID:            taskID,
+		UserUUID:          uuid.(string),
+		TaskType:          1,
+		Status:            1,
+		Prompt:            dto.Prompt,
+		OriginalPrompt:    originalPrompt,
+		NegativePrompt:    dto.NegativePrompt,
+		ModelID:           dto.ModelID,
+		Width:             dto.Width,
+		Height:            dto.Height,
+		NumInferenceSteps: dto.NumInferenceSteps,
+		GuidanceScale:     dto.GuidanceScale,
+		Seed:              dto.Seed,
+		NumImages:         dto.NumImages,
+		Sampler:           dto.Sampler,
+		CredentialID:      dto.CredentialID,
+		Priority:          int8(priority),
+		PostProcess:       postProcess,
 	}
 
-	if err := s.ImageGenerationDAO.UpdateTaskParams("status", 1, taskID); err != nil {
+	// 任务与队列消息同一事务落库, 由 outbox relay 投递到 RabbitMQ
+	created, err := s.ImageGenerationDAO.CreateText2ImgTask(ctx, &do, body, maxInFlightPerUser())
+	if err != nil {
 		return "", err
 	}
+	if !created {
+		return "", errTooManyInFlight()
+	}
+
+	s.notifyQueued(ctx, taskID, uuid.(string), priority)
 
 	return taskID, nil
 }
@@ -299,70 +527,99 @@ func (s *Service) Img2Img(ctx *gin.Context, dto *image_generation_dto.Img2ImgDTO
 		return "", fmt.Errorf("model_id '%s' does not exist", dto.ModelID)
 	}
 
-	taskID := uuid.New().String()
-	uuid, _ := ctx.Get("user_id")
-
-	// 落盘
-	ext := filepath.Ext(dto.InputImage.Filename)
-	allowedExts := []string{".png", ".jpg", ".jpeg", ".webp"}
-	isValid := slices.Contains(allowedExts, ext)
-	if !isValid {
-		return "", fmt.Errorf("unsupported file format: %s", ext)
+	if err := s.checkModelAvailable(dto.ModelID); err != nil {
+		return "", err
 	}
 
-	if err = os.MkdirAll(filepath.Join("static", "images"), 0755); err != nil {
+	if err := s.checkNumImages(dto.ModelID, dto.NumImages); err != nil {
 		return "", err
 	}
 
-	filename := "img2img-" + taskID + ext
-	dst := filepath.Join("static", "images", filename)
+	if err := s.applyModelParams(ctx, dto.ModelID, &dto.Width, &dto.Height, &dto.NumInferenceSteps, &dto.Sampler); err != nil {
+		return "", err
+	}
 
-	if err = ctx.SaveUploadedFile(dto.InputImage, dst); err != nil {
+	postProcess, err := parsePostProcessForm(dto.PostProcess)
+	if err != nil {
 		return "", err
 	}
 
-	// 落盘后进行校验
-	file, err := os.Open(dst)
+	enhance, err := parseEnhancePromptForm(dto.EnhancePrompt)
 	if err != nil {
-		errs := os.Remove(dst)
-		if errs != nil {
-			logger.Error(ctx, "Remove uploaded file error: %s", errs.Error())
-		}
 		return "", err
 	}
-	defer func() {
-		if closeErr := file.Close(); closeErr != nil {
-			logger.Error(ctx, "Close uploaded file error: %s", closeErr.Error())
-		}
-	}()
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		logger.Error(ctx, "calcute sha256 error: %s", err.Error())
-		errs := os.Remove(dst)
-		if errs != nil {
-			logger.Error(ctx, "Remove uploaded file error: %s", errs.Error())
+	taskID := uuid.New().String()
+	uuid, _ := ctx.Get("user_id")
+
+	if dto.CredentialID != 0 {
+		provider, err := image_generation_dao.GetInfoFromModel[string](s.ImageGenerationDAO, "provider", dto.ModelID)
+		if err != nil {
+			return "", err
+		}
+		if err := s.checkCredential(provider, dto.CredentialID, uuid.(string)); err != nil {
+			return "", err
 		}
+	}
+
+	priority, err := s.schedulePriority(ctx, uuid.(string), dto.Priority)
+	if err != nil {
 		return "", err
 	}
 
-	calculatedHash := hex.EncodeToString(hash.Sum(nil))
-	if calculatedHash != dto.Sha256 {
-		errs := os.Remove(dst)
-		if errs != nil {
-			logger.Error(ctx, "Remove uploaded file error: %s", errs.Error())
+	originalPrompt := ""
+	if enhance != nil {
+		enhanced, err := s.enhancePrompt(ctx, uuid.(string), dto.Prompt, enhance)
+		if err != nil {
+			return "", err
 		}
-		return "", fmt.Errorf("the file destroyed")
+		originalPrompt, dto.Prompt = dto.Prompt, enhanced
+	}
+
+	dst, err := s.saveUploadedImage(ctx, dto.InputImage, "img2img-"+taskID, dto.Sha256)
+	if err != nil {
+		return "", err
+	}
+
+	urls, err := storeTaskImages(ctx, dst)
+	if err != nil {
+		return "", err
 	}
+	inputImageURL := urls[0]
 
-	inputImageURL := fmt.Sprintf("http://%s/static/images/%s", configs.GlobalConfig.Server.SerialStringPublic(), filename)
+	message := rabbitmq.TaskMessage{
+		TaskID:   taskID,
+		UserUUID: uuid.(string),
+		Payload: rabbitmq.Img2ImgPayload{
+			Prompt:            dto.Prompt,
+			NegativePrompt:    dto.NegativePrompt,
+			ModelID:           dto.ModelID,
+			Width:             dto.Width,
+			Height:            dto.Height,
+			NumInferenceSteps: dto.NumInferenceSteps,
+			GuidanceScale:     dto.GuidanceScale,
+			Seed:              dto.Seed,
+			InputImageURL:     inputImageURL,
+			Strength:          dto.Strength,
+			NumImages:         dto.NumImages,
+			Sampler:           dto.Sampler,
+			CredentialID:      dto.CredentialID,
+		},
+		Priority: priority,
+	}
+
+	body, err := json.Marshal(&message)
+	if err != nil {
+		return "", err
+	}
 
 	do := image_generation_do.TableImageGenerationTaskDO{
 		TaskID:            taskID,
 		UserUUID:          uuid.(string),
 		TaskType:          2,
-		Status:            0,
+		Status:            1,
 		Prompt:            dto.Prompt,
+		OriginalPrompt:    originalPrompt,
 		NegativePrompt:    dto.NegativePrompt,
 		ModelID:           dto.ModelID,
 		Width:             dto.Width,
@@ -372,93 +629,1330 @@ func (s *Service) Img2Img(ctx *gin.Context, dto *image_generation_dto.Img2ImgDTO
 		Seed:              dto.Seed,
 		InputImageURL:     inputImageURL,
 		Strength:          dto.Strength,
+		NumImages:         dto.NumImages,
+		Sampler:           dto.Sampler,
+		CredentialID:      dto.CredentialID,
+		Priority:          int8(priority),
+		PostProcess:       postProcess,
+	}
+
+	// 任务与队列消息同一事务落库, 由 outbox relay 投递到 RabbitMQ
+	created, err := s.ImageGenerationDAO.CreateImg2ImgTask(ctx, &do, body, maxInFlightPerUser())
+	if err != nil || !created {
+		removeStoredImages(ctx, inputImageURL)
+		if err != nil {
+			return "", err
+		}
+		return "", errTooManyInFlight()
+	}
+
+	s.notifyQueued(ctx, taskID, uuid.(string), priority)
+
+	return taskID, nil
+}
+
+// Inpaint 局部重绘, 原图与蒙版落盘校验后创建任务
+func (s *Service) Inpaint(ctx *gin.Context, dto *image_generation_dto.InpaintDTO) (string, error) {
+	ok, err := s.ImageGenerationDAO.CheckModelExists(ctx, dto.ModelID)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("model_id '%s' does not exist", dto.ModelID)
+	}
+
+	if err := s.checkModelAvailable(dto.ModelID); err != nil {
+		return "", err
+	}
+
+	if err := s.checkNumImages(dto.ModelID, dto.NumImages); err != nil {
+		return "", err
+	}
+
+	postProcess, err := parsePostProcessForm(dto.PostProcess)
+	if err != nil {
+		return "", err
+	}
+
+	taskID := uuid.New().String()
+	uuid, _ := ctx.Get("user_id")
+
+	if dto.CredentialID != 0 {
+		provider, err := image_generation_dao.GetInfoFromModel[string](s.ImageGenerationDAO, "provider", dto.ModelID)
+		if err != nil {
+			return "", err
+		}
+		if err := s.checkCredential(provider, dto.CredentialID, uuid.(string)); err != nil {
+			return "", err
+		}
+	}
+
+	priority, err := s.schedulePriority(ctx, uuid.(string), dto.Priority)
+	if err != nil {
+		return "", err
+	}
+
+	inputDst, err := s.saveUploadedImage(ctx, dto.InputImage, "inpaint-"+taskID, dto.Sha256)
+	if err != nil {
+		return "", err
+	}
+	maskDst, err := s.saveUploadedImage(ctx, dto.MaskImage, "inpaint-mask-"+taskID, dto.MaskSha256)
+	if err != nil {
+		removeFiles(ctx, inputDst)
+		return "", err
+	}
+
+	// 蒙版必须与原图逐像素对应
+	width, height, err := s.checkMaskSize(inputDst, maskDst)
+	if err == nil {
+		err = s.checkCanvasSize(dto.ModelID, width, height)
+	}
+	if err == nil {
+		err = s.applyMaskedModelParams(ctx, dto.ModelID, width, height, &dto.NumInferenceSteps)
+	}
+	if err != nil {
+		removeFiles(ctx, inputDst, maskDst)
+		return "", err
 	}
 
-	if err := s.ImageGenerationDAO.CreateImg2ImgTask(ctx, &do); err != nil {
+	urls, err := storeTaskImages(ctx, inputDst, maskDst)
+	if err != nil {
 		return "", err
 	}
+	inputImageURL, maskImageURL := urls[0], urls[1]
 
 	message := rabbitmq.TaskMessage{
 		TaskID:   taskID,
 		UserUUID: uuid.(string),
-		Payload: rabbitmq.Img2ImgPayload{
+		Payload: rabbitmq.InpaintPayload{
 			Prompt:            dto.Prompt,
 			NegativePrompt:    dto.NegativePrompt,
 			ModelID:           dto.ModelID,
-			Width:             dto.Width,
-			Height:            dto.Height,
+			Width:             width,
+			Height:            height,
 			NumInferenceSteps: dto.NumInferenceSteps,
 			GuidanceScale:     dto.GuidanceScale,
 			Seed:              dto.Seed,
 			InputImageURL:     inputImageURL,
+			MaskImageURL:      maskImageURL,
 			Strength:          dto.Strength,
+			NumImages:         dto.NumImages,
+			CredentialID:      dto.CredentialID,
 		},
+		Priority: priority,
 	}
 
-	c, cancel := context.WithTimeout(context.Background(), time.Second*3)
-	defer cancel()
-
-	if err := rabbitmq.Publish(c, 2, &message); err != nil {
-		logger.Error(ctx, "Publish to mq error(img2img): %s", err.Error())
-
-		errs := s.ImageGenerationDAO.DeleteTask(ctx, taskID)
-		if errs != nil {
-			logger.Error(ctx, "DeleteTask error: %s", errs.Error())
-		}
-
+	body, err := json.Marshal(&message)
+	if err != nil {
+		removeStoredImages(ctx, inputImageURL, maskImageURL)
 		return "", err
 	}
 
-	now := time.Now()
-	mysqlDatetime := now.Format("2006-01-02 15:04:05")
-	if err := s.ImageGenerationDAO.UpdateTaskParams("queued_at", mysqlDatetime, taskID); err != nil {
-		return "", err
+	do := image_generation_do.TableImageGenerationTaskDO{
+		TaskID:            taskID,
+		UserUUID:          uuid.(string),
+		TaskType:          3,
+		Status:            1,
+		Prompt:            dto.Prompt,
+		NegativePrompt:    dto.NegativePrompt,
+		ModelID:           dto.ModelID,
+		Width:             width,
+		Height:            height,
+		NumInferenceSteps: dto.NumInferenceSteps,
+		GuidanceScale:     dto.GuidanceScale,
+		Seed:              dto.Seed,
+		InputImageURL:     inputImageURL,
+		Strength:          dto.Strength,
+		MaskImageURL:      maskImageURL,
+		NumImages:         dto.NumImages,
+		CredentialID:      dto.CredentialID,
+		Priority:          int8(priority),
+		PostProcess:       postProcess,
 	}
-	if err := s.ImageGenerationDAO.UpdateTaskParams("status", 1, taskID); err != nil {
-		return "", err
+
+	created, err := s.ImageGenerationDAO.CreateMaskedTask(ctx, &do, body, maxInFlightPerUser())
+	if err != nil || !created {
+		removeStoredImages(ctx, inputImageURL, maskImageURL)
+		if err != nil {
+			return "", err
+		}
+		return "", errTooManyInFlight()
 	}
 
+	s.notifyQueued(ctx, taskID, uuid.(string), priority)
+
 	return taskID, nil
 }
 
-// CancelTask 取消任务
-func (s *Service) CancelTask(ctx *gin.Context, taskID string) error {
-	ok, err := s.ImageGenerationDAO.CheckTaskExists(ctx, taskID)
+// Outpaint 扩图, 服务端生成扩展后的画布与蒙版, 上游按局部重绘处理
+func (s *Service) Outpaint(ctx *gin.Context, dto *image_generation_dto.OutpaintDTO) (string, error) {
+	ok, err := s.ImageGenerationDAO.CheckModelExists(ctx, dto.ModelID)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if !ok {
-		return fmt.Errorf("task_id '%s' does not exist", taskID)
+		return "", fmt.Errorf("model_id '%s' does not exist", dto.ModelID)
+	}
+
+	if err := s.checkModelAvailable(dto.ModelID); err != nil {
+		return "", err
 	}
 
-	// 如果是img2img任务 则删除前面保存到服务器里的图片
-	taskType, err := image_generation_dao.GetTaskInfo[int8](s.ImageGenerationDAO, "task_type", taskID)
+	if err := s.checkNumImages(dto.ModelID, dto.NumImages); err != nil {
+		return "", err
+	}
+
+	postProcess, err := parsePostProcessForm(dto.PostProcess)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	if taskType == 2 {
-		inputURL, err := image_generation_dao.GetTaskInfo[string](s.ImageGenerationDAO, "input_image_url", taskID)
-		if err == nil && inputURL != "" {
-			u, err := url.Parse(inputURL)
-			if err != nil {
-				return err
-			}
-			filename := filepath.Base(u.Path)
-			dst := filepath.Join("static", "images", filename)
-			if err = os.Remove(dst); err != nil && !os.IsNotExist(err) {
-				logger.Error(ctx, "Remove img2img input image error: %s", err.Error())
-				return err
-			}
+	taskID := uuid.New().String()
+	uuid, _ := ctx.Get("user_id")
+
+	if dto.CredentialID != 0 {
+		provider, err := image_generation_dao.GetInfoFromModel[string](s.ImageGenerationDAO, "provider", dto.ModelID)
+		if err != nil {
+			return "", err
+		}
+		if err := s.checkCredential(provider, dto.CredentialID, uuid.(string)); err != nil {
+			return "", err
 		}
 	}
 
-	if err := s.ImageGenerationDAO.UpdateTaskParams("status", 5, taskID); err != nil {
-		return err
+	priority, err := s.schedulePriority(ctx, uuid.(string), dto.Priority)
+	if err != nil {
+		return "", err
 	}
-	if err := s.ImageGenerationDAO.UpdateTaskParams("input_image_url", "", taskID); err != nil {
-		return err
+
+	// 原图只用于生成画布, 处理完即删除
+	srcDst, err := s.saveUploadedImage(ctx, dto.InputImage, "outpaint-src-"+taskID, dto.Sha256)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	// 先只读取头部的宽高, 原图与扩展后的画布都不超过模型上限才完整解码, 避免超大图片耗尽内存
+	cfg, err := decodeImageConfig(srcDst)
+	if err != nil {
+		removeFiles(ctx, srcDst)
+		return "", err
+	}
+	width := cfg.Width + dto.ExtendLeft + dto.ExtendRight
+	height := cfg.Height + dto.ExtendTop + dto.ExtendBottom
+	if err := s.checkCanvasSize(dto.ModelID, width, height); err != nil {
+		removeFiles(ctx, srcDst)
+		return "", err
+	}
+	if err := s.applyMaskedModelParams(ctx, dto.ModelID, width, height, &dto.NumInferenceSteps); err != nil {
+		removeFiles(ctx, srcDst)
+		return "", err
+	}
+
+	src, err := decodeImageFile(srcDst)
+	removeFiles(ctx, srcDst)
+	if err != nil {
+		return "", err
+	}
+
+	canvas, mask := pkg.BuildOutpaintCanvas(src, dto.ExtendLeft, dto.ExtendRight, dto.ExtendTop, dto.ExtendBottom, outpaintOverlap)
+
+	inputDst := filepath.Join(os.TempDir(), "outpaint-"+taskID+".png")
+	maskDst := filepath.Join(os.TempDir(), "outpaint-mask-"+taskID+".png")
+	if err := pkg.SavePNG(inputDst, canvas); err != nil {
+		removeFiles(ctx, inputDst)
+		return "", err
+	}
+	if err := pkg.SavePNG(maskDst, mask); err != nil {
+		removeFiles(ctx, inputDst, maskDst)
+		return "", err
+	}
+
+	urls, err := storeTaskImages(ctx, inputDst, maskDst)
+	if err != nil {
+		return "", err
+	}
+	inputImageURL, maskImageURL := urls[0], urls[1]
+
+	message := rabbitmq.TaskMessage{
+		TaskID:   taskID,
+		UserUUID: uuid.(string),
+		Payload: rabbitmq.OutpaintPayload{
+			Prompt:            dto.Prompt,
+			NegativePrompt:    dto.NegativePrompt,
+			ModelID:           dto.ModelID,
+			Width:             width,
+			Height:            height,
+			NumInferenceSteps: dto.NumInferenceSteps,
+			GuidanceScale:     dto.GuidanceScale,
+			Seed:              dto.Seed,
+			InputImageURL:     inputImageURL,
+			MaskImageURL:      maskImageURL,
+			ExtendLeft:        dto.ExtendLeft,
+			ExtendRight:       dto.ExtendRight,
+			ExtendTop:         dto.ExtendTop,
+			ExtendBottom:      dto.ExtendBottom,
+			NumImages:         dto.NumImages,
+			CredentialID:      dto.CredentialID,
+		},
+		Priority: priority,
+	}
+
+	body, err := json.Marshal(&message)
+	if err != nil {
+		removeStoredImages(ctx, inputImageURL, maskImageURL)
+		return "", err
+	}
+
+	do := image_generation_do.TableImageGenerationTaskDO{
+		TaskID:            taskID,
+		UserUUID:          uuid.(string),
+		TaskType:          4,
+		Status:            1,
+		Prompt:            dto.Prompt,
+		NegativePrompt:    dto.NegativePrompt,
+		ModelID:           dto.ModelID,
+		Width:             width,
+		Height:            height,
+		NumInferenceSteps: dto.NumInferenceSteps,
+		GuidanceScale:     dto.GuidanceScale,
+		Seed:              dto.Seed,
+		InputImageURL:     inputImageURL,
+		Strength:          1,
+		MaskImageURL:      maskImageURL,
+		ExtendLeft:        dto.ExtendLeft,
+		ExtendRight:       dto.ExtendRight,
+		ExtendTop:         dto.ExtendTop,
+		ExtendBottom:      dto.ExtendBottom,
+		NumImages:         dto.NumImages,
+		CredentialID:      dto.CredentialID,
+		Priority:          int8(priority),
+		PostProcess:       postProcess,
+	}
+
+	created, err := s.ImageGenerationDAO.CreateMaskedTask(ctx, &do, body, maxInFlightPerUser())
+	if err != nil || !created {
+		removeStoredImages(ctx, inputImageURL, maskImageURL)
+		if err != nil {
+			return "", err
+		}
+		return "", errTooManyInFlight()
+	}
+
+	s.notifyQueued(ctx, taskID, uuid.(string), priority)
+
+	return taskID, nil
+}
+
+// ReadImageMetadata 读取上传图片中的生成参数, 用于复现结果
+func (s *Service) ReadImageMetadata(fileHeader *multipart.FileHeader) (*pkg.GenerationMetadata, error) {
+	if fileHeader.Size > maxMetadataImageSize {
+		return nil, fmt.Errorf("%w: image exceeds %d bytes", ErrInvalidImage, maxMetadataImageSize)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxMetadataImageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	return pkg.ReadGenerationMetadata(data)
+}
+
+// CancelTask 取消任务, 并通知 Poller 取消上游任务
+func (s *Service) CancelTask(ctx *gin.Context, taskID string) error {
+	uuid, _ := ctx.Get("user_id")
+
+	task, err := s.ImageGenerationDAO.GetTaskByID(ctx, taskID, uuid.(string))
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return fmt.Errorf("task_id '%s' does not exist", taskID)
+	}
+
+	cancelled, err := s.ImageGenerationDAO.CancelTask(ctx, taskID, uuid.(string))
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return fmt.Errorf("task '%s' has already finished", taskID)
+	}
+
+	// 取消成功后再删除前面保存到服务器里的原图与蒙版, 删除失败只记录日志, 不影响取消结果
+	if task.TaskType != 1 {
+		for column, imageURL := range map[string]string{"input_image_url": task.InputImageURL, "mask_image_url": task.MaskImageURL} {
+			if err := removeStoredImage(ctx, imageURL); err != nil {
+				logger.Error(ctx, "Remove task input image error: %s", err.Error())
+				continue
+			}
+			if err := s.ImageGenerationDAO.UpdateTaskParams(column, "", taskID); err != nil {
+				logger.Error(ctx, "Clear task input image error: %s", err.Error())
+			}
+		}
+	}
+
+	// 广播给所有实例的 Poller, 由跟踪该任务的实例取消上游并中断等待
+	if err := rdb.Rdb.Publish(rdb.Ctx, rdb.ChannelTaskCancel, taskID).Err(); err != nil {
+		logger.Error(ctx, "Publish task cancel event error: %s", err.Error())
+	}
+
+	ws.GlobalHub.SendToUser(uuid.(string), ws.MessageTypeTaskCancelled, ws.TaskCancelledData{
+		TaskID: taskID,
+		Status: "cancelled",
+	})
+
+	return nil
+}
+
+// SetTaskVisibility 公开或取消公开已完成任务的输出图片, 公开后无需签名即可访问
+func (s *Service) SetTaskVisibility(ctx *gin.Context, dto *image_generation_dto.TaskVisibilityDTO) error {
+	uuid, _ := ctx.Get("user_id")
+
+	task, err := s.ImageGenerationDAO.GetTaskByID(ctx, dto.TaskID, uuid.(string))
+	if err != nil {
+		return err
+	}
+	if task == nil {
+		return fmt.Errorf("task_id '%s' does not exist", dto.TaskID)
+	}
+	if task.Status != 3 {
+		return fmt.Errorf("only completed tasks can change visibility")
+	}
+
+	return s.ImageGenerationDAO.UpdateTaskParams("is_public", *dto.IsPublic, dto.TaskID)
+}
+
+// OpenImage 打开存储中的图片, 携带有效签名, 或图片已公开, 或属于当前登录用户时才允许访问
+// 返回值中的 bool 表示图片是否公开, 用于决定缓存策略
+func (s *Service) OpenImage(ctx *gin.Context, key, expires, signature string) (io.ReadCloser, bool, error) {
+	key = strings.TrimPrefix(path.Clean("/"+key), "/")
+	if !strings.HasPrefix(key, "images/") {
+		return nil, false, ErrImageNotFound
+	}
+
+	public := false
+	if signature != "" {
+		if !storage.VerifySignature(key, expires, signature) {
+			return nil, false, ErrImageForbidden
+		}
+	} else {
+		access, err := s.ImageGenerationDAO.GetImageAccess(ctx, storage.Default.URL(key))
+		if err != nil {
+			return nil, false, err
+		}
+		if access == nil {
+			return nil, false, ErrImageNotFound
+		}
+
+		userUUID := ctx.GetString("user_id")
+		if !access.IsPublic && (userUUID == "" || userUUID != access.UserUUID) {
+			return nil, false, ErrImageForbidden
+		}
+		public = access.IsPublic
+	}
+
+	body, err := storage.Default.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, false, ErrImageNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return body, public, nil
+}
+
+// GetTaskInfo 获取当前用户的任务详情
+func (s *Service) GetTaskInfo(ctx *gin.Context, taskID string) (*image_generation_vo.TaskVO, error) {
+	userUUID, _ := ctx.Get("user_id")
+
+	task, err := s.ImageGenerationDAO.GetTaskByID(ctx, taskID, userUUID.(string))
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, fmt.Errorf("task_id '%s' does not exist", taskID)
+	}
+
+	outputs, err := s.ImageGenerationDAO.GetOutputsByTaskIDs(ctx, []string{taskID})
+	if err != nil {
+		return nil, err
+	}
+
+	return toTaskVO(task, outputs[taskID]), nil
+}
+
+// QueryTasks 分页查询当前用户的任务历史
+func (s *Service) QueryTasks(ctx *gin.Context, query *image_generation_query.TasksQuery) ([]*image_generation_vo.TaskVO, int64, error) {
+	userUUID, _ := ctx.Get("user_id")
+
+	tasks, total, err := s.ImageGenerationDAO.QueryTasks(ctx, userUUID.(string), query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	taskIDs := make([]string, len(tasks))
+	for i, task := range tasks {
+		taskIDs[i] = task.TaskID
+	}
+
+	outputs, err := s.ImageGenerationDAO.GetOutputsByTaskIDs(ctx, taskIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]*image_generation_vo.TaskVO, len(tasks))
+	for i, task := range tasks {
+		result[i] = toTaskVO(task, outputs[task.TaskID])
+	}
+
+	return result, total, nil
+}
+
+// CreateCredential 创建生图凭证, ownerUUID 为空表示平台凭证
+func (s *Service) CreateCredential(ctx *gin.Context, ownerUUID string, dto *image_generation_dto.CredentialCreateDTO) error {
+	encKey, err := pkg.Encrypt(dto.APIKey, configs.GlobalConfig.Chat.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("encrypt api key: %w", err)
+	}
+
+	do := &image_generation_do.TableImageProviderCredentialDO{
+		UserUUID:  ownerUUID,
+		Provider:  dto.Provider,
+		Name:      dto.Name,
+		IsActive:  true,
+		APIKeyEnc: encKey,
+	}
+	return s.ImageGenerationDAO.CreateCredential(ctx, do)
+}
+
+// UpdateCredential 更新生图凭证, worker 每个任务都会重新读取, 轮换后立即生效
+func (s *Service) UpdateCredential(ctx *gin.Context, ownerUUID string, dto *image_generation_dto.CredentialUpdateDTO) error {
+	updates := make(map[string]any)
+
+	if dto.Name != nil {
+		updates["name"] = *dto.Name
+	}
+
+	if dto.IsActive != nil {
+		updates["is_active"] = *dto.IsActive
+	}
+
+	if dto.APIKey != nil {
+		encKey, err := pkg.Encrypt(*dto.APIKey, configs.GlobalConfig.Chat.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("encrypt api key: %w", err)
+		}
+		updates["api_key_enc"] = encKey
+	}
+
+	if len(updates) == 0 {
+		return fmt.Errorf("no fields to update")
+	}
+
+	return s.ImageGenerationDAO.UpdateCredential(ctx, dto.ID, ownerUUID, updates)
+}
+
+// DeleteCredential 删除生图凭证
+func (s *Service) DeleteCredential(ctx *gin.Context, ownerUUID string, id uint64) error {
+	return s.ImageGenerationDAO.DeleteCredential(ctx, id, ownerUUID)
+}
+
+// QueryCredentials 查询生图凭证列表, API Key 仅返回掩码
+func (s *Service) QueryCredentials(ctx *gin.Context, ownerUUID string) ([]*image_generation_vo.CredentialVO, error) {
+	credentials, err := s.ImageGenerationDAO.QueryCredentials(ctx, ownerUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*image_generation_vo.CredentialVO, len(credentials))
+	for i, c := range credentials {
+		plainKey, _ := pkg.Decrypt(c.APIKeyEnc, configs.GlobalConfig.Chat.EncryptionKey)
+		result[i] = &image_generation_vo.CredentialVO{
+			ID:         c.ID,
+			Provider:   c.Provider,
+			Name:       c.Name,
+			IsActive:   c.IsActive,
+			APIKeyMask: pkg.MaskAPIKey(plainKey),
+			CreatedAt:  c.CreatedAt,
+			UpdatedAt:  c.UpdatedAt,
+		}
+	}
+	return result, nil
+}
+
+// checkCredential 校验凭证存在、启用且与模型 provider 一致
+func (s *Service) checkCredential(provider string, credentialID uint64, ownerUUID string) error {
+	credential, err := s.ImageGenerationDAO.GetCredential(credentialID, ownerUUID)
+	if err != nil {
+		return err
+	}
+	if credential == nil {
+		return fmt.Errorf("credential %d does not exist or is inactive", credentialID)
+	}
+
+	if provider == "" {
+		provider = third.ProviderModelScope
+	}
+	if credential.Provider != provider {
+		return fmt.Errorf("credential provider '%s' does not match model provider '%s'", credential.Provider, provider)
+	}
+	return nil
+}
+
+// schedulePriority 根据请求的优先级档位和用户未完成任务数计算队列优先级
+// 这里的上限校验只用于尽早拒绝, 以创建任务事务中的校验为准
+func (s *Service) schedulePriority(ctx *gin.Context, userUUID, level string) (uint8, error) {
+	base, err := priorityBase(level)
+	if err != nil {
+		return 0, err
+	}
+
+	if level == "high" {
+		allowed, err := s.canUseHighPriority(ctx, userUUID)
+		if err != nil {
+			return 0, err
+		}
+		if !allowed {
+			return 0, ErrPriorityNotAllowed
+		}
+	}
+
+	inFlight, err := s.ImageGenerationDAO.CountUserInFlightTasks(ctx, userUUID)
+	if err != nil {
+		return 0, err
+	}
+	if inFlight >= maxInFlightPerUser() {
+		return 0, errTooManyInFlight()
+	}
+
+	return queuePriority(base, inFlight), nil
+}
+
+// canUseHighPriority high 档位只开放给 imagegen.highprioritytiers 中的用户等级、admin 角色与被授予 task:priority_high 的角色
+func (s *Service) canUseHighPriority(ctx *gin.Context, userUUID string) (bool, error) {
+	tier, err := s.ImageGenerationDAO.GetUserTier(ctx, userUUID)
+	if err != nil {
+		return false, err
+	}
+	if tier != "" && slices.Contains(configs.GlobalConfig.ImageGen.HighPriorityTiers, tier) {
+		return true, nil
+	}
+
+	_, allowed, err := middleware.CheckRole(userUUID, middleware.RoleAdmin, middleware.PermTaskPriorityHigh)
+	return allowed, err
+}
+
+// priorityBase 优先级档位对应的基础优先级, 档位之间相差 3 级
+func priorityBase(level string) (int64, error) {
+	switch level {
+	case "low":
+		return 3, nil
+	case "", "normal":
+		return 6, nil
+	case "high":
+		return rabbitmq.MaxPriority, nil
+	default:
+		return 0, fmt.Errorf("priority must be one of low, normal, high")
+	}
+}
+
+// queuePriority 用户每有一个未完成任务, 新任务的优先级降低一级, 使不同用户的任务在队列中交错执行
+// 降到 0 后不再降低: normal 档在用户有 6 个未完成任务后即为 0, 此后该用户的任务与其他同为 0 的任务按入队顺序执行
+// 公平调度因此只区分每个用户排在最前面的几个任务, 轻度用户的任务始终排在重度用户之前, 总量由 maxinflightperuser 限制
+func queuePriority(base, inFlight int64) uint8 {
+	return uint8(min(max(base-inFlight, 0), rabbitmq.MaxPriority))
+}
+
+// maxInFlightPerUser 每个用户同时未完成的任务上限
+func maxInFlightPerUser() int64 {
+	maxInFlight := int64(configs.GlobalConfig.ImageGen.MaxInFlightPerUser)
+	if maxInFlight <= 0 {
+		maxInFlight = defaultMaxInFlightPerUser
+	}
+	return maxInFlight
+}
+
+func errTooManyInFlight() error {
+	return fmt.Errorf("%w, at most %d tasks can be in flight", ErrTooManyInFlight, maxInFlightPerUser())
+}
+
+// notifyQueued 推送任务入队消息, 附带估算的排队位置
+func (s *Service) notifyQueued(ctx *gin.Context, taskID, userUUID string, priority uint8) {
+	position, err := s.ImageGenerationDAO.GetQueuePosition(ctx, taskID)
+	if err != nil {
+		return
+	}
+
+	ws.GlobalHub.SendToUser(userUUID, ws.MessageTypeTaskQueued, ws.TaskQueuedData{
+		TaskID:   taskID,
+		Status:   "queued",
+		Priority: priority,
+		Position: position,
+	})
+}
+
+// checkNumImages 校验单次生成数量是否超过模型上限
+func (s *Service) checkNumImages(modelID string, numImages int) error {
+	maxNumImages, err := image_generation_dao.GetInfoFromModel[int](s.ImageGenerationDAO, "max_num_images", modelID)
+	if err != nil {
+		return err
+	}
+	if maxNumImages <= 0 {
+		maxNumImages = 1
+	}
+
+	if numImages < 1 || numImages > maxNumImages {
+		return fmt.Errorf("%w: num_images must be between 1 and %d for model '%s'", ErrInvalidParams, maxNumImages, modelID)
+	}
+	return nil
+}
+
+// checkModelAvailable 模型被管理员停用或被健康检查自动停用时拒绝创建任务
+func (s *Service) checkModelAvailable(modelID string) error {
+	isActive, err := image_generation_dao.GetInfoFromModel[bool](s.ImageGenerationDAO, "is_active", modelID)
+	if err != nil {
+		return err
+	}
+	if !isActive {
+		return fmt.Errorf("%w: model '%s' is disabled", ErrModelUnavailable, modelID)
+	}
+	return nil
+}
+
+// applyModelParams 按模型配置补全未填写的宽高、推理步数与采样器, 并校验取值范围、宽高比与采样器
+func (s *Service) applyModelParams(ctx *gin.Context, modelID string, width, height, steps *int, sampler *string) error {
+	model, err := s.ImageGenerationDAO.GetModelInfo(ctx, modelID)
+	if err != nil {
+		return err
+	}
+
+	capabilities, err := parseCapabilities(model.Capabilities)
+	if err != nil {
+		return err
+	}
+
+	return resolveModelParams(modelID, model, capabilities, width, height, steps, sampler)
+}
+
+// resolveModelParams 按已读取的模型配置与能力补全并校验生成参数
+func resolveModelParams(modelID string, model *image_generation_do.TableImageGenerationModelsDO, capabilities *image_generation_dto.ModelCapabilitiesDTO, width, height, steps *int, sampler *string) error {
+	if *width == 0 {
+		*width = model.DefaultWidth
+		if *width <= 0 {
+			*width = defaultCanvasSize
+		}
+	}
+	if *height == 0 {
+		*height = model.DefaultHeight
+		if *height <= 0 {
+			*height = defaultCanvasSize
+		}
+	}
+	if *steps == 0 {
+		*steps = max(defaultInferenceSteps, model.MinSteps)
+		if model.MaxSteps > 0 {
+			*steps = min(*steps, model.MaxSteps)
+		}
+	}
+	if *sampler == "" && len(capabilities.Samplers) > 0 {
+		*sampler = capabilities.Samplers[0]
+	}
+
+	maxWidth, maxHeight := model.MaxWidth, model.MaxHeight
+	if maxWidth <= 0 {
+		maxWidth = defaultMaxCanvasSize
+	}
+	if maxHeight <= 0 {
+		maxHeight = defaultMaxCanvasSize
+	}
+	if *width < 1 || *width > maxWidth {
+		return fmt.Errorf("%w: width must be between 1 and %d for model '%s'", ErrInvalidParams, maxWidth, modelID)
+	}
+	if *height < 1 || *height > maxHeight {
+		return fmt.Errorf("%w: height must be between 1 and %d for model '%s'", ErrInvalidParams, maxHeight, modelID)
+	}
+
+	minSteps := max(model.MinSteps, 1)
+	if *steps < minSteps || (model.MaxSteps > 0 && *steps > model.MaxSteps) {
+		if model.MaxSteps > 0 {
+			return fmt.Errorf("%w: num_inference_steps must be between %d and %d for model '%s'", ErrInvalidParams, minSteps, model.MaxSteps, modelID)
+		}
+		return fmt.Errorf("%w: num_inference_steps must be at least %d for model '%s'", ErrInvalidParams, minSteps, modelID)
+	}
+
+	if len(capabilities.AspectRatios) > 0 && !matchAspectRatio(*width, *height, capabilities.AspectRatios) {
+		return fmt.Errorf("%w: aspect ratio of %dx%d is not supported by model '%s', allowed: %s",
+			ErrInvalidParams, *width, *height, modelID, strings.Join(capabilities.AspectRatios, ", "))
+	}
+
+	if len(capabilities.Samplers) > 0 && !slices.Contains(capabilities.Samplers, *sampler) {
+		return fmt.Errorf("%w: sampler '%s' is not supported by model '%s', allowed: %s",
+			ErrInvalidParams, *sampler, modelID, strings.Join(capabilities.Samplers, ", "))
+	}
+	return nil
+}
+
+// applyMaskedModelParams 局部重绘与扩图的画布尺寸由图片决定且不支持采样器, 只补全推理步数并校验步数与宽高比
+func (s *Service) applyMaskedModelParams(ctx *gin.Context, modelID string, width, height int, steps *int) error {
+	var sampler string
+	return s.applyModelParams(ctx, modelID, &width, &height, steps, &sampler)
+}
+
+// buildCapabilities 校验模型能力配置并序列化为 JSON 落库, 未配置任何限制时返回空串
+func buildCapabilities(dto *image_generation_dto.ModelCapabilitiesDTO) (string, error) {
+	if dto == nil || (len(dto.AspectRatios) == 0 && len(dto.Samplers) == 0) {
+		return "", nil
+	}
+
+	for _, ratio := range dto.AspectRatios {
+		if _, _, err := pkg.ParseAspectRatio(ratio); err != nil {
+			return "", fmt.Errorf("capabilities: %s", err.Error())
+		}
+	}
+	for _, sampler := range dto.Samplers {
+		if strings.TrimSpace(sampler) == "" {
+			return "", fmt.Errorf("capabilities: sampler must not be empty")
+		}
+	}
+
+	data, err := json.Marshal(dto)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parseCapabilities 解析模型能力配置, 未配置时返回不做限制的空配置
+func parseCapabilities(raw string) (*image_generation_dto.ModelCapabilitiesDTO, error) {
+	capabilities := &image_generation_dto.ModelCapabilitiesDTO{}
+	if raw == "" {
+		return capabilities, nil
+	}
+
+	if err := json.Unmarshal([]byte(raw), capabilities); err != nil {
+		return nil, fmt.Errorf("invalid model capabilities: %s", err.Error())
+	}
+	return capabilities, nil
+}
+
+// matchAspectRatio 判断宽高是否在误差范围内符合任一允许的宽高比
+func matchAspectRatio(width, height int, ratios []string) bool {
+	actual := float64(width) / float64(height)
+
+	for _, ratio := range ratios {
+		w, h, err := pkg.ParseAspectRatio(ratio)
+		if err != nil {
+			continue
+		}
+		expected := float64(w) / float64(h)
+		if math.Abs(actual-expected) <= expected*aspectRatioTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPostProcess 校验后处理配置并序列化为 JSON 落库, 未配置任何步骤时返回空串
+func buildPostProcess(dto *image_generation_dto.PostProcessDTO) (string, error) {
+	if dto == nil || *dto == (image_generation_dto.PostProcessDTO{}) {
+		return "", nil
+	}
+
+	if dto.Upscale != 0 && dto.Upscale != 2 && dto.Upscale != 4 {
+		return "", fmt.Errorf("%w: upscale must be 2 or 4", ErrInvalidPostProcess)
+	}
+	if dto.AspectRatio != "" {
+		if _, _, err := pkg.ParseAspectRatio(dto.AspectRatio); err != nil {
+			return "", fmt.Errorf("%w: %s", ErrInvalidPostProcess, err.Error())
+		}
+	}
+	maxSize := configs.GlobalConfig.ImageGen.MaxProcessedSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxProcessedSize
+	}
+	if dto.TargetWidth < 0 || dto.TargetWidth > maxSize {
+		return "", fmt.Errorf("%w: target_width must be between 1 and %d", ErrInvalidPostProcess, maxSize)
+	}
+	if dto.Watermark && configs.GlobalConfig.ImageGen.WatermarkPath == "" {
+		return "", fmt.Errorf("%w: watermark is not configured", ErrInvalidPostProcess)
+	}
+
+	data, err := json.Marshal(rabbitmq.PostProcessOptions{
+		Upscale:     dto.Upscale,
+		AspectRatio: dto.AspectRatio,
+		TargetWidth: dto.TargetWidth,
+		Watermark:   dto.Watermark,
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// parsePostProcessForm multipart 请求中的 post_process 为 JSON 字符串
+func parsePostProcessForm(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+
+	var dto image_generation_dto.PostProcessDTO
+	if err := json.Unmarshal([]byte(raw), &dto); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrInvalidPostProcess, err.Error())
+	}
+	return buildPostProcess(&dto)
+}
+
+// PreviewEnhancePrompt 预览提示词扩写结果, 不创建任务
+func (s *Service) PreviewEnhancePrompt(ctx *gin.Context, dto *image_generation_dto.EnhancePromptPreviewDTO) (string, error) {
+	return s.enhancePrompt(ctx, ctx.GetString("user_id"), dto.Prompt, &dto.EnhancePromptDTO)
+}
+
+// enhancePrompt 使用用户保存的对话 API Key 扩写提示词, 扩写结果同样需要通过内容审核
+func (s *Service) enhancePrompt(ctx *gin.Context, userUUID, prompt string, dto *image_generation_dto.EnhancePromptDTO) (string, error) {
+	if dto.APIKeyID == 0 || dto.Model == "" {
+		return "", fmt.Errorf("%w: api_key_id and model are required", ErrInvalidEnhance)
+	}
+
+	key, err := s.ChatDAO.GetAPIKeyByID(ctx, dto.APIKeyID, userUUID)
+	if err != nil {
+		return "", fmt.Errorf("%w: api_key_id '%d' does not exist", ErrInvalidEnhance, dto.APIKeyID)
+	}
+	if !key.IsActive {
+		return "", fmt.Errorf("%w: api_key_id '%d' is disabled", ErrInvalidEnhance, dto.APIKeyID)
+	}
+
+	apiKey, err := pkg.Decrypt(key.APIKeyEnc, configs.GlobalConfig.Chat.EncryptionKey)
+	if err != nil {
+		return "", fmt.Errorf("decrypt api key: %w", err)
+	}
+
+	provider := chat.NewProvider(key.Provider, apiKey, key.BaseURL)
+	req := &chat.Request{
+		Model: dto.Model,
+		Messages: []chat.Message{
+			{Role: "system", Content: enhanceSystemPrompt},
+			{Role: "user", Content: prompt},
+		},
+		Temperature: 0.7,
+		MaxTokens:   512,
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, enhanceTimeout)
+	defer cancel()
+
+	ch, err := provider.ChatStream(timeoutCtx, req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrEnhanceFailed, err.Error())
+	}
+
+	var sb strings.Builder
+	for chunk := range ch {
+		if chunk.Err != nil {
+			return "", fmt.Errorf("%w: %s", ErrEnhanceFailed, chunk.Err.Error())
+		}
+		sb.WriteString(chunk.Delta)
+	}
+
+	enhanced := strings.Join(strings.Fields(strings.Trim(strings.TrimSpace(sb.String()), `"'`)), " ")
+	if enhanced == "" {
+		return "", fmt.Errorf("%w: empty response", ErrEnhanceFailed)
+	}
+	if runes := []rune(enhanced); len(runes) > maxEnhancedPromptLen {
+		enhanced = string(runes[:maxEnhancedPromptLen])
+	}
+
+	if err := pkg.ValidatePrompt(enhanced); err != nil {
+		return "", fmt.Errorf("%w: enhanced %s", ErrInvalidEnhance, err.Error())
+	}
+	return enhanced, nil
+}
+
+// parseEnhancePromptForm 解析 multipart 请求中以 JSON 字符串传入的 enhance_prompt, 为空表示不扩写
+func parseEnhancePromptForm(raw string) (*image_generation_dto.EnhancePromptDTO, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var dto image_generation_dto.EnhancePromptDTO
+	if err := json.Unmarshal([]byte(raw), &dto); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEnhance, err.Error())
+	}
+	return &dto, nil
+}
+
+// checkCanvasSize 校验输出尺寸不超过模型的最大宽高
+func (s *Service) checkCanvasSize(modelID string, width, height int) error {
+	maxWidth, err := image_generation_dao.GetInfoFromModel[int](s.ImageGenerationDAO, "max_width", modelID)
+	if err != nil {
+		return err
+	}
+	maxHeight, err := image_generation_dao.GetInfoFromModel[int](s.ImageGenerationDAO, "max_height", modelID)
+	if err != nil {
+		return err
+	}
+	if maxWidth <= 0 {
+		maxWidth = defaultMaxCanvasSize
+	}
+	if maxHeight <= 0 {
+		maxHeight = defaultMaxCanvasSize
+	}
+
+	if width > maxWidth || height > maxHeight {
+		return fmt.Errorf("%w: image size %dx%d exceeds %dx%d for model '%s'", ErrInvalidImage, width, height, maxWidth, maxHeight, modelID)
+	}
+	return nil
+}
+
+// checkMaskSize 校验蒙版与原图尺寸一致, 返回原图宽高
+func (s *Service) checkMaskSize(inputPath, maskPath string) (int, int, error) {
+	input, err := decodeImageConfig(inputPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	mask, err := decodeImageConfig(maskPath)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if input.Width != mask.Width || input.Height != mask.Height {
+		return 0, 0, fmt.Errorf("%w: mask size %dx%d does not match input image %dx%d", ErrInvalidImage, mask.Width, mask.Height, input.Width, input.Height)
+	}
+	return input.Width, input.Height, nil
+}
+
+// saveUploadedImage 上传图片先落盘到临时目录并校验 sha256, 校验失败时删除文件, 校验与尺寸检查通过后再写入存储
+func (s *Service) saveUploadedImage(ctx *gin.Context, fileHeader *multipart.FileHeader, name, sha string) (string, error) {
+	ext := filepath.Ext(fileHeader.Filename)
+	allowedExts := []string{".png", ".jpg", ".jpeg", ".webp"}
+	if !slices.Contains(allowedExts, ext) {
+		return "", fmt.Errorf("unsupported file format: %s", ext)
+	}
+
+	dst := filepath.Join(os.TempDir(), name+ext)
+	if err := ctx.SaveUploadedFile(fileHeader, dst); err != nil {
+		return "", err
+	}
+
+	// 落盘后进行校验
+	file, err := os.Open(dst)
+	if err != nil {
+		removeFiles(ctx, dst)
+		return "", err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			logger.Error(ctx, "Close uploaded file error: %s", closeErr.Error())
+		}
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		logger.Error(ctx, "calcute sha256 error: %s", err.Error())
+		removeFiles(ctx, dst)
+		return "", err
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != sha {
+		removeFiles(ctx, dst)
+		return "", fmt.Errorf("the file destroyed")
+	}
+
+	return dst, nil
+}
+
+// storeTaskImages 把临时文件写入存储的 images/ 下并删除临时文件, 返回写入数据库的地址
+// 图片默认私有, Worker 提交上游前再换成签名地址; 任一文件写入失败时删除已写入的文件
+func storeTaskImages(ctx *gin.Context, paths ...string) ([]string, error) {
+	defer removeFiles(ctx, paths...)
+
+	urls := make([]string, 0, len(paths))
+	for _, path := range paths {
+		key := "images/" + filepath.Base(path)
+		if err := storage.PutFile(ctx, key, path); err != nil {
+			logger.Error(ctx, "Save image to storage error: %s", err.Error())
+			removeStoredImages(ctx, urls...)
+			return nil, err
+		}
+		urls = append(urls, storage.Default.URL(key))
+	}
+	return urls, nil
+}
+
+// removeStoredImage 根据地址删除存储中的图片, 地址为空或对象不存在时忽略
+func removeStoredImage(ctx *gin.Context, imageURL string) error {
+	key := storage.KeyFromURL(imageURL)
+	if key == "" {
+		return nil
+	}
+	return storage.Default.Delete(ctx, key)
+}
+
+// removeStoredImages 创建任务失败时清理已写入存储的图片, 失败只记录日志
+func removeStoredImages(ctx *gin.Context, imageURLs ...string) {
+	for _, imageURL := range imageURLs {
+		if err := removeStoredImage(ctx, imageURL); err != nil {
+			logger.Error(ctx, "Remove stored image error: %s", err.Error())
+		}
+	}
+}
+
+// removeFiles 删除创建任务过程中落盘的临时文件
+func removeFiles(ctx *gin.Context, paths ...string) {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Error(ctx, "Remove uploaded file error: %s", err.Error())
+		}
+	}
+}
+
+// decodeImageConfig 读取图片宽高, 无法识别的格式视为无效图片
+func decodeImageConfig(path string) (image.Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return image.Config{}, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("%w: %s", ErrInvalidImage, err.Error())
+	}
+	return cfg, nil
+}
+
+// decodeImageFile 解码本地图片
+func decodeImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidImage, err.Error())
+	}
+	return img, nil
+}
+
+// toTaskVO 将任务 DO 转换为对外的 VO, 早期任务没有 outputs 记录时回退到 output_image_url
+func toTaskVO(task *image_generation_do.TableImageGenerationTaskDO, rows []*image_generation_do.TableImageGenerationOutputDO) *image_generation_vo.TaskVO {
+	outputs := make([]string, 0, len(rows))
+	var processed []string
+	for _, row := range rows {
+		outputs = append(outputs, imageAccessURL(row.ImageURL, task.IsPublic))
+		if row.ProcessedURL != "" {
+			processed = append(processed, imageAccessURL(row.ProcessedURL, task.IsPublic))
+		}
+	}
+	if len(outputs) == 0 && task.OutputImageURL != "" {
+		outputs = []string{imageAccessURL(task.OutputImageURL, task.IsPublic)}
+	}
+
+	var postProcess any
+	if task.PostProcess != "" {
+		postProcess = json.RawMessage(task.PostProcess)
+	}
+
+	return &image_generation_vo.TaskVO{
+		TaskID:            task.TaskID,
+		TaskType:          task.TaskType,
+		Status:            task.Status,
+		StatusText:        taskStatusText(task.Status),
+		Priority:          task.Priority,
+		Prompt:            task.Prompt,
+		OriginalPrompt:    task.OriginalPrompt,
+		NegativePrompt:    task.NegativePrompt,
+		ModelID:           task.ModelID,
+		Width:             task.Width,
+		Height:            task.Height,
+		NumInferenceSteps: task.NumInferenceSteps,
+		GuidanceScale:     task.GuidanceScale,
+		Seed:              task.Seed,
+		NumImages:         task.NumImages,
+		Sampler:           task.Sampler,
+		InputImageURL:     imageAccessURL(task.InputImageURL, false),
+		Strength:          task.Strength,
+		MaskImageURL:      imageAccessURL(task.MaskImageURL, false),
+		ExtendLeft:        task.ExtendLeft,
+		ExtendRight:       task.ExtendRight,
+		ExtendTop:         task.ExtendTop,
+		ExtendBottom:      task.ExtendBottom,
+		OutputImageURL:    imageAccessURL(task.OutputImageURL, task.IsPublic),
+		OutputImages:      outputs,
+		PostProcess:       postProcess,
+		PostStatus:        postStatusText(task.PostStatus),
+		PostError:         task.PostError,
+		ProcessedImages:   processed,
+		IsPublic:          task.IsPublic,
+		ActualSeed:        task.ActualSeed,
+		ErrorMessage:      task.ErrorMessage,
+		RetryCount:        task.RetryCount,
+		MaxRetry:          task.MaxRetry,
+		NextRetryAt:       task.NextRetryAt,
+		GenerationTimeMs:  task.GenerationTimeMs,
+		CreatedAt:         task.CreatedAt,
+		QueuedAt:          task.QueuedAt,
+		StartedAt:         task.StartedAt,
+		CompletedAt:       task.CompletedAt,
+		PurgedAt:          task.PurgedAt,
+	}
+}
+
+// imageAccessURL 公开图片返回固定地址, 私有图片返回限时签名地址
+func imageAccessURL(storedURL string, public bool) string {
+	if storedURL == "" {
+		return ""
+	}
+	if public {
+		return storage.PublicFileURL(storedURL)
+	}
+	return storage.SignedURL(context.Background(), storedURL, storage.SignedURLTTL())
+}
+
+// postStatusText 后处理状态码对应的文本, 未配置后处理时为空
+func postStatusText(status int8) string {
+	switch status {
+	case 1:
+		return "queued"
+	case 2:
+		return "processing"
+	case 3:
+		return "completed"
+	case 4:
+		return "failed"
+	default:
+		return ""
+	}
+}
+
+// taskStatusText 任务状态码对应的文本
+func taskStatusText(status int8) string {
+	switch status {
+	case 0:
+		return "pending"
+	case 1:
+		return "queued"
+	case 2:
+		return "processing"
+	case 3:
+		return "completed"
+	case 4:
+		return "failed"
+	case 5:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// QueryDeadLetters 分页查询死信记录
+func (s *Service) QueryDeadLetters(ctx *gin.Context, query *image_generation_query.DeadLettersQuery) ([]*image_generation_do.TableDeadLetterTasksDO, int64, error) {
+	return s.ImageGenerationDAO.QueryDeadLetters(ctx, query)
+}
+
+// GetDeadLetter 获取死信记录及其原始任务
+func (s *Service) GetDeadLetter(ctx *gin.Context, id int64) (*image_generation_vo.DeadLetterDetailVO, error) {
+	deadLetter, err := s.ImageGenerationDAO.GetDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if deadLetter == nil {
+		return nil, fmt.Errorf("dead letter %d does not exist", id)
+	}
+
+	detail := &image_generation_vo.DeadLetterDetailVO{DeadLetter: deadLetter}
+
+	task, err := s.ImageGenerationDAO.GetTaskByID(ctx, deadLetter.TaskID, deadLetter.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return detail, nil
+	}
+
+	outputs, err := s.ImageGenerationDAO.GetOutputsByTaskIDs(ctx, []string{task.TaskID})
+	if err != nil {
+		return nil, err
+	}
+	detail.Task = toTaskVO(task, outputs[task.TaskID])
+
+	return detail, nil
+}
+
+// ReplayDeadLetters 逐条重放死信任务, 单条失败不影响其他记录
+func (s *Service) ReplayDeadLetters(ctx *gin.Context, ids []int64) []*image_generation_vo.ReplayDeadLetterResultVO {
+	results := make([]*image_generation_vo.ReplayDeadLetterResultVO, 0, len(ids))
+
+	for _, id := range ids {
+		result := &image_generation_vo.ReplayDeadLetterResultVO{ID: id}
+
+		taskID, err := s.replayDeadLetter(ctx, id)
+		result.TaskID = taskID
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Replayed = true
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// replayDeadLetter 重置任务的重试次数并经 outbox 重新投递到生图 Exchange, 随后删除死信记录
+func (s *Service) replayDeadLetter(ctx *gin.Context, id int64) (string, error) {
+	deadLetter, err := s.ImageGenerationDAO.GetDeadLetter(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if deadLetter == nil {
+		return "", fmt.Errorf("dead letter %d does not exist", id)
+	}
+
+	task, err := s.ImageGenerationDAO.GetTaskByID(ctx, deadLetter.TaskID, deadLetter.UserID)
+	if err != nil {
+		return deadLetter.TaskID, err
+	}
+	if task == nil {
+		return deadLetter.TaskID, fmt.Errorf("task '%s' does not exist", deadLetter.TaskID)
+	}
+	if task.Status == 3 || task.Status == 5 {
+		return task.TaskID, fmt.Errorf("task '%s' is %s and cannot be replayed", task.TaskID, taskStatusText(task.Status))
+	}
+
+	body, err := json.Marshal(rabbitmq.NewTaskMessageFromDO(task))
+	if err != nil {
+		return task.TaskID, err
+	}
+
+	// 重置任务与写入 outbox 在同一事务中完成, 由 relay 重新投递
+	if err = s.ImageGenerationDAO.ResetTaskForReplay(ctx, task.TaskID, task.TaskType, body); err != nil {
+		return task.TaskID, err
+	}
+
+	if err = s.ImageGenerationDAO.DeleteDeadLetter(ctx, id); err != nil {
+		return task.TaskID, err
+	}
+
+	s.notifyQueued(ctx, task.TaskID, task.UserUUID, uint8(task.Priority))
+
+	return task.TaskID, nil
+}
+
+// PurgeDeadLetters 清理指定日期之前的死信记录
+func (s *Service) PurgeDeadLetters(ctx *gin.Context, before string) (int64, error) {
+	return s.ImageGenerationDAO.PurgeDeadLetters(ctx, before)
 }
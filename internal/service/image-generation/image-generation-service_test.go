@@ -0,0 +1,209 @@
+package imagegeneration
+
+import (
+	"errors"
+	"testing"
+
+	image_generation_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/image-generation"
+	image_generation_dto "github.com/Zhiruosama/ai_nexus/internal/domain/dto/image-generation"
+)
+
+func TestResolveModelParams(t *testing.T) {
+	model := &image_generation_do.TableImageGenerationModelsDO{
+		ModelID:       "sd-xl",
+		DefaultWidth:  1024,
+		DefaultHeight: 1024,
+		MaxWidth:      1536,
+		MaxHeight:     1536,
+		MinSteps:      10,
+		MaxSteps:      50,
+	}
+	capabilities := &image_generation_dto.ModelCapabilitiesDTO{
+		AspectRatios: []string{"1:1", "16:9"},
+		Samplers:     []string{"Euler a", "DPM++ 2M Karras"},
+	}
+
+	type params struct {
+		width, height, steps int
+		sampler              string
+	}
+
+	tests := []struct {
+		name         string
+		model        *image_generation_do.TableImageGenerationModelsDO
+		capabilities *image_generation_dto.ModelCapabilitiesDTO
+		in           params
+		want         params
+		wantErr      bool
+	}{
+		{
+			name:  "defaults from model",
+			model: model, capabilities: capabilities,
+			want: params{1024, 1024, 20, "Euler a"},
+		},
+		{
+			name:  "explicit values kept",
+			model: model, capabilities: capabilities,
+			in:   params{1536, 864, 30, "DPM++ 2M Karras"},
+			want: params{1536, 864, 30, "DPM++ 2M Karras"},
+		},
+		{
+			name:  "aspect ratio within tolerance",
+			model: model, capabilities: capabilities,
+			in:   params{1024, 576, 10, "Euler a"},
+			want: params{1024, 576, 10, "Euler a"},
+		},
+		{
+			name:  "unconfigured model falls back to package defaults",
+			model: &image_generation_do.TableImageGenerationModelsDO{ModelID: "bare"}, capabilities: &image_generation_dto.ModelCapabilitiesDTO{},
+			in:   params{sampler: "anything"},
+			want: params{512, 512, 20, "anything"},
+		},
+		{
+			name:  "default steps clamped to max",
+			model: &image_generation_do.TableImageGenerationModelsDO{ModelID: "turbo", MinSteps: 1, MaxSteps: 4}, capabilities: &image_generation_dto.ModelCapabilitiesDTO{},
+			want: params{512, 512, 4, ""},
+		},
+		{
+			name:  "default steps raised to min",
+			model: &image_generation_do.TableImageGenerationModelsDO{ModelID: "slow", MinSteps: 30}, capabilities: &image_generation_dto.ModelCapabilitiesDTO{},
+			want: params{512, 512, 30, ""},
+		},
+		{
+			name:  "width above max",
+			model: model, capabilities: capabilities,
+			in:      params{2048, 2048, 20, "Euler a"},
+			wantErr: true,
+		},
+		{
+			name:  "width above default max",
+			model: &image_generation_do.TableImageGenerationModelsDO{ModelID: "bare"}, capabilities: &image_generation_dto.ModelCapabilitiesDTO{},
+			in:      params{2049, 512, 20, ""},
+			wantErr: true,
+		},
+		{
+			name:  "negative height",
+			model: model, capabilities: capabilities,
+			in:      params{1024, -1, 20, "Euler a"},
+			wantErr: true,
+		},
+		{
+			name:  "steps below min",
+			model: model, capabilities: capabilities,
+			in:      params{1024, 1024, 5, "Euler a"},
+			wantErr: true,
+		},
+		{
+			name:  "steps above max",
+			model: model, capabilities: capabilities,
+			in:      params{1024, 1024, 51, "Euler a"},
+			wantErr: true,
+		},
+		{
+			name:  "unsupported aspect ratio",
+			model: model, capabilities: capabilities,
+			in:      params{1024, 768, 20, "Euler a"},
+			wantErr: true,
+		},
+		{
+			name:  "unsupported sampler",
+			model: model, capabilities: capabilities,
+			in:      params{1024, 1024, 20, "DDIM"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.in
+			err := resolveModelParams(tt.model.ModelID, tt.model, tt.capabilities, &got.width, &got.height, &got.steps, &got.sampler)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidParams) {
+					t.Fatalf("err = %v, want ErrInvalidParams", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchAspectRatio(t *testing.T) {
+	ratios := []string{"1:1", "16:9", "2:3"}
+
+	tests := []struct {
+		width, height int
+		want          bool
+	}{
+		{512, 512, true},
+		{1024, 576, true},
+		{1344, 768, true}, // 1.75, 与 16:9 相差约 1.6%
+		{512, 768, true},
+		{768, 512, false},
+		{1024, 768, false},
+		{1280, 768, false},
+	}
+
+	for _, tt := range tests {
+		if got := matchAspectRatio(tt.width, tt.height, ratios); got != tt.want {
+			t.Errorf("matchAspectRatio(%d, %d) = %v, want %v", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+func TestPriorityBase(t *testing.T) {
+	tests := []struct {
+		level   string
+		want    int64
+		wantErr bool
+	}{
+		{"", 6, false},
+		{"normal", 6, false},
+		{"low", 3, false},
+		{"high", 9, false},
+		{"HIGH", 0, true},
+		{"urgent", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := priorityBase(tt.level)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("priorityBase(%q) = (%d, %v), want (%d, error %v)", tt.level, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestQueuePriority(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     int64
+		inFlight int64
+		want     uint8
+	}{
+		{"normal, idle user", 6, 0, 6},
+		{"normal, one in flight", 6, 1, 5},
+		{"normal, clamped at zero", 6, 6, 0},
+		{"normal, far past zero", 6, 19, 0},
+		{"low, idle user", 3, 0, 3},
+		{"low, clamped at zero", 3, 5, 0},
+		{"high, idle user", 9, 0, 9},
+		{"high, two in flight", 9, 2, 7},
+		{"above max priority", 12, 0, 9},
+	}
+
+	for _, tt := range tests {
+		if got := queuePriority(tt.base, tt.inFlight); got != tt.want {
+			t.Errorf("%s: queuePriority(%d, %d) = %d, want %d", tt.name, tt.base, tt.inFlight, got, tt.want)
+		}
+	}
+
+	// 同一用户的未完成任务越多, 新任务的优先级越低
+	light, heavy := queuePriority(6, 0), queuePriority(6, 3)
+	if light <= heavy {
+		t.Errorf("idle user priority %d is not above busy user priority %d", light, heavy)
+	}
+}
@@ -3,16 +3,21 @@ package user
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
 	"time"
 
+	"github.com/Zhiruosama/ai_nexus/configs"
 	user_dao "github.com/Zhiruosama/ai_nexus/internal/dao/user"
 	user_do "github.com/Zhiruosama/ai_nexus/internal/domain/do/user"
 	user_dto "github.com/Zhiruosama/ai_nexus/internal/domain/dto/user"
@@ -22,7 +27,10 @@ import (
 	"github.com/Zhiruosama/ai_nexus/internal/middleware"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/logger"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/oauth"
 	"github.com/Zhiruosama/ai_nexus/internal/pkg/rdb"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/session"
+	"github.com/Zhiruosama/ai_nexus/internal/pkg/storage"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
@@ -30,13 +38,15 @@ import (
 
 // Service 对应 user 模块的 Service 结构
 type Service struct {
-	UserDao *user_dao.DAO
+	UserDao        *user_dao.DAO
+	OAuthProviders map[string]oauth.Provider
 }
 
 // NewService 对应 user 模块的 Service 工厂方法
 func NewService() *Service {
 	return &Service{
-		UserDao: &user_dao.DAO{},
+		UserDao:        &user_dao.DAO{},
+		OAuthProviders: oauth.NewProviders(configs.GlobalConfig.OAuth.Providers),
 	}
 }
 
@@ -45,8 +55,90 @@ const (
 	infoPrefix       = "info_"
 	allinfoKey       = "allInfoForUsers"
 	allinfoKeyPrefix = "allInfoForUsers_"
+
+	// defaultAvatar 注册时的默认头像, 始终由本地 static 目录提供
+	defaultAvatar = "/static/avatar/default.png"
+
+	twoFactorChallengePrefix = "2fa_challenge_"
+	// twoFactorChallengeTTL 密码校验通过后完成第二步的时限
+	twoFactorChallengeTTL = 5 * time.Minute
+	// twoFactorMaxAttempts 单个挑战令牌允许的验证次数, 超出后需要重新登录
+	twoFactorMaxAttempts = 5
+	// recoveryCodeCount 每次生成的恢复码数量
+	recoveryCodeCount = 10
+	// defaultTOTPIssuer 未配置 session.totpissuer 时验证器 App 中显示的名称
+	defaultTOTPIssuer = "AI Nexus"
+
+	oauthStatePrefix = "oauth_state_"
+	// defaultOAuthStateTTL 未配置 oauth.statettl 时发起授权到回调完成的时限
+	defaultOAuthStateTTL = 10 * time.Minute
+	// oauthNicknamePrefix 第三方账号首次登录自动注册时的昵称前缀, 与注册接口的默认昵称一致
+	oauthNicknamePrefix = "用户_"
 )
 
+// claimChallengeScript 读取登录挑战并累加尝试次数, 挑战不存在返回 nil, 超过次数时删除挑战并返回 nil
+var claimChallengeScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return false
+end
+if redis.call("HINCRBY", KEYS[1], "attempts", 1) > tonumber(ARGV[1]) then
+	redis.call("DEL", KEYS[1])
+	return false
+end
+return redis.call("HMGET", KEYS[1], "user_id", "device")
+`)
+
+// ErrRoleNotFound 角色不存在
+var ErrRoleNotFound = errors.New("role does not exist")
+
+// ErrSessionNotFound 会话不存在或已失效
+var ErrSessionNotFound = errors.New("session does not exist")
+
+// ErrUserNotFound 用户不存在
+var ErrUserNotFound = errors.New("user does not exist")
+
+// ErrTwoFactorEnabled 两步验证已启用
+var ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+
+// ErrTwoFactorNotEnabled 两步验证未启用
+var ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+
+// ErrTwoFactorNotSetup 尚未生成两步验证密钥
+var ErrTwoFactorNotSetup = errors.New("two-factor authentication has not been set up")
+
+// ErrInvalidTwoFactorCode 验证码或恢复码错误, 或验证码已被使用
+var ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+// ErrChallengeExpired 登录挑战令牌不存在、已过期或尝试次数过多
+var ErrChallengeExpired = errors.New("two-factor challenge expired, please login again")
+
+// ErrOAuthProviderNotFound 第三方登录提供方不存在或未启用
+var ErrOAuthProviderNotFound = errors.New("oauth provider is not enabled")
+
+// ErrOAuthProviderFailed 与第三方登录提供方交互失败
+var ErrOAuthProviderFailed = errors.New("oauth provider request failed")
+
+// ErrOAuthStateInvalid 授权 state 不存在、已过期或已被使用
+var ErrOAuthStateInvalid = errors.New("oauth state is invalid or expired")
+
+// ErrOAuthLinkMismatch 绑定流程只能由发起绑定的用户在登录状态下完成
+var ErrOAuthLinkMismatch = errors.New("oauth link must be completed by the user who started it")
+
+// ErrOAuthEmailUnverified 第三方账号没有已验证的邮箱, 无法关联或创建用户
+var ErrOAuthEmailUnverified = errors.New("the third-party account has no verified email")
+
+// ErrIdentityLinked 第三方账号已绑定到其他用户
+var ErrIdentityLinked = errors.New("the third-party account is already linked to another user")
+
+// ErrProviderLinked 用户已绑定该提供方的另一个账号
+var ErrProviderLinked = errors.New("another account of this provider is already linked")
+
+// ErrIdentityNotFound 用户未绑定该提供方的账号
+var ErrIdentityNotFound = errors.New("no account of this provider is linked")
+
+// roleNameValidator 自定义角色名: 小写字母开头, 由小写字母、数字、下划线与短横线组成
+var roleNameValidator = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
 // SendEmailCode 发送邮箱服务
 func (s *Service) SendEmailCode(ctx *gin.Context, dto *user_dto.SendEmailCode) error {
 	do := &user_do.TableUserVerificationCodesDO{}
@@ -101,7 +193,7 @@ func (s *Service) Register(ctx *gin.Context, dto *user_dto.RegisterRequest) erro
 	// 角色DO
 	userDO := &user_do.TableUserDO{
 		UUID:         uuid.New().String(),
-		Avatar:       "/static/avatar/default.png",
+		Avatar:       defaultAvatar,
 		Nickname:     dto.NickName,
 		Email:        dto.Email,
 		PasswordHash: passwordHash,
@@ -131,8 +223,6 @@ func (s *Service) Register(ctx *gin.Context, dto *user_dto.RegisterRequest) erro
 
 // LoginWithNicknamePassword 用户名密码登录
 func (s *Service) LoginWithNicknamePassword(ctx *gin.Context, req *user_dto.LoginRequest, vo *user_vo.LoginVO) error {
-	rdbClient := rdb.Rdb
-	rCtx := rdb.Ctx
 	uuid, password, err := s.UserDao.GetPasswordByNickname(ctx, req.NickName)
 
 	if err != nil {
@@ -142,46 +232,18 @@ func (s *Service) LoginWithNicknamePassword(ctx *gin.Context, req *user_dto.Logi
 		return fmt.Errorf("user not exists")
 	}
 
-	_, err = rdbClient.Get(rCtx, uuid).Result()
-	if err == redis.Nil {
-		ok, errs := pkg.VerifyPassword(req.PassWord, password)
-		if errs != nil {
-			return fmt.Errorf("VerifyPassword error")
-		} else if !ok {
-			return fmt.Errorf("password error")
-		}
-
-		vo.JWTToken, errs = middleware.GenerateToken(uuid)
-		if errs != nil {
-			logger.Error(ctx, "Generate token error: %s", errs.Error())
-			return errs
-		}
-
-		_, errs = rdbClient.Set(rCtx, uuid, vo.JWTToken, 0).Result()
-		if errs != nil {
-			logger.Error(ctx, "Set token to redis error: %s", errs.Error())
-			return errs
-		}
-
-		errs = s.UserDao.UpdateLoginTime(ctx, uuid)
-		if errs != nil {
-			return errs
-		}
-
-		return nil
-	}
+	ok, err := pkg.VerifyPassword(req.PassWord, password)
 	if err != nil {
-		logger.Error(ctx, "redis get error.: %s", err.Error())
-		return err
+		return fmt.Errorf("VerifyPassword error")
+	} else if !ok {
+		return fmt.Errorf("password error")
 	}
-	return fmt.Errorf("this account is logged in")
+
+	return s.completeLogin(ctx, uuid, loginDevice(ctx, req), vo)
 }
 
 // LoginWithEmailPassword 邮箱密码登录
 func (s *Service) LoginWithEmailPassword(ctx *gin.Context, req *user_dto.LoginRequest, vo *user_vo.LoginVO) error {
-	rdbClient := rdb.Rdb
-	rCtx := rdb.Ctx
-
 	uuid, password, err := s.UserDao.GetPasswordByEmail(ctx, req.Email)
 	if err != nil {
 		return err
@@ -190,40 +252,14 @@ func (s *Service) LoginWithEmailPassword(ctx *gin.Context, req *user_dto.LoginRe
 		return fmt.Errorf("user not exists")
 	}
 
-	_, err = rdbClient.Get(rCtx, uuid).Result()
-	if err == redis.Nil {
-		ok, errs := pkg.VerifyPassword(req.PassWord, password)
-		if errs != nil {
-			return fmt.Errorf("VerifyPassword error")
-		} else if !ok {
-			return fmt.Errorf("password error")
-		}
-
-		vo.JWTToken, errs = middleware.GenerateToken(uuid)
-		if errs != nil {
-			logger.Error(ctx, "Generate token error: %s", errs.Error())
-			return errs
-		}
-
-		_, errs = rdbClient.Set(rCtx, uuid, vo.JWTToken, 0).Result()
-		if errs != nil {
-			logger.Error(ctx, "Set token to redis error: %s", errs.Error())
-			return errs
-		}
-
-		errs = s.UserDao.UpdateLoginTime(ctx, uuid)
-		if errs != nil {
-			return errs
-		}
-
-		return nil
-	}
-
+	ok, err := pkg.VerifyPassword(req.PassWord, password)
 	if err != nil {
-		logger.Error(ctx, "redis get error.: %s", err.Error())
-		return err
+		return fmt.Errorf("VerifyPassword error")
+	} else if !ok {
+		return fmt.Errorf("password error")
 	}
-	return fmt.Errorf("this account is logged in")
+
+	return s.completeLogin(ctx, uuid, loginDevice(ctx, req), vo)
 }
 
 // LoginWithEmailVerifyCode 邮箱验证码登录
@@ -249,28 +285,666 @@ func (s *Service) LoginWithEmailVerifyCode(ctx *gin.Context, req *user_dto.Login
 		return fmt.Errorf("user not exists")
 	}
 
-	vo.JWTToken, err = middleware.GenerateToken(uuid)
+	if err = s.completeLogin(ctx, uuid, loginDevice(ctx, req), vo); err != nil {
+		return err
+	}
+
+	if err = rdbClient.Del(rCtx, codePrefix+req.Email).Err(); err != nil {
+		logger.Error(ctx, "Remove code in redis error: %s", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// RefreshToken 使用刷新令牌换取新的访问令牌, 刷新令牌同时轮换
+func (s *Service) RefreshToken(ctx *gin.Context, refreshToken string, vo *user_vo.LoginVO) error {
+	grant, err := session.Refresh(refreshToken, ctx.ClientIP())
 	if err != nil {
-		logger.Error(ctx, "Generate token error: %s", err.Error())
+		if !errors.Is(err, session.ErrInvalidRefreshToken) {
+			logger.Error(ctx, "Refresh session error: %s", err.Error())
+		}
 		return err
 	}
 
-	_, err = rdbClient.Set(rCtx, uuid, vo.JWTToken, 0).Result()
+	return writeTokens(ctx, grant, vo)
+}
+
+// ListSessions 列出当前用户在各设备上的登录会话
+func (s *Service) ListSessions(ctx *gin.Context) ([]*user_vo.SessionVO, error) {
+	sessions, err := session.List(ctx.GetString(middleware.UserIDKey))
+	if err != nil {
+		logger.Error(ctx, "List sessions error: %s", err.Error())
+		return nil, err
+	}
+
+	current := ctx.GetString(middleware.SessionIDKey)
+	vos := make([]*user_vo.SessionVO, 0, len(sessions))
+	for _, item := range sessions {
+		vos = append(vos, &user_vo.SessionVO{
+			SessionID: item.ID,
+			Device:    item.Device,
+			IP:        item.IP,
+			CreatedAt: item.CreatedAt.Format(time.DateTime),
+			LastSeen:  item.LastSeen.Format(time.DateTime),
+			Current:   item.ID == current,
+		})
+	}
+	return vos, nil
+}
+
+// RevokeSession 注销当前用户的指定会话, 对应设备需要重新登录
+func (s *Service) RevokeSession(ctx *gin.Context, sessionID string) error {
+	found, err := session.Revoke(ctx.GetString(middleware.UserIDKey), sessionID)
 	if err != nil {
-		logger.Error(ctx, "Set token to redis error: %s", err.Error())
+		logger.Error(ctx, "Revoke session error: %s", err.Error())
 		return err
 	}
+	if !found {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAllSessions 注销当前用户的全部会话, keepCurrent 为 true 时保留当前设备, 返回注销的会话数
+func (s *Service) RevokeAllSessions(ctx *gin.Context, keepCurrent bool) (int, error) {
+	var except string
+	if keepCurrent {
+		except = ctx.GetString(middleware.SessionIDKey)
+	}
+
+	revoked, err := session.RevokeAll(ctx.GetString(middleware.UserIDKey), except)
+	if err != nil {
+		logger.Error(ctx, "Revoke all sessions error: %s", err.Error())
+		return 0, err
+	}
+	return revoked, nil
+}
 
-	err = s.UserDao.UpdateLoginTime(ctx, uuid)
+// completeLogin 第一步校验通过后调用, 开启两步验证的账号只下发挑战令牌, 否则直接创建会话
+func (s *Service) completeLogin(ctx *gin.Context, userID, device string, vo *user_vo.LoginVO) error {
+	totp, err := s.UserDao.GetTOTP(ctx, userID)
 	if err != nil {
 		return err
 	}
+	if totp == nil || !totp.Enabled {
+		return s.startSession(ctx, userID, device, vo)
+	}
 
-	if err = rdbClient.Del(rCtx, codePrefix+req.Email).Err(); err != nil {
-		logger.Error(ctx, "Remove code in redis error: %s", err.Error())
+	token := uuid.New().String()
+	key := twoFactorChallengePrefix + token
+
+	pipe := rdb.Rdb.TxPipeline()
+	pipe.HSet(rdb.Ctx, key, "user_id", userID, "device", device, "attempts", 0)
+	pipe.Expire(rdb.Ctx, key, twoFactorChallengeTTL)
+	if _, err = pipe.Exec(rdb.Ctx); err != nil {
+		logger.Error(ctx, "Create two-factor challenge error: %s", err.Error())
+		return err
+	}
+
+	vo.TwoFactorRequired = true
+	vo.ChallengeToken = token
+	return nil
+}
+
+// VerifyTwoFactorLogin 登录第二步, 校验挑战令牌与验证码或恢复码后创建会话
+func (s *Service) VerifyTwoFactorLogin(ctx *gin.Context, req *user_dto.TwoFactorLoginRequest, vo *user_vo.LoginVO) error {
+	key := twoFactorChallengePrefix + req.ChallengeToken
+
+	values, err := claimChallengeScript.Run(rdb.Ctx, rdb.Rdb, []string{key}, twoFactorMaxAttempts).StringSlice()
+	if errors.Is(err, redis.Nil) {
+		return ErrChallengeExpired
+	}
+	if err != nil {
+		logger.Error(ctx, "Claim two-factor challenge error: %s", err.Error())
+		return err
+	}
+	userID, device := values[0], values[1]
+
+	totp, err := s.UserDao.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	// 两步之间关闭了两步验证, 需要重新登录
+	if totp == nil || !totp.Enabled {
+		rdb.Rdb.Del(rdb.Ctx, key)
+		return ErrChallengeExpired
+	}
+
+	if err = s.verifySecondFactor(ctx, totp, req.Code, req.RecoveryCode); err != nil {
+		return err
+	}
+
+	// 挑战令牌只能使用一次, 并发请求中只有删除成功的一方可以登录
+	deleted, err := rdb.Rdb.Del(rdb.Ctx, key).Result()
+	if err != nil {
+		logger.Error(ctx, "Delete two-factor challenge error: %s", err.Error())
+		return err
+	}
+	if deleted == 0 {
+		return ErrChallengeExpired
+	}
+
+	return s.startSession(ctx, userID, device, vo)
+}
+
+// loginDevice 登录设备名, 未填写时使用 User-Agent
+func loginDevice(ctx *gin.Context, req *user_dto.LoginRequest) string {
+	if req.DeviceName != "" {
+		return req.DeviceName
+	}
+	return ctx.Request.UserAgent()
+}
+
+// startSession 为本次登录创建会话并写入令牌
+func (s *Service) startSession(ctx *gin.Context, uuid, device string, vo *user_vo.LoginVO) error {
+	grant, err := session.Issue(uuid, device, ctx.ClientIP())
+	if err != nil {
+		logger.Error(ctx, "Issue session error: %s", err.Error())
+		return err
+	}
+
+	if err = writeTokens(ctx, grant, vo); err != nil {
+		return err
+	}
+
+	return s.UserDao.UpdateLoginTime(ctx, uuid)
+}
+
+// writeTokens 为会话签发绑定会话 ID 的访问令牌, 与刷新令牌一起写入响应
+func writeTokens(ctx *gin.Context, grant *session.Grant, vo *user_vo.LoginVO) error {
+	accessTTL := session.AccessTTL()
+	accessToken, err := middleware.GenerateToken(grant.UserID, grant.SessionID, accessTTL)
+	if err != nil {
+		logger.Error(ctx, "Generate access token error: %s", err.Error())
+		return err
+	}
+
+	vo.JWTToken = accessToken
+	vo.RefreshToken = grant.RefreshToken
+	vo.ExpiresIn = int64(accessTTL.Seconds())
+	return nil
+}
+
+// GetTwoFactorStatus 查询当前用户的两步验证状态
+func (s *Service) GetTwoFactorStatus(ctx *gin.Context) (*user_vo.TwoFactorStatusVO, error) {
+	userID := ctx.GetString(middleware.UserIDKey)
+
+	totp, err := s.UserDao.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	vo := &user_vo.TwoFactorStatusVO{}
+	if totp == nil || !totp.Enabled {
+		return vo, nil
+	}
+
+	vo.Enabled = true
+	if totp.EnabledAt != nil {
+		vo.EnabledAt = *totp.EnabledAt
+	}
+	if vo.RecoveryCodesRemaining, err = s.UserDao.CountRecoveryCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	return vo, nil
+}
+
+// SetupTwoFactor 生成新的 TOTP 密钥, 需再调用 EnableTwoFactor 提交验证码后才会生效
+func (s *Service) SetupTwoFactor(ctx *gin.Context) (*user_vo.TwoFactorSetupVO, error) {
+	userID := ctx.GetString(middleware.UserIDKey)
+
+	totp, err := s.UserDao.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp != nil && totp.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	user, err := s.UserDao.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.UUID == "" {
+		return nil, ErrUserNotFound
+	}
+
+	secret, err := pkg.GenerateTOTPSecret()
+	if err != nil {
+		logger.Error(ctx, "Generate totp secret error: %s", err.Error())
+		return nil, err
+	}
+
+	secretEnc, err := pkg.Encrypt(secret, configs.GlobalConfig.Chat.EncryptionKey)
+	if err != nil {
+		logger.Error(ctx, "Encrypt totp secret error: %s", err.Error())
+		return nil, err
+	}
+
+	saved, err := s.UserDao.SaveTOTPSecret(ctx, userID, secretEnc)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	issuer := configs.GlobalConfig.Session.TOTPIssuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+
+	return &user_vo.TwoFactorSetupVO{
+		Secret:          secret,
+		ProvisioningURI: pkg.TOTPProvisioningURI(issuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor 校验验证器 App 生成的验证码后启用两步验证, 返回只展示一次的恢复码
+func (s *Service) EnableTwoFactor(ctx *gin.Context, code string) ([]string, error) {
+	userID := ctx.GetString(middleware.UserIDKey)
+
+	totp, err := s.UserDao.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil {
+		return nil, ErrTwoFactorNotSetup
+	}
+	if totp.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := pkg.Decrypt(totp.SecretEnc, configs.GlobalConfig.Chat.EncryptionKey)
+	if err != nil {
+		logger.Error(ctx, "Decrypt totp secret error: %s", err.Error())
+		return nil, err
+	}
+
+	step, ok := pkg.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		logger.Error(ctx, "Generate recovery codes error: %s", err.Error())
+		return nil, err
+	}
+
+	enabled, err := s.UserDao.EnableTOTP(ctx, userID, step, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor 校验验证码或恢复码后关闭两步验证
+func (s *Service) DisableTwoFactor(ctx *gin.Context, req *user_dto.TwoFactorCodeRequest) error {
+	userID := ctx.GetString(middleware.UserIDKey)
+
+	totp, err := s.UserDao.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if totp == nil || !totp.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err = s.verifySecondFactor(ctx, totp, req.Code, req.RecoveryCode); err != nil {
+		return err
+	}
+	return s.UserDao.DisableTOTP(ctx, userID)
+}
+
+// RegenerateRecoveryCodes 校验验证码后重新生成恢复码, 旧恢复码全部作废
+func (s *Service) RegenerateRecoveryCodes(ctx *gin.Context, code string) ([]string, error) {
+	userID := ctx.GetString(middleware.UserIDKey)
+
+	totp, err := s.UserDao.GetTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp == nil || !totp.Enabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	// 恢复码丢失或泄露时才需要重新生成, 只接受验证器 App 的验证码
+	if err = s.verifySecondFactor(ctx, totp, code, ""); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		logger.Error(ctx, "Generate recovery codes error: %s", err.Error())
+		return nil, err
+	}
+
+	if err = s.UserDao.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor 校验 TOTP 验证码或恢复码, 两者都会被标记为已使用, 不能重放
+func (s *Service) verifySecondFactor(ctx *gin.Context, totp *user_do.TableUserTOTPDO, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		return consumeRecoveryCode(ctx, s.UserDao, totp.UserUUID, recoveryCode)
+	}
+
+	secret, err := pkg.Decrypt(totp.SecretEnc, configs.GlobalConfig.Chat.EncryptionKey)
+	if err != nil {
+		logger.Error(ctx, "Decrypt totp secret error: %s", err.Error())
+		return err
+	}
+
+	step, ok := pkg.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	consumed, err := s.UserDao.ConsumeTOTPStep(ctx, totp.UserUUID, step)
+	if err != nil {
 		return err
 	}
+	if !consumed {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// recoveryCodeConsumer 按摘要把恢复码标记为已使用, 由 user_dao.DAO 实现
+type recoveryCodeConsumer interface {
+	ConsumeRecoveryCode(ctx *gin.Context, uuid, codeHash string) (bool, error)
+}
+
+// consumeRecoveryCode 消耗用户输入的恢复码, 恢复码不存在或已使用时返回 ErrInvalidTwoFactorCode
+func consumeRecoveryCode(ctx *gin.Context, codes recoveryCodeConsumer, userUUID, recoveryCode string) error {
+	consumed, err := codes.ConsumeRecoveryCode(ctx, userUUID, hashRecoveryCode(recoveryCode))
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// newRecoveryCodes 生成恢复码及其摘要, 数据库只保存摘要
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := pkg.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode 恢复码为 96 位随机数, 使用 SHA-256 摘要即可抵御离线穷举
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(pkg.NormalizeRecoveryCode(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListOAuthProviders 返回已启用的第三方登录提供方名称
+func (s *Service) ListOAuthProviders() []string {
+	return slices.Sorted(maps.Keys(s.OAuthProviders))
+}
+
+// OAuthAuthorize 发起第三方授权, 返回授权地址与 state; linkUserID 不为空时回调后绑定到该用户而不是登录
+// 登录流程的 binding 由控制器写入发起方浏览器的 HttpOnly Cookie, 回调时必须携带相同的值
+func (s *Service) OAuthAuthorize(ctx *gin.Context, providerName, device, linkUserID, binding string) (string, string, error) {
+	provider, ok := s.OAuthProviders[providerName]
+	if !ok {
+		return "", "", ErrOAuthProviderNotFound
+	}
+
+	state, err := oauth.RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oauth.RandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oauth.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		logger.Error(ctx, "Build %s authorize url error: %s", providerName, err.Error())
+		return "", "", fmt.Errorf("%w: %v", ErrOAuthProviderFailed, err)
+	}
+
+	ttl := configs.GlobalConfig.OAuth.StateTTL
+	if ttl <= 0 {
+		ttl = defaultOAuthStateTTL
+	}
+
+	// PKCE verifier 与 nonce 只保存在服务端, 回调时凭 state 取回
+	key := oauthStatePrefix + state
+	pipe := rdb.Rdb.TxPipeline()
+	pipe.HSet(rdb.Ctx, key, map[string]any{
+		"provider":     providerName,
+		"verifier":     verifier,
+		"nonce":        nonce,
+		"device":       device,
+		"link_user_id": linkUserID,
+		"binding":      hashOAuthBinding(binding),
+	})
+	pipe.Expire(rdb.Ctx, key, ttl)
+	if _, err = pipe.Exec(rdb.Ctx); err != nil {
+		logger.Error(ctx, "Save oauth state error: %s", err.Error())
+		return "", "", err
+	}
+
+	return authURL, state, nil
+}
+
+// OAuthCallback 完成第三方授权, 登录时写入令牌或两步验证挑战; 绑定流程返回 linked 为 true, 不下发令牌
+// 登录流程校验 binding 与发起时一致; 绑定流程只能在登录状态下由发起绑定的用户完成, 防止把攻击者的第三方账号绑定到受害者
+func (s *Service) OAuthCallback(ctx *gin.Context, req *user_dto.OAuthCallbackRequest, binding string, vo *user_vo.LoginVO) (bool, error) {
+	// state 只能使用一次, 读取与删除放在同一事务中
+	key := oauthStatePrefix + req.State
+	pipe := rdb.Rdb.TxPipeline()
+	stateCmd := pipe.HGetAll(rdb.Ctx, key)
+	pipe.Del(rdb.Ctx, key)
+	if _, err := pipe.Exec(rdb.Ctx); err != nil {
+		logger.Error(ctx, "Load oauth state error: %s", err.Error())
+		return false, err
+	}
+
+	values := stateCmd.Val()
+	providerName := values["provider"]
+	if providerName == "" {
+		return false, ErrOAuthStateInvalid
+	}
+
+	linkUserID := values["link_user_id"]
+	if linkUserID != ctx.GetString(middleware.UserIDKey) {
+		return false, ErrOAuthLinkMismatch
+	}
+	if linkUserID == "" && (binding == "" || subtle.ConstantTimeCompare([]byte(hashOAuthBinding(binding)), []byte(values["binding"])) != 1) {
+		return false, ErrOAuthStateInvalid
+	}
+
+	provider, ok := s.OAuthProviders[providerName]
+	if !ok {
+		return false, ErrOAuthProviderNotFound
+	}
+
+	identity, err := provider.Authenticate(ctx.Request.Context(), req.Code, values["verifier"], values["nonce"])
+	if err != nil {
+		logger.Error(ctx, "Authenticate with %s error: %s", providerName, err.Error())
+		return false, fmt.Errorf("%w: %v", ErrOAuthProviderFailed, err)
+	}
+
+	if linkUserID != "" {
+		return true, s.linkIdentity(ctx, linkUserID, providerName, identity)
+	}
+
+	userID, err := s.resolveOAuthUser(ctx, providerName, identity)
+	if err != nil {
+		return false, err
+	}
+	return false, s.completeLogin(ctx, userID, values["device"], vo)
+}
 
+// hashOAuthBinding Redis 中只保存 binding 的摘要, 绑定流程不使用 binding 时为空
+func hashOAuthBinding(binding string) string {
+	if binding == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(binding))
+	return hex.EncodeToString(sum[:])
+}
+
+// ListIdentities 查询当前用户绑定的第三方账号
+func (s *Service) ListIdentities(ctx *gin.Context) ([]*user_vo.IdentityVO, error) {
+	identities, err := s.UserDao.ListIdentities(ctx, ctx.GetString(middleware.UserIDKey))
+	if err != nil {
+		return nil, err
+	}
+
+	vos := make([]*user_vo.IdentityVO, 0, len(identities))
+	for _, identity := range identities {
+		vo := &user_vo.IdentityVO{
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: identity.CreatedAt,
+		}
+		if identity.LastLoginAt != nil {
+			vo.LastLoginAt = *identity.LastLoginAt
+		}
+		vos = append(vos, vo)
+	}
+	return vos, nil
+}
+
+// UnlinkIdentity 解绑当前用户在指定提供方的账号, 解绑后仍可使用邮箱登录或重置密码
+func (s *Service) UnlinkIdentity(ctx *gin.Context, providerName string) error {
+	deleted, err := s.UserDao.DeleteIdentity(ctx, ctx.GetString(middleware.UserIDKey), providerName)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
+
+// resolveOAuthUser 查找第三方账号对应的用户: 已绑定直接登录, 否则按已验证邮箱关联已有用户, 邮箱未注册时自动创建用户
+func (s *Service) resolveOAuthUser(ctx *gin.Context, providerName string, identity *oauth.Identity) (string, error) {
+	userID, err := s.UserDao.GetUserIDByIdentity(ctx, providerName, identity.Subject)
+	if err != nil {
+		return "", err
+	}
+	if userID != "" {
+		// 只用于展示, 更新失败不影响登录
+		_ = s.UserDao.TouchIdentity(ctx, providerName, identity.Subject, identity.Email)
+		return userID, nil
+	}
+
+	// 未验证的邮箱可能属于他人, 不能用于关联或注册
+	if identity.Email == "" || !identity.EmailVerified {
+		return "", ErrOAuthEmailUnverified
+	}
+
+	identityDO := &user_do.TableUserIdentityDO{
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	userID, err = s.UserDao.GetUserIDByEmail(ctx, identity.Email)
+	if err != nil {
+		return "", err
+	}
+	if userID != "" {
+		if err = s.ensureProviderUnlinked(ctx, userID, providerName); err != nil {
+			return "", err
+		}
+		identityDO.UserUUID = userID
+		return userID, s.UserDao.CreateIdentity(ctx, identityDO)
+	}
+
+	// 自动注册的用户没有可用密码, 需要时通过重置密码流程设置
+	randomPassword, err := oauth.RandomToken()
+	if err != nil {
+		return "", err
+	}
+	passwordHash, err := pkg.HashPassword(randomPassword)
+	if err != nil {
+		logger.Error(ctx, "Hash password error: %s", err.Error())
+		return "", err
+	}
+
+	userDO := &user_do.TableUserDO{
+		UUID:         uuid.New().String(),
+		Avatar:       defaultAvatar,
+		Nickname:     oauthNicknamePrefix + strings.ReplaceAll(uuid.New().String(), "-", "")[:8],
+		Email:        identity.Email,
+		PasswordHash: passwordHash,
+	}
+	if err = s.UserDao.CreateUserWithIdentity(ctx, userDO, identityDO); err != nil {
+		return "", err
+	}
+
+	if delErr := rdb.Rdb.Del(rdb.Ctx, allinfoKey).Err(); delErr != nil {
+		logger.Error(ctx, "Delete all users cache error: %s", delErr.Error())
+	}
+	delUserInfoByPage(ctx)
+
+	return userDO.UUID, nil
+}
+
+// linkIdentity 将第三方账号绑定到已登录用户, 重复绑定同一账号视为成功
+func (s *Service) linkIdentity(ctx *gin.Context, userID, providerName string, identity *oauth.Identity) error {
+	owner, err := s.UserDao.GetUserIDByIdentity(ctx, providerName, identity.Subject)
+	if err != nil {
+		return err
+	}
+	if owner == userID {
+		return s.UserDao.TouchIdentity(ctx, providerName, identity.Subject, identity.Email)
+	}
+	if owner != "" {
+		return ErrIdentityLinked
+	}
+
+	if err = s.ensureProviderUnlinked(ctx, userID, providerName); err != nil {
+		return err
+	}
+
+	return s.UserDao.CreateIdentity(ctx, &user_do.TableUserIdentityDO{
+		UserUUID: userID,
+		Provider: providerName,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	})
+}
+
+// ensureProviderUnlinked 每个提供方只能绑定一个账号, 已绑定时返回 ErrProviderLinked
+func (s *Service) ensureProviderUnlinked(ctx *gin.Context, userID, providerName string) error {
+	identities, err := s.UserDao.ListIdentities(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if slices.ContainsFunc(identities, func(identity *user_do.TableUserIdentityDO) bool {
+		return identity.Provider == providerName
+	}) {
+		return ErrProviderLinked
+	}
 	return nil
 }
 
@@ -303,6 +977,7 @@ func (s *Service) GetUserInfo(ctx *gin.Context, userid string) (*user_vo.InfoVO,
 	uvo.Nickname = userDO.Nickname
 	uvo.Email = userDO.Email
 	uvo.Avatar = userDO.Avatar
+	uvo.Role = userDO.Role
 
 	jsonStr, err := json.Marshal(uvo)
 	if err != nil {
@@ -354,6 +1029,7 @@ func (s *Service) GetAllUsers(ctx *gin.Context, users *user_vo.ListUserInfoVO) e
 			Nickname:  userDo.Nickname,
 			Avatar:    userDo.Avatar,
 			Email:     userDo.Email,
+			Role:      userDo.Role,
 			LastLogin: userDo.LastLogin,
 			CreatedAt: userDo.CreatedAt,
 			UpdatedAt: userDo.UpdatedAt,
@@ -415,6 +1091,7 @@ func (s *Service) GetAllUsersByPage(ctx *gin.Context, users *user_vo.ListUserInf
 			Nickname:  userDo.Nickname,
 			Avatar:    userDo.Avatar,
 			Email:     userDo.Email,
+			Role:      userDo.Role,
 			LastLogin: userDo.LastLogin,
 			CreatedAt: userDo.CreatedAt,
 			UpdatedAt: userDo.UpdatedAt,
@@ -441,7 +1118,7 @@ func (s *Service) UpdateUserInfo(ctx *gin.Context, req *user_dto.UpdateInfoReque
 
 	var nickName string
 	var path string
-	var dst string
+	var key string
 
 	if req.NickName != "" {
 		nickName = req.NickName
@@ -482,8 +1159,9 @@ func (s *Service) UpdateUserInfo(ctx *gin.Context, req *user_dto.UpdateInfoReque
 			return fmt.Errorf("unsupported file format: %s, only png, jpg, jpeg, webp are allowed", ext)
 		}
 
+		// 先在临时目录完成格式转换, 再写入存储
 		filname := "avatar-" + userid + ext
-		dst = filepath.Join("static", "avatar", filname)
+		dst := filepath.Join(os.TempDir(), filname)
 
 		err = ctx.SaveUploadedFile(req.Avatar, dst)
 		if err != nil {
@@ -501,15 +1179,25 @@ func (s *Service) UpdateUserInfo(ctx *gin.Context, req *user_dto.UpdateInfoReque
 			}
 		}
 		finalFileName := "avatar-" + userid + ".webp"
-		path = filepath.Join("/static/avatar", finalFileName)
-		dst = filepath.Join("static", "avatar", finalFileName)
+		dst = filepath.Join(os.TempDir(), finalFileName)
+		key = "avatar/" + finalFileName
+
+		err = storage.PutFile(ctx, key, dst)
+		if removeErr := os.Remove(dst); removeErr != nil {
+			logger.Error(ctx, "Remove temp avatar file error: %s", removeErr.Error())
+		}
+		if err != nil {
+			logger.Error(ctx, "Save avatar to storage error: %s", err.Error())
+			return err
+		}
+		path = storage.Default.URL(key)
 	}
 
 	err := s.UserDao.UpdateUserInfo(ctx, userid, nickName, path)
 	if err != nil {
-		if dst != "" {
-			if errs := os.Remove(dst); errs != nil {
-				logger.Error(ctx, "Remove file error: %s", errs.Error())
+		if key != "" {
+			if errs := storage.Default.Delete(ctx, key); errs != nil {
+				logger.Error(ctx, "Remove avatar error: %s", errs.Error())
 			}
 		}
 		return err
@@ -545,8 +1233,8 @@ func (s *Service) DestroyUser(ctx *gin.Context) error {
 		return err
 	}
 
-	if rdberr := rdbClient.Del(rCtx, uuid).Err(); rdberr != nil {
-		logger.Error(ctx, "Remove user form redis error: %s", rdberr.Error())
+	if _, rdberr := session.RevokeAll(uuid, ""); rdberr != nil {
+		logger.Error(ctx, "Revoke sessions of destroyed user error: %s", rdberr.Error())
 	}
 
 	if rdberr := rdbClient.Del(rCtx, infoPrefix+uuid).Err(); rdberr != nil {
@@ -559,9 +1247,11 @@ func (s *Service) DestroyUser(ctx *gin.Context) error {
 
 	delUserInfoByPage(ctx)
 
-	dst := strings.TrimPrefix(path, "/")
-	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
-		logger.Warn(ctx, "Remove avatar file error (non-critical): %s", err.Error())
+	// 默认头像为共享文件, 不能删除
+	if key := storage.KeyFromURL(path); key != "" && path != defaultAvatar {
+		if err := storage.Default.Delete(ctx, key); err != nil {
+			logger.Warn(ctx, "Remove avatar file error (non-critical): %s", err.Error())
+		}
 	}
 
 	return nil
@@ -581,16 +1271,6 @@ func (s *Service) ResetUserPassword(ctx *gin.Context, req *user_dto.UpdatePasswo
 		return fmt.Errorf("user not exist")
 	}
 
-	exists, err := rdbClient.Exists(rCtx, uuid).Result()
-	if err != nil {
-		logger.Error(ctx, "check user exist error: %s", err.Error())
-		return err
-	}
-
-	if exists != 0 {
-		return fmt.Errorf("user is logged in so editing is prohibited")
-	}
-
 	code, err := rdbClient.Get(rCtx, codePrefix+req.Email).Result()
 	if err != nil {
 		logger.Error(ctx, "get code from redis error: %s", err.Error())
@@ -614,6 +1294,12 @@ func (s *Service) ResetUserPassword(ctx *gin.Context, req *user_dto.UpdatePasswo
 		return err
 	}
 
+	// 重置密码后所有设备都需要用新密码重新登录
+	if _, err = session.RevokeAll(uuid, ""); err != nil {
+		logger.Error(ctx, "Revoke sessions after password reset error: %s", err.Error())
+		return err
+	}
+
 	_, err = rdbClient.Del(rCtx, codePrefix+req.Email).Result()
 	if err != nil {
 		logger.Error(ctx, "Delete verify code error: %s", err.Error())
@@ -640,3 +1326,179 @@ func delUserInfoByPage(ctx *gin.Context) {
 		logger.Error(ctx, "Scan error: %v", err)
 	}
 }
+
+// ListRoles 查询全部角色及其权限
+func (s *Service) ListRoles(ctx *gin.Context) ([]*user_vo.RoleVO, error) {
+	roles, err := s.UserDao.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	vos := make([]*user_vo.RoleVO, 0, len(roles))
+	for _, role := range roles {
+		vo, err := toRoleVO(role)
+		if err != nil {
+			logger.Error(ctx, "Unmarshal permissions of role %s error: %s", role.Name, err.Error())
+			return nil, err
+		}
+		vos = append(vos, vo)
+	}
+	return vos, nil
+}
+
+// CreateRole 创建自定义角色
+func (s *Service) CreateRole(ctx *gin.Context, req *user_dto.RoleCreateRequest) error {
+	if !roleNameValidator.MatchString(req.Name) {
+		return fmt.Errorf("name must be 2-32 characters of lowercase letters, digits, '_' or '-', starting with a letter")
+	}
+
+	existing, err := s.UserDao.GetRole(ctx, req.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("role '%s' already exists", req.Name)
+	}
+
+	permissions, err := marshalPermissions(req.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return s.UserDao.CreateRole(ctx, &user_do.TableRoleDO{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: permissions,
+	})
+}
+
+// UpdateRole 更新自定义角色的描述与权限, 内置角色不可修改
+func (s *Service) UpdateRole(ctx *gin.Context, req *user_dto.RoleUpdateRequest) error {
+	role, err := s.getCustomRole(ctx, req.Name)
+	if err != nil {
+		return err
+	}
+
+	if req.Description != nil {
+		role.Description = *req.Description
+	}
+	if req.Permissions != nil {
+		if role.Permissions, err = marshalPermissions(*req.Permissions); err != nil {
+			return err
+		}
+	}
+
+	return s.UserDao.UpdateRole(ctx, role)
+}
+
+// DeleteRole 删除自定义角色, 持有该角色的用户降为普通用户
+func (s *Service) DeleteRole(ctx *gin.Context, name string) error {
+	if _, err := s.getCustomRole(ctx, name); err != nil {
+		return err
+	}
+
+	uuids, err := s.UserDao.ListUserUUIDsByRole(name)
+	if err != nil {
+		return err
+	}
+
+	if err = s.UserDao.DeleteRole(ctx, name, middleware.RoleUser); err != nil {
+		return err
+	}
+
+	delUserInfoCache(ctx, uuids...)
+	return nil
+}
+
+// AssignRole 为用户分配角色, 不能修改自己的角色, 避免管理员误操作后无人可以管理
+func (s *Service) AssignRole(ctx *gin.Context, req *user_dto.AssignRoleRequest) error {
+	if req.UUID == ctx.GetString(middleware.UserIDKey) {
+		return fmt.Errorf("cannot change your own role")
+	}
+
+	role, err := s.UserDao.GetRole(ctx, req.Role)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return fmt.Errorf("%w: '%s'", ErrRoleNotFound, req.Role)
+	}
+
+	found, err := s.UserDao.AssignRole(ctx, req.UUID, req.Role)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("%w: '%s'", ErrUserNotFound, req.UUID)
+	}
+
+	delUserInfoCache(ctx, req.UUID)
+	return nil
+}
+
+// getCustomRole 查询可修改的自定义角色
+func (s *Service) getCustomRole(ctx *gin.Context, name string) (*user_do.TableRoleDO, error) {
+	role, err := s.UserDao.GetRole(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrRoleNotFound, name)
+	}
+	if role.IsBuiltin {
+		return nil, fmt.Errorf("built-in role '%s' cannot be modified", name)
+	}
+	return role, nil
+}
+
+// marshalPermissions 校验权限并去重后序列化为 JSON 数组
+func marshalPermissions(permissions []string) (string, error) {
+	granted := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if !slices.Contains(middleware.Permissions(), permission) {
+			return "", fmt.Errorf("unknown permission '%s', supported permissions: %v", permission, middleware.Permissions())
+		}
+		if !slices.Contains(granted, permission) {
+			granted = append(granted, permission)
+		}
+	}
+
+	data, err := json.Marshal(granted)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// toRoleVO 解析角色的权限列表
+func toRoleVO(role *user_do.TableRoleDO) (*user_vo.RoleVO, error) {
+	permissions := make([]string, 0)
+	if role.Permissions != "" {
+		if err := json.Unmarshal([]byte(role.Permissions), &permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	return &user_vo.RoleVO{
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: permissions,
+		IsBuiltin:   role.IsBuiltin,
+		CreatedAt:   role.CreatedAt,
+		UpdatedAt:   role.UpdatedAt,
+	}, nil
+}
+
+// delUserInfoCache 角色变更后删除用户信息缓存
+func delUserInfoCache(ctx *gin.Context, userids ...string) {
+	for _, userid := range userids {
+		if err := rdb.Rdb.Del(rdb.Ctx, infoPrefix+userid).Err(); err != nil {
+			logger.Error(ctx, "Delete redis cache error: %s", err.Error())
+		}
+	}
+	if err := rdb.Rdb.Del(rdb.Ctx, allinfoKey).Err(); err != nil {
+		logger.Error(ctx, "Delete all users cache error: %s", err.Error())
+	}
+
+	delUserInfoByPage(ctx)
+}
@@ -0,0 +1,108 @@
+package user
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRecoveryCodeStore 按 user_recovery_codes 的语义保存摘要, 与 ConsumeRecoveryCode 一样只更新 used_at 为空的行
+type fakeRecoveryCodeStore struct {
+	used map[string]map[string]bool // user_uuid -> code_hash -> 是否已使用
+	err  error
+}
+
+func (f *fakeRecoveryCodeStore) ConsumeRecoveryCode(_ *gin.Context, uuid, codeHash string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	used, ok := f.used[uuid][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	f.used[uuid][codeHash] = true
+	return true, nil
+}
+
+func TestConsumeRecoveryCode(t *testing.T) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+
+	store := &fakeRecoveryCodeStore{used: map[string]map[string]bool{"user-1": {}, "user-2": {}}}
+	for _, hash := range hashes {
+		store.used["user-1"][hash] = false
+	}
+	if len(store.used["user-1"]) != recoveryCodeCount {
+		t.Fatalf("got %d distinct hashes, want %d", len(store.used["user-1"]), recoveryCodeCount)
+	}
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	// 按顺序执行, 后面的用例依赖前面消耗掉的恢复码
+	steps := []struct {
+		name    string
+		user    string
+		code    string
+		wantErr error
+	}{
+		{"unknown code", "user-1", "aaaaa-bbbbb-ccccc-ddddd", ErrInvalidTwoFactorCode},
+		{"other user's code", "user-2", codes[0], ErrInvalidTwoFactorCode},
+		{"uppercase without dashes", "user-1", strings.ToUpper(strings.ReplaceAll(codes[0], "-", "")), nil},
+		{"reused as issued", "user-1", codes[0], ErrInvalidTwoFactorCode},
+		{"spaces instead of dashes", "user-1", " " + strings.ReplaceAll(codes[1], "-", " ") + " ", nil},
+		{"reused in uppercase", "user-1", strings.ToUpper(codes[1]), ErrInvalidTwoFactorCode},
+		{"untouched code", "user-1", codes[2], nil},
+		{"empty", "user-1", "", ErrInvalidTwoFactorCode},
+	}
+
+	for _, step := range steps {
+		err := consumeRecoveryCode(ctx, store, step.user, step.code)
+		if !errors.Is(err, step.wantErr) {
+			t.Errorf("%s: consumeRecoveryCode(%q) = %v, want %v", step.name, step.code, err, step.wantErr)
+		}
+	}
+
+	remaining := 0
+	for _, used := range store.used["user-1"] {
+		if !used {
+			remaining++
+		}
+	}
+	if remaining != recoveryCodeCount-3 {
+		t.Errorf("%d codes left unused, want %d", remaining, recoveryCodeCount-3)
+	}
+}
+
+func TestConsumeRecoveryCodeStoreError(t *testing.T) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	storeErr := errors.New("connection refused")
+
+	err := consumeRecoveryCode(ctx, &fakeRecoveryCodeStore{err: storeErr}, "user-1", "aaaaa-bbbbb-ccccc-ddddd")
+	if !errors.Is(err, storeErr) {
+		t.Fatalf("err = %v, want the store error", err)
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := hashRecoveryCode("abcde-fghij-klmno-pqrst")
+	if len(want) != 64 || strings.Contains(want, "abcde") {
+		t.Fatalf("hash %q is not a sha256 hex digest", want)
+	}
+
+	for _, input := range []string{"ABCDE-FGHIJ-KLMNO-PQRST", "abcdefghijklmnopqrst", " abcde fghij klmno pqrst "} {
+		if got := hashRecoveryCode(input); got != want {
+			t.Errorf("hashRecoveryCode(%q) differs from the issued form", input)
+		}
+	}
+	if hashRecoveryCode("abcde-fghij-klmno-pqrss") == want {
+		t.Error("different codes share a hash")
+	}
+}